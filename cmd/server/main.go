@@ -1,21 +1,64 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/json"
-	"log"
+	"flag"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"dhi-oss-usage/internal/api"
+	"dhi-oss-usage/internal/assets"
+	"dhi-oss-usage/internal/config"
 	"dhi-oss-usage/internal/db"
 	"dhi-oss-usage/internal/github"
+	"dhi-oss-usage/internal/gitlab"
+	"dhi-oss-usage/internal/logging"
+	"dhi-oss-usage/internal/publish"
+	"dhi-oss-usage/internal/summarize"
 
 	"github.com/robfig/cron/v3"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "check-config" {
+		os.Exit(runCheckConfig(os.Args[2:]))
+	}
+
+	// Settings from CONFIG_FILE fill in environment variables that aren't set
+	var configFile *config.File
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		var err error
+		if configFile, err = config.Load(path); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid configuration file:\n%v\n", err)
+			os.Exit(1)
+		}
+	}
+	var overridden []string
+	if configFile != nil {
+		overridden = configFile.Apply()
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "healthcheck" {
+		os.Exit(runHealthcheck(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		os.Exit(runImport(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && remoteCommands[os.Args[1]] != nil {
+		os.Exit(remoteCommands[os.Args[1]](os.Args[2:]))
+	}
+
 	// Get port from env or default to 8000
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -28,53 +71,349 @@ func main() {
 		dbPath = "dhi-oss-usage.db"
 	}
 
-	// Get GitHub token
-	ghToken := os.Getenv("GITHUB_TOKEN")
-	if ghToken == "" {
-		log.Println("WARNING: GITHUB_TOKEN not set, refresh will not work")
-	}
-
 	// Get refresh schedule (cron syntax, empty = disabled)
 	refreshSchedule := os.Getenv("REFRESH_SCHEDULE")
 	if refreshSchedule == "" {
 		refreshSchedule = "0 3 * * *" // Default: 3 AM daily
 	}
-	if strings.ToLower(refreshSchedule) == "disabled" {
-		refreshSchedule = ""
+	refreshSchedule = normalizeSchedule(refreshSchedule)
+
+	// Log format and level, and optional file logging with rotation
+	var logLevel slog.Level
+	if err := logLevel.UnmarshalText([]byte(envString("LOG_LEVEL", "info"))); err != nil {
+		logging.Server.Fatalf("Invalid LOG_LEVEL '%s' (want debug, info, warn or error)", os.Getenv("LOG_LEVEL"))
+	}
+	logCfg := logging.Config{
+		Format: envString("LOG_FORMAT", "text"),
+		Level:  logLevel,
+
+		Dir:        os.Getenv("LOG_DIR"),
+		MaxSizeMB:  envInt("LOG_MAX_SIZE_MB", 10),
+		Daily:      os.Getenv("LOG_ROTATE_DAILY") == "true",
+		MaxBackups: envInt("LOG_MAX_BACKUPS", 5),
+
+		AccessStderr:     os.Getenv("ACCESS_LOG") == "stderr",
+		AccessSampleRate: envFloat("ACCESS_LOG_SAMPLE_RATE", 1),
+	}
+	if err := logging.Setup(logCfg); err != nil {
+		logging.Server.Fatalf("Failed to setup logging: %v", err)
+	}
+	if logCfg.Dir != "" {
+		logging.Server.Infof("File logging enabled in %s", logCfg.Dir)
+	}
+	if configFile != nil {
+		logging.Server.Infof("Loaded %d settings from %s", configFile.Len(), configFile.Path)
+		if len(overridden) > 0 {
+			logging.Server.Infof("Environment overrides %s from the configuration file", strings.Join(overridden, ", "))
+		}
+	}
+
+	// Get GitHub token (not needed when authenticating as a GitHub App)
+	ghToken := os.Getenv("GITHUB_TOKEN")
+	if ghToken == "" && os.Getenv("GITHUB_TOKENS") == "" && os.Getenv("GITHUB_APP_ID") == "" {
+		logging.Server.Warnf("GITHUB_TOKEN not set, refresh will not work")
+	}
+
+	// X-Forwarded-For and X-Forwarded-Prefix are only believed from these proxies
+	if err := logging.SetTrustedProxies(strings.Split(os.Getenv("TRUSTED_PROXIES"), ",")); err != nil {
+		logging.Server.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
 	}
 
 	// Open database
 	database, err := db.Open(dbPath)
 	if err != nil {
-		log.Fatalf("Failed to open database: %v", err)
+		logging.Server.Fatalf("Failed to open database: %v", err)
 	}
 	defer database.Close()
 
 	// Run migrations
 	if err := database.Migrate(); err != nil {
-		log.Fatalf("Failed to run migrations: %v", err)
+		logging.Server.Fatalf("Failed to run migrations: %v", err)
+	}
+	logging.Server.Infof("Database initialized")
+
+	// Optional read-only connection for public GET endpoints
+	var readDB *db.DB
+	if readPath := os.Getenv("DB_READ_PATH"); readPath != "" {
+		readDB, err = db.OpenReadOnly(readPath, os.Getenv("DB_READ_IMMUTABLE") == "true")
+		if err != nil {
+			logging.Server.Fatalf("Failed to open read database: %v", err)
+		}
+		defer readDB.Close()
+		logging.Server.Infof("Serving reads from %s", readPath)
 	}
-	log.Println("Database initialized")
 
 	// Create GitHub client
 	ghClient := github.NewClient(ghToken)
+	ghClient.SetConcurrency(envInt("GITHUB_CONCURRENCY", 4))
+	ghClient.SetGraphQL(os.Getenv("GITHUB_GRAPHQL") != "false")
+	ghClient.SetResponseCache(database)
+	if topics := os.Getenv("GITHUB_DISCOVERY_TOPICS"); topics != "" {
+		// Repos with these topics are checked for DHI even if code search misses them
+		ghClient.SetDiscoveryTopics(strings.Split(topics, ","))
+		logging.Server.Infof("Topic discovery enabled for: %s", topics)
+	}
+	if tokens := os.Getenv("GITHUB_TOKENS"); tokens != "" {
+		// Several tokens are rotated by remaining quota; GITHUB_TOKEN is included
+		// if set, and a token listed twice is only used once
+		ghClient.SetTokens(append([]string{ghToken}, strings.Split(tokens, ",")...))
+		logging.Server.Infof("Rotating between %d GitHub tokens", len(ghClient.TokenStatuses()))
+	}
+	if appID := os.Getenv("GITHUB_APP_ID"); appID != "" {
+		appAuth, err := loadGitHubApp(appID)
+		if err != nil {
+			logging.Server.Fatalf("Invalid GitHub App config: %v", err)
+		}
+		ghClient.SetAppAuth(appAuth)
+		logging.Server.Infof("Authenticating to GitHub as App %s", appID)
+	}
 
 	// Create API
 	apiHandler := api.New(database, ghClient)
+	if readDB != nil {
+		apiHandler.SetReadStore(readDB)
+	}
+
+	// GitLab scanning runs alongside GitHub when a token is set
+	if glToken := os.Getenv("GITLAB_TOKEN"); glToken != "" {
+		glClient, err := gitlab.NewClient(glToken, os.Getenv("GITLAB_URL"))
+		if err != nil {
+			logging.Server.Fatalf("Invalid GitLab config: %v", err)
+		}
+		apiHandler.SetGitLabClient(glClient)
+		logging.Server.Infof("GitLab scanning enabled (%s)", glClient.Host())
+	}
+
+	// Projects missing from this many consecutive refreshes are marked removed
+	apiHandler.SetChurnThreshold(envInt("CHURN_MISSED_REFRESHES", 3))
+	// Forks are counted unless excluded here or per request with ?exclude_forks=
+	apiHandler.SetExcludeForks(os.Getenv("EXCLUDE_FORKS") == "true")
+	// Adopters starred or contributed to by members of this org are flagged
+	apiHandler.SetEmployeeOrg(os.Getenv("EMPLOYEE_ORG"))
+	// The most starred adopters' star history is imported from their stargazer lists
+	apiHandler.SetStarImport(envInt("STAR_IMPORT_TOP", 0), envInt("STAR_IMPORT_PAGES", 10))
+	// Optionally archive the full project list after each refresh
+	apiHandler.SetRefreshArchive(os.Getenv("REFRESH_ARCHIVE") == "true", envInt("REFRESH_ARCHIVE_KEEP", 90))
+	apiHandler.SetTrashRetention(time.Duration(envInt("TRASH_RETENTION_DAYS", 30)) * 24 * time.Hour)
+
+	// Enrichment stages can be turned off, given a time budget, or run for each
+	// project less often than every refresh (stage=duration)
+	var enrichDisabled []string
+	for _, name := range strings.Split(os.Getenv("ENRICH_DISABLED"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			enrichDisabled = append(enrichDisabled, name)
+		}
+	}
+	if err := apiHandler.SetEnrichment(enrichDisabled, stageDurations("ENRICH_BUDGETS"), stageDurations("ENRICH_CADENCE")); err != nil {
+		logging.Server.Fatalf("Invalid enrichment settings: %v", err)
+	}
+
+	// Scheduled and startup refreshes are held back during maintenance windows
+	// and GitHub API outages, then run when they end (or are skipped)
+	blackoutAction := envString("REFRESH_BLACKOUT_ACTION", "delay")
+	if blackoutAction != "delay" && blackoutAction != "skip" {
+		logging.Server.Fatalf("Invalid REFRESH_BLACKOUT_ACTION '%s' (want delay or skip)", blackoutAction)
+	}
+	if err := apiHandler.SetRefreshBlackouts(envList("REFRESH_BLACKOUTS", ""), blackoutAction == "skip", envString("REFRESH_STATUS_CHECK", "true") == "true"); err != nil {
+		logging.Server.Fatalf("Invalid REFRESH_BLACKOUTS: %v", err)
+	}
+
+	// How often githubstatus.com is polled for diagnostics and refresh reports (0 = off)
+	statusInterval, err := time.ParseDuration(envString("GITHUB_STATUS_INTERVAL", "5m"))
+	if err != nil {
+		logging.Server.Fatalf("Invalid GITHUB_STATUS_INTERVAL: %v", err)
+	}
+
+	// Optional retirement date for /api/v1, advertised in the Sunset header
+	if sunset := os.Getenv("API_V1_SUNSET"); sunset != "" {
+		t, err := time.Parse("2006-01-02", sunset)
+		if err != nil {
+			logging.Server.Fatalf("Invalid API_V1_SUNSET '%s' (want YYYY-MM-DD): %v", sunset, err)
+		}
+		apiHandler.SetV1Sunset(t)
+	}
+
+	// Admin API token (empty = admin endpoints disabled)
+	apiHandler.SetAdminToken(os.Getenv("ADMIN_TOKEN"))
+	apiHandler.SetWebhookSecret(os.Getenv("GITHUB_WEBHOOK_SECRET"))
+
+	// API keys (name:key,...) attribute requests to consumers in /api/admin/usage
+	apiKeys := make(map[string]string)
+	for _, entry := range strings.Split(os.Getenv("API_KEYS"), ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		name, key, ok := strings.Cut(entry, ":")
+		if !ok || name == "" || key == "" {
+			logging.Server.Fatalf("Invalid API_KEYS entry '%s' (want name:key)", entry)
+		}
+		apiKeys[key] = name
+	}
+	apiHandler.SetAPIKeys(apiKeys)
+
+	// Request timeouts (Go durations, 0 = none), with overrides per route pattern
+	requestTimeout, err := time.ParseDuration(envString("REQUEST_TIMEOUT", "30s"))
+	if err != nil {
+		logging.Server.Fatalf("Invalid REQUEST_TIMEOUT: %v", err)
+	}
+	routeTimeouts := make(map[string]time.Duration)
+	for _, entry := range strings.Split(os.Getenv("ROUTE_TIMEOUTS"), ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		pattern, value, ok := strings.Cut(entry, "=")
+		timeout, err := time.ParseDuration(value)
+		if !ok || !strings.HasPrefix(pattern, "/api/") || err != nil {
+			logging.Server.Fatalf("Invalid ROUTE_TIMEOUTS entry '%s' (want /api/route=duration)", entry)
+		}
+		routeTimeouts[pattern] = timeout
+	}
+	apiHandler.SetRequestTimeouts(requestTimeout, routeTimeouts)
+
+	// How long clients and CDNs may reuse /api/projects and /api/stats responses
+	// before revalidating them with their ETag
+	cacheMaxAge, err := time.ParseDuration(envString("CACHE_MAX_AGE", "0s"))
+	if err != nil || cacheMaxAge < 0 {
+		logging.Server.Fatalf("Invalid CACHE_MAX_AGE '%s' (want a duration like 60s)", os.Getenv("CACHE_MAX_AGE"))
+	}
+	apiHandler.SetCacheMaxAge(cacheMaxAge)
+
+	// Origins whose pages may call the API from a browser (CORS), e.g. an
+	// external dashboard; unset keeps the API same-origin only
+	corsMaxAge, err := time.ParseDuration(envString("CORS_MAX_AGE", "10m"))
+	if err != nil || corsMaxAge < 0 {
+		logging.Server.Fatalf("Invalid CORS_MAX_AGE '%s' (want a duration like 10m)", os.Getenv("CORS_MAX_AGE"))
+	}
+	corsOrigins := envList("CORS_ORIGINS", "")
+	for _, origin := range corsOrigins {
+		if u, err := url.Parse(origin); origin != "*" && (err != nil || u.Scheme == "" || u.Host == "" || strings.Trim(u.Path, "/") != "") {
+			logging.Server.Fatalf("Invalid CORS_ORIGINS entry '%s' (want scheme://host[:port] or *)", origin)
+		}
+	}
+	apiHandler.SetCORS(corsOrigins, envList("CORS_METHODS", "GET,HEAD,OPTIONS"), envList("CORS_HEADERS", "Content-Type,X-API-Key,If-None-Match"), corsMaxAge)
+	if len(corsOrigins) > 0 {
+		logging.Server.Infof("CORS enabled for %s", strings.Join(corsOrigins, ", "))
+	}
+
+	// Freshness SLO: alert when data is older than this (0 = disabled)
+	var opsAlertConfigs []string
+	for _, name := range strings.Split(os.Getenv("OPS_ALERT_NOTIFICATIONS"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			opsAlertConfigs = append(opsAlertConfigs, name)
+		}
+	}
+	apiHandler.SetFreshnessSLO(time.Duration(envInt("FRESHNESS_SLO_HOURS", 26))*time.Hour, opsAlertConfigs)
+	// GitHub tokens expiring within this many days are alerted to the same configs
+	apiHandler.SetTokenExpiryWarning(time.Duration(envInt("TOKEN_EXPIRY_WARN_DAYS", 7)) * 24 * time.Hour)
+
+	// Milestones (500 adopters, 1M stars, ...) are announced to these configs
+	var milestoneConfigs []string
+	for _, name := range strings.Split(os.Getenv("MILESTONE_NOTIFICATIONS"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			milestoneConfigs = append(milestoneConfigs, name)
+		}
+	}
+	apiHandler.SetMilestoneNotifications(milestoneConfigs)
+
+	// Keep huge refreshes from flooding channels with new-project messages
+	apiHandler.SetNotificationBackpressure(envInt("NOTIFY_MAX_PER_RUN", 20), envInt("NOTIFY_SUMMARY_THRESHOLD", 10))
+
+	// Failed deliveries are retried with exponential backoff
+	retryBackoff, err := time.ParseDuration(envString("NOTIFY_RETRY_BACKOFF", "1m"))
+	if err != nil || retryBackoff <= 0 {
+		logging.Server.Fatalf("Invalid NOTIFY_RETRY_BACKOFF '%s' (want a positive duration like 1m)", os.Getenv("NOTIFY_RETRY_BACKOFF"))
+	}
+	apiHandler.SetNotificationRetries(envInt("NOTIFY_RETRY_ATTEMPTS", 5), retryBackoff)
+
+	// A schedule applied via /api/admin/apply overrides the environment
+	defaultSchedule := refreshSchedule
+	if override, ok, err := database.GetSetting("schedule.refresh"); err != nil {
+		logging.Server.Warnf("Failed to read schedule override: %v", err)
+	} else if ok {
+		logging.Server.Infof("Using refresh schedule from settings: '%s'", override)
+		refreshSchedule = normalizeSchedule(override)
+	}
 
 	// Setup scheduler
+	sched := newScheduler(apiHandler)
 	if refreshSchedule != "" {
-		setupScheduler(apiHandler, refreshSchedule)
+		if err := sched.set(refreshSchedule); err != nil {
+			logging.Server.Errorf("ERROR: Failed to setup scheduler with schedule '%s': %v", refreshSchedule, err)
+		}
 	} else {
-		log.Println("Scheduled refresh disabled")
+		logging.Server.Infof("Scheduled refresh disabled")
+	}
+	apiHandler.SetNextRefreshFunc(sched.next)
+	apiHandler.SetRescheduleFunc(func(spec string) error {
+		if spec == "" {
+			spec = defaultSchedule
+		}
+		return sched.set(normalizeSchedule(spec))
+	})
+
+	// Optional weekly "new adopters" summary published to GitHub
+	if publishRepo := os.Getenv("PUBLISH_REPO"); publishRepo != "" {
+		publishClient := ghClient
+		if token := os.Getenv("PUBLISH_GITHUB_TOKEN"); token != "" {
+			publishClient = github.NewClient(token)
+		}
+		publisher, err := publish.New(database, publishClient, publish.Config{
+			Repo:     publishRepo,
+			Mode:     envString("PUBLISH_MODE", "discussion"),
+			Category: envString("PUBLISH_DISCUSSION_CATEGORY", "Announcements"),
+			FilePath: envString("PUBLISH_FILE_PATH", "ADOPTERS.md"),
+			Branch:   os.Getenv("PUBLISH_BRANCH"),
+			Locale:   os.Getenv("PUBLISH_LOCALE"),
+		})
+		if err != nil {
+			logging.Server.Fatalf("Invalid publish configuration: %v", err)
+		}
+		apiHandler.SetPublisher(publisher)
+
+		// Optional narrative paragraph from an OpenAI-compatible model
+		if summaryURL := os.Getenv("SUMMARY_API_URL"); summaryURL != "" {
+			summaryTimeout, err := time.ParseDuration(envString("SUMMARY_TIMEOUT", "30s"))
+			if err != nil {
+				logging.Server.Fatalf("Invalid SUMMARY_TIMEOUT: %v", err)
+			}
+			summaryModel := envString("SUMMARY_MODEL", "gpt-4o-mini")
+			summarizer, err := summarize.NewOpenAI(summaryURL, summaryModel, os.Getenv("SUMMARY_API_KEY"), summaryTimeout)
+			if err != nil {
+				logging.Server.Fatalf("Invalid summary configuration: %v", err)
+			}
+			publisher.SetSummarizer(summarizer)
+			logging.Server.Infof("Weekly summaries open with a paragraph written by %s", summaryModel)
+		}
+
+		publishSchedule := normalizeSchedule(envString("PUBLISH_SCHEDULE", "0 9 * * 1"))
+		if publishSchedule != "" {
+			if _, err := sched.cron.AddFunc(publishSchedule, func() {
+				if _, err := publisher.Publish(context.Background(), time.Now(), nil, false, false); err != nil {
+					logging.Server.Errorf("ERROR: Scheduled publish failed: %v", err)
+				}
+			}); err != nil {
+				logging.Server.Fatalf("Invalid PUBLISH_SCHEDULE '%s': %v", publishSchedule, err)
+			}
+			logging.Server.Infof("Publishing weekly adopters to %s at '%s'", publisher.Target(), publishSchedule)
+		}
+	} else if os.Getenv("SUMMARY_API_URL") != "" {
+		logging.Server.Warnf("SUMMARY_API_URL is set but PUBLISH_REPO is not; the paragraph is only written for published summaries")
 	}
 
 	// Check if data is stale and trigger immediate refresh if needed
 	checkAndRefreshStaleData(apiHandler)
+	apiHandler.StartFreshnessMonitor(5 * time.Minute)
+	apiHandler.StartTokenMonitor(time.Hour)
+	apiHandler.StartStatusMonitor(statusInterval)
+	apiHandler.StartUsageFlusher(time.Minute)
+	apiHandler.StartTrashPurger(time.Hour)
+	apiHandler.StartNotificationRetrier(min(retryBackoff, 30*time.Second))
+	apiHandler.WarmAggregates()
 
 	// Setup routes
 	mux := http.NewServeMux()
 	mux.HandleFunc("/health", healthHandler)
+	mux.HandleFunc("/health/ready", readyHandler(database))
 
 	// Register API routes
 	apiHandler.RegisterRoutes(mux)
@@ -84,12 +423,174 @@ func main() {
 	if staticDir == "" {
 		staticDir = "static"
 	}
-	mux.Handle("/", http.FileServer(http.Dir(staticDir)))
+	staticFiles, err := assets.New(os.DirFS(staticDir), api.BasePath)
+	if err != nil {
+		logging.Server.Fatalf("Failed to load static files: %v", err)
+	}
+	mux.Handle("/", staticFiles)
 
-	log.Printf("Server starting on port %s", port)
-	if err := http.ListenAndServe(":"+port, mux); err != nil {
-		log.Fatalf("Server failed: %v", err)
+	// Serve everything under BASE_PATH (e.g. /dhi-tracker) behind a shared
+	// ingress; health checks stay at the root for probes that bypass it
+	basePath := "/" + strings.Trim(os.Getenv("BASE_PATH"), "/")
+	if basePath == "/" {
+		basePath = ""
+	}
+	root := http.NewServeMux()
+	root.Handle("/", api.WithBasePath(basePath, mux))
+	if basePath != "" {
+		root.HandleFunc("/health", healthHandler)
+		root.HandleFunc("/health/ready", readyHandler(database))
+		logging.Server.Infof("Serving under %s/", basePath)
 	}
+
+	// How long a shutdown waits for requests and a running refresh to finish
+	shutdownTimeout, err := time.ParseDuration(envString("SHUTDOWN_TIMEOUT", "30s"))
+	if err != nil || shutdownTimeout <= 0 {
+		logging.Server.Fatalf("Invalid SHUTDOWN_TIMEOUT '%s' (want a positive duration like 30s)", os.Getenv("SHUTDOWN_TIMEOUT"))
+	}
+
+	// HTTPS with certificate files or ACME, plus an optional plain HTTP listener
+	// for redirects and ACME challenges
+	serverTLS, err := loadTLS(port)
+	if err != nil {
+		logging.Server.Fatalf("Invalid TLS settings: %v", err)
+	}
+
+	srv := &http.Server{Addr: ":" + port, Handler: logging.AccessMiddleware(root)}
+	var redirectSrv *http.Server
+	serverErr := make(chan error, 2)
+	if serverTLS == nil {
+		go func() {
+			logging.Server.Infof("Server starting on port %s", port)
+			serverErr <- srv.ListenAndServe()
+		}()
+	} else {
+		srv.TLSConfig = serverTLS.config
+		go func() {
+			logging.Server.Infof("Server starting on port %s with HTTPS (%s)", port, serverTLS.source)
+			serverErr <- srv.ListenAndServeTLS("", "")
+		}()
+		if serverTLS.httpPort != "" {
+			redirectSrv = &http.Server{Addr: ":" + serverTLS.httpPort, Handler: serverTLS.httpHandler}
+			go func() {
+				logging.Server.Infof("Redirecting HTTP on port %s to HTTPS", serverTLS.httpPort)
+				serverErr <- redirectSrv.ListenAndServe()
+			}()
+		}
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case err := <-serverErr:
+		logging.Server.Fatalf("Server failed: %v", err)
+	case sig := <-signals:
+		logging.Server.Infof("Received %s, shutting down (timeout %s)", sig, shutdownTimeout)
+	}
+
+	// Stop taking work, then let what's running finish or record where it got to
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	<-sched.cron.Stop().Done()
+	if err := srv.Shutdown(ctx); err != nil {
+		logging.Server.Errorf("Error shutting down HTTP server: %v", err)
+	}
+	if redirectSrv != nil {
+		redirectSrv.Shutdown(ctx)
+	}
+	if err := apiHandler.Shutdown(ctx); err != nil {
+		logging.Server.Warnf("Refresh still running at shutdown timeout: %v", err)
+	}
+	logging.Server.Infof("Server stopped")
+}
+
+// stageDurations reads a list of stage=duration entries from an environment variable
+func stageDurations(env string) map[string]time.Duration {
+	durations := make(map[string]time.Duration)
+	for _, entry := range strings.Split(os.Getenv(env), ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		stage, value, ok := strings.Cut(entry, "=")
+		d, err := time.ParseDuration(value)
+		if !ok || err != nil {
+			logging.Server.Fatalf("Invalid %s entry '%s' (want stage=duration)", env, entry)
+		}
+		durations[stage] = d
+	}
+	return durations
+}
+
+// loadGitHubApp builds GitHub App auth from GITHUB_APP_PRIVATE_KEY (PEM contents) or
+// GITHUB_APP_PRIVATE_KEY_PATH, and the optional GITHUB_APP_INSTALLATION_ID
+func loadGitHubApp(appID string) (*github.AppAuth, error) {
+	id, err := strconv.ParseInt(appID, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("GITHUB_APP_ID must be a number: %w", err)
+	}
+
+	var installationID int64
+	if v := os.Getenv("GITHUB_APP_INSTALLATION_ID"); v != "" {
+		if installationID, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return nil, fmt.Errorf("GITHUB_APP_INSTALLATION_ID must be a number: %w", err)
+		}
+	}
+
+	key := []byte(os.Getenv("GITHUB_APP_PRIVATE_KEY"))
+	if path := os.Getenv("GITHUB_APP_PRIVATE_KEY_PATH"); len(key) == 0 && path != "" {
+		if key, err = os.ReadFile(path); err != nil {
+			return nil, fmt.Errorf("reading private key: %w", err)
+		}
+	}
+	if len(key) == 0 {
+		return nil, fmt.Errorf("GITHUB_APP_PRIVATE_KEY or GITHUB_APP_PRIVATE_KEY_PATH is required")
+	}
+	// Allow the PEM to be passed on one line with escaped newlines, as .env files often do
+	key = []byte(strings.ReplaceAll(string(key), `\n`, "\n"))
+
+	return github.NewAppAuth(id, installationID, key)
+}
+
+// envString reads an environment variable, falling back to def if unset
+func envString(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// envInt reads an integer environment variable, falling back to def if unset or invalid
+func envInt(key string, def int) int {
+	if v := os.Getenv(key); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			return n
+		}
+		logging.Server.Warnf("invalid %s=%q, using %d", key, v, def)
+	}
+	return def
+}
+
+// envList reads a comma-separated environment variable, falling back to the
+// entries of def if unset. Blank entries are dropped.
+func envList(key, def string) []string {
+	var list []string
+	for _, v := range strings.Split(envString(key, def), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// envFloat reads a float environment variable, falling back to def if unset or invalid
+func envFloat(key string, def float64) float64 {
+	if v := os.Getenv(key); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f
+		}
+		logging.Server.Warnf("invalid %s=%q, using %g", key, v, def)
+	}
+	return def
 }
 
 func healthHandler(w http.ResponseWriter, r *http.Request) {
@@ -97,44 +598,240 @@ func healthHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
 }
 
-func setupScheduler(apiHandler *api.API, schedule string) {
-	c := cron.New()
-	_, err := c.AddFunc(schedule, func() {
-		log.Printf("Scheduled refresh triggered (schedule: %s)", schedule)
-		apiHandler.TriggerRefresh("scheduled")
-	})
+// readyHandler reports whether the server can serve requests (database reachable)
+func readyHandler(database db.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+		defer cancel()
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := database.PingContext(ctx); err != nil {
+			logging.Server.Errorf("Readiness check failed: %v", err)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			json.NewEncoder(w).Encode(map[string]string{"status": "unavailable", "error": "database unreachable"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"status": "ready"})
+	}
+}
+
+// runHealthcheck probes a running server's readiness endpoint and returns the process exit code.
+// Used as a Docker HEALTHCHECK or systemd watchdog without needing curl in the image.
+func runHealthcheck(args []string) int {
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8000"
+	}
+
+	scheme := "http"
+	https := os.Getenv("TLS_CERT") != "" || os.Getenv("ACME_DOMAIN") != ""
+	if https {
+		scheme = "https"
+	}
+
+	fs := flag.NewFlagSet("healthcheck", flag.ContinueOnError)
+	url := fs.String("url", scheme+"://127.0.0.1:"+port+"/health/ready", "readiness endpoint to probe")
+	timeout := fs.Duration("timeout", 5*time.Second, "request timeout")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	client := &http.Client{Timeout: *timeout}
+	if https {
+		// The probe is of this host, whose certificate is for its public name;
+		// ask for that name, as ACME only answers for its domains, but don't verify it
+		config := &tls.Config{InsecureSkipVerify: true}
+		if domains := tlsDomains(); len(domains) > 0 {
+			config.ServerName = domains[0]
+		}
+		client.Transport = &http.Transport{TLSClientConfig: config}
+	}
+	resp, err := client.Get(*url)
 	if err != nil {
-		log.Printf("ERROR: Failed to setup scheduler with schedule '%s': %v", schedule, err)
-		return
+		fmt.Fprintf(os.Stderr, "healthcheck failed: %v\n", err)
+		return 1
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		fmt.Fprintf(os.Stderr, "healthcheck failed: %s returned %d\n", *url, resp.StatusCode)
+		return 1
+	}
+	return 0
+}
+
+// runCheckConfig validates a configuration file without starting the server
+// and returns the process exit code
+func runCheckConfig(args []string) int {
+	fs := flag.NewFlagSet("check-config", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: server check-config [path]   (defaults to $CONFIG_FILE)")
 	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	path := os.Getenv("CONFIG_FILE")
+	if fs.NArg() > 0 {
+		path = fs.Arg(0)
+	}
+	if path == "" {
+		fs.Usage()
+		return 2
+	}
+
+	f, err := config.Load(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Printf("%s: %d settings OK\n", path, f.Len())
+	return 0
+}
+
+// runImport loads a dump from /api/export into a local database and returns the
+// process exit code. Used to seed a new instance before starting it; a running
+// server can import over HTTP with POST /api/import instead.
+func runImport(args []string) int {
+	dbPath := os.Getenv("DB_PATH")
+	if dbPath == "" {
+		dbPath = "dhi-oss-usage.db"
+	}
+
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	fs.StringVar(&dbPath, "db", dbPath, "database to import into")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: server import [-db path] <dump.ndjson.gz | ->")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	in := os.Stdin
+	if name := fs.Arg(0); name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "import failed: %v\n", err)
+			return 1
+		}
+		defer f.Close()
+		in = f
+	}
+
+	database, err := db.Open(dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "import failed: %v\n", err)
+		return 1
+	}
+	defer database.Close()
+	if err := database.Migrate(); err != nil {
+		fmt.Fprintf(os.Stderr, "import failed: %v\n", err)
+		return 1
+	}
+
+	counts, err := database.ImportDump(in)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "import failed: %v\n", err)
+		return 1
+	}
+	for _, table := range db.DumpTables {
+		fmt.Printf("%s: %d\n", table, counts[table])
+	}
+	return 0
+}
+
+// normalizeSchedule maps "disabled" to an empty schedule
+func normalizeSchedule(schedule string) string {
+	if strings.ToLower(schedule) == "disabled" {
+		return ""
+	}
+	return schedule
+}
+
+// scheduler runs scheduled refreshes and allows the schedule to be replaced at runtime
+type scheduler struct {
+	mu      sync.Mutex
+	cron    *cron.Cron
+	entryID cron.EntryID
+	api     *api.API
+}
+
+func newScheduler(apiHandler *api.API) *scheduler {
+	c := cron.New()
 	c.Start()
-	log.Printf("Scheduler started: refresh at '%s'", schedule)
+	return &scheduler{cron: c, api: apiHandler}
+}
+
+// set replaces the refresh schedule. An empty schedule disables scheduled refreshes.
+func (s *scheduler) set(schedule string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	// Set function to get next scheduled refresh time
-	apiHandler.SetNextRefreshFunc(func() *time.Time {
-		entries := c.Entries()
-		if len(entries) > 0 {
-			next := entries[0].Next
-			return &next
+	var id cron.EntryID
+	if schedule != "" {
+		var err error
+		id, err = s.cron.AddFunc(schedule, func() {
+			logging.Server.Infof("Scheduled refresh triggered (schedule: %s)", schedule)
+			s.api.TriggerRefresh("scheduled")
+		})
+		if err != nil {
+			return err
 		}
+	}
+
+	if s.entryID != 0 {
+		s.cron.Remove(s.entryID)
+	}
+	s.entryID = id
+
+	if schedule != "" {
+		logging.Server.Infof("Scheduler started: refresh at '%s'", schedule)
+	} else {
+		logging.Server.Infof("Scheduled refresh disabled")
+	}
+	return nil
+}
+
+// next returns the next scheduled refresh time, or nil if scheduling is disabled
+func (s *scheduler) next() *time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.entryID == 0 {
 		return nil
-	})
+	}
+	next := s.cron.Entry(s.entryID).Next
+	return &next
 }
 
+// checkAndRefreshStaleData starts a refresh if the last one was interrupted
+// or the data is stale. The refresh is triggered in the background, as
+// checking for blackouts may read githubstatus.com, which shouldn't delay
+// the server listening.
 func checkAndRefreshStaleData(apiHandler *api.API) {
+	if apiHandler.RecoverInterruptedRefreshes() {
+		logging.Server.Infof("Last refresh was interrupted by a shutdown, re-running it")
+		go apiHandler.TriggerRefresh("resume")
+		return
+	}
+
 	lastRefresh := apiHandler.GetLastRefreshTime()
 	if lastRefresh == nil {
-		log.Println("No previous refresh found, triggering startup refresh")
-		apiHandler.TriggerRefresh("startup")
+		logging.Server.Infof("No previous refresh found, triggering startup refresh")
+		go apiHandler.TriggerRefresh("startup")
 		return
 	}
 
 	staleThreshold := 24 * time.Hour
 	age := time.Since(*lastRefresh)
 	if age > staleThreshold {
-		log.Printf("Data is stale (last refresh: %s, age: %s), triggering startup refresh", lastRefresh.Format(time.RFC3339), age.Round(time.Minute))
-		apiHandler.TriggerRefresh("startup")
+		logging.Server.Infof("Data is stale (last refresh: %s, age: %s), triggering startup refresh", lastRefresh.Format(time.RFC3339), age.Round(time.Minute))
+		go apiHandler.TriggerRefresh("startup")
 	} else {
-		log.Printf("Data is fresh (last refresh: %s, age: %s)", lastRefresh.Format(time.RFC3339), age.Round(time.Minute))
+		logging.Server.Infof("Data is fresh (last refresh: %s, age: %s)", lastRefresh.Format(time.RFC3339), age.Round(time.Minute))
 	}
 }
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"dhi-oss-usage/internal/db"
+)
+
+// remoteCommands are the subcommands that read from a running server's API
+// rather than the database, for checking adoption from a terminal or a cron job
+var remoteCommands = map[string]func(args []string) int{
+	"stats": runStats,
+	"top":   runTop,
+	"new":   runNew,
+}
+
+// remoteClient calls the API of a running server
+type remoteClient struct {
+	baseURL string
+	apiKey  string
+	raw     bool // print responses as JSON instead of tables
+	http    *http.Client
+}
+
+// remoteFlags registers the flags every remote command takes: the server's
+// base URL (including any BASE_PATH), an API key and the output format
+func remoteFlags(fs *flag.FlagSet) func() *remoteClient {
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8000"
+	}
+	server := os.Getenv("DHI_SERVER")
+	if server == "" {
+		server = "http://127.0.0.1:" + port
+	}
+
+	c := &remoteClient{}
+	fs.StringVar(&c.baseURL, "server", server, "base URL of the server ($DHI_SERVER)")
+	fs.StringVar(&c.apiKey, "key", os.Getenv("DHI_API_KEY"), "API key sent in X-API-Key ($DHI_API_KEY)")
+	fs.BoolVar(&c.raw, "json", false, "print the API response as JSON")
+	timeout := fs.Duration("timeout", 30*time.Second, "request timeout")
+	return func() *remoteClient {
+		c.baseURL = strings.TrimSuffix(c.baseURL, "/")
+		c.http = &http.Client{Timeout: *timeout}
+		return c
+	}
+}
+
+// get fetches path with query from the server and decodes the JSON response
+// into v. With -json the response is printed as is and v is left untouched.
+func (c *remoteClient) get(path string, query url.Values, v interface{}) (printed bool, err error) {
+	u := c.baseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.apiKey != "" {
+		req.Header.Set("X-API-Key", c.apiKey)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return false, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("%s returned %d: %s", u, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	if c.raw {
+		os.Stdout.Write(body)
+		return true, nil
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return false, fmt.Errorf("parsing response of %s: %w", u, err)
+	}
+	return false, nil
+}
+
+// runStats prints the summary statistics of /api/stats
+func runStats(args []string) int {
+	fs := flag.NewFlagSet("stats", flag.ContinueOnError)
+	client := remoteFlags(fs)
+	excludeForks := fs.Bool("exclude-forks", false, "leave forks out")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	c := client()
+
+	query := url.Values{}
+	if *excludeForks {
+		query.Set("exclude_forks", "true")
+	}
+	var stats struct {
+		TotalProjects  int `json:"total_projects"`
+		TotalStars     int `json:"total_stars"`
+		NewThisWeek    int `json:"new_this_week"`
+		PopularCount   int `json:"popular_count"`
+		NotableCount   int `json:"notable_count"`
+		AdoptionCount  int `json:"adoption_count"`
+		ForkCount      int `json:"fork_count"`
+		ArchivedCount  int `json:"archived_count"`
+		RemovedCount   int `json:"removed_count"`
+		RemovedLast30d int `json:"removed_last_30d"`
+	}
+	printed, err := c.get("/api/stats", query, &stats)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "stats failed: %v\n", err)
+		return 1
+	}
+	if printed {
+		return 0
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Projects\t%d\n", stats.TotalProjects)
+	fmt.Fprintf(w, "Stars\t%d\n", stats.TotalStars)
+	fmt.Fprintf(w, "New this week\t%d\n", stats.NewThisWeek)
+	fmt.Fprintf(w, "Popular (1000+ stars)\t%d\n", stats.PopularCount)
+	fmt.Fprintf(w, "Notable (100-999 stars)\t%d\n", stats.NotableCount)
+	fmt.Fprintf(w, "Adoptions (forks grouped)\t%d\n", stats.AdoptionCount)
+	fmt.Fprintf(w, "Forks\t%d\n", stats.ForkCount)
+	fmt.Fprintf(w, "Archived\t%d\n", stats.ArchivedCount)
+	fmt.Fprintf(w, "Removed\t%d (%d in the last 30 days)\n", stats.RemovedCount, stats.RemovedLast30d)
+	w.Flush()
+	return 0
+}
+
+// runTop prints the most starred live projects
+func runTop(args []string) int {
+	fs := flag.NewFlagSet("top", flag.ContinueOnError)
+	client := remoteFlags(fs)
+	n := fs.Int("n", 10, "number of projects")
+	excludeForks := fs.Bool("exclude-forks", false, "leave forks out")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *n <= 0 || *n > 1000 {
+		fmt.Fprintln(os.Stderr, "top failed: -n must be from 1 to 1000")
+		return 2
+	}
+	c := client()
+
+	query := url.Values{
+		"sort":   {"stars"},
+		"order":  {"desc"},
+		"limit":  {fmt.Sprint(*n)},
+		"fields": {"repo_full_name,stars,primary_language,github_url"},
+	}
+	if *excludeForks {
+		query.Set("exclude_forks", "true")
+	}
+	var projects []db.Project
+	printed, err := c.get("/api/projects", query, &projects)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "top failed: %v\n", err)
+		return 1
+	}
+	if printed {
+		return 0
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "#\tSTARS\tPROJECT\tLANGUAGE\tURL")
+	for i, p := range projects {
+		fmt.Fprintf(w, "%d\t%d\t%s\t%s\t%s\n", i+1, p.Stars, p.RepoFullName, orDash(p.PrimaryLanguage), p.GitHubURL)
+	}
+	w.Flush()
+	return 0
+}
+
+// runNew prints the projects adopted since a time, newest first
+func runNew(args []string) int {
+	fs := flag.NewFlagSet("new", flag.ContinueOnError)
+	client := remoteFlags(fs)
+	since := fs.String("since", "thisweek", "period: thisweek, or a duration like 7d, 2w or 24h")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	c := client()
+
+	var projects []db.Project
+	printed, err := c.get("/api/projects/new", url.Values{"since": {*since}}, &projects)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "new failed: %v\n", err)
+		return 1
+	}
+	if printed {
+		return 0
+	}
+
+	if len(projects) == 0 {
+		fmt.Printf("No new projects since %s\n", *since)
+		return 0
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ADOPTED\tSTARS\tPROJECT\tLANGUAGE\tURL")
+	for _, p := range projects {
+		adopted := "-"
+		if p.AdoptedAt != nil {
+			adopted = p.AdoptedAt.Format("2006-01-02")
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\n", adopted, p.Stars, p.RepoFullName, orDash(p.PrimaryLanguage), p.GitHubURL)
+	}
+	w.Flush()
+	fmt.Printf("\n%d new since %s\n", len(projects), *since)
+	return 0
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"dhi-oss-usage/internal/logging"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// serverTLS is how the server serves HTTPS, from TLS_CERT and TLS_KEY or from
+// certificates obtained with ACME (Let's Encrypt) for ACME_DOMAIN
+type serverTLS struct {
+	config      *tls.Config
+	source      string       // for the startup log
+	httpPort    string       // plain HTTP listener, "" for none
+	httpHandler http.Handler // what the plain HTTP listener serves
+}
+
+// loadTLS reads the TLS settings. It returns nil when HTTPS isn't configured.
+// port is the HTTPS port, which redirects from the plain HTTP listener go to.
+func loadTLS(port string) (*serverTLS, error) {
+	certPath, keyPath := os.Getenv("TLS_CERT"), os.Getenv("TLS_KEY")
+	domains := tlsDomains()
+	httpPort := os.Getenv("HTTP_PORT")
+	if httpPort == "off" {
+		httpPort = ""
+	}
+
+	switch {
+	case certPath == "" && keyPath == "" && len(domains) == 0:
+		return nil, nil
+	case (certPath != "" || keyPath != "") && len(domains) > 0:
+		return nil, errors.New("set either TLS_CERT and TLS_KEY or ACME_DOMAIN, not both")
+	case len(domains) > 0:
+		return loadACME(domains, port, httpPort)
+	case certPath == "" || keyPath == "":
+		return nil, errors.New("TLS_CERT and TLS_KEY must be set together")
+	}
+
+	cert := &certFiles{certPath: certPath, keyPath: keyPath}
+	if err := cert.load(); err != nil {
+		return nil, err
+	}
+	return &serverTLS{
+		config:      &tls.Config{GetCertificate: cert.get, MinVersion: tls.VersionTLS12},
+		source:      "certificate " + certPath,
+		httpPort:    httpPort,
+		httpHandler: redirectToHTTPS(port),
+	}, nil
+}
+
+// loadACME obtains and renews certificates for domains from Let's Encrypt, or
+// the CA at ACME_DIRECTORY_URL. Certificates and the account key are cached in
+// ACME_CACHE_DIR so restarts don't request new ones. The CA validates with the
+// TLS-ALPN-01 challenge when the server listens on 443, or else HTTP-01 on the
+// plain HTTP listener, which defaults to port 80 for this.
+func loadACME(domains []string, port, httpPort string) (*serverTLS, error) {
+	if os.Getenv("HTTP_PORT") == "" {
+		httpPort = "80"
+	}
+	if port != "443" && httpPort != "80" {
+		return nil, errors.New("ACME needs PORT=443 or HTTP_PORT=80 for the CA to validate the domain")
+	}
+	manager := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(domains...),
+		Cache:      autocert.DirCache(envString("ACME_CACHE_DIR", "acme-cache")),
+		Email:      os.Getenv("ACME_EMAIL"),
+	}
+	if dir := os.Getenv("ACME_DIRECTORY_URL"); dir != "" {
+		manager.Client = &acme.Client{DirectoryURL: dir}
+	}
+	config := manager.TLSConfig()
+	config.MinVersion = tls.VersionTLS12
+	return &serverTLS{
+		config:      config,
+		source:      "ACME certificates for " + strings.Join(domains, ", "),
+		httpPort:    httpPort,
+		httpHandler: manager.HTTPHandler(redirectToHTTPS(port)),
+	}, nil
+}
+
+// tlsDomains returns the hostnames in ACME_DOMAIN
+func tlsDomains() []string {
+	var domains []string
+	for _, d := range strings.Split(os.Getenv("ACME_DOMAIN"), ",") {
+		if d = strings.TrimSpace(d); d != "" {
+			domains = append(domains, d)
+		}
+	}
+	return domains
+}
+
+// redirectToHTTPS sends plain HTTP requests to the same URL over HTTPS
+func redirectToHTTPS(port string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
+
+// certFiles serves the certificate in TLS_CERT and TLS_KEY, reloading it when
+// the files change so renewals by certbot or similar don't need a restart
+type certFiles struct {
+	certPath, keyPath string
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	modTime   time.Time
+	checkedAt time.Time
+}
+
+// certCheckInterval is how often the certificate files are checked for changes
+const certCheckInterval = time.Minute
+
+func (c *certFiles) load() error {
+	info, err := os.Stat(c.certPath)
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(c.certPath, c.keyPath)
+	if err != nil {
+		return fmt.Errorf("loading TLS certificate: %w", err)
+	}
+	c.cert, c.modTime = &cert, info.ModTime()
+	return nil
+}
+
+func (c *certFiles) get(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if time.Since(c.checkedAt) >= certCheckInterval {
+		c.checkedAt = time.Now()
+		if info, err := os.Stat(c.certPath); err == nil && !info.ModTime().Equal(c.modTime) {
+			// Keep serving the old certificate if the new pair is incomplete or invalid
+			if err := c.load(); err != nil {
+				logging.Server.Errorf("Error reloading TLS certificate: %v", err)
+			} else {
+				logging.Server.Infof("Reloaded TLS certificate %s", c.certPath)
+			}
+		}
+	}
+	return c.cert, nil
+}
@@ -23,7 +23,7 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
 	defer cancel()
 
-	projects, err := client.FetchAllProjects(ctx, func(status string, current, total int) {
+	projects, _, err := client.FetchAllProjects(ctx, func(status string, current, total int) {
 		fmt.Printf("Status: %s %d/%d\n", status, current, total)
 	})
 	if err != nil {
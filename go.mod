@@ -4,4 +4,12 @@ go 1.22.2
 
 require github.com/mattn/go-sqlite3 v1.14.33
 
-require github.com/robfig/cron/v3 v3.0.1 // indirect
+require (
+	github.com/robfig/cron/v3 v3.0.1
+	golang.org/x/crypto v0.33.0
+)
+
+require (
+	golang.org/x/net v0.21.0 // indirect
+	golang.org/x/text v0.22.0 // indirect
+)
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"dhi-oss-usage/internal/github"
+	"dhi-oss-usage/internal/logging"
+)
+
+const (
+	// commitActivityWeeks is how many recent weeks of commit counts are kept
+	// per project, enough for a card sparkline
+	commitActivityWeeks = 12
+	// commitActivityMaxAge is the default cadence of the activity stage: how
+	// long fetched activity is kept before a refresh fetches it again; GitHub's
+	// counts only change weekly
+	commitActivityMaxAge = 7 * 24 * time.Hour
+)
+
+// fetchCommitActivity records recent weekly commit counts for live GitHub projects
+// whose counts are older than the stage's cadence (a week by default). Repos whose statistics GitHub is still
+// computing are retried by the next refresh.
+func (a *API) fetchCommitActivity(ctx context.Context, report *refreshReport) {
+	projects, err := a.db.GetLiveGitHubProjects()
+	if err != nil {
+		logging.Refresh.Ctx(ctx).Errorf("Error listing projects for commit activity: %v", err)
+		return
+	}
+	projects = a.dueProjects(ctx, "activity", projects, report)
+	if len(projects) == 0 {
+		return
+	}
+
+	logging.Refresh.Ctx(ctx).Infof("Fetching commit activity for %d projects...", len(projects))
+
+	var done int64
+	a.ghClient.Parallel(ctx, len(projects), func(i int) {
+		p := projects[i]
+
+		weeks, err := a.ghClient.GetWeeklyCommits(ctx, p.RepoFullName)
+		if err != nil && strings.Contains(err.Error(), "rate limited") {
+			// The client has paused all workers; retry once the backoff expires
+			weeks, err = a.ghClient.GetWeeklyCommits(ctx, p.RepoFullName)
+		}
+		n := atomic.AddInt64(&done, 1)
+		if errors.Is(err, github.ErrStatsPending) {
+			report.count("activity", "pending", 1)
+			return
+		}
+		if err != nil {
+			logging.Refresh.Ctx(ctx).Errorf("Error fetching commit activity for %s (%d/%d): %v", p.RepoFullName, n, len(projects), err)
+			report.count("activity", "failed", 1)
+			report.addError(err)
+			return
+		}
+
+		if len(weeks) > commitActivityWeeks {
+			weeks = weeks[len(weeks)-commitActivityWeeks:]
+		}
+		if err := a.db.SetProjectCommitActivity(p.ID, weeks); err != nil {
+			logging.Refresh.Ctx(ctx).Errorf("Error saving commit activity for %s: %v", p.RepoFullName, err)
+			report.count("activity", "failed", 1)
+			report.countError("database")
+			return
+		}
+		a.recordStageRun(ctx, "activity", p.ID)
+		report.count("activity", "fetched", 1)
+	})
+	logging.Refresh.Ctx(ctx).Infof("Finished fetching commit activity")
+}
@@ -0,0 +1,310 @@
+package api
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"dhi-oss-usage/internal/db"
+	"dhi-oss-usage/internal/logging"
+
+	"github.com/robfig/cron/v3"
+)
+
+// scheduleSettingPrefix namespaces schedule overrides within the settings table
+const scheduleSettingPrefix = "schedule."
+
+// requireAdmin checks the bearer token for admin endpoints and writes an error response if it fails
+func (a *API) requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if a.adminToken == "" {
+		http.Error(w, "Admin API disabled (ADMIN_TOKEN not set)", http.StatusForbidden)
+		return false
+	}
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+a.adminToken)) != 1 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// applyDocument is the declarative tracker configuration accepted by /api/admin/apply.
+// Omitted sections are left untouched; a present section (even if empty) is reconciled
+// so the database matches it exactly.
+type applyDocument struct {
+	Notifications []applyNotification `json:"notifications"`
+	Schedules     map[string]string   `json:"schedules"`
+	Settings      map[string]string   `json:"settings"`
+}
+
+// applyNotification describes a notification config, keyed by its unique name
+type applyNotification struct {
+	Name            string          `json:"name"`
+	Type            string          `json:"type"`
+	Enabled         *bool           `json:"enabled"`
+	RequireApproval bool            `json:"require_approval"`
+	Config          json.RawMessage `json:"config"`
+}
+
+// applyChange describes a single reconciliation step
+type applyChange struct {
+	Kind   string `json:"kind"` // notification, schedule, setting
+	Name   string `json:"name"`
+	Action string `json:"action"` // create, update, delete
+
+	apply func(store db.Store) error // writes the change; all of a document's run in one transaction
+	after func() error               // takes effect once the transaction has committed
+}
+
+// handleAdminApply reconciles notification configs, schedules and settings with a declarative document
+func (a *API) handleAdminApply(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !a.requireAdmin(w, r) {
+		return
+	}
+
+	var doc applyDocument
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&doc); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid apply document: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	dryRun := r.URL.Query().Get("dry_run") == "true"
+
+	changes, err := a.planApply(&doc)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !dryRun {
+		// All or nothing, so a failure can't leave the config half-applied
+		err := a.db.InTx(func(store db.Store) error {
+			for _, c := range changes {
+				if err := c.apply(store); err != nil {
+					return fmt.Errorf("applying %s %s %q: %w", c.Action, c.Kind, c.Name, err)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			logging.Server.Ctx(r.Context()).Errorf("Error applying document, nothing was changed: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		for _, c := range changes {
+			logging.Server.Ctx(r.Context()).Infof("Applied %s %s %q", c.Action, c.Kind, c.Name)
+			if c.after == nil {
+				continue
+			}
+			if err := c.after(); err != nil {
+				logging.Server.Ctx(r.Context()).Errorf("Error putting %s %s %q into effect: %v", c.Action, c.Kind, c.Name, err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+
+	if changes == nil {
+		changes = []applyChange{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"dry_run": dryRun,
+		"changes": changes,
+	})
+}
+
+// planApply validates the document and computes the changes needed to reconcile the database.
+// Nothing is written until the returned changes are applied.
+func (a *API) planApply(doc *applyDocument) ([]applyChange, error) {
+	var changes []applyChange
+
+	if doc.Notifications != nil {
+		c, err := a.planNotifications(doc.Notifications)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, c...)
+	}
+
+	current, err := a.db.ListSettings()
+	if err != nil {
+		return nil, fmt.Errorf("loading settings: %w", err)
+	}
+
+	if doc.Schedules != nil {
+		for name, spec := range doc.Schedules {
+			if name != "refresh" {
+				return nil, fmt.Errorf("unknown schedule %q (supported: refresh)", name)
+			}
+			if strings.ToLower(spec) != "disabled" {
+				if _, err := cron.ParseStandard(spec); err != nil {
+					return nil, fmt.Errorf("invalid schedule %q: %v", name, err)
+				}
+			}
+		}
+		desired := make(map[string]string)
+		for name, spec := range doc.Schedules {
+			desired[scheduleSettingPrefix+name] = spec
+		}
+		for _, c := range a.planSettings(current, desired, true) {
+			name := strings.TrimPrefix(c.Name, scheduleSettingPrefix)
+			spec := desired[c.Name]
+			c.Kind = "schedule"
+			c.Name = name
+			if a.rescheduleFn != nil {
+				c.after = func() error { return a.rescheduleFn(spec) }
+			}
+			changes = append(changes, c)
+		}
+	}
+
+	if doc.Settings != nil {
+		for key := range doc.Settings {
+			if strings.HasPrefix(key, scheduleSettingPrefix) {
+				return nil, fmt.Errorf("setting %q is reserved, use the schedules section", key)
+			}
+		}
+		changes = append(changes, a.planSettings(current, doc.Settings, false)...)
+	}
+
+	return changes, nil
+}
+
+func (a *API) planNotifications(desired []applyNotification) ([]applyChange, error) {
+	existing, err := a.db.ListNotificationConfigs()
+	if err != nil {
+		return nil, fmt.Errorf("loading notification configs: %w", err)
+	}
+	byName := make(map[string]db.NotificationConfig)
+	for _, c := range existing {
+		byName[c.Name] = c
+	}
+
+	var changes []applyChange
+	seen := make(map[string]bool)
+	for _, n := range desired {
+		if seen[n.Name] {
+			return nil, fmt.Errorf("duplicate notification name %q", n.Name)
+		}
+		seen[n.Name] = true
+
+		config := db.NotificationConfig{
+			Name:    n.Name,
+			Type:    n.Type,
+			Enabled: n.Enabled == nil || *n.Enabled,
+
+			RequireApproval: n.RequireApproval,
+		}
+		if len(n.Config) > 0 {
+			var buf bytes.Buffer
+			if err := json.Compact(&buf, n.Config); err != nil {
+				return nil, fmt.Errorf("notification %q: invalid config: %v", n.Name, err)
+			}
+			config.ConfigJSON = buf.String()
+		}
+		if err := validateNotificationConfig(&config); err != nil {
+			return nil, fmt.Errorf("notification %q: %v", n.Name, err)
+		}
+
+		cur, ok := byName[n.Name]
+		if !ok {
+			changes = append(changes, applyChange{
+				Kind: "notification", Name: n.Name, Action: "create",
+				apply: func(store db.Store) error {
+					_, err := store.CreateNotificationConfig(&config)
+					return err
+				},
+			})
+			continue
+		}
+
+		config.ID = cur.ID
+		if cur.Type != config.Type || cur.Enabled != config.Enabled || cur.RequireApproval != config.RequireApproval || !sameJSON(cur.ConfigJSON, config.ConfigJSON) {
+			changes = append(changes, applyChange{
+				Kind: "notification", Name: n.Name, Action: "update",
+				apply: func(store db.Store) error { return store.UpdateNotificationConfig(&config) },
+			})
+		}
+	}
+
+	for _, c := range existing {
+		if seen[c.Name] {
+			continue
+		}
+		id := c.ID
+		changes = append(changes, applyChange{
+			Kind: "notification", Name: c.Name, Action: "delete",
+			apply: func(store db.Store) error { return store.DeleteNotificationConfig(id) },
+		})
+	}
+
+	return changes, nil
+}
+
+// planSettings diffs desired settings against current ones. When schedules is true only
+// schedule-prefixed keys are considered, otherwise they are skipped.
+func (a *API) planSettings(current, desired map[string]string, schedules bool) []applyChange {
+	var changes []applyChange
+
+	keys := make([]string, 0, len(desired))
+	for k := range desired {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		key, value := k, desired[k]
+		cur, ok := current[key]
+		if ok && cur == value {
+			continue
+		}
+		action := "update"
+		if !ok {
+			action = "create"
+		}
+		changes = append(changes, applyChange{
+			Kind: "setting", Name: key, Action: action,
+			apply: func(store db.Store) error { return store.SetSetting(key, value) },
+		})
+	}
+
+	var removed []string
+	for k := range current {
+		if strings.HasPrefix(k, scheduleSettingPrefix) != schedules {
+			continue
+		}
+		if _, ok := desired[k]; !ok {
+			removed = append(removed, k)
+		}
+	}
+	sort.Strings(removed)
+	for _, k := range removed {
+		key := k
+		changes = append(changes, applyChange{
+			Kind: "setting", Name: key, Action: "delete",
+			apply: func(store db.Store) error { return store.DeleteSetting(key) },
+		})
+	}
+
+	return changes
+}
+
+// sameJSON reports whether two JSON documents are semantically equal
+func sameJSON(a, b string) bool {
+	var va, vb interface{}
+	if json.Unmarshal([]byte(a), &va) != nil || json.Unmarshal([]byte(b), &vb) != nil {
+		return a == b
+	}
+	ja, _ := json.Marshal(va)
+	jb, _ := json.Marshal(vb)
+	return bytes.Equal(ja, jb)
+}
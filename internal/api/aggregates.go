@@ -0,0 +1,139 @@
+package api
+
+import (
+	"encoding/json"
+	"time"
+
+	"dhi-oss-usage/internal/db"
+	"dhi-oss-usage/internal/logging"
+)
+
+// maxTopImages is how many images the top-images aggregate keeps; ?limit= on
+// /api/images/top is capped at the same number
+const maxTopImages = 100
+
+// dashboardStats is /api/stats apart from new_this_week, which depends on the
+// current week and is always counted live
+type dashboardStats struct {
+	TotalProjects  int               `json:"total_projects"`
+	TotalStars     int               `json:"total_stars"`
+	PopularCount   int               `json:"popular_count"`
+	NotableCount   int               `json:"notable_count"`
+	RemovedCount   int               `json:"removed_count"`
+	RemovedLast30d int               `json:"removed_last_30d"`
+	DeletedCount   int               `json:"deleted_count"`
+	ArchivedCount  int               `json:"archived_count"`
+	ForkCount      int               `json:"fork_count"`
+	AdoptionCount  int               `json:"adoption_count"`
+	EmployeeCount  int               `json:"employee_engaged_count"` // live projects starred or contributed to by EMPLOYEE_ORG members
+	Licenses       []db.LicenseCount `json:"licenses"`
+}
+
+// aggregates are the dashboard reads precomputed into the aggregates table, by
+// key. Handlers serve the stored result and only query live when none is stored.
+var aggregates = map[string]func(store db.ProjectStore) (interface{}, error){
+	"stats":               func(s db.ProjectStore) (interface{}, error) { return computeStats(s, false) },
+	"stats:exclude_forks": func(s db.ProjectStore) (interface{}, error) { return computeStats(s, true) },
+	"source_types":        func(s db.ProjectStore) (interface{}, error) { return s.GetSourceTypes() },
+	"file_types":          func(s db.ProjectStore) (interface{}, error) { return s.GetFileTypes() },
+	"providers":           func(s db.ProjectStore) (interface{}, error) { return s.GetProviders() },
+	"images":              func(s db.ProjectStore) (interface{}, error) { return s.GetImageUsage() },
+	"images_top":          func(s db.ProjectStore) (interface{}, error) { return s.GetTopImages(maxTopImages) },
+	"orgs":                func(s db.ProjectStore) (interface{}, error) { return s.GetOrgAdoption() },
+	publicDatasetKey:      func(s db.ProjectStore) (interface{}, error) { return computePublicDataset(s) },
+}
+
+// computeStats counts the projects behind /api/stats. Churn, fork and license
+// counts are best effort, as on the dashboard: failures are logged and left zero.
+func computeStats(store db.ProjectStore, excludeForks bool) (dashboardStats, error) {
+	var stats dashboardStats
+	var err error
+	stats.TotalProjects, stats.TotalStars, stats.PopularCount, stats.NotableCount, err = store.GetStats(excludeForks)
+	if err != nil {
+		return stats, err
+	}
+
+	churn, err := store.GetChurnStats()
+	if err != nil {
+		logging.Server.Errorf("Error getting churn stats: %v", err)
+	}
+	stats.RemovedCount, stats.RemovedLast30d = churn.Removed, churn.RemovedLast30Days
+	stats.DeletedCount, stats.ArchivedCount = churn.Deleted, churn.Archived
+
+	forks, err := store.GetForkStats()
+	if err != nil {
+		logging.Server.Errorf("Error getting fork stats: %v", err)
+	}
+	stats.ForkCount, stats.AdoptionCount = forks.Forks, forks.Adoptions
+	if excludeForks {
+		// Without forks every remaining project is its own adoption
+		stats.AdoptionCount = stats.TotalProjects
+	}
+
+	stats.EmployeeCount, err = store.CountProjects(db.ProjectFilter{Status: "active", ExcludeArchived: true, ExcludeForks: excludeForks, Employee: "engaged"})
+	if err != nil {
+		logging.Server.Errorf("Error counting employee-engaged projects: %v", err)
+	}
+
+	stats.Licenses, err = store.GetLicenseCounts()
+	if err != nil {
+		logging.Server.Errorf("Error getting license counts: %v", err)
+	}
+	if stats.Licenses == nil {
+		stats.Licenses = []db.LicenseCount{}
+	}
+	return stats, nil
+}
+
+// computeAggregates recomputes every aggregate from the primary store and
+// replaces the stored set. An aggregate that fails is left out, so its
+// endpoint queries live until the next run.
+func (a *API) computeAggregates() {
+	a.aggregatesMu.Lock()
+	defer a.aggregatesMu.Unlock()
+	// Whatever prompted the recomputation changed the data behind read responses
+	defer a.dataChanged()
+
+	start := time.Now()
+	values := make(map[string][]byte, len(aggregates))
+	for key, compute := range aggregates {
+		v, err := compute(a.db)
+		if err == nil {
+			values[key], err = json.Marshal(v)
+		}
+		if err != nil {
+			logging.Refresh.Errorf("Error computing aggregate %s: %v", key, err)
+			delete(values, key)
+		}
+	}
+	if err := a.db.ReplaceAggregates(values); err != nil {
+		logging.Refresh.Errorf("Error saving aggregates: %v", err)
+		return
+	}
+	logging.Refresh.Infof("Computed %d aggregates in %s", len(values), time.Since(start).Round(time.Millisecond))
+}
+
+// WarmAggregates computes the aggregates in the background, so dashboard reads
+// after a deploy come from the table (and match this version's shapes) without
+// waiting for the next refresh
+func (a *API) WarmAggregates() {
+	go a.computeAggregates()
+}
+
+// readAggregate decodes a stored aggregate into v, reporting false when there
+// is none (or it can't be read) so the caller queries live
+func (a *API) readAggregate(key string, v interface{}) bool {
+	raw, err := a.reader.GetAggregate(key)
+	if err != nil {
+		logging.Server.Errorf("Error reading aggregate %s: %v", key, err)
+		return false
+	}
+	if raw == nil {
+		return false
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		logging.Server.Errorf("Error decoding aggregate %s: %v", key, err)
+		return false
+	}
+	return true
+}
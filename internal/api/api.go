@@ -3,54 +3,232 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"dhi-oss-usage/internal/classify"
 	"dhi-oss-usage/internal/db"
 	"dhi-oss-usage/internal/github"
+	"dhi-oss-usage/internal/gitlab"
+	"dhi-oss-usage/internal/logging"
 	"dhi-oss-usage/internal/notifications"
+	"dhi-oss-usage/internal/publish"
 )
 
 type API struct {
-	db               *db.DB
+	db               db.Store
+	reader           db.Store // used by public GET endpoints; defaults to db
 	ghClient         *github.Client
+	glClient         *gitlab.Client // nil unless GitLab scanning is enabled
 	notificationsSvc *notifications.Service
 	refreshMu        sync.Mutex
 	refreshRunning   bool
+	refreshCtx       context.Context // parent of refresh contexts, cancelled by Shutdown
+	stopRefreshes    context.CancelFunc
+	refreshJobs      sync.WaitGroup // refreshes and other background work Shutdown waits for
+	stopping         bool           // set by Shutdown; no refreshes start after
+	aggregatesMu     sync.Mutex
+	webhooks         webhookActivity
+	blackouts        refreshBlackouts
+	requestTimeout   time.Duration
+	routeTimeouts    map[string]time.Duration
 	nextRefreshFn    func() *time.Time // function to get next scheduled refresh time
+	rescheduleFn     func(spec string) error
+	adminToken       string
+	freshnessSLO     time.Duration // maximum acceptable data age (0 = not tracked)
+	opsAlertConfigs  []string      // notification config names that receive ops alerts
+	tokenMonitor     tokenMonitor
+	statusMonitor    statusMonitor
+	milestoneConfigs []string      // notification config names that receive milestone announcements
+	trashRetention   time.Duration // soft-deleted projects are purged after this (0 = never)
+	publisher        *publish.Publisher
+	v1Sunset         time.Time                // advertised in the Sunset header of v1 responses
+	churnThreshold   int                      // consecutive missed refreshes before a project is marked removed
+	excludeForks     bool                     // default for ?exclude_forks= on /api/stats and /api/projects
+	webhookSecret    string                   // signs GitHub webhook deliveries; webhooks are disabled when empty
+	employeeOrg      string                   // GitHub org whose members' stars and commits flag dogfooding; disabled when empty
+	starImportTop    int                      // most starred adopters whose star history is imported (0 = none)
+	starImportPages  int                      // pages of 100 stargazers read per import
+	classifier       classify.Classifier      // tags projects with their use case
+	archiveRefreshes bool                     // store the full project list after each refresh
+	archiveKeep      int                      // archives kept (0 = all)
+	enrichDisabled   map[string]bool          // enrichment stages turned off by ENRICH_DISABLED
+	enrichBudgets    map[string]time.Duration // time each enrichment stage may take (absent = until the refresh times out)
+	enrichCadences   map[string]time.Duration // how long each enrichment stage waits before running for a project again
+	usage            usageTracker
+	dataGeneration   atomic.Int64      // bumped by dataChanged; part of read endpoint ETags
+	cacheMaxAge      time.Duration     // max-age of cacheable read responses
+	cors             *corsPolicy       // origins allowed to call the API from browsers; nil = same-origin only
+	apiKeys          map[string]string // API key -> consumer name, for usage tracking
+	startedAt        time.Time
 }
 
-func New(database *db.DB, ghClient *github.Client) *API {
+func New(database db.Store, ghClient *github.Client) *API {
+	refreshCtx, stopRefreshes := context.WithCancel(context.Background())
 	return &API{
+		refreshCtx:       refreshCtx,
+		stopRefreshes:    stopRefreshes,
 		db:               database,
+		reader:           database,
 		ghClient:         ghClient,
 		notificationsSvc: notifications.NewService(database),
+		startedAt:        time.Now(),
+		churnThreshold:   3,
+		requestTimeout:   defaultRequestTimeout,
+		enrichCadences:   defaultStageCadences(),
+		classifier:       classify.DefaultRules,
 	}
 }
 
-// RegisterRoutes adds API routes to the mux
 // SetNextRefreshFunc sets a function that returns the next scheduled refresh time
 func (a *API) SetNextRefreshFunc(fn func() *time.Time) {
 	a.nextRefreshFn = fn
 }
 
+// SetReadStore sets a separate (typically read-only) store for public GET
+// endpoints, keeping read traffic away from refresh writes
+func (a *API) SetReadStore(store db.Store) {
+	a.reader = store
+}
+
+// SetRescheduleFunc sets a function that replaces the refresh schedule.
+// An empty spec restores the schedule configured at startup.
+func (a *API) SetRescheduleFunc(fn func(spec string) error) {
+	a.rescheduleFn = fn
+}
+
+// SetChurnThreshold sets how many consecutive refreshes must miss a project
+// before it is marked removed
+func (a *API) SetChurnThreshold(n int) {
+	if n > 0 {
+		a.churnThreshold = n
+	}
+}
+
+// SetNotificationBackpressure limits the new-project messages each
+// notification config gets per refresh; see notifications.Service.SetBackpressure
+func (a *API) SetNotificationBackpressure(maxPerRun, summaryThreshold int) {
+	a.notificationsSvc.SetBackpressure(maxPerRun, summaryThreshold)
+}
+
+// SetNotificationRetries sets how failed deliveries are retried; see
+// notifications.Service.SetRetries
+func (a *API) SetNotificationRetries(maxAttempts int, backoff time.Duration) {
+	a.notificationsSvc.SetRetries(maxAttempts, backoff)
+}
+
+// StartNotificationRetrier sends the due retries of failed deliveries every interval
+func (a *API) StartNotificationRetrier(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := a.notificationsSvc.RetryDue(); err != nil {
+				logging.Notifications.Errorf("Error retrying notifications: %v", err)
+			}
+		}
+	}()
+}
+
+// SetExcludeForks sets whether forks are left out of stats and the project list
+// by default. Requests can override it with ?exclude_forks=true|false.
+func (a *API) SetExcludeForks(exclude bool) {
+	a.excludeForks = exclude
+}
+
+// excludeForksParam reads ?exclude_forks=, falling back to the configured default
+func (a *API) excludeForksParam(r *http.Request) bool {
+	if v, err := strconv.ParseBool(r.URL.Query().Get("exclude_forks")); err == nil {
+		return v
+	}
+	return a.excludeForks
+}
+
+// SetAdminToken sets the bearer token required by /api/admin endpoints.
+// Admin endpoints are disabled when no token is set.
+func (a *API) SetAdminToken(token string) {
+	a.adminToken = token
+}
+
+// RegisterRoutes adds API routes to the mux under /api/v1/, /api/v2/ and the
+// unversioned /api/ prefix (served as v1)
 func (a *API) RegisterRoutes(mux *http.ServeMux) {
-	mux.HandleFunc("/api/projects", a.handleProjects)
-	mux.HandleFunc("/api/projects/new", a.handleNewProjects)
-	mux.HandleFunc("/api/stats", a.handleStats)
-	mux.HandleFunc("/api/source-types", a.handleSourceTypes)
-	mux.HandleFunc("/api/refresh", a.handleRefresh)
-	mux.HandleFunc("/api/refresh/status", a.handleRefreshStatus)
-	mux.HandleFunc("/api/history", a.handleHistory)
+	routes := http.NewServeMux()
+	routes.HandleFunc("/api/projects", a.handleProjects)
+	routes.HandleFunc("/api/projects/new", a.handleNewProjects)
+	routes.HandleFunc("/api/projects/showcase", a.handleShowcase)
+	routes.HandleFunc("/api/projects/export", a.handleProjectsExport)
+	routes.HandleFunc("/api/export/public", a.handlePublicExport)
+	routes.HandleFunc("/api/projects/", a.handleProjectPath) // handles /api/projects/:id, /by-name/:owner/:repo and /:id/avatar, /stars, /links
+	routes.HandleFunc("/api/stats", a.handleStats)
+	routes.HandleFunc("/api/stats/breakdown", a.handleStatsBreakdown)
+	routes.HandleFunc("/api/stats/stars-influenced", a.handleStarsInfluenced)
+	routes.HandleFunc("/api/stats/heatmap", a.handleHeatmap)
+	routes.HandleFunc("/api/source-types", a.handleSourceTypes)
+	routes.HandleFunc("/api/refresh", a.handleRefresh)
+	routes.HandleFunc("/api/refresh/status", a.handleRefreshStatus)
+	routes.HandleFunc("/api/refresh/jobs", a.handleRefreshJobs)
+	routes.HandleFunc("/api/refresh/", a.handleRefreshJob) // handles /api/refresh/:id/report and /archive
+	routes.HandleFunc("/api/sources", a.handleSources)
+	routes.HandleFunc("/api/locales", a.handleLocales)
+	routes.HandleFunc("/api/history", a.handleHistory)
+	routes.HandleFunc("/api/history/snapshots", a.handleHistorySnapshots)
+	routes.HandleFunc("/api/history/source-types", a.handleHistorySourceTypes)
+	routes.HandleFunc("/api/milestones", a.handleMilestones)
+	routes.HandleFunc("/api/images", a.handleImages)
+	routes.HandleFunc("/api/images/top", a.handleImagesTop)
+	routes.HandleFunc("/api/orgs", a.handleOrgs)
+	routes.HandleFunc("/api/openapi.json", a.handleOpenAPI)
 
 	// Notification endpoints
-	mux.HandleFunc("/api/notifications", a.handleNotifications)
-	mux.HandleFunc("/api/notifications/", a.handleNotificationsSingle) // handles /api/notifications/:id paths
+	routes.HandleFunc("/api/notifications", a.handleNotifications)
+	routes.HandleFunc("/api/notifications/", a.handleNotificationsSingle) // handles /api/notifications/:id paths
+	routes.HandleFunc("/api/notifications/test-all", a.handleNotificationsTestAll)
+	routes.HandleFunc("/api/notifications/preview", a.handleNotificationPreview)
+	routes.HandleFunc("/api/notifications/validate", a.handleNotificationValidate)
+	routes.HandleFunc("/api/notifications/providers", a.handleNotificationProviders)
+	routes.HandleFunc("/api/notifications/pending", a.handlePendingMessages)
+	routes.HandleFunc("/api/notifications/pending/", a.handlePendingMessageAction)
+
+	// Inbound webhooks
+	routes.HandleFunc("/api/webhooks/github", a.handleGitHubWebhook)
+
+	// Admin endpoints
+	routes.HandleFunc("/api/admin/apply", a.handleAdminApply)
+	routes.HandleFunc("/api/admin/slo", a.handleAdminSLO)
+	routes.HandleFunc("/api/admin/diagnostics", a.handleAdminDiagnostics)
+	routes.HandleFunc("/api/admin/publish", a.handleAdminPublish)
+	routes.HandleFunc("/api/admin/featured", a.handleAdminFeatured)
+	routes.HandleFunc("/api/admin/attribution", a.handleAdminAttribution)
+	routes.HandleFunc("/api/admin/projects/delete", a.handleAdminProjectsDelete)
+	routes.HandleFunc("/api/admin/projects/restore", a.handleAdminProjectsRestore)
+	routes.HandleFunc("/api/admin/projects/trash", a.handleAdminTrash)
+	routes.HandleFunc("/api/admin/usage", a.handleAdminUsage)
+	routes.HandleFunc("/api/admin/links", a.handleAdminLinks)
+	routes.HandleFunc("/api/admin/links/", a.handleAdminLink) // handles DELETE /api/admin/links/:id
+
+	// Moving data between instances
+	routes.HandleFunc("/api/export", a.handleExport)
+	routes.HandleFunc("/api/import", a.handleImport)
+
+	checkRouteDocs(routes)
+
+	mux.Handle("/api/v1/", a.versioned(apiV1, "/api/v1", routes))
+	mux.Handle("/api/v2/", a.versioned(apiV2, "/api/v2", routes))
+	mux.Handle("/api/", a.versioned(apiV1, "/api", routes))
+
+	// Embeddable badges, outside /api so the URLs stay short in READMEs
+	mux.HandleFunc("/badge.svg", a.handleBadge)
+	mux.HandleFunc("/badge/", a.handleImageBadge)
+
+	// Adoption metrics for Prometheus, at the path scrapers expect
+	mux.HandleFunc("/metrics", a.handleMetrics)
 }
 
 // handleProjects returns list of projects with filtering/sorting
@@ -60,15 +238,116 @@ func (a *API) handleProjects(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	q := r.URL.Query()
+	if asOf := q.Get("as_of"); asOf != "" {
+		a.handleProjectsAsOf(w, r, asOf)
+		return
+	}
+
+	filter, err := a.projectFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// ?fields=repo_full_name,stars returns only those fields of each project
+	fields, err := parseFields(q.Get("fields"), projectFields)
+	if err != nil {
+		http.Error(w, "Invalid 'fields' parameter: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if a.notModified(w, r) {
+		return
+	}
+
+	if apiVersion(r) >= apiV2 {
+		// v2 always pages so the envelope's limit is meaningful
+		if filter.Limit <= 0 {
+			filter.Limit = v2DefaultLimit
+		} else if filter.Limit > v2MaxLimit {
+			filter.Limit = v2MaxLimit
+		}
+	}
+
+	projects, err := a.readerFor(r).ListProjects(filter)
+	if err != nil {
+		logging.Server.Ctx(r.Context()).Errorf("Error listing projects: %v", err)
+		readFailed(w, r)
+		return
+	}
+
+	var items interface{} = projects
+	if fields != nil {
+		if items, err = selectProjectFields(projects, fields); err != nil {
+			logging.Server.Ctx(r.Context()).Errorf("Error selecting project fields: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// v1 keeps the bare array unless ?envelope=true asks for v2's page envelope
+	if apiVersion(r) < apiV2 && q.Get("envelope") != "true" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(items)
+		return
+	}
+
+	total, err := a.readerFor(r).CountProjects(filter)
+	if err != nil {
+		logging.Server.Ctx(r.Context()).Errorf("Error counting projects: %v", err)
+		readFailed(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if projects == nil {
+		items = []interface{}{}
+	}
+	json.NewEncoder(w).Encode(pageEnvelope{Items: items, Total: total, Limit: filter.Limit, Offset: filter.Offset})
+}
+
+// projectFilter reads the /api/projects filter, sort and paging parameters. The
+// error describes an invalid parameter.
+func (a *API) projectFilter(r *http.Request) (db.ProjectFilter, error) {
 	q := r.URL.Query()
 
 	filter := db.ProjectFilter{
 		Search:     q.Get("search"),
 		SourceType: q.Get("source_type"),
+		FileType:   q.Get("file_type"),
+		Provider:   q.Get("provider"),
+		Status:     q.Get("status"),
+		Topic:      q.Get("topic"),
+		License:    q.Get("license"),
+		Featured:   q.Get("featured") == "true",
 		SortBy:     q.Get("sort"),
 		SortOrder:  q.Get("order"),
 	}
 
+	// Removed and deleted projects are hidden unless asked for; status=all lists everything
+	switch filter.Status {
+	case "":
+		filter.Status = "active"
+	case "all":
+		filter.Status = ""
+	case "active", "removed", "deleted":
+	default:
+		return filter, errors.New("Invalid 'status' parameter. Use 'active', 'removed', 'deleted' or 'all'")
+	}
+
+	// Archived repositories are hidden from the active list unless include_archived=true
+	filter.ExcludeArchived = filter.Status == "active" && q.Get("include_archived") != "true"
+	filter.ExcludeForks = a.excludeForksParam(r)
+	filter.Attribution = q.Get("attribution")
+	if filter.UseCase = q.Get("use_case"); filter.UseCase != "" && filter.UseCase != "none" && !classify.IsUseCase(filter.UseCase) {
+		return filter, errors.New("Invalid 'use_case' parameter. Use 'web_service', 'cli', 'ml_pipeline', 'infra' or 'none'")
+	}
+
+	// employee=organic leaves out projects employees starred or contributed to
+	switch filter.Employee = q.Get("employee"); filter.Employee {
+	case "", "engaged", "organic":
+	default:
+		return filter, errors.New("Invalid 'employee' parameter. Use 'engaged' or 'organic'")
+	}
+
 	if minStars := q.Get("min_stars"); minStars != "" {
 		if v, err := strconv.Atoi(minStars); err == nil {
 			filter.MinStars = v
@@ -80,41 +359,105 @@ func (a *API) handleProjects(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 	if limit := q.Get("limit"); limit != "" {
-		if v, err := strconv.Atoi(limit); err == nil {
-			filter.Limit = v
+		v, err := strconv.Atoi(limit)
+		if err != nil || v < 0 {
+			return filter, errors.New("Invalid 'limit' parameter. Use a non-negative number")
 		}
+		filter.Limit = min(v, maxListLimit)
 	}
 	if offset := q.Get("offset"); offset != "" {
-		if v, err := strconv.Atoi(offset); err == nil {
-			filter.Offset = v
+		v, err := strconv.Atoi(offset)
+		if err != nil || v < 0 || v > maxListOffset {
+			return filter, fmt.Errorf("Invalid 'offset' parameter. Use a number from 0 to %d", maxListOffset)
 		}
+		filter.Offset = v
 	}
+	return filter, nil
+}
 
-	projects, err := a.db.ListProjects(filter)
+// handleProjectPath routes /api/projects/:id, /api/projects/by-name/:owner/:repo
+// and /api/projects/:id/... requests
+func (a *API) handleProjectPath(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, "/api/projects/")
+	// The rest of the path is the whole name, as GitLab paths can have more segments
+	if name, ok := strings.CutPrefix(rest, "by-name/"); ok {
+		project, err := a.readerFor(r).GetProjectByName(name)
+		if err != nil {
+			logging.Server.Ctx(r.Context()).Errorf("Error getting project %s: %v", name, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		a.handleProjectDetail(w, r, project)
+		return
+	}
+
+	parts := strings.Split(rest, "/")
+	if len(parts) > 2 {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	id, err := strconv.ParseInt(parts[0], 10, 64)
 	if err != nil {
-		log.Printf("Error listing projects: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		http.Error(w, "Invalid project ID", http.StatusBadRequest)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(projects)
+	if len(parts) == 1 {
+		project, err := a.readerFor(r).GetProject(id)
+		if err != nil {
+			logging.Server.Ctx(r.Context()).Errorf("Error getting project %d: %v", id, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		a.handleProjectDetail(w, r, project)
+		return
+	}
+
+	switch parts[1] {
+	case "avatar":
+		a.handleProjectAvatar(w, r, id)
+	case "stars":
+		a.handleProjectStars(w, r, id)
+	case "links":
+		a.handleProjectLinks(w, r, id)
+	default:
+		http.Error(w, "Not found", http.StatusNotFound)
+	}
 }
 
-// handleSourceTypes returns list of distinct source types
+// handleSourceTypes returns list of distinct source types, or with ?dimension=file_type
+// the distinct file types (dockerfile, compose, helm, ...) and with ?dimension=provider
+// the code hosts (github, gitlab)
 func (a *API) handleSourceTypes(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	types, err := a.db.GetSourceTypes()
-	if err != nil {
-		log.Printf("Error getting source types: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	var key string
+	var live func() ([]string, error)
+	switch r.URL.Query().Get("dimension") {
+	case "", "source_type":
+		key, live = "source_types", a.readerFor(r).GetSourceTypes
+	case "file_type":
+		key, live = "file_types", a.readerFor(r).GetFileTypes
+	case "provider":
+		key, live = "providers", a.readerFor(r).GetProviders
+	default:
+		http.Error(w, "dimension must be 'source_type', 'file_type' or 'provider'", http.StatusBadRequest)
 		return
 	}
 
+	var types []string
+	if !a.readAggregate(key, &types) {
+		var err error
+		if types, err = live(); err != nil {
+			logging.Server.Ctx(r.Context()).Errorf("Error getting source types: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(types)
 }
@@ -126,29 +469,39 @@ func (a *API) handleStats(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	total, totalStars, popular, notable, err := a.db.GetStats()
-	if err != nil {
-		log.Printf("Error getting stats: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	// new_this_week starts over each Monday even if nothing else changes
+	weekStart := publish.StartOfWeek(time.Now())
+	if a.notModified(w, r, weekStart.Format("2006-01-02")) {
 		return
 	}
 
+	excludeForks := a.excludeForksParam(r)
+	key := "stats"
+	if excludeForks {
+		key = "stats:exclude_forks"
+	}
+	var stats dashboardStats
+	if !a.readAggregate(key, &stats) {
+		var err error
+		if stats, err = computeStats(a.readerFor(r), excludeForks); err != nil {
+			logging.Server.Ctx(r.Context()).Errorf("Error getting stats: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
 	// Get count of new projects this week (current calendar week, Monday-Sunday)
-	weekStart := startOfWeek(time.Now())
-	newThisWeek, err := a.db.GetNewProjectsCount(weekStart)
+	newThisWeek, err := a.readerFor(r).GetNewProjectsCount(weekStart)
 	if err != nil {
-		log.Printf("Error getting new projects count: %v", err)
+		logging.Server.Ctx(r.Context()).Errorf("Error getting new projects count: %v", err)
 		newThisWeek = 0 // Don't fail the whole request
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]int{
-		"total_projects":  total,
-		"total_stars":     totalStars,
-		"popular_count":   popular,
-		"notable_count":   notable,
-		"new_this_week":   newThisWeek,
-	})
+	json.NewEncoder(w).Encode(struct {
+		dashboardStats
+		NewThisWeek int `json:"new_this_week"`
+	}{stats, newThisWeek})
 }
 
 // handleRefresh triggers an async refresh
@@ -158,33 +511,50 @@ func (a *API) handleRefresh(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// ?sample=50 ingests only that many search results, as a quick pipeline check
+	sample := 0
+	if v := r.URL.Query().Get("sample"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxRefreshSample {
+			http.Error(w, fmt.Sprintf("Invalid 'sample' parameter. Use a number from 1 to %d", maxRefreshSample), http.StatusBadRequest)
+			return
+		}
+		sample = n
+	}
+
 	// Check if refresh is already running
 	a.refreshMu.Lock()
-	if a.refreshRunning {
+	if a.refreshRunning || a.stopping {
 		a.refreshMu.Unlock()
+		message := "Refresh already in progress"
+		if a.stopping {
+			message = "Server is shutting down"
+		}
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"success": false,
-			"message": "Refresh already in progress",
+			"message": message,
 		})
 		return
 	}
 	a.refreshRunning = true
+	a.refreshJobs.Add(1)
 	a.refreshMu.Unlock()
 
 	// Create job record
 	jobID, err := a.db.CreateRefreshJob()
 	if err != nil {
-		log.Printf("Error creating refresh job: %v", err)
+		logging.Server.Ctx(r.Context()).Errorf("Error creating refresh job: %v", err)
 		a.refreshMu.Lock()
 		a.refreshRunning = false
 		a.refreshMu.Unlock()
+		a.refreshJobs.Done()
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
 	// Start async refresh
-	go a.runRefresh(jobID, "manual")
+	go a.runRefresh(jobID, "manual", sample, logging.RequestID(r.Context()))
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -194,34 +564,114 @@ func (a *API) handleRefresh(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func (a *API) runRefresh(jobID int64, source string) {
+// maxRefreshSample bounds ?sample= on POST /api/refresh
+const maxRefreshSample = 500
+
+// runRefresh runs a refresh job. A positive sample ingests only that many
+// GitHub search results: projects are upserted, dated and scanned for images,
+// but nothing is churned, snapshotted or announced, since the sample doesn't
+// represent the tracked set.
+func (a *API) runRefresh(jobID int64, source string, sample int, requestID string) {
+	defer a.refreshJobs.Done()
 	defer func() {
 		a.refreshMu.Lock()
 		a.refreshRunning = false
 		a.refreshMu.Unlock()
 	}()
 
-	log.Printf("Starting refresh job %d (source: %s)", jobID, source)
+	// Every line about the job carries its ID, and the ID of the request that started it
+	logAttrs := []any{"job_id", jobID}
+	if requestID != "" {
+		logAttrs = append(logAttrs, "request_id", requestID)
+	}
+	logger := logging.Refresh.With(logAttrs...)
+	logger.Infof("Starting refresh job %d (source: %s)", jobID, source)
 
 	if err := a.db.StartRefreshJob(jobID); err != nil {
-		log.Printf("Error starting job: %v", err)
+		logger.Errorf("Error starting job: %v", err)
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	report := newRefreshReport(jobID, source, a.ghClient)
+	report.Sample = sample
+	report.RequestID = requestID
+	progress := newRefreshProgress(logging.With(a.refreshCtx, logAttrs...), a, jobID, report)
+	status := "failed"
+	defer func() {
+		if report.FailureCode == failureInterrupted {
+			status = "interrupted"
+		}
+		progress.finish(status == "completed")
+		if degraded := a.degradedDuring(report.StartedAt, time.Now()); len(degraded) > 0 {
+			report.GitHubStatus = degraded
+			logger.Warnf("GitHub %s was degraded during job %d (%s); results may be incomplete", github.APIComponent, jobID, degraded[len(degraded)-1].Status)
+		}
+		data, err := report.finish(status, a.ghClient)
+		if err == nil {
+			err = a.db.SaveRefreshReport(jobID, data)
+		}
+		if err == nil {
+			err = a.db.SaveRefreshErrorCounts(jobID, report.Errors)
+		}
+		if err != nil {
+			logger.Errorf("Error saving report for job %d: %v", jobID, err)
+		}
+		if status == "failed" {
+			a.dispatch(notifications.Event{
+				Type: notifications.EventRefreshFailed,
+				Data: map[string]interface{}{"job_id": jobID, "source": source, "error": report.ErrorMessage, "failure_code": report.FailureCode},
+			})
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(logging.With(a.refreshCtx, logAttrs...), 10*time.Minute)
 	defer cancel()
 
-	projects, err := a.ghClient.FetchAllProjects(ctx, nil)
+	// Projects found by this run's search have last_seen_at at or after this time
+	refreshStart := time.Now().UTC().Truncate(time.Second)
+
+	// Snapshot the tracked set before the refresh for the report's diff
+	existing, err := a.db.ListProjects(db.ProjectFilter{Deleted: "include"})
+	if err != nil {
+		logger.Errorf("Error listing projects for report: %v", err)
+	}
+	known := make(map[string]bool, len(existing))
+	for _, p := range existing {
+		known[p.RepoFullName] = true
+		if p.Status == "active" && !p.Archived && p.DeletedAt == nil {
+			report.Diff.TotalBefore++
+			report.Diff.StarsBefore += p.Stars
+		}
+	}
+
+	var projects []github.Project
+	var stats *github.FetchStats
+	if sample > 0 {
+		projects, stats, err = a.ghClient.FetchSampleProjects(ctx, sample, progress.fetch)
+	} else {
+		projects, stats, err = a.ghClient.FetchAllProjects(ctx, progress.fetch)
+	}
+	if stats != nil {
+		report.count("search", "repos_discovered", stats.ReposDiscovered)
+		report.count("search", "topic_repos", stats.TopicRepos)
+		report.count("search", "topic_errors", stats.TopicErrors)
+		report.count("details", "fetched", stats.DetailsFetched)
+		report.count("details", "failed", stats.DetailsFailed)
+		report.count("details", "graphql_batches", stats.GraphQLBatches)
+		report.count("details", "rest_fallbacks", stats.RESTFallbacks)
+		report.addErrors(stats.Errors)
+	}
 	if err != nil {
-		log.Printf("Error fetching projects: %v", err)
-		a.db.FailRefreshJob(jobID, err.Error())
+		logger.Errorf("Error fetching projects: %v", err)
+		a.failRefresh(jobID, report, err)
 		return
 	}
 
-	// Upsert all projects
+	discovered := make([]db.Project, 0, len(projects))
 	for _, p := range projects {
-		dbProject := &db.Project{
+		discovered = append(discovered, db.Project{
 			RepoFullName:    p.RepoFullName,
+			Provider:        "github",
 			GitHubURL:       p.GitHubURL,
 			Stars:           p.Stars,
 			Description:     p.Description,
@@ -229,119 +679,291 @@ func (a *API) runRefresh(jobID int64, source string) {
 			DockerfilePath:  p.DockerfilePath,
 			FileURL:         p.FileURL,
 			SourceType:      p.SourceType,
+			FileType:        p.FileType,
+			Archived:        p.Archived,
+			Fork:            p.Fork,
+			ForkParent:      p.ForkParent,
+			License:         p.License,
+			Topics:          p.Topics,
+		})
+	}
+	// Providers whose search results are complete; only these can churn projects,
+	// so a partial failure doesn't count as every missing repo removing DHI
+	complete := map[string]bool{"github": sample == 0 && stats != nil && stats.DetailsFailed == 0 && stats.TopicErrors == 0}
+	if a.glClient != nil && sample == 0 {
+		progress.phase("gitlab")
+		glProjects, glComplete := a.fetchGitLabProjects(ctx, report)
+		discovered = append(discovered, glProjects...)
+		progress.addDiscovered(len(glProjects))
+		complete["gitlab"] = glComplete
+	}
+
+	// Upsert all projects
+	progress.phase("saving")
+	found := make(map[string]bool, len(discovered))
+	var upsertErr error
+	upserted := 0
+	for i := range discovered {
+		// Stop between writes on shutdown; the projects not yet seen mustn't be churned
+		if a.interrupted() {
+			logger.Warnf("Refresh job %d interrupted after saving %d of %d projects", jobID, upserted, len(discovered))
+			a.failRefresh(jobID, report, errInterrupted)
+			return
+		}
+		p := &discovered[i]
+		found[p.RepoFullName] = true
+		if err := a.db.UpsertProject(p); err != nil {
+			logger.Errorf("Error upserting project %s: %v", p.RepoFullName, err)
+			report.count("upsert", "failed", 1)
+			report.countError("database")
+			upsertErr = err
+			continue
 		}
-		if err := a.db.UpsertProject(dbProject); err != nil {
-			log.Printf("Error upserting project %s: %v", p.RepoFullName, err)
+		upserted++
+		if known[p.RepoFullName] {
+			report.count("upsert", "updated", 1)
+		} else {
+			report.count("upsert", "inserted", 1)
+			report.Diff.NewProjects = append(report.Diff.NewProjects, p.RepoFullName)
 		}
 	}
 
-	if err := a.db.CompleteRefreshJob(jobID, len(projects)); err != nil {
-		log.Printf("Error completing job: %v", err)
+	// Nothing saved: the database is unusable, and churning would remove everything
+	if upserted == 0 && upsertErr != nil {
+		a.failRefresh(jobID, report, &databaseError{fmt.Errorf("saving projects: %w", upsertErr)})
+		return
 	}
 
-	// Fetch adoption dates for projects that don't have them
-	a.fetchAdoptionDates(ctx)
+	// Projects no longer tracked, announced once the job is complete
+	var gone []db.Project
+
+	// Search hits whose repository is gone (the code search index lags deletions)
+	if stats != nil {
+		for _, name := range stats.NotFound {
+			found[name] = true
+			deleted, err := a.db.MarkProjectDeleted(name)
+			if err != nil {
+				logger.Errorf("Error marking %s deleted: %v", name, err)
+				report.countError("database")
+				continue
+			}
+			if deleted {
+				logger.Infof("Marked %s deleted: repository no longer exists", name)
+				report.Diff.Deleted = append(report.Diff.Deleted, name)
+				for _, p := range existing {
+					if p.RepoFullName == name && p.DeletedAt == nil {
+						p.Status = "deleted"
+						gone = append(gone, p)
+					}
+				}
+			}
+		}
+	}
+
+	for _, p := range existing {
+		if found[p.RepoFullName] {
+			continue
+		}
+		report.Diff.NotSeenCount++
+		if p.Status != "active" || p.DeletedAt != nil || !complete[p.Provider] {
+			continue
+		}
+		removed, err := a.db.MarkProjectMissed(p.ID, a.churnThreshold)
+		if err != nil {
+			logger.Errorf("Error recording missed project %s: %v", p.RepoFullName, err)
+			report.countError("database")
+			continue
+		}
+		if removed {
+			logger.Infof("Marked %s removed after %d refreshes without DHI", p.RepoFullName, a.churnThreshold)
+			report.Diff.Removed = append(report.Diff.Removed, p.RepoFullName)
+			p.Status = "removed"
+			gone = append(gone, p)
+		}
+	}
+
+	if err := a.db.CompleteRefreshJob(jobID, len(discovered), sample); err != nil {
+		logger.Errorf("Error completing job: %v", err)
+	}
+	status = "completed"
+
+	for i := range gone {
+		a.dispatch(notifications.Event{Type: notifications.EventProjectRemoved, Project: &gone[i]})
+	}
+
+	// Adoption dates, DHI images, commit activity and employee engagement
+	a.runEnrichment(ctx, &enrichRun{seenSince: refreshStart, sample: sample > 0, report: report, progress: progress})
+
+	if sample > 0 {
+		a.computeAggregates()
+		logger.Infof("Sample refresh job %d completed (source: %s): %d projects", jobID, source, len(discovered))
+		return
+	}
 
 	// Get new projects from this week to notify about
-	weekStart := startOfWeek(time.Now())
+	progress.phase("notifying")
+	weekStart := publish.StartOfWeek(time.Now())
 	newProjects, err := a.db.GetNewProjectsSince(weekStart)
 	if err != nil {
-		log.Printf("Error getting new projects for notification: %v", err)
+		logger.Errorf("Error getting new projects for notification: %v", err)
 	} else if len(newProjects) > 0 {
-		log.Printf("Sending notifications for %d new projects", len(newProjects))
-		if err := a.notificationsSvc.NotifyNewProjects(newProjects); err != nil {
-			log.Printf("Error sending notifications: %v", err)
+		logger.Infof("Sending notifications for %d new projects", len(newProjects))
+		report.count("notifications", "new_this_week", len(newProjects))
+		if err := a.notificationsSvc.WithContext(ctx).NotifyNewProjects(newProjects); err != nil {
+			logger.Errorf("Error sending notifications: %v", err)
+			report.count("notifications", "failed", 1)
 		}
 	}
 
 	// Record snapshot for historical tracking
-	if err := a.db.RecordSnapshot(); err != nil {
-		log.Printf("Error recording snapshot: %v", err)
+	progress.phase("snapshot")
+	if milestones, err := a.db.RecordSnapshot(); err != nil {
+		logger.Errorf("Error recording snapshot: %v", err)
 	} else {
-		log.Printf("Recorded snapshot after refresh")
+		logger.Infof("Recorded snapshot after refresh")
+		a.celebrateMilestones(milestones)
+	}
+
+	// Full project list for point-in-time reconstruction
+	if a.archiveRefreshes {
+		a.archiveRefresh(jobID)
+	}
+
+	// Dashboard endpoints serve these instead of aggregating on every request
+	a.computeAggregates()
+
+	total, totalStars, _, _, err := a.db.GetStats(false)
+	if err == nil {
+		report.Diff.TotalAfter = total
+		report.Diff.StarsAfter = totalStars
 	}
 
-	log.Printf("Refresh job %d completed (source: %s): %d projects", jobID, source, len(projects))
+	logger.Infof("Refresh job %d completed (source: %s): %d projects", jobID, source, len(discovered))
+
+	// Warm the avatar cache for the dashboard without holding up the job
+	a.background(a.prefetchAvatars)
 }
 
-// fetchAdoptionDates fetches adoption dates for projects that don't have them
-func (a *API) fetchAdoptionDates(ctx context.Context) {
-	projects, err := a.db.GetProjectsWithoutAdoptionDate()
+// fetchAdoptionDates fetches adoption dates for projects that don't have them.
+// Lookups run on the GitHub client's worker pool and share its rate limiter.
+// Projects not found by the search since seenSince are unverified and skipped,
+// so rate limit isn't spent on repos that may have dropped DHI.
+func (a *API) fetchAdoptionDates(ctx context.Context, seenSince time.Time, report *refreshReport) {
+	candidates, err := a.db.GetProjectsWithoutAdoptionDate()
 	if err != nil {
-		log.Printf("Error getting projects without adoption date: %v", err)
+		logging.Refresh.Ctx(ctx).Errorf("Error getting projects without adoption date: %v", err)
 		return
 	}
+	candidates = a.dueProjects(ctx, "adoption", candidates, report)
 
-	if len(projects) == 0 {
-		log.Printf("All projects have adoption dates")
-		return
+	var projects, gitlabProjects []db.Project
+	for _, p := range candidates {
+		if p.LastSeenAt.Before(seenSince) {
+			continue
+		}
+		if p.Provider == "gitlab" {
+			if a.glClient != nil {
+				gitlabProjects = append(gitlabProjects, p)
+			}
+			continue
+		}
+		projects = append(projects, p)
+	}
+	report.count("adoption", "candidates", len(candidates))
+	if skipped := len(candidates) - len(projects) - len(gitlabProjects); skipped > 0 {
+		report.count("adoption", "skipped_unverified", skipped)
+		logging.Refresh.Ctx(ctx).Infof("Skipping adoption dates for %d projects not found by this refresh", skipped)
 	}
 
-	log.Printf("Fetching adoption dates for %d projects...", len(projects))
+	if len(projects) == 0 && len(gitlabProjects) == 0 {
+		logging.Refresh.Ctx(ctx).Infof("All projects have adoption dates")
+		return
+	}
 
-	for i, p := range projects {
-		select {
-		case <-ctx.Done():
-			log.Printf("Context cancelled, stopping adoption date fetch")
-			return
-		default:
-		}
+	logging.Refresh.Ctx(ctx).Infof("Fetching adoption dates for %d projects...", len(projects)+len(gitlabProjects))
 
-		log.Printf("Fetching adoption info for %s (%d/%d)", p.RepoFullName, i+1, len(projects))
+	var done int64
+	a.ghClient.Parallel(ctx, len(projects), func(i int) {
+		p := projects[i]
 
 		adoptionInfo, err := a.ghClient.GetFileFirstCommit(ctx, p.RepoFullName, p.DockerfilePath)
-		if err != nil {
-			log.Printf("Error getting adoption info for %s: %v", p.RepoFullName, err)
-			// If rate limited, wait and retry
-			if strings.Contains(err.Error(), "rate limited") {
-				log.Printf("Rate limited, waiting 60s...")
-				time.Sleep(60 * time.Second)
-				adoptionInfo, err = a.ghClient.GetFileFirstCommit(ctx, p.RepoFullName, p.DockerfilePath)
-				if err != nil {
-					log.Printf("Retry failed for %s: %v", p.RepoFullName, err)
-					continue
-				}
-			} else {
-				continue
+		if err != nil && strings.Contains(err.Error(), "rate limited") {
+			// The client has paused all workers; retry once the backoff expires
+			logging.Refresh.Ctx(ctx).Warnf("Rate limited fetching adoption info for %s, retrying", p.RepoFullName)
+			adoptionInfo, err = a.ghClient.GetFileFirstCommit(ctx, p.RepoFullName, p.DockerfilePath)
+		}
+		n := atomic.AddInt64(&done, 1)
+		if !transient(err) {
+			a.recordStageRun(ctx, "adoption", p.ID)
+		}
+		if errors.Is(err, github.ErrFileNotFound) {
+			logging.Refresh.Ctx(ctx).Infof("Adoption file for %s no longer exists (%d/%d), marking unverified", p.RepoFullName, n, len(projects))
+			report.count("adoption", "file_missing", 1)
+			if err := a.db.SetProjectVerification(p.ID, "file_missing"); err != nil {
+				logging.Refresh.Ctx(ctx).Errorf("Error updating verification for %s: %v", p.RepoFullName, err)
 			}
+			return
+		}
+		if err != nil {
+			logging.Refresh.Ctx(ctx).Errorf("Error getting adoption info for %s (%d/%d): %v", p.RepoFullName, n, len(projects), err)
+			report.count("adoption", "failed", 1)
+			report.addError(err)
+			return
 		}
 
 		if err := a.db.UpdateProjectAdoption(p.ID, adoptionInfo.Date, adoptionInfo.CommitURL); err != nil {
-			log.Printf("Error updating adoption info for %s: %v", p.RepoFullName, err)
+			logging.Refresh.Ctx(ctx).Errorf("Error updating adoption info for %s: %v", p.RepoFullName, err)
+			report.count("adoption", "failed", 1)
 		} else {
-			log.Printf("Set adoption for %s: %s (%s)", p.RepoFullName, adoptionInfo.Date.Format("2006-01-02"), adoptionInfo.CommitURL)
+			report.count("adoption", "dated", 1)
+			logging.Refresh.Ctx(ctx).Debugf("Set adoption for %s (%d/%d): %s (%s)", p.RepoFullName, n, len(projects), adoptionInfo.Date.Format("2006-01-02"), adoptionInfo.CommitURL)
 		}
-
-		// Rate limit: commits API is part of the 5000/hr limit
-		time.Sleep(500 * time.Millisecond)
+	})
+	if len(gitlabProjects) > 0 {
+		a.fetchGitLabAdoptionDates(ctx, gitlabProjects, report)
 	}
 
-	log.Printf("Finished fetching adoption dates")
+	if ctx.Err() != nil {
+		logging.Refresh.Ctx(ctx).Warnf("Context cancelled, stopped adoption date fetch")
+		return
+	}
+	logging.Refresh.Ctx(ctx).Infof("Finished fetching adoption dates")
 }
 
-// TriggerRefresh starts a refresh if one isn't already running.
+// TriggerRefresh starts a refresh if one isn't already running and no
+// refresh blackout is in effect (see SetRefreshBlackouts).
 // Returns true if a refresh was started, false if one was already running.
 // This is used by the scheduler for automated refreshes.
 func (a *API) TriggerRefresh(source string) bool {
+	if a.deferForBlackout(source, time.Time{}) {
+		return false
+	}
+	return a.startRefresh(source)
+}
+
+// startRefresh starts a refresh if one isn't already running
+func (a *API) startRefresh(source string) bool {
 	a.refreshMu.Lock()
-	if a.refreshRunning {
+	if a.refreshRunning || a.stopping {
 		a.refreshMu.Unlock()
-		log.Printf("Skipping %s refresh: already running", source)
+		logging.Refresh.Infof("Skipping %s refresh: already running or shutting down", source)
 		return false
 	}
 	a.refreshRunning = true
+	a.refreshJobs.Add(1)
 	a.refreshMu.Unlock()
 
 	jobID, err := a.db.CreateRefreshJob()
 	if err != nil {
-		log.Printf("Error creating refresh job for %s refresh: %v", source, err)
+		logging.Refresh.Errorf("Error creating refresh job for %s refresh: %v", source, err)
 		a.refreshMu.Lock()
 		a.refreshRunning = false
 		a.refreshMu.Unlock()
+		a.refreshJobs.Done()
 		return false
 	}
 
-	go a.runRefresh(jobID, source)
+	go a.runRefresh(jobID, source, 0, "")
 	return true
 }
 
@@ -369,16 +991,24 @@ func (a *API) handleHistory(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	adoptions, err := a.db.GetAdoptionByDate(days)
+	store := a.readerFor(r)
+	adoptions, err := store.GetAdoptionByDate(days)
 	if err != nil {
-		log.Printf("Error getting adoption history: %v", err)
+		logging.Server.Ctx(r.Context()).Errorf("Error getting adoption history: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	annotations, err := milestoneAnnotations(store, days)
+	if err != nil {
+		logging.Server.Ctx(r.Context()).Errorf("Error getting milestones: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"adoptions": adoptions,
+		"adoptions":   adoptions,
+		"annotations": annotations,
 	})
 }
 
@@ -397,7 +1027,7 @@ func (a *API) handleNewProjects(w http.ResponseWriter, r *http.Request) {
 
 	var since time.Time
 	if sinceStr == "thisweek" {
-		since = startOfWeek(time.Now())
+		since = publish.StartOfWeek(time.Now())
 	} else {
 		duration, err := parseDuration(sinceStr)
 		if err != nil {
@@ -406,9 +1036,9 @@ func (a *API) handleNewProjects(w http.ResponseWriter, r *http.Request) {
 		}
 		since = time.Now().Add(-duration)
 	}
-	projects, err := a.db.GetNewProjectsSince(since)
+	projects, err := a.readerFor(r).GetNewProjectsSince(since)
 	if err != nil {
-		log.Printf("Error getting new projects: %v", err)
+		logging.Server.Ctx(r.Context()).Errorf("Error getting new projects: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
@@ -417,20 +1047,37 @@ func (a *API) handleNewProjects(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(projects)
 }
 
-// parseDuration parses a duration string like "7d", "1w", "30d"
-// startOfWeek returns the start of the current week (Monday 00:00:00 UTC)
-func startOfWeek(t time.Time) time.Time {
-	t = t.UTC()
-	weekday := int(t.Weekday())
-	if weekday == 0 {
-		weekday = 7 // Sunday is 7, not 0
+// dispatch sends an event to the webhooks subscribed to it in the background,
+// so slow receivers don't hold up the caller. Once the server is shutting
+// down it sends inline instead, as the background work would not be waited for.
+func (a *API) dispatch(event notifications.Event) {
+	send := func() {
+		if err := a.notificationsSvc.Dispatch(event); err != nil {
+			logging.Refresh.Errorf("Error dispatching %s: %v", event.Type, err)
+		}
+	}
+	if !a.background(send) {
+		send()
 	}
-	// Go back to Monday
-	monday := t.AddDate(0, 0, -(weekday - 1))
-	// Return start of that day
-	return time.Date(monday.Year(), monday.Month(), monday.Day(), 0, 0, 0, 0, time.UTC)
 }
 
+// background runs fn in a goroutine that Shutdown waits for. It reports false
+// without running fn once the server is shutting down.
+func (a *API) background(fn func()) bool {
+	a.refreshMu.Lock()
+	defer a.refreshMu.Unlock()
+	if a.stopping {
+		return false
+	}
+	a.refreshJobs.Add(1)
+	go func() {
+		defer a.refreshJobs.Done()
+		fn()
+	}()
+	return true
+}
+
+// parseDuration parses a duration string like "7d", "1w", "30d"
 func parseDuration(s string) (time.Duration, error) {
 	if len(s) < 2 {
 		return 0, fmt.Errorf("invalid duration: %s", s)
@@ -468,7 +1115,7 @@ func (a *API) handleRefreshStatus(w http.ResponseWriter, r *http.Request) {
 
 	job, err := a.db.GetLatestRefreshJob()
 	if err != nil {
-		log.Printf("Error getting refresh status: %v", err)
+		logging.Server.Ctx(r.Context()).Errorf("Error getting refresh status: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
@@ -481,6 +1128,17 @@ func (a *API) handleRefreshStatus(w http.ResponseWriter, r *http.Request) {
 		response["last_job"] = job
 	}
 
+	// How the GitHub client authenticates: app, tokens, token or none
+	response["github_auth"] = a.ghClient.AuthMode()
+	if tokens := a.ghClient.TokenStatuses(); tokens != nil {
+		response["github_tokens"] = tokens
+	}
+
+	// Remaining GitHub quota as of the last API response, keyed by resource
+	if quotas := a.ghClient.RateLimits(); len(quotas) > 0 {
+		response["rate_limits"] = quotas
+	}
+
 	// Add next scheduled refresh time if available
 	if a.nextRefreshFn != nil {
 		if nextTime := a.nextRefreshFn(); nextTime != nil {
@@ -532,6 +1190,24 @@ func (a *API) handleNotificationsSingle(w http.ResponseWriter, r *http.Request)
 		case "logs":
 			a.getNotificationLogs(w, r, id)
 			return
+		case "preview":
+			a.previewNotification(w, r, id)
+			return
+		case "redeliver":
+			if len(parts) != 3 {
+				http.Error(w, "Log ID required", http.StatusBadRequest)
+				return
+			}
+			logID, err := strconv.ParseInt(parts[2], 10, 64)
+			if err != nil {
+				http.Error(w, "Invalid log ID", http.StatusBadRequest)
+				return
+			}
+			a.redeliverNotification(w, r, id, logID)
+			return
+		case "resend":
+			a.resendNotification(w, r, id)
+			return
 		default:
 			http.Error(w, "Unknown action", http.StatusNotFound)
 			return
@@ -554,15 +1230,23 @@ func (a *API) handleNotificationsSingle(w http.ResponseWriter, r *http.Request)
 func (a *API) listNotifications(w http.ResponseWriter, r *http.Request) {
 	configs, err := a.db.ListNotificationConfigs()
 	if err != nil {
-		log.Printf("Error listing notification configs: %v", err)
+		logging.Server.Ctx(r.Context()).Errorf("Error listing notification configs: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
+	for i := range configs {
+		redactNotificationConfig(&configs[i])
+	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(configs)
 }
 
+// redactNotificationConfig masks secrets in a config before it is returned
+func redactNotificationConfig(config *db.NotificationConfig) {
+	config.ConfigJSON = notifications.RedactConfig(config.Type, config.ConfigJSON)
+}
+
 func (a *API) createNotification(w http.ResponseWriter, r *http.Request) {
 	var config db.NotificationConfig
 	if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
@@ -570,58 +1254,41 @@ func (a *API) createNotification(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Validate required fields
-	if config.Name == "" || config.Type == "" || config.ConfigJSON == "" {
-		http.Error(w, "name, type, and config_json are required", http.StatusBadRequest)
+	if err := validateNotificationConfig(&config); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Validate type
-	if config.Type != "slack" && config.Type != "email" {
-		http.Error(w, "type must be 'slack' or 'email'", http.StatusBadRequest)
-		return
-	}
-
-	// Validate config by trying to create a provider
-	if config.Type == "slack" {
-		var slackConfig notifications.SlackConfig
-		if err := json.Unmarshal([]byte(config.ConfigJSON), &slackConfig); err != nil {
-			http.Error(w, fmt.Sprintf("Invalid slack config: %v", err), http.StatusBadRequest)
-			return
-		}
-		if slackConfig.WebhookURL == "" {
-			http.Error(w, "webhook_url is required for Slack notifications", http.StatusBadRequest)
-			return
-		}
-	} else if config.Type == "email" {
-		var emailConfig notifications.EmailConfig
-		if err := json.Unmarshal([]byte(config.ConfigJSON), &emailConfig); err != nil {
-			http.Error(w, fmt.Sprintf("Invalid email config: %v", err), http.StatusBadRequest)
-			return
-		}
-		if emailConfig.To == "" {
-			http.Error(w, "to (recipient email) is required for email notifications", http.StatusBadRequest)
-			return
-		}
-	}
-
 	id, err := a.db.CreateNotificationConfig(&config)
 	if err != nil {
-		log.Printf("Error creating notification config: %v", err)
+		logging.Server.Ctx(r.Context()).Errorf("Error creating notification config: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
 	config.ID = id
+	config.Version = 1
+	redactNotificationConfig(&config)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(config)
 }
 
+// validateNotificationConfig checks required fields and validates config_json
+// against the provider's JSON Schema
+func validateNotificationConfig(config *db.NotificationConfig) error {
+	// Validate required fields
+	if config.Name == "" || config.Type == "" || config.ConfigJSON == "" {
+		return fmt.Errorf("name, type, and config_json are required")
+	}
+
+	return notifications.ValidateConfig(config.Type, config.ConfigJSON)
+}
+
 func (a *API) getNotification(w http.ResponseWriter, r *http.Request, id int64) {
 	config, err := a.db.GetNotificationConfig(id)
 	if err != nil {
-		log.Printf("Error getting notification config: %v", err)
+		logging.Server.Ctx(r.Context()).Errorf("Error getting notification config: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
@@ -630,10 +1297,16 @@ func (a *API) getNotification(w http.ResponseWriter, r *http.Request, id int64)
 		return
 	}
 
+	redactNotificationConfig(config)
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", versionETag(config.Version))
 	json.NewEncoder(w).Encode(config)
 }
 
+// updateNotification replaces a config. The expected version comes from an If-Match
+// header or the body's version field; if it no longer matches, another update won
+// and the request fails with 409 instead of overwriting it. Requests with neither
+// are applied unconditionally.
 func (a *API) updateNotification(w http.ResponseWriter, r *http.Request, id int64) {
 	var config db.NotificationConfig
 	if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
@@ -643,31 +1316,76 @@ func (a *API) updateNotification(w http.ResponseWriter, r *http.Request, id int6
 
 	config.ID = id
 
-	// Validate required fields
-	if config.Name == "" || config.Type == "" || config.ConfigJSON == "" {
-		http.Error(w, "name, type, and config_json are required", http.StatusBadRequest)
+	expected := config.Version
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+		v, ok := parseVersionETag(ifMatch)
+		if !ok {
+			http.Error(w, "Invalid If-Match header", http.StatusBadRequest)
+			return
+		}
+		expected = v
+	}
+
+	current, err := a.db.GetNotificationConfig(id)
+	if err != nil {
+		logging.Server.Ctx(r.Context()).Errorf("Error getting notification config: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if current == nil {
+		http.Error(w, "Notification config not found", http.StatusNotFound)
 		return
 	}
 
-	// Validate type
-	if config.Type != "slack" && config.Type != "email" {
-		http.Error(w, "type must be 'slack' or 'email'", http.StatusBadRequest)
+	// A config read back from the API carries a masked secret; keep the stored one
+	config.ConfigJSON = notifications.RestoreSecret(config.Type, config.ConfigJSON, current.ConfigJSON)
+
+	if err := validateNotificationConfig(&config); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	if err := a.db.UpdateNotificationConfig(&config); err != nil {
-		log.Printf("Error updating notification config: %v", err)
+	if expected == 0 {
+		err = a.db.UpdateNotificationConfig(&config)
+		expected = current.Version
+	} else {
+		var updated bool
+		updated, err = a.db.UpdateNotificationConfigIfVersion(&config, expected)
+		if err == nil && !updated {
+			http.Error(w, "Notification config was modified by another request; reload and try again", http.StatusConflict)
+			return
+		}
+	}
+	if err != nil {
+		logging.Server.Ctx(r.Context()).Errorf("Error updating notification config: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
+	config.Version = expected + 1
+	redactNotificationConfig(&config)
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", versionETag(config.Version))
 	json.NewEncoder(w).Encode(config)
 }
 
+// versionETag formats a row version as a strong ETag
+func versionETag(version int64) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+// parseVersionETag parses an If-Match value produced by versionETag
+func parseVersionETag(tag string) (int64, bool) {
+	v, err := strconv.ParseInt(strings.Trim(strings.TrimSpace(tag), `"`), 10, 64)
+	if err != nil || v < 1 {
+		return 0, false
+	}
+	return v, true
+}
+
 func (a *API) deleteNotification(w http.ResponseWriter, r *http.Request, id int64) {
 	if err := a.db.DeleteNotificationConfig(id); err != nil {
-		log.Printf("Error deleting notification config: %v", err)
+		logging.Server.Ctx(r.Context()).Errorf("Error deleting notification config: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
@@ -681,8 +1399,8 @@ func (a *API) testNotification(w http.ResponseWriter, r *http.Request, id int64)
 		return
 	}
 
-	if err := a.notificationsSvc.SendTestNotification(id); err != nil {
-		log.Printf("Error sending test notification: %v", err)
+	if err := a.notificationsSvc.WithContext(r.Context()).SendTestNotification(id); err != nil {
+		logging.Server.Ctx(r.Context()).Errorf("Error sending test notification: %v", err)
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(map[string]interface{}{
@@ -699,6 +1417,135 @@ func (a *API) testNotification(w http.ResponseWriter, r *http.Request, id int64)
 	})
 }
 
+// redeliverNotification replays a logged webhook delivery with its stored
+// payload. It bypasses dedup and approval, so it is admin-only.
+func (a *API) redeliverNotification(w http.ResponseWriter, r *http.Request, id, logID int64) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !a.requireAdmin(w, r) {
+		return
+	}
+
+	entry, err := a.notificationsSvc.WithContext(r.Context()).Redeliver(id, logID)
+	switch {
+	case errors.Is(err, notifications.ErrLogNotFound):
+		http.Error(w, "Notification log not found", http.StatusNotFound)
+		return
+	case errors.Is(err, notifications.ErrNotRedeliverable):
+		http.Error(w, "Only webhook deliveries with a stored payload can be redelivered", http.StatusBadRequest)
+		return
+	case err != nil:
+		logging.Server.Ctx(r.Context()).Errorf("Error redelivering notification log %d: %v", logID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// A failed replay is still logged; report it as the upstream's failure
+	w.Header().Set("Content-Type", "application/json")
+	if entry.Status == "failed" {
+		w.WriteHeader(http.StatusBadGateway)
+	}
+	json.NewEncoder(w).Encode(entry)
+}
+
+// resendNotification sends a config this week's new projects, or the one named
+// by ?project=, even if it was already notified about them. It bypasses the
+// dedup of notified projects, so it is admin-only.
+func (a *API) resendNotification(w http.ResponseWriter, r *http.Request, id int64) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !a.requireAdmin(w, r) {
+		return
+	}
+
+	var projects []db.Project
+	if name := r.URL.Query().Get("project"); name != "" {
+		project, err := a.db.GetProjectByName(name)
+		if err != nil {
+			logging.Server.Ctx(r.Context()).Errorf("Error getting project %s: %v", name, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if project == nil {
+			http.Error(w, "Project not found", http.StatusNotFound)
+			return
+		}
+		projects = []db.Project{*project}
+	} else {
+		var err error
+		if projects, err = a.db.GetNewProjectsSince(publish.StartOfWeek(time.Now())); err != nil {
+			logging.Server.Ctx(r.Context()).Errorf("Error getting new projects: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	sent, err := a.notificationsSvc.WithContext(r.Context()).Resend(id, projects)
+	switch {
+	case errors.Is(err, notifications.ErrConfigNotFound):
+		http.Error(w, "Notification config not found", http.StatusNotFound)
+		return
+	case errors.Is(err, notifications.ErrConfigDisabled):
+		http.Error(w, "Notification config is disabled", http.StatusConflict)
+		return
+	case err != nil:
+		logging.Server.Ctx(r.Context()).Errorf("Error resending notification %d: %v", id, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"projects": sent,
+		"message":  fmt.Sprintf("Resent %d of %d projects; see the logs for the outcome", sent, len(projects)),
+	})
+}
+
+// handleNotificationProviders describes the available provider types and their config schemas
+func (a *API) handleNotificationProviders(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(notifications.Providers())
+}
+
+// handleNotificationsTestAll sends a test through every enabled config and reports each result
+func (a *API) handleNotificationsTestAll(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	results, err := a.notificationsSvc.WithContext(r.Context()).SendTestToAll()
+	if err != nil {
+		logging.Server.Ctx(r.Context()).Errorf("Error sending test notifications: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	failed := 0
+	for _, res := range results {
+		if !res.Success {
+			failed++
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": failed == 0,
+		"total":   len(results),
+		"failed":  failed,
+		"results": results,
+	})
+}
+
 func (a *API) getNotificationLogs(w http.ResponseWriter, r *http.Request, id int64) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -708,13 +1555,13 @@ func (a *API) getNotificationLogs(w http.ResponseWriter, r *http.Request, id int
 	limit := 50 // default
 	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
 		if v, err := strconv.Atoi(limitStr); err == nil && v > 0 {
-			limit = v
+			limit = min(v, maxListLimit)
 		}
 	}
 
 	logs, err := a.db.GetNotificationLogs(id, limit)
 	if err != nil {
-		log.Printf("Error getting notification logs: %v", err)
+		logging.Server.Ctx(r.Context()).Errorf("Error getting notification logs: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
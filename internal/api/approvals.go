@@ -0,0 +1,108 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"dhi-oss-usage/internal/db"
+	"dhi-oss-usage/internal/logging"
+	"dhi-oss-usage/internal/notifications"
+)
+
+// handlePendingMessages lists messages held for approval. ?status= filters by
+// pending (default), sent, rejected, failed or all. Like deciding on them,
+// listing requires the admin token, as queued posts are unreviewed.
+func (a *API) handlePendingMessages(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !a.requireAdmin(w, r) {
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "":
+		status = "pending"
+	case "all":
+		status = ""
+	case "pending", "sending", "sent", "rejected", "failed":
+	default:
+		http.Error(w, "status must be one of: pending, sending, sent, rejected, failed, all", http.StatusBadRequest)
+		return
+	}
+	limit := 100
+	if v, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && v > 0 {
+		limit = min(v, maxListLimit)
+	}
+
+	messages, err := a.notificationsSvc.ListPendingMessages(status, limit)
+	if err != nil {
+		logging.Server.Ctx(r.Context()).Errorf("Error listing pending messages: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	var out interface{} = messages
+	if messages == nil {
+		out = []interface{}{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+// handlePendingMessageAction handles POST /api/notifications/pending/:id/approve and
+// /reject. Deciding requires the admin token so queued channels never receive
+// unreviewed posts.
+func (a *API) handlePendingMessageAction(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/notifications/pending/"), "/")
+	if len(parts) != 2 {
+		http.Error(w, "Expected /api/notifications/pending/:id/approve or /reject", http.StatusNotFound)
+		return
+	}
+	id, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid message ID", http.StatusBadRequest)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !a.requireAdmin(w, r) {
+		return
+	}
+
+	svc := a.notificationsSvc.WithContext(r.Context())
+	var decide func(int64) (*db.PendingMessage, error)
+	switch parts[1] {
+	case "approve":
+		decide = svc.ApprovePendingMessage
+	case "reject":
+		decide = svc.RejectPendingMessage
+	default:
+		http.Error(w, "Unknown action", http.StatusNotFound)
+		return
+	}
+
+	message, err := decide(id)
+	switch {
+	case errors.Is(err, notifications.ErrPendingNotFound):
+		http.Error(w, "Pending message not found", http.StatusNotFound)
+		return
+	case errors.Is(err, notifications.ErrPendingDecided):
+		http.Error(w, "Message was already decided", http.StatusConflict)
+		return
+	case err != nil:
+		logging.Server.Ctx(r.Context()).Errorf("Error deciding pending message %d: %v", id, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(message)
+}
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"dhi-oss-usage/internal/db"
+	"dhi-oss-usage/internal/logging"
+)
+
+// SetRefreshArchive enables storing the full project list after each refresh,
+// keeping the newest keep archives (0 keeps all)
+func (a *API) SetRefreshArchive(enabled bool, keep int) {
+	a.archiveRefreshes = enabled
+	a.archiveKeep = keep
+}
+
+// archiveRefresh stores every tracked project, whatever its status, as
+// gzip-compressed JSON for the job, then prunes old archives
+func (a *API) archiveRefresh(jobID int64) {
+	projects, err := a.db.ListProjects(db.ProjectFilter{Deleted: "include"})
+	if err != nil {
+		logging.Refresh.Errorf("Error listing projects for archive: %v", err)
+		return
+	}
+	if projects == nil {
+		projects = []db.Project{}
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(zw).Encode(projects); err != nil {
+		logging.Refresh.Errorf("Error encoding refresh archive: %v", err)
+		return
+	}
+	if err := zw.Close(); err != nil {
+		logging.Refresh.Errorf("Error compressing refresh archive: %v", err)
+		return
+	}
+
+	if err := a.db.SaveRefreshArchive(jobID, len(projects), buf.Bytes()); err != nil {
+		logging.Refresh.Errorf("Error saving refresh archive: %v", err)
+		return
+	}
+	logging.Refresh.Infof("Archived %d projects (%d bytes compressed)", len(projects), buf.Len())
+
+	if a.archiveKeep > 0 {
+		n, err := a.db.PruneRefreshArchives(a.archiveKeep)
+		if err != nil {
+			logging.Refresh.Errorf("Error pruning refresh archives: %v", err)
+		} else if n > 0 {
+			logging.Refresh.Infof("Pruned %d old refresh archives", n)
+		}
+	}
+}
+
+// handleRefreshArchive returns the project list archived by a refresh job. The
+// stored gzip body is sent as is to clients that accept gzip.
+func (a *API) handleRefreshArchive(w http.ResponseWriter, r *http.Request, id int64) {
+	archive, err := a.db.GetRefreshArchive(id)
+	if err != nil {
+		logging.Server.Ctx(r.Context()).Errorf("Error getting refresh archive: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if archive == nil {
+		http.Error(w, "No archive available for this job", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="dhi-projects-job-%d.json"`, id))
+	w.Header().Set("Vary", "Accept-Encoding")
+	if acceptsGzip(r.Header.Get("Accept-Encoding")) {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(archive.Body)
+		return
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(archive.Body))
+	if err != nil {
+		logging.Server.Ctx(r.Context()).Errorf("Error reading refresh archive %d: %v", id, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer zr.Close()
+	io.Copy(w, zr)
+}
+
+// acceptsGzip reports whether an Accept-Encoding header allows gzip, honoring
+// q-values: "gzip;q=0" refuses it, and "*" covers it unless gzip is listed
+func acceptsGzip(acceptEncoding string) bool {
+	gzipQ, anyQ := -1.0, -1.0
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			if v, ok := strings.CutPrefix(strings.TrimSpace(param), "q="); ok {
+				if f, err := strconv.ParseFloat(v, 64); err == nil {
+					q = f
+				}
+			}
+		}
+		switch strings.ToLower(strings.TrimSpace(coding)) {
+		case "gzip", "x-gzip":
+			gzipQ = max(gzipQ, q)
+		case "*":
+			anyQ = max(anyQ, q)
+		}
+	}
+	if gzipQ >= 0 {
+		return gzipQ > 0
+	}
+	return anyQ > 0
+}
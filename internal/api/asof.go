@@ -0,0 +1,199 @@
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"dhi-oss-usage/internal/db"
+	"dhi-oss-usage/internal/logging"
+)
+
+// asOfSource describes what an ?as_of= listing was reconstructed from
+type asOfSource struct {
+	Date       string    `json:"date"`   // as requested; the list is as of the end of that day (UTC)
+	Source     string    `json:"source"` // archive: project rows stored by a refresh; snapshot: the projects and stars of a snapshot, with current details
+	RecordedAt time.Time `json:"recorded_at"`
+	JobID      int64     `json:"job_id,omitempty"`
+	SnapshotID int64     `json:"snapshot_id,omitempty"`
+}
+
+// asOfEnvelope is the page envelope of an ?as_of= listing
+type asOfEnvelope struct {
+	pageEnvelope
+	AsOf asOfSource `json:"as_of"`
+}
+
+// asOfUnsupported are /api/projects parameters that describe current state and
+// can't be applied to a past list
+var asOfUnsupported = []string{"status", "include_archived", "topic", "license", "featured", "attribution", "use_case", "employee"}
+
+// handleProjectsAsOf lists the adopters as they were at the end of a past day,
+// for auditing numbers published in old reports. It uses the newest refresh
+// archive stored by then, falling back to the newest snapshot's membership.
+func (a *API) handleProjectsAsOf(w http.ResponseWriter, r *http.Request, date string) {
+	q := r.URL.Query()
+	day, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		http.Error(w, "Invalid 'as_of' parameter. Use a date like 2025-06-01", http.StatusBadRequest)
+		return
+	}
+	for _, name := range asOfUnsupported {
+		if q.Has(name) {
+			http.Error(w, fmt.Sprintf("'%s' can't be combined with 'as_of'", name), http.StatusBadRequest)
+			return
+		}
+	}
+	switch q.Get("sort") {
+	case "", "stars", "name":
+	default:
+		http.Error(w, "Invalid 'sort' parameter with 'as_of'. Use 'stars' or 'name'", http.StatusBadRequest)
+		return
+	}
+	filter, err := a.projectFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	fields, err := parseFields(q.Get("fields"), projectFields)
+	if err != nil {
+		http.Error(w, "Invalid 'fields' parameter: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if apiVersion(r) >= apiV2 {
+		filter.Limit = min(max(filter.Limit, 0), v2MaxLimit)
+		if filter.Limit == 0 {
+			filter.Limit = v2DefaultLimit
+		}
+	}
+
+	projects, source, err := projectsAsOf(a.readerFor(r), day.AddDate(0, 0, 1))
+	if err != nil {
+		logging.Server.Ctx(r.Context()).Errorf("Error reconstructing projects as of %s: %v", date, err)
+		readFailed(w, r)
+		return
+	}
+	if source == nil {
+		http.Error(w, fmt.Sprintf("No refresh archive or snapshot exists from %s or earlier", date), http.StatusNotFound)
+		return
+	}
+	source.Date = date
+
+	matched := projects[:0]
+	for _, p := range projects {
+		if asOfMatches(&p, filter) {
+			matched = append(matched, p)
+		}
+	}
+	sortProjectsAsOf(matched, q.Get("sort"), q.Get("order"))
+
+	total := len(matched)
+	page := matched[min(filter.Offset, total):]
+	if filter.Limit > 0 {
+		page = page[:min(filter.Limit, len(page))]
+	}
+	var items interface{} = page
+	if fields != nil {
+		if items, err = selectProjectFields(page, fields); err != nil {
+			logging.Server.Ctx(r.Context()).Errorf("Error selecting project fields: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if apiVersion(r) < apiV2 && q.Get("envelope") != "true" {
+		json.NewEncoder(w).Encode(items)
+		return
+	}
+	json.NewEncoder(w).Encode(asOfEnvelope{
+		pageEnvelope: pageEnvelope{Items: items, Total: total, Limit: filter.Limit, Offset: filter.Offset},
+		AsOf:         *source,
+	})
+}
+
+// projectsAsOf returns the live projects as of before, and where they came
+// from, or a nil source when nothing was recorded by then
+func projectsAsOf(store db.Store, before time.Time) ([]db.Project, *asOfSource, error) {
+	archive, err := store.GetRefreshArchiveBefore(before)
+	if err != nil {
+		return nil, nil, err
+	}
+	snapshot, err := store.GetSnapshotBefore(before)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Archives hold whole rows, so they win unless a snapshot is newer
+	if archive != nil && (snapshot == nil || !snapshot.RecordedAt.After(archive.CreatedAt)) {
+		zr, err := gzip.NewReader(bytes.NewReader(archive.Body))
+		if err != nil {
+			return nil, nil, fmt.Errorf("reading archive of job %d: %w", archive.JobID, err)
+		}
+		defer zr.Close()
+		var all []db.Project
+		if err := json.NewDecoder(zr).Decode(&all); err != nil {
+			return nil, nil, fmt.Errorf("decoding archive of job %d: %w", archive.JobID, err)
+		}
+		var live []db.Project
+		for _, p := range all {
+			if p.Status == "active" && !p.Archived && p.DeletedAt == nil {
+				live = append(live, p)
+			}
+		}
+		return live, &asOfSource{Source: "archive", RecordedAt: archive.CreatedAt, JobID: archive.JobID}, nil
+	}
+
+	if snapshot == nil {
+		return nil, nil, nil
+	}
+	projects, err := store.GetSnapshotProjects(snapshot.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return projects, &asOfSource{Source: "snapshot", RecordedAt: snapshot.RecordedAt, SnapshotID: snapshot.ID}, nil
+}
+
+// asOfMatches applies the filters /api/projects supports with as_of
+func asOfMatches(p *db.Project, filter db.ProjectFilter) bool {
+	if filter.MinStars > 0 && p.Stars < filter.MinStars {
+		return false
+	}
+	if filter.MaxStars > 0 && p.Stars > filter.MaxStars {
+		return false
+	}
+	if search := strings.ToLower(filter.Search); search != "" &&
+		!strings.Contains(strings.ToLower(p.RepoFullName), search) && !strings.Contains(strings.ToLower(p.Description), search) {
+		return false
+	}
+	if filter.SourceType != "" && p.SourceType != filter.SourceType {
+		return false
+	}
+	if filter.FileType != "" && p.FileType != filter.FileType {
+		return false
+	}
+	if filter.Provider != "" && p.Provider != filter.Provider {
+		return false
+	}
+	return !(filter.ExcludeForks && p.Fork)
+}
+
+// sortProjectsAsOf sorts by stars (the default) or name, descending unless
+// order is asc, as ListProjects does
+func sortProjectsAsOf(projects []db.Project, by, order string) {
+	less := func(i, j int) bool { return projects[i].Stars < projects[j].Stars }
+	if by == "name" {
+		less = func(i, j int) bool { return projects[i].RepoFullName < projects[j].RepoFullName }
+	}
+	sort.SliceStable(projects, func(i, j int) bool {
+		if order == "asc" {
+			return less(i, j)
+		}
+		return less(j, i)
+	})
+}
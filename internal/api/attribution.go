@@ -0,0 +1,113 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"dhi-oss-usage/internal/db"
+	"dhi-oss-usage/internal/logging"
+)
+
+// attributionPattern is the form of attribution labels: lowercase words, with
+// an optional qualifier such as conference:kubecon-eu-2026
+var attributionPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_.:-]{0,63}$`)
+
+// attributionRequest tags projects via POST /api/admin/attribution
+type attributionRequest struct {
+	Projects    []string `json:"projects"`    // repo_full_name of each project
+	Attribution string   `json:"attribution"` // e.g. docs_tutorial, conference, partner; empty clears it
+}
+
+// handleAdminAttribution tags projects with the campaign or channel that
+// brought them to DHI, for adoption by attribution in /api/stats/breakdown
+func (a *API) handleAdminAttribution(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !a.requireAdmin(w, r) {
+		return
+	}
+
+	var req attributionRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid attribution request: %v", err), http.StatusBadRequest)
+		return
+	}
+	if len(req.Projects) == 0 {
+		http.Error(w, "projects is required", http.StatusBadRequest)
+		return
+	}
+	if req.Attribution != "" && !attributionPattern.MatchString(req.Attribution) {
+		http.Error(w, "attribution must be lowercase letters, digits, '_', '.', ':' or '-', at most 64 characters", http.StatusBadRequest)
+		return
+	}
+
+	ids := make([]int64, 0, len(req.Projects))
+	for _, name := range req.Projects {
+		p, err := a.db.GetProjectByName(name)
+		if err != nil {
+			logging.Server.Ctx(r.Context()).Errorf("Error getting project %s: %v", name, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if p == nil {
+			http.Error(w, fmt.Sprintf("Project %q is not tracked", name), http.StatusBadRequest)
+			return
+		}
+		ids = append(ids, p.ID)
+	}
+
+	if err := a.db.SetProjectAttribution(ids, req.Attribution); err != nil {
+		logging.Server.Ctx(r.Context()).Errorf("Error setting attribution: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	logging.Server.Ctx(r.Context()).Infof("Attribution of %d projects set to %q", len(ids), req.Attribution)
+	a.dataChanged()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"updated": len(ids),
+	})
+}
+
+// handleStatsBreakdown counts live projects, stars and recent adoptions per
+// value of a dimension: attribution by default, for campaign ROI, or
+// source_type, file_type, language, provider or use_case
+func (a *API) handleStatsBreakdown(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	by := r.URL.Query().Get("by")
+	if by == "" {
+		by = "attribution"
+	}
+	if !db.IsBreakdownDimension(by) {
+		http.Error(w, "Invalid 'by' parameter. Use 'attribution', 'source_type', 'file_type', 'language', 'provider' or 'use_case'", http.StatusBadRequest)
+		return
+	}
+
+	counts, err := a.readerFor(r).GetBreakdown(by)
+	if err != nil {
+		logging.Server.Ctx(r.Context()).Errorf("Error getting %s breakdown: %v", by, err)
+		readFailed(w, r)
+		return
+	}
+	if counts == nil {
+		counts = []db.BreakdownCount{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"by":     by,
+		"values": counts,
+	})
+}
@@ -0,0 +1,146 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"dhi-oss-usage/internal/db"
+	"dhi-oss-usage/internal/logging"
+)
+
+// avatarSizes are the size variants served; other requested sizes round up to
+// the next one so the cache holds a bounded number of copies per owner
+var avatarSizes = []int{40, 80, 160, 460}
+
+const (
+	defaultAvatarSize = 80
+	// avatarTTL is how long a cached avatar is served before it is refetched
+	avatarTTL = 24 * time.Hour
+	// avatarPrefetchAge is the age past which the post-refresh prefetch refetches
+	// a cached avatar, so it stays fresh until the next daily refresh
+	avatarPrefetchAge = avatarTTL / 2
+)
+
+// avatarSize returns the size variant for a ?size= value
+func avatarSize(param string) int {
+	requested, err := strconv.Atoi(param)
+	if err != nil || requested <= 0 {
+		return defaultAvatarSize
+	}
+	for _, s := range avatarSizes {
+		if requested <= s {
+			return s
+		}
+	}
+	return avatarSizes[len(avatarSizes)-1]
+}
+
+// handleProjectAvatar serves the GitHub owner avatar of a project from a local
+// cache, so dashboard visitors' browsers never request images from GitHub.
+// A stale copy is served if GitHub can't be reached.
+func (a *API) handleProjectAvatar(w http.ResponseWriter, r *http.Request, id int64) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	project, err := a.readerFor(r).GetProject(id)
+	if err != nil {
+		logging.Server.Ctx(r.Context()).Errorf("Error getting project %d: %v", id, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if project == nil {
+		http.Error(w, "Project not found", http.StatusNotFound)
+		return
+	}
+	if project.Provider != "github" {
+		http.Error(w, "No avatar for this project", http.StatusNotFound)
+		return
+	}
+	owner, _, _ := strings.Cut(project.RepoFullName, "/")
+	size := avatarSize(r.URL.Query().Get("size"))
+
+	avatar, err := a.cachedAvatar(r.Context(), owner, size, avatarTTL)
+	if err != nil {
+		logging.Server.Ctx(r.Context()).Errorf("Error fetching avatar for %s: %v", owner, err)
+		http.Error(w, "Avatar unavailable", http.StatusBadGateway)
+		return
+	}
+
+	etag := fmt.Sprintf(`"%x"`, sha256.Sum256(avatar.Body))
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(avatarTTL.Seconds())))
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", avatar.ContentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(avatar.Body)))
+	w.Write(avatar.Body)
+}
+
+// cachedAvatar returns an owner's avatar from the cache, fetching it from GitHub
+// if it is missing or older than maxAge. A stale copy is returned when GitHub
+// can't be reached.
+func (a *API) cachedAvatar(ctx context.Context, owner string, size int, maxAge time.Duration) (*db.Avatar, error) {
+	avatar, err := a.db.GetAvatar(owner, size)
+	if err != nil {
+		logging.Server.Ctx(ctx).Errorf("Error reading cached avatar for %s: %v", owner, err)
+	}
+	if avatar != nil && time.Since(avatar.FetchedAt) <= maxAge {
+		return avatar, nil
+	}
+
+	body, contentType, err := a.ghClient.GetAvatar(ctx, owner, size)
+	if err != nil {
+		if avatar != nil {
+			logging.Server.Ctx(ctx).Errorf("Error refreshing avatar for %s, serving cached copy: %v", owner, err)
+			return avatar, nil
+		}
+		return nil, err
+	}
+	avatar = &db.Avatar{Owner: owner, Size: size, ContentType: contentType, Body: body, FetchedAt: time.Now()}
+	if err := a.db.PutAvatar(avatar); err != nil {
+		logging.Server.Ctx(ctx).Errorf("Error caching avatar for %s: %v", owner, err)
+	}
+	return avatar, nil
+}
+
+// prefetchAvatars caches the default-size avatar of every live GitHub project
+// owner, so the first dashboard render after a refresh doesn't wait on GitHub.
+// It runs in the background after a refresh completes, and stops when the
+// server shuts down.
+func (a *API) prefetchAvatars() {
+	ctx, cancel := context.WithTimeout(a.refreshCtx, 10*time.Minute)
+	defer cancel()
+
+	projects, err := a.db.ListProjects(db.ProjectFilter{Provider: "github", Status: "active", ExcludeArchived: true})
+	if err != nil {
+		logging.Refresh.Errorf("Error listing projects for avatar prefetch: %v", err)
+		return
+	}
+	seen := make(map[string]bool)
+	var owners []string
+	for _, p := range projects {
+		owner, _, _ := strings.Cut(p.RepoFullName, "/")
+		if !seen[owner] {
+			seen[owner] = true
+			owners = append(owners, owner)
+		}
+	}
+
+	var failed int64
+	a.ghClient.Parallel(ctx, len(owners), func(i int) {
+		if _, err := a.cachedAvatar(ctx, owners[i], defaultAvatarSize, avatarPrefetchAge); err != nil {
+			atomic.AddInt64(&failed, 1)
+		}
+	})
+	logging.Refresh.Infof("Prefetched avatars for %d owners (%d failed)", len(owners), failed)
+}
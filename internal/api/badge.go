@@ -0,0 +1,123 @@
+package api
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+	"time"
+
+	"dhi-oss-usage/internal/db"
+	"dhi-oss-usage/internal/i18n"
+	"dhi-oss-usage/internal/logging"
+)
+
+// badgeTTL is how long clients and CDNs (e.g. GitHub's camo proxy) may cache a
+// badge. Counts only change with a refresh, so a few minutes is plenty.
+const badgeTTL = 5 * time.Minute
+
+// handleBadge serves /badge.svg, a shields.io-style badge with the number of
+// DHI adopters. ?label= replaces the label and ?lang= (or Accept-Language)
+// translates it; ?exclude_forks= applies as on /api/stats.
+func (a *API) handleBadge(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	excludeForks := a.excludeForksParam(r)
+	key := "stats"
+	if excludeForks {
+		key = "stats:exclude_forks"
+	}
+	var stats dashboardStats
+	if !a.readAggregate(key, &stats) {
+		var err error
+		if stats, err = computeStats(a.readerFor(r), excludeForks); err != nil {
+			logging.Server.Ctx(r.Context()).Errorf("Error getting stats: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+	loc := localeFor(w, r)
+	writeBadge(w, r, loc, loc.T("badge.adopters"), stats.TotalProjects)
+}
+
+// handleImageBadge serves /badge/:image.svg, the number of projects using one
+// DHI image (e.g. /badge/python.svg for dhi.io/python). Unknown images show 0.
+func (a *API) handleImageBadge(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	image, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/badge/"), ".svg")
+	if !ok || image == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	var usage []db.ImageUsage
+	if !a.readAggregate("images", &usage) {
+		var err error
+		if usage, err = a.readerFor(r).GetImageUsage(); err != nil {
+			logging.Server.Ctx(r.Context()).Errorf("Error getting image usage: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+	count := 0
+	for _, u := range usage {
+		if u.Image == image {
+			count = u.Projects
+			break
+		}
+	}
+	loc := localeFor(w, r)
+	writeBadge(w, r, loc, loc.T("badge.image_adopters", "dhi.io/"+image), count)
+}
+
+// writeBadge renders a flat two-part badge: label on grey, count on Docker blue
+func writeBadge(w http.ResponseWriter, r *http.Request, loc *i18n.Locale, label string, count int) {
+	if l := r.URL.Query().Get("label"); l != "" {
+		label = l
+	}
+	value := loc.Number(count)
+
+	// Text is 11px Verdana, as on shields.io, with 6px of padding either side
+	lw := badgeTextWidth(label) + 12
+	vw := badgeTextWidth(value) + 12
+	lx, vx := lw*5, lw*10+vw*5 // text is drawn at scale(.1) for subpixel placement
+	label, value = html.EscapeString(label), html.EscapeString(value)
+
+	w.Header().Set("Content-Type", "image/svg+xml; charset=utf-8")
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(badgeTTL.Seconds())))
+	fmt.Fprintf(w, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="20" role="img" aria-label="%s: %s">`, lw+vw, label, value)
+	fmt.Fprintf(w, `<title>%s: %s</title>`, label, value)
+	fmt.Fprint(w, `<linearGradient id="s" x2="0" y2="100%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>`)
+	fmt.Fprintf(w, `<clipPath id="r"><rect width="%d" height="20" rx="3" fill="#fff"/></clipPath>`, lw+vw)
+	fmt.Fprintf(w, `<g clip-path="url(#r)"><rect width="%d" height="20" fill="#555"/><rect x="%d" width="%d" height="20" fill="#1d63ed"/><rect width="%d" height="20" fill="url(#s)"/></g>`, lw, lw, vw, lw+vw)
+	fmt.Fprint(w, `<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="110">`)
+	fmt.Fprintf(w, `<text x="%d" y="150" fill="#010101" fill-opacity=".3" transform="scale(.1)">%s</text><text x="%d" y="140" transform="scale(.1)">%s</text>`, lx, label, lx, label)
+	fmt.Fprintf(w, `<text x="%d" y="150" fill="#010101" fill-opacity=".3" transform="scale(.1)">%s</text><text x="%d" y="140" transform="scale(.1)">%s</text>`, vx, value, vx, value)
+	fmt.Fprint(w, `</g></svg>`)
+}
+
+// badgeTextWidth approximates the width in pixels of text in 11px Verdana
+func badgeTextWidth(s string) int {
+	width := 0.0
+	for _, c := range s {
+		switch {
+		case strings.ContainsRune("iljI.,:;'!|", c):
+			width += 3.5
+		case c == ' ' || strings.ContainsRune("frt()[]/-", c):
+			width += 4.5
+		case strings.ContainsRune("mwMW", c):
+			width += 10
+		case c >= 'A' && c <= 'Z':
+			width += 7.5
+		default:
+			width += 6.8
+		}
+	}
+	return int(width + 0.5)
+}
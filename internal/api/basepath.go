@@ -0,0 +1,54 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"dhi-oss-usage/internal/logging"
+)
+
+type basePathKey struct{}
+
+// WithBasePath serves next under prefix (e.g. "/dhi-tracker"; "" for the
+// root) as if it were mounted at the root, so routes and handlers don't change.
+// Requests outside prefix get a 404. The prefix is kept on the request for the
+// links the API generates, behind any X-Forwarded-Prefix of a trusted proxy
+// that strips its own prefix before forwarding.
+func WithBasePath(prefix string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		base := prefix
+		if fwd := r.Header.Get("X-Forwarded-Prefix"); fwd != "" && logging.FromTrustedProxy(r) {
+			base = "/" + strings.Trim(fwd, "/") + prefix
+		}
+
+		r2 := r.WithContext(context.WithValue(r.Context(), basePathKey{}, base))
+		if prefix != "" {
+			if r.URL.Path == prefix {
+				target := base + "/"
+				if r.URL.RawQuery != "" {
+					target += "?" + r.URL.RawQuery
+				}
+				http.Redirect(w, r, target, http.StatusMovedPermanently)
+				return
+			}
+			rest, ok := strings.CutPrefix(r.URL.Path, prefix+"/")
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			u := *r.URL
+			u.Path = "/" + rest
+			u.RawPath = strings.TrimPrefix(r.URL.RawPath, prefix)
+			r2.URL = &u
+		}
+		next.ServeHTTP(w, r2)
+	})
+}
+
+// BasePath returns the path prefix the app is served under, as seen by the
+// client, for links in responses
+func BasePath(r *http.Request) string {
+	base, _ := r.Context().Value(basePathKey{}).(string)
+	return base
+}
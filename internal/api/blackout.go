@@ -0,0 +1,219 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"dhi-oss-usage/internal/github"
+	"dhi-oss-usage/internal/logging"
+)
+
+const (
+	// blackoutRecheck is how long a refresh held back by a GitHub incident
+	// waits before checking the status page again
+	blackoutRecheck = 15 * time.Minute
+	// maxBlackoutDelay bounds how long a refresh is delayed; past it the refresh
+	// is skipped and the next scheduled one tries again
+	maxBlackoutDelay = 12 * time.Hour
+)
+
+// refreshBlackouts are the times automatic refreshes don't start: configured
+// windows such as GitHub's maintenance slots, and GitHub API incidents
+type refreshBlackouts struct {
+	windows     []blackoutWindow
+	skip        bool // skip blocked refreshes instead of delaying them to the end of the blackout
+	statusCheck bool // check githubstatus.com before each automatic refresh
+
+	mu      sync.Mutex
+	pending *time.Timer // a delayed refresh waiting for its blackout to end
+}
+
+// blackoutWindow is a recurring window in UTC (weekly, or daily without a
+// weekday) or a one-off period
+type blackoutWindow struct {
+	spec       string
+	weekday    int // 0 (Sunday) to 6, or -1 for every day
+	start, end int // minutes after midnight; an end at or before start is the next day
+	from, to   time.Time
+}
+
+// SetRefreshBlackouts sets when scheduled and startup refreshes are held back:
+// windows like "sat 22:00-02:00" (weekly), "03:00-04:00" (daily) or
+// "2026-11-01T00:00:00Z/2026-11-01T06:00:00Z" (once), all in UTC, plus GitHub
+// API outages reported on githubstatus.com when statusCheck is set. A held
+// back refresh starts when the blackout ends, or is skipped if skip is set.
+// Refreshes started from the API aren't held back.
+func (a *API) SetRefreshBlackouts(windows []string, skip, statusCheck bool) error {
+	var parsed []blackoutWindow
+	for _, spec := range windows {
+		w, err := parseBlackout(spec)
+		if err != nil {
+			return err
+		}
+		parsed = append(parsed, w)
+	}
+	a.blackouts.windows = parsed
+	a.blackouts.skip = skip
+	a.blackouts.statusCheck = statusCheck
+	return nil
+}
+
+func parseBlackout(spec string) (blackoutWindow, error) {
+	w := blackoutWindow{spec: spec, weekday: -1}
+	if from, to, ok := strings.Cut(spec, "/"); ok {
+		var err1, err2 error
+		w.from, err1 = time.Parse(time.RFC3339, strings.TrimSpace(from))
+		w.to, err2 = time.Parse(time.RFC3339, strings.TrimSpace(to))
+		if err1 != nil || err2 != nil || !w.to.After(w.from) {
+			return w, fmt.Errorf("invalid blackout %q (want start/end in RFC 3339, e.g. 2026-11-01T00:00:00Z/2026-11-01T06:00:00Z)", spec)
+		}
+		return w, nil
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) == 2 {
+		w.weekday = parseWeekday(fields[0])
+		if w.weekday < 0 {
+			return w, fmt.Errorf("invalid blackout %q: unknown weekday %q", spec, fields[0])
+		}
+		fields = fields[1:]
+	}
+	if len(fields) != 1 {
+		return w, fmt.Errorf("invalid blackout %q (want e.g. \"sat 22:00-02:00\" or \"03:00-04:00\")", spec)
+	}
+	start, end, _ := strings.Cut(fields[0], "-")
+	s, err1 := time.Parse("15:04", start)
+	e, err2 := time.Parse("15:04", end)
+	if err1 != nil || err2 != nil || s.Equal(e) {
+		return w, fmt.Errorf("invalid blackout %q (want e.g. \"sat 22:00-02:00\" or \"03:00-04:00\")", spec)
+	}
+	w.start, w.end = s.Hour()*60+s.Minute(), e.Hour()*60+e.Minute()
+	return w, nil
+}
+
+func parseWeekday(name string) int {
+	name = strings.ToLower(name)
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if day := strings.ToLower(d.String()); name == day || name == day[:3] {
+			return int(d)
+		}
+	}
+	return -1
+}
+
+// until returns when the window ends if t is in it, or the zero time
+func (w blackoutWindow) until(t time.Time) time.Time {
+	if !w.from.IsZero() {
+		if !t.Before(w.from) && t.Before(w.to) {
+			return w.to
+		}
+		return time.Time{}
+	}
+	t = t.UTC()
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	m, day := t.Hour()*60+t.Minute(), int(t.Weekday())
+	on := func(d int) bool { return w.weekday < 0 || w.weekday == d }
+	switch {
+	case w.start < w.end && on(day) && m >= w.start && m < w.end:
+		return midnight.Add(time.Duration(w.end) * time.Minute)
+	case w.start > w.end && on(day) && m >= w.start:
+		return midnight.AddDate(0, 0, 1).Add(time.Duration(w.end) * time.Minute)
+	case w.start > w.end && on((day+6)%7) && m < w.end:
+		return midnight.Add(time.Duration(w.end) * time.Minute)
+	}
+	return time.Time{}
+}
+
+// blackoutReason returns why a refresh shouldn't start at now and when to
+// try again, or "" if it can start. The status monitor's last check is used
+// if it is recent; otherwise the status page is read. A status page that
+// can't be read doesn't hold refreshes back.
+func (a *API) blackoutReason(now time.Time) (string, time.Time) {
+	for _, w := range a.blackouts.windows {
+		if until := w.until(now); !until.IsZero() {
+			return "blackout window " + w.spec, until
+		}
+	}
+	if !a.blackouts.statusCheck {
+		return "", time.Time{}
+	}
+	status := a.recentGitHubStatus(now)
+	if status == nil {
+		var err error
+		status, err = a.checkGitHubStatus(a.refreshCtx)
+		if err != nil {
+			logging.Refresh.Warnf("Couldn't read GitHub status, refreshing anyway: %v", err)
+			return "", time.Time{}
+		}
+	}
+	if status.Disrupted(github.APIComponent) {
+		reason := fmt.Sprintf("GitHub %s %s", github.APIComponent, strings.ReplaceAll(status.Components[github.APIComponent], "_", " "))
+		if len(status.Incidents) > 0 {
+			reason += " (" + strings.Join(status.Incidents, "; ") + ")"
+		}
+		return reason, now.Add(blackoutRecheck)
+	}
+	return "", time.Time{}
+}
+
+// recentGitHubStatus returns the status monitor's last successful check if
+// it was made within blackoutRecheck of now, or nil
+func (a *API) recentGitHubStatus(now time.Time) *github.ServiceStatus {
+	m := &a.statusMonitor
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.status == nil || m.err != "" || m.checkedAt == nil || now.Sub(*m.checkedAt) > blackoutRecheck {
+		return nil
+	}
+	return m.status
+}
+
+// deferForBlackout holds back an automatic refresh during a blackout, logging
+// why, and returns true if it mustn't start now. The refresh is retried when
+// the blackout ends unless refreshes are skipped, another refresh is already
+// waiting, or it has waited maxBlackoutDelay since first held back (since).
+func (a *API) deferForBlackout(source string, since time.Time) bool {
+	now := time.Now()
+	reason, until := a.blackoutReason(now)
+	if reason == "" {
+		return false
+	}
+
+	b := &a.blackouts
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch {
+	case b.skip:
+		logging.Refresh.Warnf("Skipping %s refresh: %s", source, reason)
+	case since.IsZero() && b.pending != nil:
+		logging.Refresh.Infof("Skipping %s refresh: %s, and a delayed refresh is already waiting", source, reason)
+	case !since.IsZero() && now.Sub(since) >= maxBlackoutDelay:
+		logging.Refresh.Warnf("Skipping %s refresh: %s, still blocked after %s", source, reason, maxBlackoutDelay)
+	default:
+		if since.IsZero() {
+			since = now
+		}
+		logging.Refresh.Warnf("Delaying %s refresh until %s: %s", source, until.UTC().Format(time.RFC3339), reason)
+		b.pending = time.AfterFunc(max(until.Sub(now), time.Minute), func() {
+			b.mu.Lock()
+			b.pending = nil
+			b.mu.Unlock()
+			if !a.deferForBlackout(source, since) {
+				a.startRefresh(source)
+			}
+		})
+	}
+	return true
+}
+
+// stopDelayedRefresh drops a refresh waiting for a blackout to end
+func (a *API) stopDelayedRefresh() {
+	a.blackouts.mu.Lock()
+	defer a.blackouts.mu.Unlock()
+	if a.blackouts.pending != nil {
+		a.blackouts.pending.Stop()
+		a.blackouts.pending = nil
+	}
+}
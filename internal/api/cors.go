@@ -0,0 +1,75 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// corsPolicy is which other origins may call the API from a browser
+type corsPolicy struct {
+	origins map[string]bool // allowed origins, e.g. https://dashboard.example.com
+	any     bool            // "*": every origin
+	methods string
+	headers string
+	maxAge  time.Duration // how long browsers may cache a preflight
+}
+
+// corsExposed are the response headers scripts on another origin may read
+const corsExposed = "ETag, Link, Deprecation, Sunset, X-Request-Id"
+
+// SetCORS lets pages on origins (scheme://host[:port], or "*" for any) call the
+// API, with the given methods and request headers allowed in preflights. No
+// origins disables CORS, so browsers keep the API same-origin only. Cookies
+// and other credentials are never allowed: the API doesn't use them.
+func (a *API) SetCORS(origins, methods, headers []string, maxAge time.Duration) {
+	if len(origins) == 0 {
+		a.cors = nil
+		return
+	}
+	p := &corsPolicy{
+		origins: make(map[string]bool),
+		methods: strings.Join(methods, ", "),
+		headers: strings.Join(headers, ", "),
+		maxAge:  maxAge,
+	}
+	for _, o := range origins {
+		if o == "*" {
+			p.any = true
+		}
+		p.origins[strings.TrimSuffix(strings.ToLower(o), "/")] = true
+	}
+	a.cors = p
+}
+
+// allowCORS adds the CORS headers for a request from an allowed origin. It
+// answers preflights itself, returning true when the request is handled.
+func (a *API) allowCORS(w http.ResponseWriter, r *http.Request) bool {
+	p := a.cors
+	if p == nil {
+		return false
+	}
+	origin := r.Header.Get("Origin")
+	w.Header().Add("Vary", "Origin")
+	if origin == "" || !p.any && !p.origins[strings.ToLower(origin)] {
+		return false
+	}
+
+	if p.any {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+	} else {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+	}
+	if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+		w.Header().Set("Access-Control-Allow-Methods", p.methods)
+		if p.headers != "" {
+			w.Header().Set("Access-Control-Allow-Headers", p.headers)
+		}
+		w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(p.maxAge.Seconds())))
+		w.WriteHeader(http.StatusNoContent)
+		return true
+	}
+	w.Header().Set("Access-Control-Expose-Headers", corsExposed)
+	return false
+}
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"dhi-oss-usage/internal/db"
+	"dhi-oss-usage/internal/logging"
+)
+
+// projectDetailNotifications caps the notification history in a project detail
+const projectDetailNotifications = 50
+
+// adoptionInfo describes the commit that first added DHI to a project
+type adoptionInfo struct {
+	AdoptedAt *time.Time `json:"adopted_at"`
+	CommitURL string     `json:"commit_url"`
+	CommitSHA string     `json:"commit_sha"`
+}
+
+// projectDetail is the response of /api/projects/:id: the project with everything
+// recorded about it
+type projectDetail struct {
+	db.Project
+	Adoption      adoptionInfo             `json:"adoption"`
+	Images        []db.ProjectImage        `json:"images"`
+	StarHistory   []db.StarHistoryPoint    `json:"star_history"`
+	Links         []db.ProjectLink         `json:"links"`
+	Notifications []db.ProjectNotification `json:"notifications"`
+}
+
+// handleProjectDetail returns a project with its adoption commit, DHI images,
+// star history over the last ?days= days (default 90), links and notification
+// history. project is nil when it wasn't found; one in the trash is not found either.
+func (a *API) handleProjectDetail(w http.ResponseWriter, r *http.Request, project *db.Project) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if project == nil || project.DeletedAt != nil {
+		http.Error(w, "Project not found", http.StatusNotFound)
+		return
+	}
+
+	days := 90
+	if v, err := strconv.Atoi(r.URL.Query().Get("days")); err == nil && v > 0 {
+		days = v
+	}
+
+	detail := projectDetail{
+		Project: *project,
+		Adoption: adoptionInfo{
+			AdoptedAt: project.AdoptedAt,
+			CommitURL: project.AdoptionCommit,
+			CommitSHA: commitSHA(project.AdoptionCommit),
+		},
+	}
+	var err error
+	if detail.Images, err = a.readerFor(r).GetProjectImages(project.ID); err != nil {
+		logging.Server.Ctx(r.Context()).Errorf("Error getting images for project %d: %v", project.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if detail.StarHistory, err = a.readerFor(r).GetStarHistory(project.ID, days); err != nil {
+		logging.Server.Ctx(r.Context()).Errorf("Error getting star history for project %d: %v", project.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if detail.Links, err = a.readerFor(r).GetProjectLinks(project.ID); err != nil {
+		logging.Server.Ctx(r.Context()).Errorf("Error getting links for project %d: %v", project.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if detail.Notifications, err = a.readerFor(r).GetProjectNotifications(project.ID, projectDetailNotifications); err != nil {
+		logging.Server.Ctx(r.Context()).Errorf("Error getting notifications for project %d: %v", project.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if detail.Images == nil {
+		detail.Images = []db.ProjectImage{}
+	}
+	if detail.StarHistory == nil {
+		detail.StarHistory = []db.StarHistoryPoint{}
+	}
+	if detail.Links == nil {
+		detail.Links = []db.ProjectLink{}
+	}
+	if detail.Notifications == nil {
+		detail.Notifications = []db.ProjectNotification{}
+	}
+	// Errors can quote a config's endpoint, such as a Slack webhook URL, and
+	// payloads are the messages themselves; the public view only has outcomes
+	for i := range detail.Notifications {
+		detail.Notifications[i].ErrorMessage = ""
+		detail.Notifications[i].Payload = ""
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(detail)
+}
+
+// commitSHA extracts the commit hash from a GitHub (/commit/<sha>) or GitLab
+// (/-/commit/<sha>) commit URL
+func commitSHA(commitURL string) string {
+	_, sha, ok := strings.Cut(commitURL, "/commit/")
+	if !ok {
+		return ""
+	}
+	sha, _, _ = strings.Cut(sha, "/")
+	return sha
+}
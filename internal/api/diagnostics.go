@@ -0,0 +1,162 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"dhi-oss-usage/internal/github"
+	"dhi-oss-usage/internal/logging"
+)
+
+// tokenCheckTimeout bounds one round of GitHub token checks
+const tokenCheckTimeout = 30 * time.Second
+
+// tokenMonitor holds the last check of the GitHub credentials and the alerts
+// that are open, so each problem is alerted once rather than every check
+type tokenMonitor struct {
+	mu         sync.Mutex
+	warnBefore time.Duration // alert this long before a token expires
+	tokens     []github.TokenInfo
+	checkedAt  *time.Time
+	alerted    map[string]bool // keys of problems already alerted
+}
+
+// githubDiagnostics is the response of GET /api/admin/diagnostics
+type githubDiagnostics struct {
+	AuthMode          string                            `json:"auth_mode"`
+	Tokens            []github.TokenInfo                `json:"tokens"`
+	TokensCheckedAt   *time.Time                        `json:"tokens_checked_at"`
+	ExpiryWarningDays int                               `json:"expiry_warning_days"`
+	RateLimits        map[string]github.RateLimitStatus `json:"rate_limits"` // as last reported to the refresh
+	NextRefreshAt     *time.Time                        `json:"next_refresh_at,omitempty"`
+	GitHubStatus      *statusDiagnostics                `json:"github_status"` // null until githubstatus.com is first checked
+}
+
+// SetTokenExpiryWarning sets how long before a GitHub token expires an ops
+// alert is sent
+func (a *API) SetTokenExpiryWarning(d time.Duration) {
+	a.tokenMonitor.warnBefore = d
+}
+
+// StartTokenMonitor checks the GitHub credentials every interval
+func (a *API) StartTokenMonitor(interval time.Duration) {
+	if a.ghClient == nil || a.ghClient.AuthMode() == "none" {
+		return
+	}
+	go func() {
+		a.checkTokens()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			a.checkTokens()
+		}
+	}()
+}
+
+// checkTokens records what GitHub says about each credential and alerts on
+// tokens that were rejected or expire within the warning period. Network
+// errors aren't alerted: the freshness SLO catches a GitHub that stays
+// unreachable.
+func (a *API) checkTokens() {
+	ctx, cancel := context.WithTimeout(context.Background(), tokenCheckTimeout)
+	defer cancel()
+	tokens := a.ghClient.InspectTokens(ctx)
+	now := time.Now()
+
+	m := &a.tokenMonitor
+	m.mu.Lock()
+	m.tokens, m.checkedAt = tokens, &now
+	previous := m.alerted
+	m.alerted = make(map[string]bool)
+	var alerts []string
+	for _, t := range tokens {
+		key, problem := a.tokenProblem(t, now)
+		if key == "" {
+			continue
+		}
+		m.alerted[key] = true
+		if !previous[key] {
+			alerts = append(alerts, problem)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, problem := range alerts {
+		logging.Server.Warnf("GitHub token problem: %s", problem)
+		a.sendOpsAlert("DHI OSS Tracker - GitHub token needs attention", problem)
+	}
+}
+
+// tokenProblem returns a key identifying what's wrong with a token and a
+// description for the alert, or "" if nothing is
+func (a *API) tokenProblem(t github.TokenInfo, now time.Time) (key, problem string) {
+	if strings.Contains(t.Error, "API error 401") {
+		return "invalid:" + t.Token, fmt.Sprintf("GitHub rejected token %s (401 Bad credentials): it is wrong, expired or revoked. Refreshes using it will fail until it is replaced.", t.Token)
+	}
+	if t.ExpiresAt == nil || t.ExpiresAt.Sub(now) > a.tokenMonitor.warnBefore {
+		return "", ""
+	}
+	problem = fmt.Sprintf("GitHub token %s (%s) expires %s, in %s.", t.Token, t.Kind, t.ExpiresAt.Format(time.RFC1123), t.ExpiresAt.Sub(now).Round(time.Hour))
+	if a.nextRefreshFn != nil {
+		if next := a.nextRefreshFn(); next != nil && next.After(*t.ExpiresAt) {
+			problem += fmt.Sprintf(" The refresh scheduled for %s will fail unless it is replaced first.", next.Format(time.RFC1123))
+		}
+	}
+	return "expiring:" + t.Token + ":" + t.ExpiresAt.Format(time.RFC3339), problem
+}
+
+// handleAdminDiagnostics reports the GitHub credentials' scopes, quota and
+// expiry and GitHub's status as of the last checks. ?check=true checks them
+// again first.
+func (a *API) handleAdminDiagnostics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !a.requireAdmin(w, r) {
+		return
+	}
+
+	if a.ghClient != nil && a.ghClient.AuthMode() != "none" {
+		a.tokenMonitor.mu.Lock()
+		checked := a.tokenMonitor.checkedAt != nil
+		a.tokenMonitor.mu.Unlock()
+		if !checked || r.URL.Query().Get("check") == "true" {
+			a.checkTokens()
+		}
+	}
+	if r.URL.Query().Get("check") == "true" {
+		if _, err := a.checkGitHubStatus(r.Context()); err != nil {
+			logging.Server.Ctx(r.Context()).Warnf("Error checking GitHub status: %v", err)
+		}
+	}
+
+	response := githubDiagnostics{
+		AuthMode:          "none",
+		Tokens:            []github.TokenInfo{},
+		ExpiryWarningDays: int(a.tokenMonitor.warnBefore.Hours() / 24),
+		RateLimits:        map[string]github.RateLimitStatus{},
+	}
+	if a.ghClient != nil {
+		response.AuthMode = a.ghClient.AuthMode()
+		response.RateLimits = a.ghClient.RateLimits()
+	}
+	a.tokenMonitor.mu.Lock()
+	if a.tokenMonitor.tokens != nil {
+		response.Tokens = a.tokenMonitor.tokens
+	}
+	response.TokensCheckedAt = a.tokenMonitor.checkedAt
+	a.tokenMonitor.mu.Unlock()
+	if a.nextRefreshFn != nil {
+		response.NextRefreshAt = a.nextRefreshFn()
+	}
+	response.GitHubStatus = a.statusDiagnostics()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
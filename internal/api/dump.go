@@ -0,0 +1,74 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"dhi-oss-usage/internal/logging"
+)
+
+// maxImportSize bounds the (compressed) body of /api/import
+const maxImportSize = 512 << 20
+
+// handleExport streams projects, refresh snapshots and adoption data as a
+// gzip-compressed NDJSON dump for POST /api/import on another instance
+func (a *API) handleExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !a.requireAdmin(w, r) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="dhi-oss-usage-%s.ndjson.gz"`, time.Now().UTC().Format("2006-01-02")))
+	// Headers are already sent once rows stream, so a failure can only cut the dump short
+	if err := a.readerFor(r).WriteDump(w); err != nil {
+		logging.Server.Ctx(r.Context()).Errorf("Error writing export: %v", err)
+	}
+}
+
+// handleImport replaces projects, snapshots and adoption data with a dump from
+// /api/export. Refreshes are held off while it runs.
+func (a *API) handleImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !a.requireAdmin(w, r) {
+		return
+	}
+
+	a.refreshMu.Lock()
+	if a.refreshRunning {
+		a.refreshMu.Unlock()
+		http.Error(w, "Refresh in progress; import once it has finished", http.StatusConflict)
+		return
+	}
+	a.refreshRunning = true
+	a.refreshMu.Unlock()
+	defer func() {
+		a.refreshMu.Lock()
+		a.refreshRunning = false
+		a.refreshMu.Unlock()
+	}()
+
+	counts, err := a.db.ImportDump(http.MaxBytesReader(w, r.Body, maxImportSize))
+	if err != nil {
+		// Almost always a malformed or mismatched dump; nothing was changed
+		logging.Server.Ctx(r.Context()).Errorf("Error importing dump: %v", err)
+		http.Error(w, "Import failed: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	logging.Server.Ctx(r.Context()).Infof("Imported dump: %v", counts)
+	a.computeAggregates()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"imported": counts,
+	})
+}
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"dhi-oss-usage/internal/logging"
+)
+
+const (
+	// employeeCheckMaxAge is the default cadence of the employees stage: how
+	// long a project's employee engagement is kept before a refresh checks it again
+	employeeCheckMaxAge = 7 * 24 * time.Hour
+	// employeeStarPages bounds the pages of 100 starred repos read per member,
+	// so a prolific stargazer doesn't eat the rate limit
+	employeeStarPages = 10
+)
+
+// SetEmployeeOrg enables the employee engagement check: adopter repos starred
+// or contributed to by members of this GitHub org (e.g. docker) are flagged, to
+// tell organic adoption from internal dogfooding. Empty disables it.
+func (a *API) SetEmployeeOrg(org string) {
+	a.employeeOrg = org
+}
+
+// fetchEmployeeEngagement counts, for live GitHub projects not checked within
+// the stage's cadence (a week by default), the employee org members who starred the repo or are among its top
+// contributors. Stars come from each member's starred list, read once per run.
+func (a *API) fetchEmployeeEngagement(ctx context.Context, report *refreshReport) {
+	if a.employeeOrg == "" {
+		return
+	}
+	projects, err := a.db.GetLiveGitHubProjects()
+	if err != nil {
+		logging.Refresh.Ctx(ctx).Errorf("Error listing projects for employee check: %v", err)
+		return
+	}
+	projects = a.dueProjects(ctx, "employees", projects, report)
+	if len(projects) == 0 {
+		return
+	}
+
+	members, err := a.ghClient.GetOrgMembers(ctx, a.employeeOrg)
+	if err != nil {
+		logging.Refresh.Ctx(ctx).Errorf("Error listing %s members: %v", a.employeeOrg, err)
+		report.count("employees", "failed", 1)
+		report.addError(err)
+		return
+	}
+	isMember := make(map[string]bool, len(members))
+	for _, m := range members {
+		isMember[m] = true
+	}
+	logging.Refresh.Ctx(ctx).Infof("Checking %d projects against %d %s members...", len(projects), len(members), a.employeeOrg)
+
+	// A member whose stars can't be read would undercount every project, so
+	// nothing is saved unless all of them are read
+	var mu sync.Mutex
+	stars := make(map[string]int)
+	var starFailures int64
+	a.ghClient.Parallel(ctx, len(members), func(i int) {
+		repos, err := a.ghClient.GetStarredRepos(ctx, members[i], employeeStarPages)
+		if err != nil {
+			logging.Refresh.Ctx(ctx).Errorf("Error listing repos starred by %s: %v", members[i], err)
+			atomic.AddInt64(&starFailures, 1)
+			report.addError(err)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		for _, r := range repos {
+			stars[r]++
+		}
+	})
+	if starFailures > 0 || ctx.Err() != nil {
+		logging.Refresh.Ctx(ctx).Warnf("Skipping employee check: starred repos of %d members couldn't be read", starFailures)
+		report.count("employees", "failed", 1)
+		return
+	}
+
+	a.ghClient.Parallel(ctx, len(projects), func(i int) {
+		p := projects[i]
+		contributors, err := a.ghClient.GetTopContributors(ctx, p.RepoFullName)
+		if err != nil {
+			logging.Refresh.Ctx(ctx).Errorf("Error listing contributors of %s: %v", p.RepoFullName, err)
+			report.count("employees", "failed", 1)
+			report.addError(err)
+			return
+		}
+		starring, contributing := stars[strings.ToLower(p.RepoFullName)], 0
+		for _, login := range contributors {
+			if isMember[login] {
+				contributing++
+			}
+		}
+
+		if err := a.db.SetProjectEmployeeEngagement(p.ID, starring, contributing); err != nil {
+			logging.Refresh.Ctx(ctx).Errorf("Error saving employee engagement for %s: %v", p.RepoFullName, err)
+			report.count("employees", "failed", 1)
+			report.countError("database")
+			return
+		}
+		a.recordStageRun(ctx, "employees", p.ID)
+		report.count("employees", "checked", 1)
+		if starring > 0 || contributing > 0 {
+			report.count("employees", "engaged", 1)
+		}
+	})
+	logging.Refresh.Ctx(ctx).Infof("Finished employee engagement check")
+}
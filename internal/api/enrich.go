@@ -0,0 +1,246 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"dhi-oss-usage/internal/db"
+	"dhi-oss-usage/internal/github"
+	"dhi-oss-usage/internal/logging"
+)
+
+// enrichRun is what a refresh hands its enrichment stages
+type enrichRun struct {
+	seenSince time.Time // projects found by this refresh's search have last_seen_at at or after this
+	sample    bool      // a ?sample= refresh, which skips stages marked full
+	report    *refreshReport
+	progress  *refreshProgress // nil outside refresh jobs
+}
+
+// enricher is a stage of the enrichment pipeline that fills in project data
+// after a refresh's search results are saved. Its name is also the report
+// phase its counters go under, and the name ENRICH_DISABLED and ENRICH_BUDGETS
+// refer to it by.
+type enricher struct {
+	name    string
+	full    bool          // only run by full refreshes, not ?sample= ones
+	cadence time.Duration // default time before the stage runs for a project again (0 = every refresh)
+	run     func(a *API, ctx context.Context, run *enrichRun)
+}
+
+// enrichers are the stages in the order they run. Adoption comes first as it
+// marks projects whose file is gone unverified before anything else reads it.
+// To add an enricher, write a function that reads the projects it needs from
+// the store, keeps those dueProjects returns, honors ctx (the stage's budget),
+// calls recordStageRun for each project it's done with and counts into
+// run.report under its name, then list it here.
+var enrichers = []enricher{
+	{"adoption", false, 0, func(a *API, ctx context.Context, run *enrichRun) {
+		a.fetchAdoptionDates(ctx, run.seenSince, run.report)
+	}},
+	{"images", false, 0, func(a *API, ctx context.Context, run *enrichRun) {
+		a.fetchProjectImages(ctx, run.seenSince, run.report)
+	}},
+	{"activity", true, commitActivityMaxAge, func(a *API, ctx context.Context, run *enrichRun) {
+		a.fetchCommitActivity(ctx, run.report)
+	}},
+	{"employees", true, employeeCheckMaxAge, func(a *API, ctx context.Context, run *enrichRun) {
+		a.fetchEmployeeEngagement(ctx, run.report)
+	}},
+	{"star_history", true, starImportMaxAge, func(a *API, ctx context.Context, run *enrichRun) {
+		a.importStarHistory(ctx, run.report)
+	}},
+	{"use_case", true, 0, func(a *API, ctx context.Context, run *enrichRun) {
+		a.classifyProjects(ctx, run.report)
+	}},
+}
+
+// stageResult is the report entry of an enrichment stage
+type stageResult struct {
+	Name            string  `json:"name"`
+	Status          string  `json:"status"` // completed, over_budget, cancelled, disabled, skipped
+	DurationSeconds float64 `json:"duration_seconds"`
+	Budget          string  `json:"budget,omitempty"`
+	Cadence         string  `json:"cadence,omitempty"`
+	CoreRequests    int64   `json:"core_requests"`
+	GraphQLRequests int64   `json:"graphql_requests"`
+}
+
+// SetEnrichment disables enrichment stages by name, bounds how long the
+// others may run (a stage out of budget stops and the next one starts) and
+// overrides how often they run for each project (0 = every refresh).
+// Unknown stage names are an error.
+func (a *API) SetEnrichment(disabled []string, budgets, cadences map[string]time.Duration) error {
+	a.enrichDisabled = make(map[string]bool)
+	a.enrichBudgets = make(map[string]time.Duration)
+	a.enrichCadences = defaultStageCadences()
+	for _, name := range disabled {
+		if !isEnricher(name) {
+			return fmt.Errorf("unknown enrichment stage %q (stages: %s)", name, strings.Join(enricherNames(), ", "))
+		}
+		a.enrichDisabled[name] = true
+	}
+	for name, budget := range budgets {
+		if !isEnricher(name) {
+			return fmt.Errorf("unknown enrichment stage %q (stages: %s)", name, strings.Join(enricherNames(), ", "))
+		}
+		if budget <= 0 {
+			return fmt.Errorf("budget of enrichment stage %s must be positive", name)
+		}
+		a.enrichBudgets[name] = budget
+	}
+	for name, cadence := range cadences {
+		if !isEnricher(name) {
+			return fmt.Errorf("unknown enrichment stage %q (stages: %s)", name, strings.Join(enricherNames(), ", "))
+		}
+		if cadence < 0 {
+			return fmt.Errorf("cadence of enrichment stage %s can't be negative", name)
+		}
+		a.enrichCadences[name] = cadence
+	}
+	return nil
+}
+
+// defaultStageCadences returns the cadence each stage has unless configured
+func defaultStageCadences() map[string]time.Duration {
+	cadences := make(map[string]time.Duration, len(enrichers))
+	for _, e := range enrichers {
+		cadences[e.name] = e.cadence
+	}
+	return cadences
+}
+
+// dueProjects returns the projects a stage last ran for longer ago than its
+// cadence, or never, counting the others as not_due in the report. Spreading
+// slow-changing data over several refreshes keeps each one's API cost down.
+func (a *API) dueProjects(ctx context.Context, stage string, projects []db.Project, report *refreshReport) []db.Project {
+	cadence := a.enrichCadences[stage]
+	if cadence <= 0 || len(projects) == 0 {
+		return projects
+	}
+	runs, err := a.db.GetStageRuns(stage)
+	if err != nil {
+		// Better to spend rate limit than to skip data indefinitely
+		logging.Refresh.Ctx(ctx).Errorf("Error reading %s stage runs: %v", stage, err)
+		return projects
+	}
+	cutoff := time.Now().Add(-cadence)
+	due := make([]db.Project, 0, len(projects))
+	for _, p := range projects {
+		if last, ok := runs[p.ID]; ok && last.After(cutoff) {
+			continue
+		}
+		due = append(due, p)
+	}
+	if notDue := len(projects) - len(due); notDue > 0 {
+		report.count(stage, "not_due", notDue)
+	}
+	return due
+}
+
+// recordStageRun records that a stage ran for a project, so it isn't due
+// again until the stage's cadence has passed. Work cut short by ctx doesn't count.
+func (a *API) recordStageRun(ctx context.Context, stage string, projectID int64) {
+	if ctx.Err() != nil {
+		return
+	}
+	if err := a.db.RecordStageRun(projectID, stage); err != nil {
+		logging.Refresh.Ctx(ctx).Errorf("Error recording %s stage run for project %d: %v", stage, projectID, err)
+	}
+}
+
+func isEnricher(name string) bool {
+	for _, e := range enrichers {
+		if e.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func enricherNames() []string {
+	names := make([]string, len(enrichers))
+	for i, e := range enrichers {
+		names[i] = e.name
+	}
+	return names
+}
+
+// runEnrichment runs the enrichment stages in order, recording each one's
+// outcome, duration and GitHub requests in the report. Stages run one at a
+// time, so the request counts are theirs alone. Once ctx is done (the refresh
+// timed out or the server is stopping) the remaining stages are cancelled.
+func (a *API) runEnrichment(ctx context.Context, run *enrichRun) {
+	var slow []string
+	for _, e := range enrichers {
+		result := stageResult{Name: e.name}
+		switch {
+		case a.enrichDisabled[e.name]:
+			result.Status = "disabled"
+		case e.full && run.sample:
+			result.Status = "skipped"
+		case ctx.Err() != nil:
+			result.Status = "cancelled"
+		default:
+			if run.progress != nil {
+				run.progress.phase("enriching_" + e.name)
+			}
+			a.runStage(ctx, e, run, &result)
+		}
+		run.report.addStage(result)
+		if result.Status == "over_budget" {
+			slow = append(slow, e.name)
+		}
+	}
+	if len(slow) > 0 {
+		logging.Refresh.Ctx(ctx).Warnf("Enrichment stages out of budget: %s", strings.Join(slow, ", "))
+	}
+}
+
+// runStage runs one stage within its budget
+func (a *API) runStage(ctx context.Context, e enricher, run *enrichRun, result *stageResult) {
+	stageCtx := logging.With(ctx, "stage", e.name)
+	if cadence := a.enrichCadences[e.name]; cadence > 0 {
+		result.Cadence = cadence.String()
+	}
+	if budget := a.enrichBudgets[e.name]; budget > 0 {
+		var cancel context.CancelFunc
+		stageCtx, cancel = context.WithTimeout(stageCtx, budget)
+		defer cancel()
+		result.Budget = budget.String()
+	}
+
+	coreBefore, _ := a.ghClient.RequestCounts()
+	graphqlBefore := a.ghClient.GraphQLRequestCount()
+	start := time.Now()
+
+	e.run(a, stageCtx, run)
+
+	result.DurationSeconds = time.Since(start).Round(time.Millisecond).Seconds()
+	coreAfter, _ := a.ghClient.RequestCounts()
+	result.CoreRequests = coreAfter - coreBefore
+	result.GraphQLRequests = a.ghClient.GraphQLRequestCount() - graphqlBefore
+
+	switch {
+	case ctx.Err() != nil:
+		result.Status = "cancelled"
+	case errors.Is(stageCtx.Err(), context.DeadlineExceeded):
+		result.Status = "over_budget"
+	default:
+		result.Status = "completed"
+	}
+	logging.Refresh.Ctx(stageCtx).Debugf("Enrichment stage %s %s in %.1fs (%d core, %d GraphQL requests)", e.name, result.Status, result.DurationSeconds, result.CoreRequests, result.GraphQLRequests)
+}
+
+// transient reports whether a lookup failed in a way worth retrying on the next
+// refresh whatever the stage's cadence: rate limits, timeouts and network errors
+func transient(err error) bool {
+	switch github.ClassifyError(err) {
+	case "rate_limit", "timeout", "network":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"dhi-oss-usage/internal/db"
+	"dhi-oss-usage/internal/logging"
+)
+
+// csvColumn is a column of the project CSV export
+type csvColumn struct {
+	name  string // matches the project's JSON field name
+	value func(p *db.Project) string
+}
+
+// projectCSVColumns are the columns of /api/projects/export?format=csv, in order
+var projectCSVColumns = []csvColumn{
+	{"id", func(p *db.Project) string { return strconv.FormatInt(p.ID, 10) }},
+	{"repo_full_name", func(p *db.Project) string { return p.RepoFullName }},
+	{"provider", func(p *db.Project) string { return p.Provider }},
+	{"github_url", func(p *db.Project) string { return p.GitHubURL }},
+	{"stars", func(p *db.Project) string { return strconv.Itoa(p.Stars) }},
+	{"description", func(p *db.Project) string { return p.Description }},
+	{"primary_language", func(p *db.Project) string { return p.PrimaryLanguage }},
+	{"dockerfile_path", func(p *db.Project) string { return p.DockerfilePath }},
+	{"file_url", func(p *db.Project) string { return p.FileURL }},
+	{"source_type", func(p *db.Project) string { return p.SourceType }},
+	{"file_type", func(p *db.Project) string { return p.FileType }},
+	{"adopted_at", func(p *db.Project) string { return csvTime(p.AdoptedAt) }},
+	{"adoption_commit", func(p *db.Project) string { return p.AdoptionCommit }},
+	{"verification_status", func(p *db.Project) string { return p.VerificationStatus }},
+	{"first_seen_at", func(p *db.Project) string { return csvTime(&p.FirstSeenAt) }},
+	{"last_seen_at", func(p *db.Project) string { return csvTime(&p.LastSeenAt) }},
+	{"status", func(p *db.Project) string { return p.Status }},
+	{"removed_at", func(p *db.Project) string { return csvTime(p.RemovedAt) }},
+	{"archived", func(p *db.Project) string { return strconv.FormatBool(p.Archived) }},
+	{"fork", func(p *db.Project) string { return strconv.FormatBool(p.Fork) }},
+	{"fork_parent", func(p *db.Project) string { return p.ForkParent }},
+	{"license", func(p *db.Project) string { return p.License }},
+	{"topics", func(p *db.Project) string { return strings.Join(p.Topics, ";") }},
+	{"featured_rank", func(p *db.Project) string { return strconv.Itoa(p.FeaturedRank) }},
+	{"attribution", func(p *db.Project) string { return p.Attribution }},
+	{"employee_stars", func(p *db.Project) string { return strconv.Itoa(p.EmployeeStars) }},
+	{"employee_contributors", func(p *db.Project) string { return strconv.Itoa(p.EmployeeContribs) }},
+	{"use_case", func(p *db.Project) string { return p.UseCase }},
+}
+
+// csvTime formats an optional timestamp for CSV, empty when unset
+func csvTime(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// handleProjectsExport streams every project matching the /api/projects filters
+// as CSV (?format=csv, the only format). ?fields= picks and orders the columns.
+// Paging applies only if limit is given, so the default is the full result set.
+func (a *API) handleProjectsExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	if format := q.Get("format"); format != "" && format != "csv" {
+		http.Error(w, "Invalid 'format' parameter. Use 'csv'", http.StatusBadRequest)
+		return
+	}
+	filter, err := a.projectFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	columns := projectCSVColumns
+	if q.Get("fields") != "" {
+		valid := make(map[string]bool, len(projectCSVColumns))
+		byName := make(map[string]csvColumn, len(projectCSVColumns))
+		for _, c := range projectCSVColumns {
+			valid[c.name] = true
+			byName[c.name] = c
+		}
+		fields, err := parseFields(q.Get("fields"), valid)
+		if err != nil {
+			http.Error(w, "Invalid 'fields' parameter: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		columns = make([]csvColumn, len(fields))
+		for i, f := range fields {
+			columns[i] = byName[f]
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="dhi-projects-%s.csv"`, time.Now().UTC().Format("2006-01-02")))
+
+	cw := csv.NewWriter(w)
+	record := make([]string, len(columns))
+	for i, c := range columns {
+		record[i] = c.name
+	}
+	cw.Write(record)
+
+	err = a.readerFor(r).EachProject(filter, func(p db.Project) error {
+		for i, c := range columns {
+			record[i] = c.value(&p)
+		}
+		return cw.Write(record)
+	})
+	cw.Flush()
+	if err == nil {
+		err = cw.Error()
+	}
+	if err != nil {
+		// Headers are already sent, so the response just ends early
+		logging.Server.Ctx(r.Context()).Errorf("Error exporting projects: %v", err)
+	}
+}
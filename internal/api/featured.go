@@ -0,0 +1,82 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"dhi-oss-usage/internal/db"
+	"dhi-oss-usage/internal/logging"
+)
+
+// featuredDocument is the curated featured list accepted by PUT /api/admin/featured,
+// in display order
+type featuredDocument struct {
+	Projects []string `json:"projects"` // repo_full_name of each project
+}
+
+// handleAdminFeatured lists featured projects in order (GET) or replaces the
+// list (PUT). Projects not in the document are unfeatured.
+func (a *API) handleAdminFeatured(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !a.requireAdmin(w, r) {
+		return
+	}
+
+	if r.Method == http.MethodPut {
+		var doc featuredDocument
+		dec := json.NewDecoder(r.Body)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&doc); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid featured document: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		ids := make([]int64, 0, len(doc.Projects))
+		seen := make(map[int64]bool)
+		for _, name := range doc.Projects {
+			p, err := a.db.GetProjectByName(name)
+			if err != nil {
+				logging.Server.Ctx(r.Context()).Errorf("Error getting project %s: %v", name, err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			if p == nil {
+				http.Error(w, fmt.Sprintf("Project %q is not tracked", name), http.StatusBadRequest)
+				return
+			}
+			if seen[p.ID] {
+				http.Error(w, fmt.Sprintf("Project %q is listed more than once", name), http.StatusBadRequest)
+				return
+			}
+			seen[p.ID] = true
+			ids = append(ids, p.ID)
+		}
+
+		if err := a.db.SetFeaturedProjects(ids); err != nil {
+			logging.Server.Ctx(r.Context()).Errorf("Error setting featured projects: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		logging.Server.Ctx(r.Context()).Infof("Featured projects updated: %d projects", len(ids))
+		a.dataChanged()
+	}
+
+	// Featured projects are listed whatever their status, so curators can see
+	// when one has been removed from the public list
+	projects, err := a.db.ListProjects(db.ProjectFilter{Featured: true})
+	if err != nil {
+		logging.Server.Ctx(r.Context()).Errorf("Error listing featured projects: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if projects == nil {
+		json.NewEncoder(w).Encode([]interface{}{})
+		return
+	}
+	json.NewEncoder(w).Encode(projects)
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"dhi-oss-usage/internal/db"
+)
+
+// projectFields are the JSON field names of db.Project accepted by ?fields=
+var projectFields = jsonFieldNames(reflect.TypeOf(db.Project{}))
+
+// jsonFieldNames returns the JSON names of a struct type's encoded fields
+func jsonFieldNames(t reflect.Type) map[string]bool {
+	names := make(map[string]bool, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name == "" {
+			name = t.Field(i).Name
+		}
+		if name != "-" {
+			names[name] = true
+		}
+	}
+	return names
+}
+
+// parseFields splits a comma-separated ?fields= value, rejecting names not in
+// valid. An empty param returns nil, meaning all fields.
+func parseFields(param string, valid map[string]bool) ([]string, error) {
+	if param == "" {
+		return nil, nil
+	}
+	var fields []string
+	for _, f := range strings.Split(param, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		if !valid[f] {
+			return nil, fmt.Errorf("unknown field %q", f)
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// selectProjectFields reduces each project to the requested fields, keeping
+// their usual JSON encoding
+func selectProjectFields(projects []db.Project, fields []string) ([]map[string]json.RawMessage, error) {
+	out := make([]map[string]json.RawMessage, len(projects))
+	for i, p := range projects {
+		encoded, err := json.Marshal(p)
+		if err != nil {
+			return nil, err
+		}
+		var all map[string]json.RawMessage
+		if err := json.Unmarshal(encoded, &all); err != nil {
+			return nil, err
+		}
+		out[i] = make(map[string]json.RawMessage, len(fields))
+		for _, f := range fields {
+			out[i][f] = all[f]
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,165 @@
+package api
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"dhi-oss-usage/internal/github"
+	"dhi-oss-usage/internal/logging"
+)
+
+// degradedPeriodKeep is how long periods of degraded GitHub status are kept
+// for diagnostics after they end
+const degradedPeriodKeep = 7 * 24 * time.Hour
+
+// statusMonitor holds the last check of githubstatus.com and the recent
+// periods in which GitHub's API wasn't fully operational
+type statusMonitor struct {
+	mu        sync.Mutex
+	polling   bool
+	status    *github.ServiceStatus
+	checkedAt *time.Time
+	err       string
+	periods   []degradedPeriod // oldest first; the last is open while the API is degraded
+}
+
+// degradedPeriod is a time GitHub reported its API degraded, down or under
+// maintenance, as seen by the status checks
+type degradedPeriod struct {
+	Start     time.Time  `json:"start"`
+	End       *time.Time `json:"end,omitempty"` // unset while ongoing
+	Status    string     `json:"status"`        // the worst API Requests status seen
+	Incidents []string   `json:"incidents"`
+}
+
+// statusDiagnostics is the GitHub status part of /api/admin/diagnostics
+type statusDiagnostics struct {
+	Status          *github.ServiceStatus `json:"status"`
+	CheckedAt       *time.Time            `json:"checked_at"`
+	Error           string                `json:"error,omitempty"` // of the last check, if it failed
+	DegradedPeriods []degradedPeriod      `json:"degraded_periods"`
+}
+
+// componentSeverity orders status page component statuses, worst last
+var componentSeverity = map[string]int{"operational": 0, "degraded_performance": 1, "under_maintenance": 2, "partial_outage": 3, "major_outage": 4}
+
+// StartStatusMonitor checks githubstatus.com every interval, so diagnostics
+// show GitHub's health and refresh reports note when GitHub was degraded
+func (a *API) StartStatusMonitor(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	a.statusMonitor.mu.Lock()
+	a.statusMonitor.polling = true
+	a.statusMonitor.mu.Unlock()
+	go func() {
+		a.checkGitHubStatus(context.Background())
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			a.checkGitHubStatus(context.Background())
+		}
+	}()
+}
+
+// checkGitHubStatus reads githubstatus.com and records the result, opening a
+// degraded period when the API stops being operational and closing it when
+// it recovers. A failed check leaves the periods as they were.
+func (a *API) checkGitHubStatus(ctx context.Context) (*github.ServiceStatus, error) {
+	status, err := github.GetServiceStatus(ctx)
+	now := time.Now().UTC()
+
+	m := &a.statusMonitor
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.checkedAt = &now
+	if err != nil {
+		m.err = err.Error()
+		return nil, err
+	}
+	m.status, m.err = status, ""
+
+	var open *degradedPeriod
+	if n := len(m.periods); n > 0 && m.periods[n-1].End == nil {
+		open = &m.periods[n-1]
+	}
+	api := status.Components[github.APIComponent]
+	switch {
+	case api != "" && api != "operational" && open == nil:
+		m.periods = append(m.periods, degradedPeriod{Start: now, Status: api, Incidents: status.Incidents})
+		logging.Server.Warnf("GitHub %s: %s (%s)", github.APIComponent, strings.ReplaceAll(api, "_", " "), strings.Join(status.Incidents, "; "))
+	case api != "" && api != "operational":
+		if componentSeverity[api] > componentSeverity[open.Status] {
+			open.Status = api
+		}
+		for _, incident := range status.Incidents {
+			if !containsString(open.Incidents, incident) {
+				open.Incidents = append(open.Incidents, incident)
+			}
+		}
+	case open != nil:
+		open.End = &now
+		logging.Server.Infof("GitHub %s operational again", github.APIComponent)
+	}
+
+	// Drop periods that ended long ago
+	kept := m.periods[:0]
+	for _, p := range m.periods {
+		if p.End == nil || now.Sub(*p.End) < degradedPeriodKeep {
+			kept = append(kept, p)
+		}
+	}
+	m.periods = kept
+	return status, nil
+}
+
+// degradedDuring returns the degraded periods overlapping from start to end,
+// checking the status again first when it is being monitored, so a refresh
+// finishing during an incident is annotated with it
+func (a *API) degradedDuring(start, end time.Time) []degradedPeriod {
+	a.statusMonitor.mu.Lock()
+	polling := a.statusMonitor.polling
+	a.statusMonitor.mu.Unlock()
+	if polling {
+		a.checkGitHubStatus(context.Background())
+	}
+
+	a.statusMonitor.mu.Lock()
+	defer a.statusMonitor.mu.Unlock()
+	var during []degradedPeriod
+	for _, p := range a.statusMonitor.periods {
+		if !p.Start.After(end) && (p.End == nil || p.End.After(start)) {
+			p.Incidents = append([]string{}, p.Incidents...)
+			during = append(during, p)
+		}
+	}
+	return during
+}
+
+// statusDiagnostics returns the last status check, or nil if GitHub's
+// status has never been checked
+func (a *API) statusDiagnostics() *statusDiagnostics {
+	m := &a.statusMonitor
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.checkedAt == nil {
+		return nil
+	}
+	return &statusDiagnostics{
+		Status:          m.status,
+		CheckedAt:       m.checkedAt,
+		Error:           m.err,
+		DegradedPeriods: append([]degradedPeriod{}, m.periods...),
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"dhi-oss-usage/internal/db"
+	"dhi-oss-usage/internal/github"
+	"dhi-oss-usage/internal/gitlab"
+	"dhi-oss-usage/internal/logging"
+)
+
+// SetGitLabClient enables scanning GitLab alongside GitHub on every refresh
+func (a *API) SetGitLabClient(c *gitlab.Client) {
+	a.glClient = c
+}
+
+// fetchGitLabProjects searches GitLab and returns its projects ready to upsert, and
+// whether the results are complete. GitLab failures are reported but don't fail
+// the refresh, so GitHub results are still saved.
+func (a *API) fetchGitLabProjects(ctx context.Context, report *refreshReport) ([]db.Project, bool) {
+	projects, stats, err := a.glClient.FetchAllProjects(ctx)
+	if stats != nil {
+		report.count("gitlab", "repos_discovered", stats.ReposDiscovered)
+		report.count("gitlab", "fetched", stats.DetailsFetched)
+		report.count("gitlab", "failed", stats.DetailsFailed)
+	}
+	if err != nil {
+		logging.Refresh.Ctx(ctx).Errorf("Error fetching GitLab projects: %v", err)
+		report.addError(err)
+		report.sourceError("gitlab", err)
+	}
+
+	host := a.glClient.Host()
+	out := make([]db.Project, 0, len(projects))
+	for _, p := range projects {
+		project := db.Project{
+			// Namespaced by host: GitHub owner names can't contain dots, so these never collide
+			RepoFullName:    host + "/" + p.FullName,
+			Provider:        "gitlab",
+			GitHubURL:       p.WebURL,
+			Stars:           p.Stars,
+			Description:     p.Description,
+			PrimaryLanguage: p.PrimaryLanguage,
+			DockerfilePath:  p.FilePath,
+			FileURL:         p.FileURL,
+			SourceType:      p.SourceType,
+			FileType:        github.ClassifyFileType(p.FilePath),
+			Archived:        p.Archived,
+			Fork:            p.ForkParent != "",
+			Topics:          p.Topics,
+		}
+		if p.ForkParent != "" {
+			project.ForkParent = host + "/" + p.ForkParent
+		}
+		out = append(out, project)
+	}
+	return out, err == nil && stats != nil && stats.DetailsFailed == 0
+}
+
+// fetchGitLabAdoptionDates dates GitLab projects one at a time; GitLab requests
+// don't go through the GitHub worker pool or its rate limiter
+func (a *API) fetchGitLabAdoptionDates(ctx context.Context, projects []db.Project, report *refreshReport) {
+	host := a.glClient.Host()
+	for i, p := range projects {
+		if ctx.Err() != nil {
+			return
+		}
+
+		commit, err := a.glClient.GetFileFirstCommit(ctx, strings.TrimPrefix(p.RepoFullName, host+"/"), p.DockerfilePath)
+		if !transient(err) {
+			a.recordStageRun(ctx, "adoption", p.ID)
+		}
+		if errors.Is(err, gitlab.ErrFileNotFound) {
+			logging.Refresh.Ctx(ctx).Infof("Adoption file for %s no longer exists (%d/%d), marking unverified", p.RepoFullName, i+1, len(projects))
+			report.count("adoption", "file_missing", 1)
+			if err := a.db.SetProjectVerification(p.ID, "file_missing"); err != nil {
+				logging.Refresh.Ctx(ctx).Errorf("Error updating verification for %s: %v", p.RepoFullName, err)
+			}
+			continue
+		}
+		if err != nil {
+			logging.Refresh.Ctx(ctx).Errorf("Error getting adoption info for %s (%d/%d): %v", p.RepoFullName, i+1, len(projects), err)
+			report.count("adoption", "failed", 1)
+			report.addError(err)
+			continue
+		}
+
+		if err := a.db.UpdateProjectAdoption(p.ID, commit.CreatedAt, commit.WebURL); err != nil {
+			logging.Refresh.Ctx(ctx).Errorf("Error updating adoption info for %s: %v", p.RepoFullName, err)
+			report.count("adoption", "failed", 1)
+		} else {
+			report.count("adoption", "dated", 1)
+			logging.Refresh.Ctx(ctx).Debugf("Set adoption for %s (%d/%d): %s (%s)", p.RepoFullName, i+1, len(projects), commit.CreatedAt.Format("2006-01-02"), commit.WebURL)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"dhi-oss-usage/internal/logging"
+)
+
+// heatmapWeekdays names the rows of the adoption heatmap, Monday first as
+// weeks start elsewhere in the API
+var heatmapWeekdays = []string{"monday", "tuesday", "wednesday", "thursday", "friday", "saturday", "sunday"}
+
+// adoptionHeatmap is the response of /api/stats/heatmap
+type adoptionHeatmap struct {
+	Timezone  string       `json:"timezone"`
+	Days      int          `json:"days"` // 0 = all adoptions
+	Total     int          `json:"total"`
+	Weekdays  []string     `json:"weekdays"`
+	Counts    [7][24]int   `json:"counts"` // [weekday][hour]
+	ByWeekday [7]int       `json:"by_weekday"`
+	ByHour    [24]int      `json:"by_hour"`
+	Peak      *heatmapPeak `json:"peak"` // null without adoptions
+}
+
+// heatmapPeak is the busiest cell of the heatmap
+type heatmapPeak struct {
+	Weekday string `json:"weekday"`
+	Hour    int    `json:"hour"`
+	Count   int    `json:"count"`
+}
+
+// handleHeatmap counts adoption commits by weekday and hour, showing when
+// adoption happens so announcements can be timed for it. Commit times are
+// bucketed in UTC unless ?tz= names an IANA time zone.
+func (a *API) handleHeatmap(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	days := 0
+	if v := q.Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, "Invalid 'days' parameter. Use a positive number, or 0 for all adoptions", http.StatusBadRequest)
+			return
+		}
+		days = n
+	}
+	loc := time.UTC
+	if tz := q.Get("tz"); tz != "" {
+		var err error
+		if loc, err = time.LoadLocation(tz); err != nil {
+			http.Error(w, "Invalid 'tz' parameter. Use an IANA time zone such as Europe/Berlin", http.StatusBadRequest)
+			return
+		}
+	}
+	// A window of days moves with the date
+	if a.notModified(w, r, time.Now().UTC().Format("2006-01-02")) {
+		return
+	}
+
+	times, err := a.readerFor(r).GetAdoptionCommitTimes(days)
+	if err != nil {
+		logging.Server.Ctx(r.Context()).Errorf("Error getting adoption commit times: %v", err)
+		readFailed(w, r)
+		return
+	}
+
+	heatmap := adoptionHeatmap{Timezone: loc.String(), Days: days, Total: len(times), Weekdays: heatmapWeekdays}
+	for _, t := range times {
+		t = t.In(loc)
+		day := (int(t.Weekday()) + 6) % 7 // Monday = 0
+		heatmap.Counts[day][t.Hour()]++
+		heatmap.ByWeekday[day]++
+		heatmap.ByHour[t.Hour()]++
+	}
+	for day := range heatmap.Counts {
+		for hour, n := range heatmap.Counts[day] {
+			if n > 0 && (heatmap.Peak == nil || n > heatmap.Peak.Count) {
+				heatmap.Peak = &heatmapPeak{Weekday: heatmapWeekdays[day], Hour: hour, Count: n}
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(heatmap)
+}
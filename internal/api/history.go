@@ -0,0 +1,131 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"dhi-oss-usage/internal/db"
+	"dhi-oss-usage/internal/logging"
+)
+
+// handleHistorySnapshots returns live project counts per value of a dimension
+// (source_type, file_type, language or provider) from the last refresh snapshot
+// of each day, for segmented trend charts
+func (a *API) handleHistorySnapshots(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	dimension := r.URL.Query().Get("dimension")
+	if dimension == "" {
+		dimension = "source_type"
+	}
+	if !db.IsSnapshotDimension(dimension) {
+		http.Error(w, "Invalid 'dimension' parameter. Use 'source_type', 'file_type', 'language' or 'provider'", http.StatusBadRequest)
+		return
+	}
+	days := 30
+	if v, err := strconv.Atoi(r.URL.Query().Get("days")); err == nil && v > 0 {
+		days = v
+	}
+
+	segments, err := a.readerFor(r).GetSnapshotSegments(dimension, days)
+	if err != nil {
+		logging.Server.Ctx(r.Context()).Errorf("Error getting snapshot segments: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if segments == nil {
+		segments = []db.SnapshotSegment{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"dimension": dimension,
+		"segments":  segments,
+	})
+}
+
+// handleHistorySourceTypes returns daily adoptions split by discovery channel:
+// the search that found each project (source_type), or with ?by=file_type the
+// kind of file (dockerfile, compose, github_actions, ...)
+func (a *API) handleHistorySourceTypes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	by := r.URL.Query().Get("by")
+	if by == "" {
+		by = "source_type"
+	}
+	if by != "source_type" && by != "file_type" {
+		http.Error(w, "Invalid 'by' parameter. Use 'source_type' or 'file_type'", http.StatusBadRequest)
+		return
+	}
+	days := 30
+	if v, err := strconv.Atoi(r.URL.Query().Get("days")); err == nil && v > 0 {
+		days = v
+	}
+
+	adoptions, err := a.readerFor(r).GetAdoptionBySegment(by, days)
+	if err != nil {
+		logging.Server.Ctx(r.Context()).Errorf("Error getting adoption by %s: %v", by, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if adoptions == nil {
+		adoptions = []db.AdoptionBySegment{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"by":        by,
+		"adoptions": adoptions,
+	})
+}
+
+// handleProjectStars returns a project's daily star counts over the last ?days=
+// days (default 90), recorded at each refresh
+func (a *API) handleProjectStars(w http.ResponseWriter, r *http.Request, id int64) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	days := 90
+	if v, err := strconv.Atoi(r.URL.Query().Get("days")); err == nil && v > 0 {
+		days = v
+	}
+
+	project, err := a.readerFor(r).GetProject(id)
+	if err != nil {
+		logging.Server.Ctx(r.Context()).Errorf("Error getting project %d: %v", id, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if project == nil {
+		http.Error(w, "Project not found", http.StatusNotFound)
+		return
+	}
+
+	history, err := a.readerFor(r).GetStarHistory(id, days)
+	if err != nil {
+		logging.Server.Ctx(r.Context()).Errorf("Error getting star history for project %d: %v", id, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if history == nil {
+		history = []db.StarHistoryPoint{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"project_id":     project.ID,
+		"repo_full_name": project.RepoFullName,
+		"stars":          project.Stars,
+		"history":        history,
+	})
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"dhi-oss-usage/internal/logging"
+)
+
+// SetCacheMaxAge sets how long browsers and CDNs may reuse a cacheable read
+// response before revalidating it. With 0 they revalidate every time, which
+// is still cheap: an unchanged response is a 304 with no body.
+func (a *API) SetCacheMaxAge(d time.Duration) {
+	a.cacheMaxAge = d
+}
+
+// dataChanged marks project data as changed outside a refresh (an admin edit
+// or a webhook), so cached read responses are no longer current
+func (a *API) dataChanged() {
+	a.dataGeneration.Add(1)
+}
+
+// notModified makes a read response cacheable. Its ETag is derived from the
+// last completed refresh, changes since (dataChanged), this process (so a
+// restart with different code doesn't serve old shapes) and everything about
+// the request the response depends on: API version, path, query, the Accept
+// headers and the API key (which can choose a response format), plus any
+// extra keys the handler adds (e.g. the current week). If the client already
+// has that version, a 304 is written and notModified returns true.
+func (a *API) notModified(w http.ResponseWriter, r *http.Request, extra ...string) bool {
+	last, err := a.readerFor(r).GetLastCompletedRefreshJob()
+	if err != nil {
+		// Serve the response uncached rather than risk a stale 304
+		logging.Server.Ctx(r.Context()).Errorf("Error getting last refresh for ETag: %v", err)
+		return false
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%d|%d|v%d|", a.startedAt.UnixNano(), a.dataGeneration.Load(), apiVersion(r))
+	if last != nil && last.CompletedAt != nil {
+		fmt.Fprintf(h, "%d|%d|", last.ID, last.CompletedAt.UnixNano())
+	}
+	for _, part := range append([]string{r.URL.Path, r.URL.RawQuery, r.Header.Get("Accept"), r.Header.Get("Accept-Language"), r.Header.Get("X-API-Key")}, extra...) {
+		io.WriteString(h, part+"|")
+	}
+	// Weak, as the encoding of the body may differ (e.g. compressed by a proxy)
+	etag := `W/"` + hex.EncodeToString(h.Sum(nil)[:12]) + `"`
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d, must-revalidate", int(a.cacheMaxAge.Seconds())))
+	w.Header().Add("Vary", "Accept, Accept-Language, X-API-Key")
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return true
+	}
+	return false
+}
+
+// etagMatches reports whether an If-None-Match header lists etag, comparing
+// weakly as RFC 9110 requires for If-None-Match
+func etagMatches(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+	opaque := strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == opaque {
+			return true
+		}
+	}
+	return false
+}
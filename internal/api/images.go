@@ -0,0 +1,167 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"dhi-oss-usage/internal/db"
+	"dhi-oss-usage/internal/github"
+	"dhi-oss-usage/internal/logging"
+)
+
+// handleImages returns each DHI image used by active projects with per-image
+// and per-tag adoption counts
+func (a *API) handleImages(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var usage []db.ImageUsage
+	if !a.readAggregate("images", &usage) {
+		var err error
+		if usage, err = a.readerFor(r).GetImageUsage(); err != nil {
+			logging.Server.Ctx(r.Context()).Errorf("Error getting image usage: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if usage == nil {
+		json.NewEncoder(w).Encode([]interface{}{})
+		return
+	}
+	json.NewEncoder(w).Encode(usage)
+}
+
+// topImage is an entry of /api/images/top
+type topImage struct {
+	db.ImageRank
+	Change int                  `json:"change"` // projects gained (or lost) over the trend window
+	Trend  []db.ImageTrendPoint `json:"trend"`
+}
+
+// handleImagesTop returns the most used DHI images with their combined stars and
+// daily usage over the last ?days= days (default 30) from refresh snapshots
+func (a *API) handleImagesTop(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	limit := 10
+	if v, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && v > 0 && v <= maxTopImages {
+		limit = v
+	}
+	days := 30
+	if v, err := strconv.Atoi(r.URL.Query().Get("days")); err == nil && v > 0 {
+		days = v
+	}
+
+	var ranks []db.ImageRank
+	if a.readAggregate("images_top", &ranks) {
+		if len(ranks) > limit {
+			ranks = ranks[:limit]
+		}
+	} else {
+		var err error
+		if ranks, err = a.readerFor(r).GetTopImages(limit); err != nil {
+			logging.Server.Ctx(r.Context()).Errorf("Error getting top images: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+	names := make([]string, len(ranks))
+	for i, rank := range ranks {
+		names[i] = rank.Image
+	}
+	trends, err := a.readerFor(r).GetImageTrends(names, days)
+	if err != nil {
+		logging.Server.Ctx(r.Context()).Errorf("Error getting image trends: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	top := make([]topImage, len(ranks))
+	for i, rank := range ranks {
+		trend := trends[rank.Image]
+		top[i] = topImage{ImageRank: rank, Trend: trend}
+		if len(trend) > 0 {
+			top[i].Change = rank.Projects - trend[0].Projects
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(top)
+}
+
+// fetchProjectImages reads the Dockerfile of each GitHub project found since
+// seenSince and records the DHI images it builds from. Contents are revalidated
+// by ETag, so Dockerfiles unchanged since the last refresh don't use rate limit.
+func (a *API) fetchProjectImages(ctx context.Context, seenSince time.Time, report *refreshReport) {
+	candidates, err := a.db.ListProjects(db.ProjectFilter{Provider: "github", FileType: "dockerfile", Status: "active"})
+	if err != nil {
+		logging.Refresh.Ctx(ctx).Errorf("Error listing projects for image extraction: %v", err)
+		return
+	}
+	var projects []db.Project
+	for _, p := range candidates {
+		if !p.LastSeenAt.Before(seenSince) {
+			projects = append(projects, p)
+		}
+	}
+	projects = a.dueProjects(ctx, "images", projects, report)
+	if len(projects) == 0 {
+		return
+	}
+
+	logging.Refresh.Ctx(ctx).Infof("Extracting DHI images from %d Dockerfiles...", len(projects))
+
+	var done int64
+	a.ghClient.Parallel(ctx, len(projects), func(i int) {
+		p := projects[i]
+
+		content, err := a.ghClient.GetFileContentCached(ctx, p.RepoFullName, p.DockerfilePath)
+		if err != nil && strings.Contains(err.Error(), "rate limited") {
+			// The client has paused all workers; retry once the backoff expires
+			content, err = a.ghClient.GetFileContentCached(ctx, p.RepoFullName, p.DockerfilePath)
+		}
+		n := atomic.AddInt64(&done, 1)
+		if errors.Is(err, github.ErrFileNotFound) {
+			report.count("images", "file_missing", 1)
+			return
+		}
+		if err != nil {
+			logging.Refresh.Ctx(ctx).Errorf("Error fetching Dockerfile for %s (%d/%d): %v", p.RepoFullName, n, len(projects), err)
+			report.count("images", "failed", 1)
+			report.addError(err)
+			return
+		}
+
+		refs := github.ParseDockerfileImages(content)
+		images := make([]db.ProjectImage, len(refs))
+		for j, ref := range refs {
+			images[j] = db.ProjectImage{Image: ref.Image, Tag: ref.Tag, Digest: ref.Digest}
+		}
+		if err := a.db.SetProjectImages(p.ID, images); err != nil {
+			logging.Refresh.Ctx(ctx).Errorf("Error saving images for %s: %v", p.RepoFullName, err)
+			report.count("images", "failed", 1)
+			report.countError("database")
+			return
+		}
+		a.recordStageRun(ctx, "images", p.ID)
+		report.count("images", "parsed", 1)
+		if len(images) == 0 {
+			// e.g. dhi.io only appears in a comment or a COPY --from
+			report.count("images", "no_dhi_from", 1)
+		}
+	})
+	logging.Refresh.Ctx(ctx).Infof("Finished extracting DHI images")
+}
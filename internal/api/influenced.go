@@ -0,0 +1,172 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"dhi-oss-usage/internal/logging"
+)
+
+// influencedMethods are the ways /api/stats/stars-influenced can count stars:
+// as they were when each project adopted DHI, as they are now, or the
+// difference (stars gained since adopting)
+var influencedMethods = map[string]bool{"at_adoption": true, "current": true, "gained": true}
+
+// starsInfluenced is the response of /api/stats/stars-influenced
+type starsInfluenced struct {
+	Since           string              `json:"since"`
+	Until           string              `json:"until"` // inclusive
+	Method          string              `json:"method"`
+	Projects        int                 `json:"projects"`
+	Stars           int                 `json:"stars"` // by method
+	StarsAtAdoption int                 `json:"stars_at_adoption"`
+	StarsCurrent    int                 `json:"stars_current"`
+	StarsGained     int                 `json:"stars_gained"`
+	Estimated       int                 `json:"estimated"` // projects with no star count on or before their adoption day
+	Top             []influencedProject `json:"top"`
+}
+
+// influencedProject is one of the projects contributing most to the total
+type influencedProject struct {
+	RepoFullName    string    `json:"repo_full_name"`
+	AdoptedAt       time.Time `json:"adopted_at"`
+	Stars           int       `json:"stars"` // by method
+	StarsAtAdoption int       `json:"stars_at_adoption"`
+	StarsCurrent    int       `json:"stars_current"`
+	Estimated       bool      `json:"estimated,omitempty"`
+}
+
+// influencedTop is how many projects are listed under top
+const influencedTop = 10
+
+// handleStarsInfluenced totals the stars of live projects adopted in a period,
+// so reports can say "projects representing X stars adopted DHI this quarter".
+// Current stars include growth since adopting, which DHI didn't cause, so the
+// default counts each project's stars on its adoption day instead, from star
+// history. A project tracked or imported only after it adopted is counted with
+// its earliest known stars (or its current stars, without any history) and
+// reported as estimated.
+func (a *API) handleStarsInfluenced(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	method := q.Get("method")
+	if method == "" {
+		method = "at_adoption"
+	}
+	if !influencedMethods[method] {
+		http.Error(w, "Invalid 'method' parameter. Use 'at_adoption', 'current' or 'gained'", http.StatusBadRequest)
+		return
+	}
+	since, until, errMsg := influencedPeriod(q.Get("period"), q.Get("since"), q.Get("until"), time.Now())
+	if errMsg != "" {
+		http.Error(w, errMsg, http.StatusBadRequest)
+		return
+	}
+	// Periods ending today change as the day goes on
+	if a.notModified(w, r, time.Now().UTC().Format("2006-01-02")) {
+		return
+	}
+
+	adopted, err := a.readerFor(r).GetAdoptionStars(since, until.AddDate(0, 0, 1))
+	if err != nil {
+		logging.Server.Ctx(r.Context()).Errorf("Error getting stars at adoption: %v", err)
+		readFailed(w, r)
+		return
+	}
+
+	excludeForks := a.excludeForksParam(r)
+	result := starsInfluenced{
+		Since:  since.Format("2006-01-02"),
+		Until:  until.Format("2006-01-02"),
+		Method: method,
+		Top:    []influencedProject{},
+	}
+	for _, p := range adopted {
+		if excludeForks && p.Fork {
+			continue
+		}
+		entry := influencedProject{RepoFullName: p.RepoFullName, AdoptedAt: p.AdoptedAt, StarsCurrent: p.Stars}
+		switch {
+		case p.StarsAtAdoption != nil:
+			entry.StarsAtAdoption = *p.StarsAtAdoption
+		case p.StarsAfterAdoption != nil:
+			entry.StarsAtAdoption, entry.Estimated = *p.StarsAfterAdoption, true
+		default:
+			entry.StarsAtAdoption, entry.Estimated = p.Stars, true
+		}
+		gained := max(entry.StarsCurrent-entry.StarsAtAdoption, 0)
+		switch method {
+		case "at_adoption":
+			entry.Stars = entry.StarsAtAdoption
+		case "current":
+			entry.Stars = entry.StarsCurrent
+		case "gained":
+			entry.Stars = gained
+		}
+
+		result.Projects++
+		result.Stars += entry.Stars
+		result.StarsAtAdoption += entry.StarsAtAdoption
+		result.StarsCurrent += entry.StarsCurrent
+		result.StarsGained += gained
+		if entry.Estimated {
+			result.Estimated++
+		}
+		result.Top = append(result.Top, entry)
+	}
+	sort.SliceStable(result.Top, func(i, j int) bool { return result.Top[i].Stars > result.Top[j].Stars })
+	if len(result.Top) > influencedTop {
+		result.Top = result.Top[:influencedTop]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// influencedPeriod returns the first and last day (UTC) of the adoptions to
+// count: since and until (YYYY-MM-DD, inclusive), or the current month,
+// quarter (default) or year up to today. A non-empty message is a bad request.
+func influencedPeriod(period, sinceStr, untilStr string, now time.Time) (since, until time.Time, errMsg string) {
+	now = now.UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	if sinceStr != "" || untilStr != "" {
+		if period != "" {
+			return since, until, "'period' can't be combined with 'since' or 'until'"
+		}
+		if sinceStr == "" {
+			return since, until, "'until' needs 'since'"
+		}
+		var err error
+		if since, err = time.Parse("2006-01-02", sinceStr); err != nil {
+			return since, until, "Invalid 'since' parameter. Use a date like 2026-07-01"
+		}
+		until = today
+		if untilStr != "" {
+			if until, err = time.Parse("2006-01-02", untilStr); err != nil {
+				return since, until, "Invalid 'until' parameter. Use a date like 2026-09-30"
+			}
+		}
+		if until.Before(since) {
+			return since, until, "'until' is before 'since'"
+		}
+		return since, until, ""
+	}
+
+	switch period {
+	case "month":
+		since = time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, time.UTC)
+	case "", "quarter":
+		since = time.Date(today.Year(), today.Month()-(today.Month()-1)%3, 1, 0, 0, 0, 0, time.UTC)
+	case "year":
+		since = time.Date(today.Year(), time.January, 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return since, until, "Invalid 'period' parameter. Use 'month', 'quarter' or 'year'"
+	}
+	return since, today, ""
+}
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"dhi-oss-usage/internal/db"
+)
+
+// Bounds on list parameters so one request can't hold a connection for an
+// unbounded scan. Limits above the maximum are clamped; offsets are rejected,
+// since SQLite still walks every skipped row.
+const (
+	maxListLimit  = 1000
+	maxListOffset = 100000
+
+	// defaultRequestTimeout bounds API requests (and their queries) unless
+	// overridden per route
+	defaultRequestTimeout = 30 * time.Second
+)
+
+// defaultRouteTimeouts override the request timeout for routes that stream or
+// wait on other services. 0 means no timeout.
+var defaultRouteTimeouts = map[string]time.Duration{
+	"/api/projects/export": 0,
+	"/api/export":          0,
+	"/api/import":          0,
+	"/api/admin/publish":   2 * time.Minute,
+}
+
+// SetRequestTimeouts sets the timeout of API requests and per-route overrides,
+// keyed by route pattern as registered ("/api/projects/" covers every
+// /api/projects/:id path). A timeout of 0 disables it.
+func (a *API) SetRequestTimeouts(timeout time.Duration, routes map[string]time.Duration) {
+	a.requestTimeout = timeout
+	a.routeTimeouts = routes
+}
+
+// routeTimeout returns the timeout of a route pattern
+func (a *API) routeTimeout(pattern string) time.Duration {
+	if t, ok := a.routeTimeouts[pattern]; ok {
+		return t
+	}
+	if t, ok := defaultRouteTimeouts[pattern]; ok {
+		return t
+	}
+	return a.requestTimeout
+}
+
+// readFailed responds to a failed read: 503 if the request ran out of time,
+// which says the query was too expensive rather than the server broken, else 500
+func readFailed(w http.ResponseWriter, r *http.Request) {
+	if errors.Is(r.Context().Err(), context.DeadlineExceeded) {
+		http.Error(w, "Request timed out; narrow the query or page with a smaller limit", http.StatusServiceUnavailable)
+		return
+	}
+	http.Error(w, "Internal server error", http.StatusInternalServerError)
+}
+
+// readerFor returns the read store bound to the request's context, so its
+// queries are interrupted when the request times out or the client goes away
+func (a *API) readerFor(r *http.Request) db.Store {
+	return a.reader.WithContext(r.Context())
+}
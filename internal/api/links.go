@@ -0,0 +1,133 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"dhi-oss-usage/internal/db"
+	"dhi-oss-usage/internal/logging"
+)
+
+// projectLinkKinds are the accepted kinds of project links
+var projectLinkKinds = map[string]bool{"blog": true, "case_study": true, "talk": true, "other": true}
+
+// linkRequest is the body of POST /api/admin/links
+type linkRequest struct {
+	Project string `json:"project"` // repo_full_name
+	Kind    string `json:"kind"`
+	Title   string `json:"title"`
+	URL     string `json:"url"`
+}
+
+// handleProjectLinks returns the external links (blog posts, case studies, talks)
+// attached to a project
+func (a *API) handleProjectLinks(w http.ResponseWriter, r *http.Request, id int64) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	project, err := a.readerFor(r).GetProject(id)
+	if err != nil {
+		logging.Server.Ctx(r.Context()).Errorf("Error getting project %d: %v", id, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if project == nil {
+		http.Error(w, "Project not found", http.StatusNotFound)
+		return
+	}
+
+	links, err := a.readerFor(r).GetProjectLinks(id)
+	if err != nil {
+		logging.Server.Ctx(r.Context()).Errorf("Error getting links for project %d: %v", id, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if links == nil {
+		json.NewEncoder(w).Encode([]interface{}{})
+		return
+	}
+	json.NewEncoder(w).Encode(links)
+}
+
+// handleAdminLinks attaches an external link to a project
+func (a *API) handleAdminLinks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !a.requireAdmin(w, r) {
+		return
+	}
+
+	var req linkRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid link: %v", err), http.StatusBadRequest)
+		return
+	}
+	if !projectLinkKinds[req.Kind] {
+		http.Error(w, "kind must be one of: blog, case_study, talk, other", http.StatusBadRequest)
+		return
+	}
+	if u, err := url.Parse(req.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		http.Error(w, "url must be an absolute http(s) URL", http.StatusBadRequest)
+		return
+	}
+
+	project, err := a.db.GetProjectByName(req.Project)
+	if err != nil {
+		logging.Server.Ctx(r.Context()).Errorf("Error getting project %s: %v", req.Project, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if project == nil {
+		http.Error(w, fmt.Sprintf("Project %q is not tracked", req.Project), http.StatusBadRequest)
+		return
+	}
+
+	link := db.ProjectLink{ProjectID: project.ID, Kind: req.Kind, Title: strings.TrimSpace(req.Title), URL: req.URL}
+	if err := a.db.AddProjectLink(&link); err != nil {
+		logging.Server.Ctx(r.Context()).Errorf("Error adding link to %s: %v", project.RepoFullName, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(link)
+}
+
+// handleAdminLink handles DELETE /api/admin/links/:id
+func (a *API) handleAdminLink(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, "/api/admin/links/"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid link ID", http.StatusBadRequest)
+		return
+	}
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !a.requireAdmin(w, r) {
+		return
+	}
+
+	deleted, err := a.db.DeleteProjectLink(id)
+	if err != nil {
+		logging.Server.Ctx(r.Context()).Errorf("Error deleting link %d: %v", id, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !deleted {
+		http.Error(w, "Link not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,43 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"dhi-oss-usage/internal/i18n"
+)
+
+// localeInfo is an entry of /api/locales
+type localeInfo struct {
+	Tag  string `json:"tag"`
+	Name string `json:"name"`
+}
+
+// localeFor returns the locale of a response with display strings: ?lang= if
+// supported, else the best match for Accept-Language, else English
+func localeFor(w http.ResponseWriter, r *http.Request) *i18n.Locale {
+	loc, ok := i18n.Get(r.URL.Query().Get("lang"))
+	if !ok {
+		loc = i18n.Match(r.Header.Get("Accept-Language"))
+		w.Header().Add("Vary", "Accept-Language")
+	}
+	w.Header().Set("Content-Language", loc.Tag)
+	return loc
+}
+
+// handleLocales lists the locales server-generated text can be produced in
+func (a *API) handleLocales(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	tags := i18n.Tags()
+	locales := make([]localeInfo, len(tags))
+	for i, tag := range tags {
+		loc, _ := i18n.Get(tag)
+		locales[i] = localeInfo{Tag: loc.Tag, Name: loc.Name}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(locales)
+}
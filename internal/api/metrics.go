@@ -0,0 +1,129 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"dhi-oss-usage/internal/db"
+	"dhi-oss-usage/internal/logging"
+)
+
+// handleMetrics serves adoption metrics in the Prometheus text format at
+// /metrics, so Grafana and Alertmanager can chart and alert on them. Counts
+// are of live projects, as on /api/stats, and come from the aggregates where
+// they exist.
+func (a *API) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	store := a.readerFor(r)
+	var stats dashboardStats
+	if !a.readAggregate("stats", &stats) {
+		var err error
+		if stats, err = computeStats(store, false); err != nil {
+			logging.Server.Ctx(r.Context()).Errorf("Error getting stats: %v", err)
+			readFailed(w, r)
+			return
+		}
+	}
+	new7d, err := store.GetNewProjectsCount(time.Now().UTC().AddDate(0, 0, -7))
+	if err != nil {
+		logging.Server.Ctx(r.Context()).Errorf("Error counting new projects: %v", err)
+		readFailed(w, r)
+		return
+	}
+	languages, err := store.GetBreakdown("language")
+	if err != nil {
+		logging.Server.Ctx(r.Context()).Errorf("Error getting language breakdown: %v", err)
+		readFailed(w, r)
+		return
+	}
+	var images []db.ImageUsage
+	if !a.readAggregate("images", &images) {
+		if images, err = store.GetImageUsage(); err != nil {
+			logging.Server.Ctx(r.Context()).Errorf("Error getting image usage: %v", err)
+			readFailed(w, r)
+			return
+		}
+	}
+	lastRefresh, err := store.GetLastCompletedRefreshJob()
+	if err != nil {
+		logging.Server.Ctx(r.Context()).Errorf("Error getting last refresh: %v", err)
+		readFailed(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	writeGauge(w, "dhi_total_projects", "Projects using Docker Hardened Images", stats.TotalProjects)
+	writeGauge(w, "dhi_total_stars", "Combined GitHub stars of projects using DHI", stats.TotalStars)
+	writeGauge(w, "dhi_popular_projects", "Projects using DHI with 1000 or more stars", stats.PopularCount)
+	writeGauge(w, "dhi_new_projects_7d", "Projects that adopted DHI in the last 7 days", new7d)
+	writeGauge(w, "dhi_removed_projects", "Projects that stopped using DHI", stats.RemovedCount)
+
+	writeHeader(w, "dhi_projects_by_language", "Projects using DHI per primary language")
+	for _, l := range languages {
+		fmt.Fprintf(w, "dhi_projects_by_language{language=\"%s\"} %d\n", labelValue(l.Value), l.Projects)
+	}
+	writeHeader(w, "dhi_stars_by_language", "Combined stars of projects using DHI per primary language")
+	for _, l := range languages {
+		fmt.Fprintf(w, "dhi_stars_by_language{language=\"%s\"} %d\n", labelValue(l.Value), l.Stars)
+	}
+	writeHeader(w, "dhi_projects_by_image", "Projects building from each DHI image")
+	for _, u := range images {
+		fmt.Fprintf(w, "dhi_projects_by_image{image=\"%s\"} %d\n", labelValue(u.Image), u.Projects)
+	}
+
+	if lastRefresh != nil && lastRefresh.CompletedAt != nil {
+		writeGauge(w, "dhi_last_refresh_timestamp_seconds", "Unix time the last successful refresh completed", int(lastRefresh.CompletedAt.Unix()))
+		writeStageMetrics(w, r, store, lastRefresh.ID)
+	}
+}
+
+// writeStageMetrics writes the enrichment stage durations and GitHub requests
+// of a refresh's report. Reports from before the pipeline have no stages.
+func writeStageMetrics(w io.Writer, r *http.Request, store db.Store, jobID int64) {
+	raw, err := store.GetRefreshReport(jobID)
+	if err != nil {
+		logging.Server.Ctx(r.Context()).Errorf("Error getting refresh report: %v", err)
+		return
+	}
+	var report struct {
+		Stages []stageResult `json:"stages"`
+	}
+	if raw == "" || json.Unmarshal([]byte(raw), &report) != nil || len(report.Stages) == 0 {
+		return
+	}
+	writeHeader(w, "dhi_enrichment_stage_duration_seconds", "Time each enrichment stage of the last successful refresh took")
+	for _, s := range report.Stages {
+		fmt.Fprintf(w, "dhi_enrichment_stage_duration_seconds{stage=\"%s\",status=\"%s\"} %g\n", s.Name, s.Status, s.DurationSeconds)
+	}
+	writeHeader(w, "dhi_enrichment_stage_requests", "GitHub REST and GraphQL requests each enrichment stage of the last successful refresh made")
+	for _, s := range report.Stages {
+		fmt.Fprintf(w, "dhi_enrichment_stage_requests{stage=\"%s\"} %d\n", s.Name, s.CoreRequests+s.GraphQLRequests)
+	}
+}
+
+// writeHeader writes the HELP and TYPE lines of a gauge
+func writeHeader(w io.Writer, name, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+}
+
+// writeGauge writes a gauge without labels
+func writeGauge(w io.Writer, name, help string, value int) {
+	writeHeader(w, name, help)
+	fmt.Fprintf(w, "%s %d\n", name, value)
+}
+
+// labelValue escapes a label value; projects without one are labelled "none"
+func labelValue(v string) string {
+	if v == "" {
+		return "none"
+	}
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
@@ -0,0 +1,131 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"dhi-oss-usage/internal/db"
+	"dhi-oss-usage/internal/logging"
+	"dhi-oss-usage/internal/notifications"
+)
+
+// milestoneEntry is a milestone as served by /api/milestones
+type milestoneEntry struct {
+	db.Milestone
+	Label string `json:"label"` // e.g. "500 adopters" or "1M stars"
+}
+
+// historyAnnotation marks a milestone on the /api/history timeline
+type historyAnnotation struct {
+	Date      string `json:"date"` // YYYY-MM-DD, as in adoptions
+	Label     string `json:"label"`
+	Metric    string `json:"metric"`
+	Threshold int    `json:"threshold"`
+}
+
+// SetMilestoneNotifications sets the notification configs (by name) that
+// receive an announcement when a milestone is reached
+func (a *API) SetMilestoneNotifications(configNames []string) {
+	a.milestoneConfigs = configNames
+}
+
+// milestoneLabel describes a milestone, e.g. "500 adopters" or "1M stars"
+func milestoneLabel(m db.Milestone) string {
+	if m.Metric == "projects" {
+		return shortCount(m.Threshold) + " adopters"
+	}
+	return shortCount(m.Threshold) + " " + m.Metric
+}
+
+// shortCount abbreviates a round number: 2500 is 2.5K, 1000000 is 1M
+func shortCount(n int) string {
+	switch {
+	case n >= 1000000:
+		return strconv.FormatFloat(float64(n)/1e6, 'f', -1, 64) + "M"
+	case n >= 1000:
+		return strconv.FormatFloat(float64(n)/1e3, 'f', -1, 64) + "K"
+	}
+	return strconv.Itoa(n)
+}
+
+// celebrateMilestones announces milestones reached by a snapshot. When several
+// of a metric are crossed at once, as on the first snapshot of an install, only
+// the highest is announced.
+func (a *API) celebrateMilestones(milestones []db.Milestone) {
+	highest := make(map[string]db.Milestone)
+	var metrics []string
+	for _, m := range milestones {
+		prev, ok := highest[m.Metric]
+		if !ok {
+			metrics = append(metrics, m.Metric)
+		}
+		if !ok || m.Threshold > prev.Threshold {
+			highest[m.Metric] = m
+		}
+	}
+
+	for _, metric := range metrics {
+		m := highest[metric]
+		label := milestoneLabel(m)
+		logging.Server.Infof("Milestone reached: %s (%d)", label, m.Value)
+
+		a.dispatch(notifications.Event{Type: notifications.EventMilestoneReached, Data: map[string]interface{}{
+			"metric":    m.Metric,
+			"threshold": m.Threshold,
+			"value":     m.Value,
+			"label":     label,
+		}})
+		if len(a.milestoneConfigs) == 0 {
+			continue
+		}
+		subject := fmt.Sprintf("DHI OSS Tracker - %s!", label)
+		body := fmt.Sprintf("Docker Hardened Images just passed %s: the tracker now counts %d.", label, m.Value)
+		if err := a.notificationsSvc.SendAlert(a.milestoneConfigs, subject, body); err != nil {
+			logging.Server.Errorf("Error announcing milestone: %v", err)
+		}
+	}
+}
+
+// milestoneAnnotations returns the milestones reached in the last days as
+// timeline annotations
+func milestoneAnnotations(store db.Store, days int) ([]historyAnnotation, error) {
+	milestones, err := store.GetMilestones(time.Now().UTC().AddDate(0, 0, -days))
+	if err != nil {
+		return nil, err
+	}
+	annotations := make([]historyAnnotation, len(milestones))
+	for i, m := range milestones {
+		annotations[i] = historyAnnotation{
+			Date:      m.ReachedAt.UTC().Format("2006-01-02"),
+			Label:     milestoneLabel(m),
+			Metric:    m.Metric,
+			Threshold: m.Threshold,
+		}
+	}
+	return annotations, nil
+}
+
+// handleMilestones lists every milestone reached, oldest first
+func (a *API) handleMilestones(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	milestones, err := a.readerFor(r).GetMilestones(time.Time{})
+	if err != nil {
+		logging.Server.Ctx(r.Context()).Errorf("Error getting milestones: %v", err)
+		readFailed(w, r)
+		return
+	}
+	entries := make([]milestoneEntry, len(milestones))
+	for i, m := range milestones {
+		entries[i] = milestoneEntry{Milestone: m, Label: milestoneLabel(m)}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
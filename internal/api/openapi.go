@@ -0,0 +1,358 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"dhi-oss-usage/internal/db"
+	"dhi-oss-usage/internal/logging"
+	"dhi-oss-usage/internal/notifications"
+	"dhi-oss-usage/internal/publish"
+)
+
+// routeDoc documents one operation for /api/openapi.json. Paths are relative to
+// /api/v2 and use {name} for path parameters.
+type routeDoc struct {
+	Method   string
+	Path     string
+	Summary  string
+	Admin    bool // requires the admin bearer token
+	Params   []paramDoc
+	Body     interface{} // example value of the JSON request body, nil if none
+	Response interface{} // example value of the JSON response, nil if not JSON
+}
+
+// paramDoc documents a path or query parameter
+type paramDoc struct {
+	Name        string
+	In          string // query or path
+	Type        string // string, integer, boolean
+	Description string
+}
+
+func queryParam(name, typ, description string) paramDoc {
+	return paramDoc{Name: name, In: "query", Type: typ, Description: description}
+}
+
+func pathParam(name, typ, description string) paramDoc {
+	return paramDoc{Name: name, In: "path", Type: typ, Description: description}
+}
+
+// paged marks a response wrapped in pageEnvelope with items of the given type
+type paged struct {
+	Item interface{}
+}
+
+// object is a JSON object response whose keys aren't described by a Go type
+type object map[string]interface{}
+
+var (
+	idParam       = pathParam("id", "integer", "Project ID")
+	daysParam     = queryParam("days", "integer", "Days of history to return")
+	limitParam    = queryParam("limit", "integer", "Maximum number of results")
+	dryRunParam   = queryParam("dry_run", "boolean", "Preview without applying")
+	excludeForks  = queryParam("exclude_forks", "boolean", "Leave forks out (defaults to EXCLUDE_FORKS)")
+	projectFilter = []paramDoc{
+		queryParam("search", "string", "Substring of the repository name or description"),
+		queryParam("source_type", "string", "Search that found the project"),
+		queryParam("file_type", "string", "dockerfile, compose, helm, kubernetes, github_actions, gitlab_ci or other"),
+		queryParam("provider", "string", "github or gitlab"),
+		queryParam("status", "string", "active (default), removed, deleted or all"),
+		queryParam("topic", "string", "Repository topic"),
+		queryParam("license", "string", "SPDX identifier, or none"),
+		queryParam("featured", "boolean", "Only featured projects, in curated order"),
+		queryParam("attribution", "string", "Acquisition channel, or none"),
+		queryParam("use_case", "string", "web_service, cli, ml_pipeline, infra, or none for unclassified projects"),
+		queryParam("employee", "string", "engaged (starred or contributed to by EMPLOYEE_ORG members) or organic"),
+		queryParam("include_archived", "boolean", "Include archived repositories in the active list"),
+		excludeForks,
+		queryParam("min_stars", "integer", "Minimum stars"),
+		queryParam("max_stars", "integer", "Maximum stars"),
+		queryParam("sort", "string", "stars (default), name or first_seen"),
+		queryParam("order", "string", "desc (default) or asc"),
+		queryParam("fields", "string", "Comma-separated project fields to return"),
+		queryParam("limit", "integer", "Page size (default 100, max 1000)"),
+		queryParam("offset", "integer", "Projects to skip"),
+	}
+)
+
+// apiRoutes documents every API operation. RegisterRoutes logs a warning for
+// any entry without a registered handler.
+var apiRoutes = []routeDoc{
+	{Method: "GET", Path: "/projects", Summary: "List projects", Params: append([]paramDoc{queryParam("as_of", "string", "Date (YYYY-MM-DD) to list the adopters as of, from refresh archives or snapshots; only search, source_type, file_type, provider, exclude_forks, min_stars, max_stars, sort (stars or name), order and paging apply")}, projectFilter...), Response: paged{db.Project{}}},
+	{Method: "GET", Path: "/projects/export", Summary: "Export projects as CSV", Params: append([]paramDoc{queryParam("format", "string", "csv (default)")}, projectFilter...)},
+	{Method: "GET", Path: "/export/public", Summary: "Sanitized adoption dataset for publishing: active projects, image usage and history", Response: publicDataset{}},
+	{Method: "GET", Path: "/projects/new", Summary: "Projects adopted since a date", Params: []paramDoc{queryParam("since", "string", "thisweek (default) or a duration such as 7d, 1w or 30d")}, Response: []db.Project{}},
+	{Method: "GET", Path: "/projects/showcase", Summary: "A selection of notable adopters", Params: []paramDoc{queryParam("n", "integer", "Number of projects"), queryParam("min_stars", "integer", "Minimum stars"), queryParam("mode", "string", "daily (default) or random")}, Response: []db.Project{}},
+	{Method: "GET", Path: "/projects/{id}", Summary: "Project detail with images, star history, links and notifications", Params: []paramDoc{idParam, daysParam}, Response: projectDetail{}},
+	{Method: "GET", Path: "/projects/by-name/{name}", Summary: "Project detail by repo_full_name", Params: []paramDoc{pathParam("name", "string", "owner/repo"), daysParam}, Response: projectDetail{}},
+	{Method: "GET", Path: "/projects/{id}/avatar", Summary: "Project owner's avatar image", Params: []paramDoc{idParam, queryParam("size", "integer", "40, 80 (default), 160 or 460")}},
+	{Method: "GET", Path: "/projects/{id}/stars", Summary: "Daily star history", Params: []paramDoc{idParam, daysParam}, Response: object{}},
+	{Method: "GET", Path: "/projects/{id}/links", Summary: "External links about the project", Params: []paramDoc{idParam}, Response: []db.ProjectLink{}},
+	{Method: "GET", Path: "/stats", Summary: "Summary statistics", Params: []paramDoc{excludeForks}, Response: object{}},
+	{Method: "GET", Path: "/stats/breakdown", Summary: "Live projects, stars and recent adoptions per attribution or other dimension", Params: []paramDoc{queryParam("by", "string", "attribution (default), source_type, file_type, language, provider or use_case")}, Response: object{}},
+	{Method: "GET", Path: "/stats/stars-influenced", Summary: "Stars of the projects adopted in a period, at adoption or now", Params: []paramDoc{queryParam("method", "string", "at_adoption (default), current or gained"), queryParam("period", "string", "month, quarter (default) or year, to date"), queryParam("since", "string", "First adoption day (YYYY-MM-DD), instead of period"), queryParam("until", "string", "Last adoption day (YYYY-MM-DD), defaults to today"), excludeForks}, Response: starsInfluenced{}},
+	{Method: "GET", Path: "/stats/heatmap", Summary: "Adoption commits by weekday and hour", Params: []paramDoc{queryParam("days", "integer", "Days of adoptions to count (default 0 = all)"), queryParam("tz", "string", "IANA time zone to bucket in (default UTC)")}, Response: adoptionHeatmap{}},
+	{Method: "GET", Path: "/source-types", Summary: "Distinct source types, file types or providers", Params: []paramDoc{queryParam("dimension", "string", "source_type (default), file_type or provider")}, Response: []string{}},
+	{Method: "GET", Path: "/history", Summary: "Adoption history by date, annotated with milestones reached", Params: []paramDoc{daysParam}, Response: object{}},
+	{Method: "GET", Path: "/history/snapshots", Summary: "Project counts per segment from daily snapshots", Params: []paramDoc{queryParam("dimension", "string", "source_type, file_type, language or provider"), daysParam}, Response: object{}},
+	{Method: "GET", Path: "/history/source-types", Summary: "Daily adoptions per discovery channel", Params: []paramDoc{queryParam("by", "string", "source_type (default) or file_type"), daysParam}, Response: object{}},
+	{Method: "GET", Path: "/milestones", Summary: "Round numbers of adopters and combined stars reached, oldest first", Response: []milestoneEntry{}},
+	{Method: "GET", Path: "/orgs", Summary: "Adoption per owner or group", Params: []paramDoc{queryParam("sort", "string", "stars (default) or repos"), limitParam}, Response: []db.OrgAdoption{}},
+	{Method: "GET", Path: "/images", Summary: "DHI images used by active projects", Response: []db.ImageUsage{}},
+	{Method: "GET", Path: "/images/top", Summary: "Most used DHI images with trends", Params: []paramDoc{limitParam, daysParam}, Response: []topImage{}},
+	{Method: "GET", Path: "/refresh/status", Summary: "Refresh status and GitHub quota", Response: object{}},
+	{Method: "GET", Path: "/sources", Summary: "Discovery sources with their last run, items found, errors and next run", Response: []sourceStatus{}},
+	{Method: "GET", Path: "/locales", Summary: "Languages server-generated text (weekly summaries, badges) can be produced in", Response: []localeInfo{}},
+	{Method: "POST", Path: "/refresh", Summary: "Trigger a refresh", Params: []paramDoc{queryParam("sample", "integer", "Refresh at most this many repos as a smoke test")}, Response: object{}},
+	{Method: "GET", Path: "/refresh/jobs", Summary: "Recent refresh jobs", Params: []paramDoc{limitParam}, Response: []refreshJobSummary{}},
+	{Method: "GET", Path: "/refresh/{id}/report", Summary: "Structured report of a refresh job", Params: []paramDoc{pathParam("id", "integer", "Refresh job ID")}, Response: object{}},
+	{Method: "GET", Path: "/refresh/{id}/archive", Summary: "Projects archived by a refresh job", Params: []paramDoc{pathParam("id", "integer", "Refresh job ID")}, Response: []db.Project{}},
+	{Method: "GET", Path: "/notifications", Summary: "List notification configurations", Response: []db.NotificationConfig{}},
+	{Method: "POST", Path: "/notifications", Summary: "Create a notification configuration", Body: db.NotificationConfig{}, Response: db.NotificationConfig{}},
+	{Method: "GET", Path: "/notifications/{id}", Summary: "Get a notification configuration", Params: []paramDoc{pathParam("id", "integer", "Notification config ID")}, Response: db.NotificationConfig{}},
+	{Method: "PUT", Path: "/notifications/{id}", Summary: "Update a notification configuration", Params: []paramDoc{pathParam("id", "integer", "Notification config ID")}, Body: db.NotificationConfig{}, Response: db.NotificationConfig{}},
+	{Method: "DELETE", Path: "/notifications/{id}", Summary: "Delete a notification configuration", Params: []paramDoc{pathParam("id", "integer", "Notification config ID")}},
+	{Method: "POST", Path: "/notifications/{id}/test", Summary: "Send a test notification", Params: []paramDoc{pathParam("id", "integer", "Notification config ID")}, Response: object{}},
+	{Method: "GET", Path: "/notifications/{id}/preview", Summary: "Render the config's new-project message without sending it", Params: []paramDoc{pathParam("id", "integer", "Notification config ID"), queryParam("project", "string", "repo_full_name to render (defaults to a sample project)")}, Response: notifications.Preview{}},
+	{Method: "GET", Path: "/notifications/{id}/logs", Summary: "Notification delivery log", Params: []paramDoc{pathParam("id", "integer", "Notification config ID"), limitParam}, Response: []db.NotificationLog{}},
+	{Method: "POST", Path: "/notifications/{id}/redeliver/{log_id}", Summary: "Replay a webhook delivery with its stored payload", Params: []paramDoc{pathParam("id", "integer", "Notification config ID"), pathParam("log_id", "integer", "Notification log ID")}, Response: db.NotificationLog{}},
+	{Method: "POST", Path: "/notifications/{id}/resend", Summary: "Send this week's new projects again, including ones already notified", Params: []paramDoc{pathParam("id", "integer", "Notification config ID"), queryParam("project", "string", "repo_full_name to resend instead of this week's new projects")}, Response: object{}},
+	{Method: "GET", Path: "/notifications/providers", Summary: "Available provider types", Response: []notifications.ProviderInfo{}},
+	{Method: "POST", Path: "/notifications/preview", Summary: "Render the new-project message of an unsaved configuration", Body: previewRequest{}, Response: notifications.Preview{}},
+	{Method: "POST", Path: "/notifications/validate", Summary: "Check an unsaved configuration, its templates, credentials and endpoint without sending anything", Body: db.NotificationConfig{}, Response: notifications.Validation{}},
+	{Method: "POST", Path: "/notifications/test-all", Summary: "Test every enabled configuration", Response: object{}},
+	{Method: "GET", Path: "/notifications/pending", Summary: "Messages held for approval", Params: []paramDoc{queryParam("status", "string", "pending (default), sending, sent, rejected, failed or all"), limitParam}, Response: []db.PendingMessage{}},
+	{Method: "POST", Path: "/notifications/pending/{id}/approve", Summary: "Send a held message", Admin: true, Params: []paramDoc{pathParam("id", "integer", "Pending message ID")}, Response: db.PendingMessage{}},
+	{Method: "POST", Path: "/notifications/pending/{id}/reject", Summary: "Discard a held message", Admin: true, Params: []paramDoc{pathParam("id", "integer", "Pending message ID")}, Response: db.PendingMessage{}},
+	{Method: "POST", Path: "/webhooks/github", Summary: "GitHub push webhook", Response: object{}},
+	{Method: "GET", Path: "/admin/slo", Summary: "Data freshness SLO status", Admin: true, Response: object{}},
+	{Method: "GET", Path: "/admin/diagnostics", Summary: "GitHub credentials' scopes, quota and expiry", Admin: true, Params: []paramDoc{queryParam("check", "boolean", "Check the credentials again instead of reporting the last hourly check")}, Response: githubDiagnostics{}},
+	{Method: "GET", Path: "/admin/publish", Summary: "Publish target and past summaries", Admin: true, Response: object{}},
+	{Method: "POST", Path: "/admin/publish", Summary: "Publish last week's summary", Admin: true, Params: []paramDoc{dryRunParam, queryParam("force", "boolean", "Republish an already published week"), queryParam("lang", "string", "Language of the summary (defaults to PUBLISH_LOCALE)")}, Response: publish.Result{}},
+	{Method: "GET", Path: "/admin/usage", Summary: "API usage per consumer and endpoint", Admin: true, Params: []paramDoc{queryParam("consumer", "string", "Only this consumer")}, Response: []consumerUsage{}},
+	{Method: "GET", Path: "/admin/featured", Summary: "Featured projects in curated order", Admin: true, Response: []db.Project{}},
+	{Method: "PUT", Path: "/admin/featured", Summary: "Replace the featured list", Admin: true, Body: featuredDocument{}, Response: []db.Project{}},
+	{Method: "POST", Path: "/admin/attribution", Summary: "Tag projects with the campaign or channel they were acquired through", Admin: true, Body: attributionRequest{}, Response: object{}},
+	{Method: "POST", Path: "/admin/projects/delete", Summary: "Move projects to the trash (soft delete)", Admin: true, Body: trashRequest{}, Response: object{}},
+	{Method: "POST", Path: "/admin/projects/restore", Summary: "Restore projects from the trash", Admin: true, Body: trashRequest{}, Response: object{}},
+	{Method: "GET", Path: "/admin/projects/trash", Summary: "Soft-deleted projects, most recently deleted first", Admin: true, Response: object{}},
+	{Method: "POST", Path: "/admin/links", Summary: "Attach a link to a project", Admin: true, Body: linkRequest{}, Response: db.ProjectLink{}},
+	{Method: "DELETE", Path: "/admin/links/{id}", Summary: "Remove a project link", Admin: true, Params: []paramDoc{pathParam("id", "integer", "Link ID")}},
+	{Method: "POST", Path: "/admin/apply", Summary: "Reconcile configuration with a declarative document", Admin: true, Params: []paramDoc{dryRunParam}, Body: applyDocument{}, Response: object{}},
+	{Method: "GET", Path: "/export", Summary: "Gzipped NDJSON dump of projects, snapshots and adoption data", Admin: true},
+	{Method: "POST", Path: "/import", Summary: "Replace projects, snapshots and adoption data with a dump from /export", Admin: true, Response: object{}},
+	{Method: "GET", Path: "/openapi.json", Summary: "This OpenAPI document", Response: object{}},
+}
+
+// checkRouteDocs warns about documented operations that no route handles, so
+// the OpenAPI document doesn't drift from RegisterRoutes
+func checkRouteDocs(routes *http.ServeMux) {
+	for _, doc := range apiRoutes {
+		path := "/api" + strings.NewReplacer("{id}", "1", "{log_id}", "1", "{name}", "owner/repo").Replace(doc.Path)
+		req, _ := http.NewRequest(doc.Method, path, nil)
+		if _, pattern := routes.Handler(req); pattern == "" {
+			logging.Server.Warnf("OpenAPI documents %s %s but no route handles it", doc.Method, doc.Path)
+		}
+	}
+}
+
+// handleOpenAPI serves the OpenAPI 3 description of the v2 API
+func (a *API) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(openAPISpec(BasePath(r)))
+}
+
+// openAPISpec builds the OpenAPI document from apiRoutes, for an app served
+// under base. Schemas are derived from the JSON tags of the Go types handlers encode.
+func openAPISpec(base string) map[string]interface{} {
+	g := schemaGen{schemas: make(map[string]interface{})}
+	paths := make(map[string]map[string]interface{})
+
+	for _, doc := range apiRoutes {
+		op := map[string]interface{}{
+			"summary":     doc.Summary,
+			"operationId": operationID(doc),
+		}
+		var params []interface{}
+		for _, p := range doc.Params {
+			param := map[string]interface{}{
+				"name":   p.Name,
+				"in":     p.In,
+				"schema": map[string]interface{}{"type": p.Type},
+			}
+			if p.Description != "" {
+				param["description"] = p.Description
+			}
+			if p.In == "path" {
+				param["required"] = true
+			}
+			params = append(params, param)
+		}
+		if params != nil {
+			op["parameters"] = params
+		}
+		if doc.Admin {
+			op["security"] = []interface{}{map[string]interface{}{"adminToken": []string{}}}
+		}
+		if doc.Body != nil {
+			op["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content":  map[string]interface{}{"application/json": map[string]interface{}{"schema": g.schema(reflect.TypeOf(doc.Body))}},
+			}
+		}
+		response := map[string]interface{}{"description": "OK"}
+		if doc.Response != nil {
+			response["content"] = map[string]interface{}{"application/json": map[string]interface{}{"schema": g.response(doc.Response)}}
+		}
+		op["responses"] = map[string]interface{}{"200": response}
+
+		if paths[doc.Path] == nil {
+			paths[doc.Path] = make(map[string]interface{})
+		}
+		paths[doc.Path][strings.ToLower(doc.Method)] = op
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       "DHI OSS Usage Tracker API",
+			"version":     "2",
+			"description": "Open source projects using Docker Hardened Images. v1 (/api/v1 and /api) serves the same operations; only GET /projects differs, returning a bare array. Any operation accepts ?naming=camel for camelCase keys and ?timestamps=epoch_ms for *_at timestamps in milliseconds since the epoch.",
+		},
+		"servers": []interface{}{map[string]interface{}{"url": base + "/api/v2"}},
+		"paths":   paths,
+		"components": map[string]interface{}{
+			"schemas": g.schemas,
+			"securitySchemes": map[string]interface{}{
+				"adminToken": map[string]interface{}{"type": "http", "scheme": "bearer"},
+			},
+		},
+	}
+}
+
+// operationID names an operation for generated clients, e.g. GET
+// /projects/{id}/stars is getProjectsIdStars
+func operationID(doc routeDoc) string {
+	id := strings.ToLower(doc.Method)
+	for _, part := range strings.FieldsFunc(doc.Path, func(r rune) bool { return strings.ContainsRune("/{}-_.", r) }) {
+		id += strings.ToUpper(part[:1]) + part[1:]
+	}
+	return id
+}
+
+// schemaGen derives JSON schemas from Go types, collecting named structs in schemas
+type schemaGen struct {
+	schemas map[string]interface{}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// response returns the schema of a documented response value
+func (g *schemaGen) response(v interface{}) interface{} {
+	switch v := v.(type) {
+	case paged:
+		return map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"items":  map[string]interface{}{"type": "array", "items": g.schema(reflect.TypeOf(v.Item))},
+				"total":  map[string]interface{}{"type": "integer"},
+				"limit":  map[string]interface{}{"type": "integer"},
+				"offset": map[string]interface{}{"type": "integer"},
+			},
+		}
+	case object:
+		return map[string]interface{}{"type": "object"}
+	}
+	return g.schema(reflect.TypeOf(v))
+}
+
+func (g *schemaGen) schema(t reflect.Type) interface{} {
+	nullable := false
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+		nullable = true
+	}
+
+	var s map[string]interface{}
+	switch {
+	case t == timeType:
+		s = map[string]interface{}{"type": "string", "format": "date-time"}
+	case t.Kind() == reflect.Struct:
+		name := schemaName(t)
+		if _, ok := g.schemas[name]; !ok {
+			g.schemas[name] = nil // placeholder so recursive types terminate
+			g.schemas[name] = g.structSchema(t)
+		}
+		ref := map[string]interface{}{"$ref": "#/components/schemas/" + name}
+		if nullable {
+			return map[string]interface{}{"allOf": []interface{}{ref}, "nullable": true}
+		}
+		return ref
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8:
+		s = map[string]interface{}{"type": "string", "format": "byte"}
+	case t.Kind() == reflect.Slice || t.Kind() == reflect.Array:
+		s = map[string]interface{}{"type": "array", "items": g.schema(t.Elem())}
+	case t.Kind() == reflect.Map:
+		s = map[string]interface{}{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case t.Kind() == reflect.Bool:
+		s = map[string]interface{}{"type": "boolean"}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		s = map[string]interface{}{"type": "integer"}
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		s = map[string]interface{}{"type": "number"}
+	case t.Kind() == reflect.String:
+		s = map[string]interface{}{"type": "string"}
+	default:
+		s = map[string]interface{}{} // interface{} and json.RawMessage hold any value
+	}
+	if nullable {
+		s["nullable"] = true
+	}
+	return s
+}
+
+// schemaName names a struct's schema: exported, and prefixed with its package
+// outside db and api (e.g. PublishResult)
+func schemaName(t reflect.Type) string {
+	name := strings.ToUpper(t.Name()[:1]) + t.Name()[1:]
+	pkg := t.PkgPath()[strings.LastIndex(t.PkgPath(), "/")+1:]
+	if pkg != "db" && pkg != "api" {
+		name = strings.ToUpper(pkg[:1]) + pkg[1:] + name
+	}
+	return name
+}
+
+// structSchema describes a struct's JSON fields. Embedded structs without a
+// tag are flattened, as encoding/json does.
+func (g *schemaGen) structSchema(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	var addFields func(t reflect.Type)
+	addFields = func(t reflect.Type) {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			tag := f.Tag.Get("json")
+			if f.Anonymous && tag == "" && f.Type.Kind() == reflect.Struct {
+				addFields(f.Type)
+				continue
+			}
+			if !f.IsExported() || tag == "-" {
+				continue
+			}
+			name, _, _ := strings.Cut(tag, ",")
+			if name == "" {
+				name = f.Name
+			}
+			properties[name] = g.schema(f.Type)
+		}
+	}
+	addFields(t)
+	return map[string]interface{}{"type": "object", "properties": properties}
+}
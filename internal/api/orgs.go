@@ -0,0 +1,48 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"dhi-oss-usage/internal/db"
+	"dhi-oss-usage/internal/logging"
+)
+
+// handleOrgs returns live adoption grouped by GitHub owner or GitLab group,
+// sorted by total stars or, with ?sort=repos, by number of adopting repos
+func (a *API) handleOrgs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	sortBy := r.URL.Query().Get("sort")
+	if sortBy != "" && sortBy != "stars" && sortBy != "repos" {
+		http.Error(w, "Invalid 'sort' parameter. Use 'stars' or 'repos'", http.StatusBadRequest)
+		return
+	}
+
+	var orgs []db.OrgAdoption
+	if !a.readAggregate("orgs", &orgs) {
+		var err error
+		if orgs, err = a.readerFor(r).GetOrgAdoption(); err != nil {
+			logging.Server.Ctx(r.Context()).Errorf("Error getting org adoption: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+	if sortBy == "repos" {
+		sort.SliceStable(orgs, func(i, j int) bool { return orgs[i].Repos > orgs[j].Repos })
+	}
+	if limit, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && limit > 0 && limit < len(orgs) {
+		orgs = orgs[:limit]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if orgs == nil {
+		orgs = []db.OrgAdoption{}
+	}
+	json.NewEncoder(w).Encode(orgs)
+}
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"dhi-oss-usage/internal/db"
+	"dhi-oss-usage/internal/logging"
+	"dhi-oss-usage/internal/notifications"
+)
+
+// previewRequest renders a notification config that may not be saved yet
+type previewRequest struct {
+	Type       string `json:"type"`
+	ConfigJSON string `json:"config_json"`
+	Project    string `json:"project,omitempty"` // repo_full_name to render; the sample project when empty
+}
+
+// handleNotificationPreview renders the new-project message of an unsaved
+// config, so templates can be tried out before saving
+func (a *API) handleNotificationPreview(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req previewRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Type == "" || req.ConfigJSON == "" {
+		http.Error(w, "type and config_json are required", http.StatusBadRequest)
+		return
+	}
+	a.writePreview(w, req.Type, req.ConfigJSON, req.Project)
+}
+
+// previewNotification renders the new-project message of a saved config,
+// about ?project= or the sample project
+func (a *API) previewNotification(w http.ResponseWriter, r *http.Request, id int64) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	config, err := a.db.GetNotificationConfig(id)
+	if err != nil {
+		logging.Server.Ctx(r.Context()).Errorf("Error getting notification config: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if config == nil {
+		http.Error(w, "Notification config not found", http.StatusNotFound)
+		return
+	}
+	a.writePreview(w, config.Type, config.ConfigJSON, r.URL.Query().Get("project"))
+}
+
+// writePreview renders a config's message about a tracked project, or the
+// sample project when name is empty
+func (a *API) writePreview(w http.ResponseWriter, providerType, configJSON, name string) {
+	var project *db.Project
+	if name != "" {
+		var err error
+		if project, err = a.db.GetProjectByName(name); err != nil {
+			logging.Server.Errorf("Error getting project %s: %v", name, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if project == nil {
+			http.Error(w, fmt.Sprintf("Project %q is not tracked", name), http.StatusNotFound)
+			return
+		}
+	}
+
+	preview, err := a.notificationsSvc.Preview(providerType, configJSON, project)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(preview)
+}
+
+// handleNotificationValidate runs every check of a config short of sending a
+// message, so the UI can report problems before saving. The body is the one
+// create and update take; nothing is stored. It connects to hosts named in
+// the config, so it is admin-only.
+func (a *API) handleNotificationValidate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !a.requireAdmin(w, r) {
+		return
+	}
+
+	var config db.NotificationConfig
+	if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if config.Type == "" || config.ConfigJSON == "" {
+		http.Error(w, "type and config_json are required", http.StatusBadRequest)
+		return
+	}
+
+	validation := a.notificationsSvc.Validate(config.Type, config.ConfigJSON)
+	if config.Name == "" {
+		validation.Valid = false
+		validation.Checks = append([]notifications.Check{{Name: "name", Status: "failed", Detail: "name is required"}}, validation.Checks...)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(validation)
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"dhi-oss-usage/internal/db"
+	"dhi-oss-usage/internal/logging"
+)
+
+// progressInterval is how often counts within a phase are written to the job;
+// a new phase is written at once
+const progressInterval = 2 * time.Second
+
+// refreshProgress keeps a running job's phase and counts in refresh_jobs, so
+// /api/refresh/status shows how far along a long refresh is
+type refreshProgress struct {
+	a      *API
+	ctx    context.Context
+	jobID  int64
+	report *refreshReport // source of the error count
+
+	mu      sync.Mutex
+	current db.RefreshProgress
+	written time.Time
+}
+
+func newRefreshProgress(ctx context.Context, a *API, jobID int64, report *refreshReport) *refreshProgress {
+	return &refreshProgress{a: a, ctx: ctx, jobID: jobID, report: report}
+}
+
+// phase moves the job to a new phase
+func (p *refreshProgress) phase(name string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.current.Phase = name
+	p.write()
+}
+
+// fetch records search and details progress reported by the GitHub client
+func (p *refreshProgress) fetch(status string, current, total int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	changed := status != p.current.Phase
+	p.current.Phase = status
+	switch status {
+	case "searching":
+		p.current.ReposDiscovered = current
+	case "fetching_details":
+		p.current.ReposDiscovered, p.current.ReposProcessed = total, current
+	}
+	if changed || time.Since(p.written) >= progressInterval {
+		p.write()
+	}
+}
+
+// addDiscovered counts repos found by another provider, which are fetched
+// with their details
+func (p *refreshProgress) addDiscovered(n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.current.ReposDiscovered += n
+	p.current.ReposProcessed += n
+	p.write()
+}
+
+// finish writes the job's final progress, moving a completed job to "done"
+// and a failed one's error count up to date
+func (p *refreshProgress) finish(completed bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if completed {
+		p.current.Phase = "done"
+	}
+	p.write()
+}
+
+// write saves the progress; p.mu must be held. A failed write only costs the
+// status endpoint an update, so it doesn't fail the refresh.
+func (p *refreshProgress) write() {
+	p.current.ErrorsCount = p.report.errorCount()
+	p.written = time.Now()
+	if err := p.a.db.UpdateRefreshProgress(p.jobID, p.current); err != nil {
+		logging.Refresh.Ctx(p.ctx).Warnf("Error saving progress of job %d: %v", p.jobID, err)
+	}
+}
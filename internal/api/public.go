@@ -0,0 +1,147 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"dhi-oss-usage/internal/db"
+	"dhi-oss-usage/internal/logging"
+)
+
+// publicDatasetKey is the aggregate holding the public dataset, recomputed
+// with the others after each refresh
+const publicDatasetKey = "public_dataset"
+
+// publicDataset is /api/export/public: adoption data fit to publish openly.
+// Only active projects are listed, as removed and deleted repos may have gone
+// private, and only facts anyone can read on GitHub or GitLab: no internal
+// IDs, featured ranks, attribution tags or employee engagement.
+type publicDataset struct {
+	GeneratedAt time.Time        `json:"generated_at"`
+	Projects    []publicProject  `json:"projects"`
+	Images      []db.ImageUsage  `json:"images"`
+	History     []publicSnapshot `json:"history"` // totals after each refresh, oldest first
+}
+
+type publicProject struct {
+	Repo            string     `json:"repo"` // owner/repo on GitHub, host/path on GitLab
+	Provider        string     `json:"provider"`
+	URL             string     `json:"url"`
+	Stars           int        `json:"stars"`
+	Description     string     `json:"description"`
+	PrimaryLanguage string     `json:"primary_language"`
+	License         string     `json:"license"`
+	Topics          []string   `json:"topics"`
+	Archived        bool       `json:"archived"`
+	Fork            bool       `json:"fork"`
+	SourceType      string     `json:"source_type"`
+	FileType        string     `json:"file_type"`
+	FilePath        string     `json:"file_path"`
+	Images          []string   `json:"images"` // DHI images referenced, e.g. python:3.12
+	AdoptedAt       *time.Time `json:"adopted_at"`
+	AdoptionCommit  string     `json:"adoption_commit"`
+	FirstSeenAt     time.Time  `json:"first_seen_at"`
+}
+
+type publicSnapshot struct {
+	RecordedAt    time.Time `json:"recorded_at"`
+	TotalProjects int       `json:"total_projects"`
+	TotalStars    int       `json:"total_stars"`
+}
+
+// computePublicDataset builds the public dataset from the store
+func computePublicDataset(store db.ProjectStore) (*publicDataset, error) {
+	dataset := &publicDataset{
+		GeneratedAt: time.Now().UTC(),
+		Projects:    []publicProject{},
+		History:     []publicSnapshot{},
+	}
+
+	projects, err := store.ListProjects(db.ProjectFilter{Status: "active", SortBy: "stars", SortOrder: "desc"})
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range projects {
+		images, err := store.GetProjectImages(p.ID)
+		if err != nil {
+			return nil, err
+		}
+		refs := []string{}
+		for _, img := range images {
+			ref := img.Image
+			if img.Tag != "" {
+				ref += ":" + img.Tag
+			}
+			refs = append(refs, ref)
+		}
+		topics := p.Topics
+		if topics == nil {
+			topics = []string{}
+		}
+		dataset.Projects = append(dataset.Projects, publicProject{
+			Repo:            p.RepoFullName,
+			Provider:        p.Provider,
+			URL:             p.GitHubURL,
+			Stars:           p.Stars,
+			Description:     p.Description,
+			PrimaryLanguage: p.PrimaryLanguage,
+			License:         p.License,
+			Topics:          topics,
+			Archived:        p.Archived,
+			Fork:            p.Fork,
+			SourceType:      p.SourceType,
+			FileType:        p.FileType,
+			FilePath:        p.DockerfilePath,
+			Images:          refs,
+			AdoptedAt:       p.AdoptedAt,
+			AdoptionCommit:  p.AdoptionCommit,
+			FirstSeenAt:     p.FirstSeenAt,
+		})
+	}
+
+	if dataset.Images, err = store.GetImageUsage(); err != nil {
+		return nil, err
+	}
+	if dataset.Images == nil {
+		dataset.Images = []db.ImageUsage{}
+	}
+
+	snapshots, err := store.GetSnapshots(0)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(snapshots) - 1; i >= 0; i-- {
+		s := snapshots[i]
+		dataset.History = append(dataset.History, publicSnapshot{RecordedAt: s.RecordedAt, TotalProjects: s.TotalProjects, TotalStars: s.TotalStars})
+	}
+	return dataset, nil
+}
+
+// handlePublicExport serves the public dataset as of the last refresh,
+// building it live if it hasn't been stored yet
+func (a *API) handlePublicExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	raw, err := a.reader.GetAggregate(publicDatasetKey)
+	if err != nil {
+		logging.Server.Ctx(r.Context()).Errorf("Error reading aggregate %s: %v", publicDatasetKey, err)
+	}
+	if raw == nil {
+		dataset, err := computePublicDataset(a.readerFor(r))
+		if err == nil {
+			raw, err = json.Marshal(dataset)
+		}
+		if err != nil {
+			logging.Server.Ctx(r.Context()).Errorf("Error building public dataset: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(raw)
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"dhi-oss-usage/internal/i18n"
+	"dhi-oss-usage/internal/logging"
+	"dhi-oss-usage/internal/publish"
+)
+
+// SetPublisher enables the weekly adopters publisher and /api/admin/publish
+func (a *API) SetPublisher(p *publish.Publisher) {
+	a.publisher = p
+}
+
+// handleAdminPublish lists past publications (GET) or publishes last week's summary (POST).
+// POST accepts ?dry_run=true to render without posting, ?force=true to republish
+// and ?lang= to write the summary in another language than PUBLISH_LOCALE.
+func (a *API) handleAdminPublish(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !a.requireAdmin(w, r) {
+		return
+	}
+	if a.publisher == nil {
+		http.Error(w, "Publishing not configured (PUBLISH_REPO not set)", http.StatusNotFound)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		pubs, err := a.db.ListPublications(50)
+		if err != nil {
+			logging.Server.Ctx(r.Context()).Errorf("Error listing publications: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		response := map[string]interface{}{
+			"target":       a.publisher.Target(),
+			"publications": pubs,
+		}
+		if pubs == nil {
+			response["publications"] = []interface{}{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	q := r.URL.Query()
+	var loc *i18n.Locale
+	if lang := q.Get("lang"); lang != "" {
+		var ok bool
+		if loc, ok = i18n.Get(lang); !ok {
+			http.Error(w, "Invalid 'lang' parameter. Use one of: "+strings.Join(i18n.Tags(), ", "), http.StatusBadRequest)
+			return
+		}
+	}
+	result, err := a.publisher.Publish(r.Context(), time.Now(), loc, q.Get("dry_run") == "true", q.Get("force") == "true")
+	if err != nil {
+		logging.Server.Ctx(r.Context()).Errorf("Error publishing adopters summary: %v", err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
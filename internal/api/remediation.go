@@ -0,0 +1,96 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"dhi-oss-usage/internal/github"
+	"dhi-oss-usage/internal/logging"
+)
+
+// Failure codes of refresh jobs, with the hint stored next to them, so
+// operators don't have to decode raw GitHub error bodies
+const (
+	failureInvalidToken = "invalid_token"
+	failureMissingScope = "missing_scope"
+	failureRateLimit    = "rate_limit"
+	failureNetwork      = "network"
+	failureTimeout      = "timeout"
+	failureDatabase     = "database"
+	failureInterrupted  = "interrupted"
+	failureUnknown      = "unknown"
+)
+
+var remediations = map[string]string{
+	failureInvalidToken: "GitHub rejected the credentials (401 Bad credentials): the token is wrong, expired or revoked. Set a valid GITHUB_TOKEN or GITHUB_TOKENS, or check the GitHub App's GITHUB_APP_ID, GITHUB_APP_INSTALLATION_ID and private key, then restart.",
+	failureMissingScope: "GitHub refused access (403) for a reason other than rate limiting: the token lacks a permission the refresh needs. Give a fine-grained token read access to public repositories, or a GitHub App the Contents and Metadata read permissions, and authorize the token for SAML SSO if an organization requires it.",
+	failureRateLimit:    "GitHub's rate limit ran out before the refresh could finish. Wait for the reset in rate_limits of /api/refresh/status, refresh less often (REFRESH_SCHEDULE), or spread the load over more tokens with GITHUB_TOKENS.",
+	failureNetwork:      "The server couldn't reach GitHub. Check DNS, any proxy (HTTPS_PROXY) and that the firewall allows HTTPS to api.github.com.",
+	failureTimeout:      "The refresh hit its 10 minute limit, usually because GitHub was slow or requests were paused for rate limits. Retry, and check rate_limits of /api/refresh/status if it keeps happening.",
+	failureDatabase:     "The database rejected writes. Check free disk space and permissions of DB_PATH, and that no other process holds a lock on it.",
+	failureInterrupted:  "The server shut down during the refresh. Projects saved before it stopped are kept, but nothing was churned; the refresh is re-run when the server starts again, or start one with POST /api/refresh.",
+	failureUnknown:      "The cause wasn't recognized; see error_message and the server log.",
+}
+
+// databaseError marks a refresh failure as the database's rather than GitHub's
+type databaseError struct{ err error }
+
+func (e *databaseError) Error() string { return e.err.Error() }
+func (e *databaseError) Unwrap() error { return e.err }
+
+// failRefresh records why a refresh failed on its job and report. Failures
+// during a shutdown are recorded as interruptions instead.
+func (a *API) failRefresh(jobID int64, report *refreshReport, err error) {
+	if a.interrupted() {
+		report.ErrorMessage, report.FailureCode = errInterrupted.Error(), failureInterrupted
+		if err := a.db.InterruptRefreshJob(jobID, errInterrupted.Error(), remediations[failureInterrupted]); err != nil {
+			logging.Refresh.Errorf("Error interrupting job %d: %v", jobID, err)
+		}
+		return
+	}
+	code, hint := diagnoseRefreshFailure(err)
+	report.ErrorMessage, report.FailureCode = err.Error(), code
+	if err := a.db.FailRefreshJob(jobID, err.Error(), code, hint); err != nil {
+		logging.Refresh.Errorf("Error failing job %d: %v", jobID, err)
+	}
+}
+
+// diagnoseRefreshFailure returns the failure code of a refresh error and its remediation hint
+func diagnoseRefreshFailure(err error) (code, hint string) {
+	code = classifyRefreshFailure(err)
+	return code, remediations[code]
+}
+
+func classifyRefreshFailure(err error) string {
+	var dbErr *databaseError
+	var rateLimited *github.RateLimitError
+	msg := err.Error()
+	switch {
+	case errors.As(err, &dbErr):
+		return failureDatabase
+	case strings.Contains(msg, "API error 401"):
+		return failureInvalidToken
+	case errors.As(err, &rateLimited):
+		// 403s all surface as rate limit errors; GitHub says "rate limit" in the
+		// body of the ones that are
+		body := strings.ToLower(rateLimited.Message)
+		if body != "" && !strings.Contains(body, "rate limit") && !strings.Contains(body, "abuse") {
+			return failureMissingScope
+		}
+		return failureRateLimit
+	case strings.Contains(msg, "API error 403"):
+		return failureMissingScope
+	case errors.Is(err, context.DeadlineExceeded):
+		return failureTimeout
+	}
+	switch github.ClassifyError(err) {
+	case "rate_limit":
+		return failureRateLimit
+	case "timeout":
+		return failureTimeout
+	case "network":
+		return failureNetwork
+	}
+	return failureUnknown
+}
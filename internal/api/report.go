@@ -0,0 +1,247 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"dhi-oss-usage/internal/db"
+	"dhi-oss-usage/internal/github"
+	"dhi-oss-usage/internal/logging"
+)
+
+// refreshReport is the structured summary stored with each refresh job
+type refreshReport struct {
+	mu sync.Mutex
+
+	JobID           int64                     `json:"job_id"`
+	Source          string                    `json:"source"`
+	Status          string                    `json:"status"` // completed, failed, interrupted
+	StartedAt       time.Time                 `json:"started_at"`
+	CompletedAt     time.Time                 `json:"completed_at"`
+	DurationSeconds float64                   `json:"duration_seconds"`
+	Phases          map[string]map[string]int `json:"phases"` // phase -> counter -> value
+	Stages          []stageResult             `json:"stages"` // enrichment stages in the order they ran
+	Errors          map[string]int            `json:"errors"` // category -> count
+	RateLimit       reportRateLimit           `json:"rate_limit"`
+	Diff            reportDiff                `json:"diff"`
+	ErrorMessage    string                    `json:"error_message,omitempty"`
+	FailureCode     string                    `json:"failure_code,omitempty"` // see RefreshJob.FailureCode
+	SourceErrors    map[string]string         `json:"source_errors,omitempty"`
+	Sample          int                       `json:"sample,omitempty"`        // repos ingested by a ?sample= smoke refresh
+	RequestID       string                    `json:"request_id,omitempty"`    // X-Request-ID of the POST /api/refresh that started a manual refresh
+	GitHubStatus    []degradedPeriod          `json:"github_status,omitempty"` // times GitHub's API was degraded while the job ran, which may explain odd results
+
+	coreStart, searchStart, graphqlStart, notModifiedStart int64
+}
+
+// reportRateLimit records GitHub API consumption during the job
+type reportRateLimit struct {
+	CoreRequests    int64 `json:"core_requests"`
+	SearchRequests  int64 `json:"search_requests"`
+	GraphQLRequests int64 `json:"graphql_requests"`
+	NotModified     int64 `json:"not_modified"` // conditional requests answered 304 (not charged)
+}
+
+// reportDiff summarizes how the tracked project set changed
+type reportDiff struct {
+	NewProjects  []string `json:"new_projects"`
+	NotSeenCount int      `json:"not_seen_count"` // tracked projects the search didn't find
+	Removed      []string `json:"removed"`        // projects marked removed by this refresh
+	Deleted      []string `json:"deleted"`        // projects whose repository no longer exists
+	TotalBefore  int      `json:"total_before"`
+	TotalAfter   int      `json:"total_after"`
+	StarsBefore  int      `json:"stars_before"`
+	StarsAfter   int      `json:"stars_after"`
+}
+
+func newRefreshReport(jobID int64, source string, gh *github.Client) *refreshReport {
+	r := &refreshReport{
+		JobID:     jobID,
+		Source:    source,
+		StartedAt: time.Now().UTC(),
+		Phases:    make(map[string]map[string]int),
+		Errors:    make(map[string]int),
+	}
+	r.coreStart, r.searchStart = gh.RequestCounts()
+	r.graphqlStart = gh.GraphQLRequestCount()
+	r.notModifiedStart = gh.NotModifiedCount()
+	r.Diff.NewProjects = []string{}
+	r.Stages = []stageResult{}
+	return r
+}
+
+// count adds n to a phase counter
+func (r *refreshReport) count(phase, key string, n int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.Phases[phase] == nil {
+		r.Phases[phase] = make(map[string]int)
+	}
+	r.Phases[phase][key] += n
+}
+
+// addStage records the outcome of an enrichment stage
+func (r *refreshReport) addStage(s stageResult) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Stages = append(r.Stages, s)
+}
+
+// addError records an error under its category
+func (r *refreshReport) addError(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Errors[github.ClassifyError(err)]++
+}
+
+// countError records an error for a category that isn't a GitHub client error (e.g. database)
+func (r *refreshReport) countError(category string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Errors[category]++
+}
+
+// sourceError records the error of a provider's search that failed without
+// failing the refresh (GitLab's), for /api/sources
+func (r *refreshReport) sourceError(provider string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.SourceErrors == nil {
+		r.SourceErrors = make(map[string]string)
+	}
+	r.SourceErrors[provider] = err.Error()
+}
+
+// addErrors merges pre-classified error counts
+func (r *refreshReport) addErrors(counts map[string]int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for category, n := range counts {
+		r.Errors[category] += n
+	}
+}
+
+// errorCount returns the number of errors recorded so far
+func (r *refreshReport) errorCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for _, count := range r.Errors {
+		n += count
+	}
+	return n
+}
+
+// finish stamps completion and rate limit usage, then returns the report as JSON
+func (r *refreshReport) finish(status string, gh *github.Client) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Status = status
+	r.CompletedAt = time.Now().UTC()
+	r.DurationSeconds = r.CompletedAt.Sub(r.StartedAt).Round(time.Second).Seconds()
+	core, search := gh.RequestCounts()
+	r.RateLimit.CoreRequests = core - r.coreStart
+	r.RateLimit.SearchRequests = search - r.searchStart
+	r.RateLimit.GraphQLRequests = gh.GraphQLRequestCount() - r.graphqlStart
+	r.RateLimit.NotModified = gh.NotModifiedCount() - r.notModifiedStart
+
+	data, err := json.Marshal(r)
+	return string(data), err
+}
+
+// handleRefreshJob handles /api/refresh/:id/report and /api/refresh/:id/archive
+func (a *API) handleRefreshJob(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/api/refresh/")
+	parts := strings.Split(path, "/")
+	if len(parts) != 2 || (parts[1] != "report" && parts[1] != "archive") {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	id, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid job ID", http.StatusBadRequest)
+		return
+	}
+	if parts[1] == "archive" {
+		a.handleRefreshArchive(w, r, id)
+		return
+	}
+
+	job, err := a.db.GetRefreshJob(id)
+	if err != nil {
+		logging.Server.Ctx(r.Context()).Errorf("Error getting refresh job: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if job == nil {
+		http.Error(w, "Refresh job not found", http.StatusNotFound)
+		return
+	}
+
+	report, err := a.db.GetRefreshReport(id)
+	if err != nil {
+		logging.Server.Ctx(r.Context()).Errorf("Error getting refresh report: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if report == "" {
+		http.Error(w, "No report available for this job", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(report))
+}
+
+// refreshJobSummary is an entry of /api/refresh/jobs
+type refreshJobSummary struct {
+	db.RefreshJob
+	TopError string `json:"top_error"` // category with the most errors, empty if none
+}
+
+// handleRefreshJobs lists recent refresh jobs (?limit=, default 20) with their
+// error counts by category, so a bad run shows at a glance whether it hit rate
+// limits, network trouble or bad data
+func (a *API) handleRefreshJobs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	limit := 20
+	if v, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && v > 0 && v <= 200 {
+		limit = v
+	}
+
+	jobs, err := a.readerFor(r).ListRefreshJobs(limit)
+	if err != nil {
+		logging.Server.Ctx(r.Context()).Errorf("Error listing refresh jobs: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	summaries := make([]refreshJobSummary, len(jobs))
+	for i, job := range jobs {
+		summaries[i] = refreshJobSummary{RefreshJob: job}
+		top := 0
+		for category, n := range job.ErrorCounts {
+			if n > top || (n == top && category < summaries[i].TopError) {
+				summaries[i].TopError, top = category, n
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(summaries)
+}
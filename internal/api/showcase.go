@@ -0,0 +1,79 @@
+package api
+
+import (
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"dhi-oss-usage/internal/db"
+	"dhi-oss-usage/internal/logging"
+)
+
+// Showcase defaults: notable projects (100+ stars), six per page
+const (
+	showcaseMinStars = 100
+	showcaseCount    = 6
+	showcaseMaxCount = 50
+)
+
+// handleShowcase returns a selection of notable adopters for the homepage
+// carousel: live, verified, non-fork projects with at least ?min_stars= stars
+// (default 100). By default the selection changes once a day (UTC) so every
+// visitor sees the same adopters; ?mode=random picks anew on each request.
+func (a *API) handleShowcase(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	n := showcaseCount
+	if v, err := strconv.Atoi(q.Get("n")); err == nil && v > 0 {
+		n = min(v, showcaseMaxCount)
+	}
+	minStars := showcaseMinStars
+	if v, err := strconv.Atoi(q.Get("min_stars")); err == nil && v >= 0 {
+		minStars = v
+	}
+
+	var rng *rand.Rand
+	switch q.Get("mode") {
+	case "", "daily":
+		now := time.Now().UTC()
+		rng = rand.New(rand.NewSource(int64(now.Year()*10000 + int(now.Month())*100 + now.Day())))
+	case "random":
+		rng = rand.New(rand.NewSource(time.Now().UnixNano()))
+	default:
+		http.Error(w, "Invalid 'mode' parameter. Use 'daily' or 'random'", http.StatusBadRequest)
+		return
+	}
+
+	candidates, err := a.readerFor(r).ListProjects(db.ProjectFilter{
+		MinStars:        minStars,
+		Status:          "active",
+		ExcludeArchived: true,
+		ExcludeForks:    true,
+		SortBy:          "name", // a stable order, so a daily seed picks the same projects
+		SortOrder:       "asc",
+	})
+	if err != nil {
+		logging.Server.Ctx(r.Context()).Errorf("Error listing showcase projects: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	showcase := make([]db.Project, 0, n)
+	for _, i := range rng.Perm(len(candidates)) {
+		if len(showcase) == n {
+			break
+		}
+		if candidates[i].VerificationStatus == "verified" {
+			showcase = append(showcase, candidates[i])
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(showcase)
+}
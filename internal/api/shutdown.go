@@ -0,0 +1,63 @@
+package api
+
+import (
+	"context"
+	"errors"
+
+	"dhi-oss-usage/internal/logging"
+)
+
+// errInterrupted is the error of refresh jobs stopped by a shutdown
+var errInterrupted = errors.New("refresh interrupted: the server shut down before it finished")
+
+// Shutdown stops any running refresh and waits for it to record where it got
+// to, and for background work such as webhook pushes and avatar prefetching to
+// stop, then flushes the API usage counters. Refreshes can't be started after.
+// If ctx ends first the job stays running in the database and is marked
+// interrupted on the next start.
+func (a *API) Shutdown(ctx context.Context) error {
+	a.refreshMu.Lock()
+	a.stopping = true
+	a.refreshMu.Unlock()
+	a.stopRefreshes()
+	a.stopDelayedRefresh()
+
+	done := make(chan struct{})
+	go func() {
+		a.refreshJobs.Wait()
+		close(done)
+	}()
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	a.flushUsage()
+	return err
+}
+
+// interrupted reports whether refreshes are being stopped by Shutdown
+func (a *API) interrupted() bool {
+	return a.refreshCtx.Err() != nil
+}
+
+// RecoverInterruptedRefreshes marks refresh jobs left pending or running by a
+// server that was killed before it could stop them as interrupted. It reports
+// whether the most recent refresh was interrupted, either way, so it can be
+// re-run.
+func (a *API) RecoverInterruptedRefreshes() bool {
+	n, err := a.db.InterruptUnfinishedRefreshJobs(errInterrupted.Error(), remediations[failureInterrupted])
+	if err != nil {
+		logging.Refresh.Errorf("Error marking unfinished refresh jobs interrupted: %v", err)
+	} else if n > 0 {
+		logging.Refresh.Infof("Marked %d unfinished refresh job(s) interrupted", n)
+	}
+
+	job, err := a.db.GetLatestRefreshJob()
+	if err != nil {
+		logging.Refresh.Errorf("Error getting latest refresh job: %v", err)
+		return false
+	}
+	return job != nil && job.Status == "interrupted"
+}
@@ -0,0 +1,155 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"dhi-oss-usage/internal/logging"
+)
+
+// sloWindow is the period over which freshness compliance is reported
+const sloWindow = 30 * 24 * time.Hour
+
+// SetFreshnessSLO sets the maximum acceptable data age and the notification
+// configs (by name) that receive ops alerts when it is breached
+func (a *API) SetFreshnessSLO(maxAge time.Duration, alertConfigs []string) {
+	a.freshnessSLO = maxAge
+	a.opsAlertConfigs = alertConfigs
+}
+
+// StartFreshnessMonitor checks data freshness against the SLO every interval
+func (a *API) StartFreshnessMonitor(interval time.Duration) {
+	if a.freshnessSLO <= 0 {
+		return
+	}
+	go func() {
+		a.checkFreshness()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			a.checkFreshness()
+		}
+	}()
+}
+
+// checkFreshness opens a violation when data is older than the SLO and resolves it once a refresh succeeds
+func (a *API) checkFreshness() {
+	lastRefresh := a.GetLastRefreshTime()
+	open, err := a.db.GetOpenFreshnessViolation()
+	if err != nil {
+		logging.Server.Errorf("Error checking freshness violations: %v", err)
+		return
+	}
+
+	// With no successful refresh yet, measure from server start so a fresh
+	// install isn't immediately in violation but a broken one still alerts
+	now := time.Now()
+	freshAsOf := a.startedAt
+	if lastRefresh != nil {
+		freshAsOf = *lastRefresh
+	}
+	stale := now.Sub(freshAsOf) > a.freshnessSLO
+
+	// An open violation only resolves on an actual successful refresh; after a
+	// restart with none recorded yet it stays open rather than measuring from startup
+	if open != nil && lastRefresh == nil {
+		stale = true
+	}
+
+	if stale && open == nil {
+		startedAt := freshAsOf.Add(a.freshnessSLO)
+		if _, err := a.db.CreateFreshnessViolation(startedAt, lastRefresh); err != nil {
+			logging.Server.Errorf("Error recording freshness violation: %v", err)
+			return
+		}
+		last := "never"
+		if lastRefresh != nil {
+			last = lastRefresh.Format(time.RFC1123)
+		}
+		logging.Server.Warnf("Freshness SLO breached: last successful refresh %s (objective %s)", last, a.freshnessSLO)
+		a.sendOpsAlert("DHI OSS Tracker - Data freshness SLO breached",
+			fmt.Sprintf("Tracker data is older than the %s freshness objective.\n\nLast successful refresh: %s", a.freshnessSLO, last))
+		return
+	}
+
+	if !stale && open != nil {
+		if err := a.db.ResolveFreshnessViolation(open.ID, *lastRefresh); err != nil {
+			logging.Server.Errorf("Error resolving freshness violation: %v", err)
+			return
+		}
+		duration := lastRefresh.Sub(open.StartedAt).Round(time.Minute)
+		logging.Server.Infof("Freshness SLO recovered after %s", duration)
+		a.sendOpsAlert("DHI OSS Tracker - Data freshness recovered",
+			fmt.Sprintf("Tracker data is fresh again.\n\nLast successful refresh: %s\nViolation lasted: %s", lastRefresh.Format(time.RFC1123), duration))
+	}
+}
+
+func (a *API) sendOpsAlert(subject, body string) {
+	if len(a.opsAlertConfigs) == 0 {
+		return
+	}
+	if err := a.notificationsSvc.SendAlert(a.opsAlertConfigs, subject, body); err != nil {
+		logging.Server.Errorf("Error sending ops alert: %v", err)
+	}
+}
+
+// handleAdminSLO reports freshness SLO status and compliance over the last 30 days
+func (a *API) handleAdminSLO(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !a.requireAdmin(w, r) {
+		return
+	}
+
+	now := time.Now()
+	windowStart := now.Add(-sloWindow)
+	violations, err := a.db.ListFreshnessViolations(windowStart)
+	if err != nil {
+		logging.Server.Ctx(r.Context()).Errorf("Error listing freshness violations: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// Time spent in violation within the window
+	var violated time.Duration
+	for _, v := range violations {
+		start, end := v.StartedAt, now
+		if v.ResolvedAt != nil {
+			end = *v.ResolvedAt
+		}
+		if start.Before(windowStart) {
+			start = windowStart
+		}
+		if end.After(start) {
+			violated += end.Sub(start)
+		}
+	}
+
+	response := map[string]interface{}{
+		"objective_hours":   a.freshnessSLO.Hours(),
+		"window_days":       int(sloWindow.Hours() / 24),
+		"compliance_pct":    100 * (1 - violated.Seconds()/sloWindow.Seconds()),
+		"violation_seconds": int64(violated.Seconds()),
+		"violations":        violations,
+	}
+
+	lastRefresh := a.GetLastRefreshTime()
+	response["last_refresh_at"] = lastRefresh
+	if lastRefresh != nil {
+		age := now.Sub(*lastRefresh)
+		response["data_age_seconds"] = int64(age.Seconds())
+		response["compliant"] = a.freshnessSLO <= 0 || age <= a.freshnessSLO
+	} else {
+		response["compliant"] = false
+	}
+	if violations == nil {
+		response["violations"] = []interface{}{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
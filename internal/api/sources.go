@@ -0,0 +1,155 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"dhi-oss-usage/internal/db"
+	"dhi-oss-usage/internal/logging"
+)
+
+// sourceJobsScanned bounds the refresh jobs read to find the last manual one
+const sourceJobsScanned = 50
+
+// sourceStatus is an entry of /api/sources: one way projects are discovered
+type sourceStatus struct {
+	Name       string     `json:"name"` // github, gitlab, manual, webhook
+	Enabled    bool       `json:"enabled"`
+	Status     string     `json:"status"` // ok, degraded (ran with failed items), error, never_run
+	LastRunAt  *time.Time `json:"last_run_at"`
+	ItemsFound int        `json:"items_found"`
+	Error      string     `json:"error,omitempty"`
+	NextRunAt  *time.Time `json:"next_run_at"`
+}
+
+// webhookActivity records the last push delivery processed, since startup
+type webhookActivity struct {
+	mu    sync.Mutex
+	last  time.Time
+	error string
+}
+
+// record notes a processed push and its error, if any
+func (w *webhookActivity) record(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.last = time.Now().UTC()
+	w.error = ""
+	if err != nil {
+		w.error = err.Error()
+	}
+}
+
+// handleSources reports each discovery source (GitHub and GitLab search,
+// manual refreshes and GitHub webhooks) with when it last ran, what it found,
+// whether it failed and when it runs next
+func (a *API) handleSources(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	store := a.readerFor(r)
+	jobs, err := store.ListRefreshJobs(sourceJobsScanned)
+	if err != nil {
+		logging.Server.Ctx(r.Context()).Errorf("Error listing refresh jobs: %v", err)
+		readFailed(w, r)
+		return
+	}
+
+	// The last finished refresh ran both searches; the last manual one may be older
+	var last *refreshReport
+	var lastJob, lastManualJob *db.RefreshJob
+	for i := range jobs {
+		job := &jobs[i]
+		if job.Status != "completed" && job.Status != "failed" {
+			continue
+		}
+		raw, err := store.GetRefreshReport(job.ID)
+		if err != nil {
+			logging.Server.Ctx(r.Context()).Errorf("Error getting refresh report %d: %v", job.ID, err)
+			readFailed(w, r)
+			return
+		}
+		var report refreshReport
+		if raw == "" || json.Unmarshal([]byte(raw), &report) != nil {
+			continue
+		}
+		if last == nil {
+			last, lastJob = &report, job
+		}
+		if report.Source == "manual" {
+			lastManualJob = job
+			break
+		}
+	}
+
+	var next *time.Time
+	if a.nextRefreshFn != nil {
+		next = a.nextRefreshFn()
+	}
+
+	github := sourceStatus{Name: "github", Enabled: true, Status: "never_run", NextRunAt: next}
+	gitlab := sourceStatus{Name: "gitlab", Enabled: a.glClient != nil, Status: "never_run"}
+	if gitlab.Enabled {
+		gitlab.NextRunAt = next
+	}
+	if last != nil {
+		github.LastRunAt = lastJob.CompletedAt
+		github.ItemsFound = last.Phases["search"]["repos_discovered"]
+		github.Status = "ok"
+		if last.ErrorMessage != "" {
+			github.Status, github.Error = "error", last.ErrorMessage
+		} else if last.Phases["details"]["failed"] > 0 || last.Phases["search"]["topic_errors"] > 0 {
+			github.Status = "degraded"
+		}
+
+		// GitLab runs after GitHub succeeds, and not in sample refreshes
+		if gitlab.Enabled && last.ErrorMessage == "" && last.Sample == 0 {
+			gitlab.LastRunAt = lastJob.CompletedAt
+			gitlab.ItemsFound = last.Phases["gitlab"]["repos_discovered"]
+			gitlab.Status = "ok"
+			if msg := last.SourceErrors["gitlab"]; msg != "" {
+				gitlab.Status, gitlab.Error = "error", msg
+			} else if last.Phases["gitlab"]["failed"] > 0 {
+				gitlab.Status = "degraded"
+			}
+		}
+	}
+
+	manual := sourceStatus{Name: "manual", Enabled: true, Status: "never_run"}
+	if lastManualJob != nil {
+		manual.LastRunAt = lastManualJob.CompletedAt
+		manual.ItemsFound = lastManualJob.ProjectsFound
+		manual.Status = "ok"
+		if lastManualJob.Status == "failed" {
+			manual.Status, manual.Error = "error", lastManualJob.ErrorMessage
+		}
+	}
+
+	webhook := sourceStatus{Name: "webhook", Enabled: a.webhookSecret != "", Status: "never_run"}
+	if webhook.Enabled {
+		a.webhooks.mu.Lock()
+		lastPush, pushErr := a.webhooks.last, a.webhooks.error
+		a.webhooks.mu.Unlock()
+		if !lastPush.IsZero() {
+			webhook.LastRunAt = &lastPush
+			webhook.Status = "ok"
+			if pushErr != "" {
+				webhook.Status, webhook.Error = "error", pushErr
+			}
+		}
+		// Projects first found by a push, however long ago
+		webhook.ItemsFound, err = store.CountProjects(db.ProjectFilter{SourceType: webhookSourceType, Status: "active"})
+		if err != nil {
+			logging.Server.Ctx(r.Context()).Errorf("Error counting webhook projects: %v", err)
+			readFailed(w, r)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode([]sourceStatus{github, gitlab, manual, webhook})
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"context"
+	"time"
+
+	"dhi-oss-usage/internal/db"
+	"dhi-oss-usage/internal/logging"
+)
+
+// starImportMaxAge is the default cadence of the star_history stage: history
+// from before a project was tracked doesn't change, but a re-import picks up
+// the stars given since and a changed page budget
+const starImportMaxAge = 30 * 24 * time.Hour
+
+// SetStarImport enables importing star history from the stargazer list for
+// the top most starred adopters, reading at most pages pages of 100 stargazers
+// per repository. top 0 disables it.
+func (a *API) SetStarImport(top, pages int) {
+	a.starImportTop = top
+	a.starImportPages = pages
+}
+
+// importStarHistory imports the daily star counts of the most starred live
+// GitHub projects not imported within the stage's cadence, so their growth
+// charts reach back before the tracker first saw them
+func (a *API) importStarHistory(ctx context.Context, report *refreshReport) {
+	if a.starImportTop <= 0 {
+		return
+	}
+	projects, err := a.db.GetLiveGitHubProjects()
+	if err != nil {
+		logging.Refresh.Ctx(ctx).Errorf("Error listing projects for star history import: %v", err)
+		return
+	}
+	if len(projects) > a.starImportTop {
+		projects = projects[:a.starImportTop] // most starred first
+	}
+	projects = a.dueProjects(ctx, "star_history", projects, report)
+	if len(projects) == 0 {
+		return
+	}
+	logging.Refresh.Ctx(ctx).Infof("Importing star history of %d projects...", len(projects))
+
+	a.ghClient.Parallel(ctx, len(projects), func(i int) {
+		p := projects[i]
+		timeline, err := a.ghClient.GetStarTimeline(ctx, p.RepoFullName, a.starImportPages)
+		if err != nil {
+			logging.Refresh.Ctx(ctx).Errorf("Error reading stargazers of %s: %v", p.RepoFullName, err)
+			report.count("star_history", "failed", 1)
+			report.addError(err)
+			return
+		}
+
+		// The running count at the last star of each day
+		var points []db.StarHistoryPoint
+		for _, s := range timeline {
+			day := s.At.UTC().Format("2006-01-02")
+			if n := len(points); n > 0 && points[n-1].Date == day {
+				points[n-1].Stars = s.Stars
+				continue
+			}
+			points = append(points, db.StarHistoryPoint{Date: day, Stars: s.Stars})
+		}
+
+		if err := a.db.SetImportedStarHistory(p.ID, points); err != nil {
+			logging.Refresh.Ctx(ctx).Errorf("Error saving star history of %s: %v", p.RepoFullName, err)
+			report.count("star_history", "failed", 1)
+			report.countError("database")
+			return
+		}
+		a.recordStageRun(ctx, "star_history", p.ID)
+		report.count("star_history", "imported", 1)
+	})
+	logging.Refresh.Ctx(ctx).Infof("Finished star history import")
+}
@@ -0,0 +1,204 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"dhi-oss-usage/internal/db"
+	"dhi-oss-usage/internal/github"
+	"dhi-oss-usage/internal/i18n"
+	"dhi-oss-usage/internal/logging"
+	"dhi-oss-usage/internal/notifications"
+)
+
+// responseFormatSettingPrefix namespaces per-consumer response formats within the
+// settings table, e.g. response_format.dashboard = "naming=camel,timestamps=epoch_ms"
+const responseFormatSettingPrefix = "response_format."
+
+// responseFormat is how JSON responses are rewritten for a client
+type responseFormat struct {
+	camelCase   bool // repo_full_name becomes repoFullName
+	epochMillis bool // *_at timestamps become milliseconds since the epoch
+}
+
+// apply applies "naming=camel|snake" and "timestamps=epoch_ms|rfc3339"
+// options to f. Unknown options are ignored.
+func (f *responseFormat) apply(name, value string) {
+	switch name {
+	case "naming":
+		f.camelCase = value == "camel"
+	case "timestamps":
+		f.epochMillis = value == "epoch_ms"
+	}
+}
+
+// responseFormat returns the format a request asked for: the consumer's setting,
+// overridden by ?naming= and ?timestamps=
+func (a *API) responseFormat(r *http.Request) responseFormat {
+	var f responseFormat
+	if consumer := a.apiConsumer(r); consumer != anonymousConsumer {
+		setting, ok, err := a.readerFor(r).GetSetting(responseFormatSettingPrefix + consumer)
+		if err != nil {
+			logging.Server.Ctx(r.Context()).Errorf("Error reading response format of %s: %v", consumer, err)
+		} else if ok {
+			for _, opt := range strings.Split(setting, ",") {
+				name, value, _ := strings.Cut(strings.TrimSpace(opt), "=")
+				f.apply(name, value)
+			}
+		}
+	}
+	q := r.URL.Query()
+	for _, name := range []string{"naming", "timestamps"} {
+		if q.Has(name) {
+			f.apply(name, q.Get(name))
+		}
+	}
+	return f
+}
+
+// bufferedResponse holds a handler's response so it can be rewritten before sending
+type bufferedResponse struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	b.status = status
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	return b.body.Write(p)
+}
+
+// serveFormatted runs next with the response buffered and rewrites successful,
+// uncompressed JSON responses in format f. Other responses pass through unchanged.
+func serveFormatted(w http.ResponseWriter, r *http.Request, f responseFormat, next http.Handler) {
+	buf := &bufferedResponse{ResponseWriter: w, status: http.StatusOK}
+	next.ServeHTTP(buf, r)
+
+	body := buf.body.Bytes()
+	if buf.status < 300 && w.Header().Get("Content-Encoding") == "" &&
+		strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+		dec := json.NewDecoder(bytes.NewReader(body))
+		dec.UseNumber()
+		var v interface{}
+		if err := dec.Decode(&v); err == nil {
+			if out, err := json.Marshal(f.transform("", v, 0)); err == nil {
+				body = append(out, '\n')
+				w.Header().Del("Content-Length")
+			}
+		}
+	}
+	w.WriteHeader(buf.status)
+	w.Write(body)
+}
+
+// dataFields are the JSON fields of response types whose objects are keyed by
+// data rather than field names, such as a report's error categories, with how
+// many levels of nested objects are keyed that way (-1 for raw JSON, all of
+// them). camelCase leaves their keys alone.
+var dataFields = collectDataFields(
+	refreshReport{}, db.RefreshJob{}, githubDiagnostics{}, github.TokenStatus{},
+	github.TokenInfo{}, github.ServiceStatus{}, github.FetchStats{}, i18n.Locale{},
+	notifications.ProviderInfo{}, notifications.Event{}, applyDocument{},
+)
+
+// collectDataFields finds the map and raw JSON fields reachable from values
+func collectDataFields(values ...interface{}) map[string]int {
+	fields := make(map[string]int)
+	seen := make(map[reflect.Type]bool)
+	var walk func(t reflect.Type)
+	walk = func(t reflect.Type) {
+		for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct || seen[t] {
+			return
+		}
+		seen[t] = true
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if field.Anonymous && name == "" {
+				walk(field.Type)
+				continue
+			}
+			if name == "" || name == "-" || !field.IsExported() {
+				continue
+			}
+			ft := field.Type
+			if ft == reflect.TypeOf(json.RawMessage{}) {
+				fields[name] = -1
+				continue
+			}
+			levels := 0
+			for ft.Kind() == reflect.Pointer || ft.Kind() == reflect.Map {
+				if ft.Kind() == reflect.Map {
+					levels++
+				}
+				ft = ft.Elem()
+			}
+			if levels > 0 {
+				fields[name] = levels
+			}
+			walk(ft)
+		}
+	}
+	for _, v := range values {
+		walk(reflect.TypeOf(v))
+	}
+	return fields
+}
+
+// transform rewrites a decoded JSON value; key is the object key it was found
+// under. The keys of the next keep levels of objects are data and aren't
+// renamed; a negative keep keeps every level.
+func (f responseFormat) transform(key string, v interface{}, keep int) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			name, childKeep := k, 0
+			switch {
+			case keep < 0:
+				childKeep = -1
+			case keep > 0:
+				childKeep = keep - 1
+			case f.camelCase:
+				name = camelCase(k)
+				childKeep = dataFields[k]
+			}
+			out[name] = f.transform(k, val, childKeep)
+		}
+		return out
+	case []interface{}:
+		for i, val := range v {
+			v[i] = f.transform(key, val, keep)
+		}
+		return v
+	case string:
+		if f.epochMillis && strings.HasSuffix(key, "_at") {
+			if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+				return json.Number(strconv.FormatInt(t.UnixMilli(), 10))
+			}
+		}
+	}
+	return v
+}
+
+// camelCase converts a snake_case key, e.g. repo_full_name to repoFullName
+func camelCase(s string) string {
+	parts := strings.Split(s, "_")
+	for i := 1; i < len(parts); i++ {
+		if parts[i] != "" {
+			parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
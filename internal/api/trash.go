@@ -0,0 +1,147 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"dhi-oss-usage/internal/db"
+	"dhi-oss-usage/internal/logging"
+)
+
+// trashRequest moves projects to or from the trash via /api/admin/projects/delete
+// and /api/admin/projects/restore
+type trashRequest struct {
+	Projects []string `json:"projects"` // repo_full_name of each project
+}
+
+// SetTrashRetention sets how long soft-deleted projects are kept before they
+// are purged. 0 keeps them until restored.
+func (a *API) SetTrashRetention(retention time.Duration) {
+	a.trashRetention = retention
+}
+
+// StartTrashPurger purges projects past the trash retention every interval
+func (a *API) StartTrashPurger(interval time.Duration) {
+	if a.trashRetention <= 0 {
+		return
+	}
+	go func() {
+		a.purgeTrash()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			a.purgeTrash()
+		}
+	}()
+}
+
+// purgeTrash permanently deletes projects in the trash for longer than the retention
+func (a *API) purgeTrash() {
+	n, err := a.db.PurgeDeletedProjects(time.Now().Add(-a.trashRetention))
+	if err != nil {
+		logging.Server.Errorf("Error purging deleted projects: %v", err)
+		return
+	}
+	if n > 0 {
+		logging.Server.Infof("Purged %d projects deleted more than %s ago", n, a.trashRetention)
+		a.dataChanged()
+	}
+}
+
+// handleAdminProjectsDelete soft-deletes projects, e.g. false positives. They
+// drop out of listings and stats but can be restored until purged.
+func (a *API) handleAdminProjectsDelete(w http.ResponseWriter, r *http.Request) {
+	a.handleTrashChange(w, r, "deleted", a.db.SoftDeleteProjects)
+}
+
+// handleAdminProjectsRestore takes soft-deleted projects out of the trash
+func (a *API) handleAdminProjectsRestore(w http.ResponseWriter, r *http.Request) {
+	a.handleTrashChange(w, r, "restored", a.db.RestoreProjects)
+}
+
+// handleTrashChange applies a trash operation to the projects named in a
+// trashRequest, failing the whole request if any isn't tracked
+func (a *API) handleTrashChange(w http.ResponseWriter, r *http.Request, verb string, apply func(ids []int64) (int, error)) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !a.requireAdmin(w, r) {
+		return
+	}
+
+	var req trashRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+	if len(req.Projects) == 0 {
+		http.Error(w, "projects is required", http.StatusBadRequest)
+		return
+	}
+
+	ids := make([]int64, 0, len(req.Projects))
+	for _, name := range req.Projects {
+		p, err := a.db.GetProjectByName(name)
+		if err != nil {
+			logging.Server.Ctx(r.Context()).Errorf("Error getting project %s: %v", name, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if p == nil {
+			http.Error(w, fmt.Sprintf("Project %q is not tracked", name), http.StatusBadRequest)
+			return
+		}
+		ids = append(ids, p.ID)
+	}
+
+	n, err := apply(ids)
+	if err != nil {
+		logging.Server.Ctx(r.Context()).Errorf("Error updating trash: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	logging.Server.Ctx(r.Context()).Infof("%d of %d projects %s", n, len(ids), verb)
+
+	// Stats and listings served from aggregates must reflect the change now
+	if n > 0 {
+		a.computeAggregates()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		verb:      n,
+	})
+}
+
+// handleAdminTrash lists soft-deleted projects, most recently deleted first
+func (a *API) handleAdminTrash(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !a.requireAdmin(w, r) {
+		return
+	}
+
+	projects, err := a.db.ListProjects(db.ProjectFilter{Deleted: "only", SortBy: "deleted", SortOrder: "desc"})
+	if err != nil {
+		logging.Server.Ctx(r.Context()).Errorf("Error listing deleted projects: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if projects == nil {
+		projects = []db.Project{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"retention_days": int(a.trashRetention.Hours() / 24),
+		"projects":       projects,
+	})
+}
@@ -0,0 +1,192 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"dhi-oss-usage/internal/db"
+	"dhi-oss-usage/internal/logging"
+)
+
+// anonymousConsumer is the usage consumer of requests without a known API key
+const anonymousConsumer = "anonymous"
+
+// usageKey identifies a usage counter
+type usageKey struct {
+	consumer, method, endpoint string
+	version                    int
+}
+
+// usageTracker counts requests in memory between flushes to the database
+type usageTracker struct {
+	mu      sync.Mutex
+	pending map[usageKey]*db.APIUsage
+}
+
+// SetAPIKeys sets the API keys consumers identify with (key -> consumer name),
+// sent in the X-API-Key header or ?api_key=. Keys only attribute usage; they
+// aren't required to use the API.
+func (a *API) SetAPIKeys(keys map[string]string) {
+	a.apiKeys = keys
+}
+
+// StartUsageFlusher writes counted API usage to the database every interval
+func (a *API) StartUsageFlusher(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			a.flushUsage()
+		}
+	}()
+}
+
+// apiConsumer returns the name of the API key a request was made with
+func (a *API) apiConsumer(r *http.Request) string {
+	key := r.Header.Get("X-API-Key")
+	if key == "" {
+		key = r.URL.Query().Get("api_key")
+	}
+	if name, ok := a.apiKeys[key]; ok && key != "" {
+		return name
+	}
+	return anonymousConsumer
+}
+
+// add merges a counter into the pending counts
+func (t *usageTracker) add(u db.APIUsage) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.pending == nil {
+		t.pending = make(map[usageKey]*db.APIUsage)
+	}
+	k := usageKey{consumer: u.Consumer, method: u.Method, endpoint: u.Endpoint, version: u.Version}
+	cur, ok := t.pending[k]
+	if !ok {
+		t.pending[k] = &u
+		return
+	}
+	cur.Count += u.Count
+	if u.FirstSeenAt.Before(cur.FirstSeenAt) {
+		cur.FirstSeenAt = u.FirstSeenAt
+	}
+	if u.LastSeenAt.After(cur.LastSeenAt) {
+		cur.LastSeenAt = u.LastSeenAt
+	}
+}
+
+// take removes and returns the pending counts
+func (t *usageTracker) take() []db.APIUsage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	usage := make([]db.APIUsage, 0, len(t.pending))
+	for _, u := range t.pending {
+		usage = append(usage, *u)
+	}
+	t.pending = nil
+	return usage
+}
+
+// recordUsage counts a request to a route, identified by the pattern it matched
+func (a *API) recordUsage(r *http.Request, version int, pattern string) {
+	now := time.Now()
+	a.usage.add(db.APIUsage{
+		Consumer:    a.apiConsumer(r),
+		Method:      usageMethod(r.Method),
+		Endpoint:    usageEndpoint(pattern),
+		Version:     version,
+		Count:       1,
+		FirstSeenAt: now,
+		LastSeenAt:  now,
+	})
+}
+
+// flushUsage writes counted usage to the database. Counts are kept for the next
+// flush if the write fails.
+func (a *API) flushUsage() {
+	usage := a.usage.take()
+	if len(usage) == 0 {
+		return
+	}
+	if err := a.db.RecordAPIUsage(usage); err != nil {
+		logging.Server.Errorf("Error recording API usage: %v", err)
+		for _, u := range usage {
+			a.usage.add(u)
+		}
+	}
+}
+
+// usageMethod returns the method a request is counted under. Any token is
+// accepted as a method, so nonstandard ones share one counter rather than
+// letting clients grow the table.
+func usageMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodPatch, http.MethodDelete, http.MethodOptions:
+		return method
+	}
+	return "OTHER"
+}
+
+// usageEndpoint names the route a request matched. Usage is keyed by route
+// rather than path so clients can't grow the table with arbitrary paths;
+// routes serving a subtree, such as /api/projects/, are shown as /api/projects/*.
+func usageEndpoint(pattern string) string {
+	if strings.HasSuffix(pattern, "/") {
+		return pattern + "*"
+	}
+	return pattern
+}
+
+// consumerUsage is an entry of /api/admin/usage
+type consumerUsage struct {
+	Consumer   string        `json:"consumer"`
+	Requests   int64         `json:"requests"`
+	LastSeenAt time.Time     `json:"last_seen_at"`
+	Endpoints  []db.APIUsage `json:"endpoints"`
+}
+
+// handleAdminUsage returns request counts per API consumer and endpoint, most
+// active consumers first. ?consumer= limits it to one consumer.
+func (a *API) handleAdminUsage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !a.requireAdmin(w, r) {
+		return
+	}
+
+	a.flushUsage()
+	usage, err := a.db.ListAPIUsage(r.URL.Query().Get("consumer"))
+	if err != nil {
+		logging.Server.Ctx(r.Context()).Errorf("Error listing API usage: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	consumers := []consumerUsage{}
+	index := make(map[string]int)
+	for _, u := range usage {
+		i, ok := index[u.Consumer]
+		if !ok {
+			i = len(consumers)
+			index[u.Consumer] = i
+			consumers = append(consumers, consumerUsage{Consumer: u.Consumer})
+		}
+		c := &consumers[i]
+		c.Requests += u.Count
+		if u.LastSeenAt.After(c.LastSeenAt) {
+			c.LastSeenAt = u.LastSeenAt
+		}
+		c.Endpoints = append(c.Endpoints, u)
+	}
+	sort.SliceStable(consumers, func(i, j int) bool { return consumers[i].Requests > consumers[j].Requests })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(consumers)
+}
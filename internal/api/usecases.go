@@ -0,0 +1,69 @@
+package api
+
+import (
+	"context"
+
+	"dhi-oss-usage/internal/classify"
+	"dhi-oss-usage/internal/db"
+	"dhi-oss-usage/internal/logging"
+)
+
+// SetClassifier replaces the keyword rules that tag projects with their use
+// case, e.g. with a classify.Chain that asks a language model first
+func (a *API) SetClassifier(c classify.Classifier) {
+	a.classifier = c
+}
+
+// classifyProjects tags live projects with their use case from their name,
+// description and topics, saving the ones that changed. Use cases a
+// classifier makes up are treated as no answer.
+func (a *API) classifyProjects(ctx context.Context, report *refreshReport) {
+	projects, err := a.db.ListProjects(db.ProjectFilter{Status: "active"})
+	if err != nil {
+		logging.Refresh.Ctx(ctx).Errorf("Error listing projects to classify: %v", err)
+		report.countError("database")
+		return
+	}
+	projects = a.dueProjects(ctx, "use_case", projects, report)
+
+	changed := make(map[int64]string)
+	var done []int64
+	for i := range projects {
+		if ctx.Err() != nil {
+			break
+		}
+		p := &projects[i]
+		useCase, err := a.classifier.Classify(ctx, p)
+		if err != nil {
+			logging.Refresh.Ctx(ctx).Warnf("Error classifying %s: %v", p.RepoFullName, err)
+			report.count("use_case", "failed", 1)
+			report.addError(err)
+			continue
+		}
+		if !classify.IsUseCase(useCase) {
+			useCase = ""
+		}
+		if useCase == "" {
+			report.count("use_case", "unclassified", 1)
+		} else {
+			report.count("use_case", useCase, 1)
+		}
+		if useCase != p.UseCase {
+			changed[p.ID] = useCase
+		}
+		done = append(done, p.ID)
+	}
+
+	if len(changed) > 0 {
+		if err := a.db.SetProjectUseCases(changed); err != nil {
+			logging.Refresh.Ctx(ctx).Errorf("Error saving use cases: %v", err)
+			report.countError("database")
+			return
+		}
+		report.count("use_case", "changed", len(changed))
+		logging.Refresh.Ctx(ctx).Infof("Use case of %d projects changed", len(changed))
+	}
+	for _, id := range done {
+		a.recordStageRun(ctx, "use_case", id)
+	}
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// API versions. Every route is served under /api/v1/ and /api/v2/; unversioned
+// /api/ paths keep serving v1 for existing dashboards and scripts. v1 response
+// shapes are frozen: shape changes only go to v2, where handlers check
+// apiVersion(r). v1 and unversioned responses carry Deprecation headers that
+// point at the v2 equivalent.
+const (
+	apiV1 = 1
+	apiV2 = 2
+
+	// v2 list endpoints page by default so responses stay bounded
+	v2DefaultLimit = 100
+	v2MaxLimit     = maxListLimit
+)
+
+type apiVersionKey struct{}
+
+// apiVersion returns the version a request was routed through (v1 for unversioned paths)
+func apiVersion(r *http.Request) int {
+	if v, ok := r.Context().Value(apiVersionKey{}).(int); ok {
+		return v
+	}
+	return apiV1
+}
+
+// SetV1Sunset sets the date advertised in the Sunset header of v1 and unversioned
+// responses. The zero time omits the header.
+func (a *API) SetV1Sunset(t time.Time) {
+	a.v1Sunset = t
+}
+
+// versioned serves routes for one version prefix (e.g. "/api/v2"), rewriting the
+// path to its unversioned form so handlers parse paths the same way in every version
+func (a *API) versioned(version int, prefix string, routes *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a.allowCORS(w, r) {
+			return // preflight
+		}
+		rest := strings.TrimPrefix(r.URL.Path, prefix)
+		if version < apiV2 {
+			w.Header().Set("Deprecation", "true")
+			w.Header().Set("Link", "<"+BasePath(r)+"/api/v2"+rest+`>; rel="successor-version"`)
+			if !a.v1Sunset.IsZero() {
+				w.Header().Set("Sunset", a.v1Sunset.UTC().Format(http.TimeFormat))
+			}
+		}
+
+		r2 := r.Clone(context.WithValue(r.Context(), apiVersionKey{}, version))
+		r2.URL.Path = "/api" + rest
+		r2.URL.RawPath = ""
+		// Unknown paths aren't counted so usage only lists real endpoints
+		_, pattern := routes.Handler(r2)
+		if pattern != "" {
+			a.recordUsage(r2, version, pattern)
+		}
+		// Handlers read through readerFor, so the deadline also interrupts their queries
+		if timeout := a.routeTimeout(pattern); timeout > 0 {
+			ctx, cancel := context.WithTimeout(r2.Context(), timeout)
+			defer cancel()
+			r2 = r2.WithContext(ctx)
+		}
+		// camelCase keys and epoch timestamps are applied to the encoded response
+		// here, so handlers only ever write the default format
+		if f := a.responseFormat(r2); f != (responseFormat{}) {
+			serveFormatted(w, r2, f, routes)
+			return
+		}
+		routes.ServeHTTP(w, r2)
+	})
+}
+
+// pageEnvelope wraps v2 list responses (and v1 ones with ?envelope=true) with
+// what clients need for page controls. Limit is 0 when a v1 list isn't paged.
+type pageEnvelope struct {
+	Items  interface{} `json:"items"`
+	Total  int         `json:"total"`
+	Limit  int         `json:"limit"`
+	Offset int         `json:"offset"`
+}
@@ -0,0 +1,218 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"dhi-oss-usage/internal/db"
+	"dhi-oss-usage/internal/github"
+	"dhi-oss-usage/internal/logging"
+)
+
+const (
+	// maxWebhookPayload bounds the request body read from GitHub
+	maxWebhookPayload = 10 << 20
+	// maxWebhookFiles bounds the Dockerfiles fetched for one push
+	maxWebhookFiles = 20
+	// webhookSourceType is the source_type of projects first found by a webhook
+	webhookSourceType = "Webhook"
+)
+
+// SetWebhookSecret sets the secret GitHub signs webhook deliveries with.
+// /api/webhooks/github is disabled when no secret is set.
+func (a *API) SetWebhookSecret(secret string) {
+	a.webhookSecret = secret
+}
+
+// handleGitHubWebhook accepts push events from orgs that install the webhook.
+// Deliveries must carry a valid X-Hub-Signature-256. Pushes to a public repo's
+// default branch are processed in the background: changed Dockerfiles that
+// reference dhi.io add or update the project right away instead of waiting for
+// the next search.
+func (a *API) handleGitHubWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if a.webhookSecret == "" {
+		http.Error(w, "Webhooks disabled (GITHUB_WEBHOOK_SECRET not set)", http.StatusForbidden)
+		return
+	}
+
+	payload, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookPayload))
+	if err != nil {
+		http.Error(w, "Payload too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if !github.VerifyWebhookSignature(a.webhookSecret, payload, r.Header.Get("X-Hub-Signature-256")) {
+		http.Error(w, "Invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	event := r.Header.Get("X-GitHub-Event")
+	switch event {
+	case "ping":
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": true})
+		return
+	case "push":
+	default:
+		json.NewEncoder(w).Encode(map[string]interface{}{"ignored": event})
+		return
+	}
+
+	var push github.PushEvent
+	if err := json.Unmarshal(payload, &push); err != nil {
+		http.Error(w, "Invalid push payload", http.StatusBadRequest)
+		return
+	}
+	if push.Repository.Private || !push.ToDefaultBranch() {
+		json.NewEncoder(w).Encode(map[string]interface{}{"ignored": "push"})
+		return
+	}
+
+	delivery := r.Header.Get("X-GitHub-Delivery")
+	if !a.background(func() { a.processPush(&push, delivery) }) {
+		// GitHub can redeliver it once the server is back
+		http.Error(w, "Server is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{"accepted": true})
+}
+
+// processPush checks the Dockerfiles a push changed for dhi.io. The first one
+// that references it is upserted as the repo's project (keeping the source type
+// of a tracked project). A tracked project whose file was removed is flagged
+// file_missing, and one whose file no longer mentions dhi.io is flagged
+// unreferenced. It runs in the background and stops when the server shuts down.
+func (a *API) processPush(push *github.PushEvent, delivery string) {
+	ctx, cancel := context.WithTimeout(a.refreshCtx, 2*time.Minute)
+	defer cancel()
+
+	// The outcome is recorded for /api/sources
+	var failed error
+	defer func() { a.webhooks.record(failed) }()
+
+	repo := push.Repository.FullName
+	tracked, err := a.db.GetProjectByName(repo)
+	if err != nil {
+		logging.Server.Errorf("Webhook %s: error getting project %s: %v", delivery, repo, err)
+		failed = err
+		return
+	}
+
+	changed, removed := push.ChangedFiles()
+	if tracked != nil {
+		for _, path := range removed {
+			if path == tracked.DockerfilePath {
+				logging.Server.Infof("Webhook %s: %s removed %s", delivery, repo, path)
+				if err := a.db.SetProjectVerification(tracked.ID, "file_missing"); err != nil {
+					logging.Server.Errorf("Webhook %s: error flagging %s: %v", delivery, repo, err)
+				}
+			}
+		}
+	}
+
+	// The tracked file is checked first, so an update keeps the same path
+	var candidates []string
+	for _, path := range changed {
+		if github.ClassifyFileType(path) != "dockerfile" {
+			continue
+		}
+		if tracked != nil && path == tracked.DockerfilePath {
+			candidates = append([]string{path}, candidates...)
+		} else {
+			candidates = append(candidates, path)
+		}
+	}
+	if len(candidates) > maxWebhookFiles {
+		candidates = candidates[:maxWebhookFiles]
+	}
+
+	for _, path := range candidates {
+		content, err := a.ghClient.GetFileContentCached(ctx, repo, path)
+		if err != nil {
+			logging.Server.Errorf("Webhook %s: error fetching %s/%s: %v", delivery, repo, path, err)
+			continue
+		}
+		if !strings.Contains(strings.ToLower(content), "dhi.io") {
+			if tracked != nil && path == tracked.DockerfilePath {
+				logging.Server.Infof("Webhook %s: %s no longer references dhi.io in %s", delivery, repo, path)
+				if err := a.db.SetProjectVerification(tracked.ID, "unreferenced"); err != nil {
+					logging.Server.Errorf("Webhook %s: error flagging %s: %v", delivery, repo, err)
+				}
+			}
+			continue
+		}
+		failed = a.upsertPushedProject(ctx, push, tracked, path, content, delivery)
+		return
+	}
+}
+
+// upsertPushedProject records a repo whose pushed Dockerfile references dhi.io,
+// along with the DHI images it builds from. Returns an error if the project
+// couldn't be saved.
+func (a *API) upsertPushedProject(ctx context.Context, push *github.PushEvent, tracked *db.Project, path, content, delivery string) error {
+	repo := push.Repository.FullName
+	details, err := a.ghClient.GetRepoDetails(ctx, repo)
+	if err != nil {
+		logging.Server.Ctx(ctx).Errorf("Webhook %s: error fetching details for %s: %v", delivery, repo, err)
+		return err
+	}
+
+	p := db.Project{
+		RepoFullName:    details.FullName,
+		Provider:        "github",
+		GitHubURL:       details.HTMLURL,
+		Stars:           details.StargazersCount,
+		Description:     details.Description,
+		PrimaryLanguage: details.Language,
+		DockerfilePath:  path,
+		FileURL:         details.HTMLURL + "/blob/" + push.Repository.DefaultBranch + "/" + path,
+		SourceType:      webhookSourceType,
+		FileType:        github.ClassifyFileType(path),
+		Archived:        details.Archived,
+		Fork:            details.Fork,
+		Topics:          details.Topics,
+	}
+	if tracked != nil {
+		p.SourceType = tracked.SourceType
+	}
+	if details.License != nil {
+		p.License = details.License.SPDXID
+	}
+	if details.Parent != nil {
+		p.ForkParent = details.Parent.FullName
+	}
+	if err := a.db.UpsertProject(&p); err != nil {
+		logging.Server.Ctx(ctx).Errorf("Webhook %s: error upserting %s: %v", delivery, repo, err)
+		return err
+	}
+
+	saved, err := a.db.GetProjectByName(p.RepoFullName)
+	if err != nil || saved == nil {
+		logging.Server.Ctx(ctx).Errorf("Webhook %s: error reading back %s: %v", delivery, repo, err)
+		return err
+	}
+	refs := github.ParseDockerfileImages(content)
+	images := make([]db.ProjectImage, len(refs))
+	for i, ref := range refs {
+		images[i] = db.ProjectImage{Image: ref.Image, Tag: ref.Tag, Digest: ref.Digest}
+	}
+	if err := a.db.SetProjectImages(saved.ID, images); err != nil {
+		logging.Server.Ctx(ctx).Errorf("Webhook %s: error saving images for %s: %v", delivery, repo, err)
+	}
+
+	if tracked == nil {
+		logging.Server.Ctx(ctx).Infof("Webhook %s: added %s (%s)", delivery, repo, path)
+	} else {
+		logging.Server.Ctx(ctx).Infof("Webhook %s: updated %s (%s)", delivery, repo, path)
+	}
+	a.computeAggregates()
+	return nil
+}
@@ -0,0 +1,220 @@
+// Package assets serves the dashboard's static files with cache headers.
+// Every file is also served under a fingerprinted name carrying a hash of its
+// content (app.js as app.3f2a9c1b04de.js), which HTML files are rewritten to
+// reference and browsers may cache forever: a deploy that changes a file
+// changes its name, so nobody gets a stale copy. HTML and requests by the
+// plain name are revalidated with an ETag on every load.
+package assets
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// hashLength is how many hex digits of a file's SHA-256 go into its name
+	hashLength = 12
+
+	cacheImmutable   = "public, max-age=31536000, immutable"
+	cacheRevalidate  = "no-cache"
+	fallbackDocument = "index.html"
+)
+
+// localRef matches src and href attributes that may point at a local file
+var localRef = regexp.MustCompile(`(\s(?:src|href)=")([^"#?:]+)(")`)
+
+// Handler serves the files of an fs.FS. Files are hashed when the Handler is
+// created, so changes on disk take effect on restart.
+type Handler struct {
+	fsys     fs.FS
+	files    map[string]*file  // by path, e.g. "index.html" or "js/app.js"
+	hashed   map[string]string // fingerprinted path -> path
+	basePath func(*http.Request) string
+}
+
+type file struct {
+	name    string
+	hash    string
+	html    []byte // HTML with references rewritten; other files are read from fsys
+	modTime time.Time
+}
+
+// New hashes the files of fsys, skipping dotfiles. basePath returns the path
+// the app is served under for a request, for the <base> of HTML documents;
+// nil means the root.
+func New(fsys fs.FS, basePath func(*http.Request) string) (*Handler, error) {
+	h := &Handler{
+		fsys:     fsys,
+		files:    make(map[string]*file),
+		hashed:   make(map[string]string),
+		basePath: basePath,
+	}
+	var pages []*file
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if name != "." && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		f := &file{name: name, modTime: info.ModTime()}
+		if isHTML(name) {
+			if f.html, err = fs.ReadFile(fsys, name); err != nil {
+				return err
+			}
+			pages = append(pages, f)
+		} else if f.hash, err = hashFile(fsys, name); err != nil {
+			return err
+		}
+		h.files[name] = f
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reading static files: %w", err)
+	}
+
+	// Assets are hashed before the pages referencing them
+	for name, f := range h.files {
+		if f.html == nil {
+			h.hashed[fingerprint(name, f.hash)] = name
+		}
+	}
+	for _, f := range pages {
+		f.html = h.rewrite(f.name, f.html)
+		sum := sha256.Sum256(f.html)
+		f.hash = hex.EncodeToString(sum[:])[:hashLength]
+	}
+	return h, nil
+}
+
+// ServeHTTP serves a file by its plain or fingerprinted path. Paths without an
+// extension that match no file get index.html, for client-side routes.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+	if name == "" {
+		name = fallbackDocument
+	} else if h.files[name] == nil {
+		if _, ok := h.files[name+"/"+fallbackDocument]; ok {
+			name += "/" + fallbackDocument
+		}
+	}
+
+	cache := cacheRevalidate
+	if original, ok := h.hashed[name]; ok {
+		name, cache = original, cacheImmutable
+	}
+	f := h.files[name]
+	if f == nil {
+		if path.Ext(name) != "" || h.files[fallbackDocument] == nil {
+			http.NotFound(w, r)
+			return
+		}
+		f = h.files[fallbackDocument]
+	}
+
+	w.Header().Set("Cache-Control", cache)
+	if f.html != nil {
+		h.servePage(w, r, f)
+		return
+	}
+	content, err := h.fsys.Open(f.name)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer content.Close()
+	seeker, ok := content.(io.ReadSeeker)
+	if !ok {
+		data, err := io.ReadAll(content)
+		if err != nil {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		seeker = bytes.NewReader(data)
+	}
+	w.Header().Set("ETag", `"`+f.hash+`"`)
+	http.ServeContent(w, r, f.name, f.modTime, seeker)
+}
+
+// servePage serves an HTML file with a <base> for the path the app is served
+// under, so relative URLs resolve the same from client-side routes
+func (h *Handler) servePage(w http.ResponseWriter, r *http.Request, f *file) {
+	base := "/"
+	if h.basePath != nil {
+		base = h.basePath(r) + "/"
+	}
+	page := f.html
+	etag := f.hash
+	if head := bytes.Index(page, []byte("<head>")); head >= 0 && !bytes.Contains(page, []byte("<base ")) {
+		end := head + len("<head>")
+		tag := fmt.Sprintf("\n    <base href=\"%s\">", base)
+		page = append(append(append([]byte{}, page[:end]...), tag...), page[end:]...)
+		sum := sha256.Sum256([]byte(base))
+		etag += "-" + hex.EncodeToString(sum[:4])
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("ETag", `"`+etag+`"`)
+	http.ServeContent(w, r, f.name, f.modTime, bytes.NewReader(page))
+}
+
+// rewrite points the local src and href attributes of the page at name to the
+// fingerprinted paths of the files they reference
+func (h *Handler) rewrite(name string, page []byte) []byte {
+	return localRef.ReplaceAllFunc(page, func(m []byte) []byte {
+		parts := localRef.FindSubmatch(m)
+		ref := string(parts[2])
+		target := path.Join(path.Dir(name), ref)
+		if strings.HasPrefix(ref, "/") {
+			target = strings.TrimPrefix(path.Clean(ref), "/")
+		}
+		f := h.files[target]
+		if f == nil || f.html != nil {
+			return m
+		}
+		fingerprinted := path.Join(path.Dir(ref), path.Base(fingerprint(target, f.hash)))
+		return []byte(string(parts[1]) + fingerprinted + string(parts[3]))
+	})
+}
+
+// fingerprint inserts hash before the extension of name
+func fingerprint(name, hash string) string {
+	ext := path.Ext(name)
+	return strings.TrimSuffix(name, ext) + "." + hash + ext
+}
+
+func hashFile(fsys fs.FS, name string) (string, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	sum := sha256.New()
+	if _, err := io.Copy(sum, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(sum.Sum(nil))[:hashLength], nil
+}
+
+func isHTML(name string) bool {
+	ext := strings.ToLower(path.Ext(name))
+	return ext == ".html" || ext == ".htm"
+}
@@ -0,0 +1,120 @@
+// Package classify tags projects with what they are used for, such as a web
+// service or a CLI, from their name, description and topics
+package classify
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"unicode"
+
+	"dhi-oss-usage/internal/db"
+)
+
+// Use cases a project can be tagged with
+const (
+	WebService = "web_service"
+	CLI        = "cli"
+	MLPipeline = "ml_pipeline"
+	Infra      = "infra"
+)
+
+// UseCases lists every use case, in the order ties between them are broken
+var UseCases = []string{WebService, CLI, MLPipeline, Infra}
+
+// IsUseCase reports whether s is one of UseCases
+func IsUseCase(s string) bool {
+	for _, uc := range UseCases {
+		if uc == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Classifier tags a project with one of UseCases, or "" when it can't tell.
+// Rules is the built-in implementation; one backed by a language model can
+// be put in a Chain ahead of it.
+type Classifier interface {
+	Classify(ctx context.Context, p *db.Project) (string, error)
+}
+
+// Rules classifies by keywords: each use case scores a point for every
+// keyword in the repository name or description and two for every topic that
+// matches one, and the highest score wins. Keywords are lowercase words or
+// phrases; punctuation counts as a space, so "command-line" matches
+// "command line".
+type Rules map[string][]string
+
+// DefaultRules are the keywords used unless others are configured
+var DefaultRules = Rules{
+	WebService: {"api", "rest api", "web app", "webapp", "web application", "web service", "web server", "http server", "api server",
+		"backend", "microservice", "microservices", "graphql", "website", "frontend", "dashboard", "saas",
+		"django", "flask", "fastapi", "express", "rails", "spring boot", "nextjs", "next js"},
+	CLI: {"cli", "command line", "terminal", "tui", "shell", "cobra"},
+	MLPipeline: {"machine learning", "ml", "mlops", "deep learning", "llm", "llms", "ai", "rag", "embeddings",
+		"model training", "inference", "pytorch", "tensorflow", "huggingface", "hugging face", "transformers",
+		"data pipeline", "etl", "airflow", "kubeflow", "mlflow", "jupyter", "data science"},
+	Infra: {"kubernetes", "k8s", "helm", "operator", "controller", "terraform", "infrastructure", "devops", "ci cd",
+		"gitops", "monitoring", "observability", "prometheus", "grafana", "proxy", "ingress", "service mesh",
+		"database", "cloud native", "platform engineering"},
+}
+
+// Classify returns the use case scoring highest, or "" if no keyword matches
+func (r Rules) Classify(_ context.Context, p *db.Project) (string, error) {
+	text := normalize(strings.ReplaceAll(p.RepoFullName, "/", " ") + " " + p.Description)
+	topics := make([]string, len(p.Topics))
+	for i, t := range p.Topics {
+		topics[i] = normalize(t)
+	}
+
+	best, bestScore := "", 0
+	for _, uc := range UseCases {
+		score := 0
+		for _, kw := range r[uc] {
+			kw = normalize(kw)
+			if strings.Contains(text, kw) {
+				score++
+			}
+			for _, t := range topics {
+				if t == kw {
+					score += 2
+				}
+			}
+		}
+		if score > bestScore {
+			best, bestScore = uc, score
+		}
+	}
+	return best, nil
+}
+
+// normalize lowercases s and turns runs of anything but letters and digits
+// into single spaces, padding the result so whole words match with Contains
+func normalize(s string) string {
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return " " + strings.Join(words, " ") + " "
+}
+
+// Chain asks each classifier in turn and returns the first use case one
+// finds, so rules can answer when a model can't or fails. Errors are only
+// returned when no classifier found a use case.
+type Chain []Classifier
+
+// Classify implements Classifier
+func (c Chain) Classify(ctx context.Context, p *db.Project) (string, error) {
+	var errs []error
+	for _, classifier := range c {
+		uc, err := classifier.Classify(ctx, p)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if uc != "" {
+			return uc, nil
+		}
+	}
+	return "", errors.Join(errs...)
+}
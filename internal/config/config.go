@@ -0,0 +1,414 @@
+// Package config loads settings from a TOML file as an alternative to
+// setting every environment variable. Each key maps to the environment
+// variable the server already reads (server.port to PORT, github.tokens to
+// GITHUB_TOKENS), so the file only fills in variables that aren't set: the
+// environment overrides the file, and code reading settings doesn't change.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// kind is the type a setting's value must have in the file
+type kind int
+
+const (
+	kindString kind = iota
+	kindInt
+	kindFloat
+	kindBool
+	kindDuration // string in Go syntax, e.g. "30s" or "1h30m"
+	kindSchedule // cron expression, or "disabled"
+	kindList     // array of strings, joined with commas
+)
+
+// setting is a key of the file and the environment variable it sets
+type setting struct {
+	key   string // table.key
+	env   string
+	kind  kind
+	check func(v interface{}) error // further constraints on the value, if any
+}
+
+// settings are the keys a configuration file may have
+var settings = []setting{
+	{"server.port", "PORT", kindInt, between(1, 65535)},
+	{"server.base_path", "BASE_PATH", kindString, nil},
+	{"server.trusted_proxies", "TRUSTED_PROXIES", kindList, nil},
+	{"server.static_dir", "STATIC_DIR", kindString, nil},
+	{"server.admin_token", "ADMIN_TOKEN", kindString, nil},
+	{"server.api_keys", "API_KEYS", kindList, each(containing(":", "name:key"))},
+	{"server.api_v1_sunset", "API_V1_SUNSET", kindString, date},
+	{"server.request_timeout", "REQUEST_TIMEOUT", kindDuration, nil},
+	{"server.route_timeouts", "ROUTE_TIMEOUTS", kindList, each(containing("=", "/api/route=duration"))},
+	{"server.cache_max_age", "CACHE_MAX_AGE", kindDuration, nil},
+	{"server.cors_origins", "CORS_ORIGINS", kindList, each(origin)},
+	{"server.cors_methods", "CORS_METHODS", kindList, nil},
+	{"server.cors_headers", "CORS_HEADERS", kindList, nil},
+	{"server.cors_max_age", "CORS_MAX_AGE", kindDuration, nil},
+	{"server.shutdown_timeout", "SHUTDOWN_TIMEOUT", kindDuration, positive},
+	{"server.http_port", "HTTP_PORT", kindString, nil},
+	{"server.tls_cert", "TLS_CERT", kindString, nil},
+	{"server.tls_key", "TLS_KEY", kindString, nil},
+
+	{"acme.domains", "ACME_DOMAIN", kindList, nil},
+	{"acme.email", "ACME_EMAIL", kindString, nil},
+	{"acme.cache_dir", "ACME_CACHE_DIR", kindString, nil},
+	{"acme.directory_url", "ACME_DIRECTORY_URL", kindString, nil},
+
+	{"database.path", "DB_PATH", kindString, nil},
+	{"database.read_path", "DB_READ_PATH", kindString, nil},
+	{"database.read_immutable", "DB_READ_IMMUTABLE", kindBool, nil},
+
+	{"refresh.schedule", "REFRESH_SCHEDULE", kindSchedule, nil},
+	{"refresh.churn_missed_refreshes", "CHURN_MISSED_REFRESHES", kindInt, atLeast(1)},
+	{"refresh.archive", "REFRESH_ARCHIVE", kindBool, nil},
+	{"refresh.archive_keep", "REFRESH_ARCHIVE_KEEP", kindInt, atLeast(0)},
+	{"refresh.freshness_slo_hours", "FRESHNESS_SLO_HOURS", kindInt, atLeast(0)},
+	{"refresh.trash_retention_days", "TRASH_RETENTION_DAYS", kindInt, atLeast(0)},
+	{"refresh.exclude_forks", "EXCLUDE_FORKS", kindBool, nil},
+	{"refresh.enrich_disabled", "ENRICH_DISABLED", kindList, each(oneOf("adoption", "images", "activity", "employees", "star_history", "use_case"))},
+	{"refresh.enrich_budgets", "ENRICH_BUDGETS", kindList, each(containing("=", "stage=duration"))},
+	{"refresh.blackouts", "REFRESH_BLACKOUTS", kindList, nil},
+	{"refresh.blackout_action", "REFRESH_BLACKOUT_ACTION", kindString, oneOf("delay", "skip")},
+	{"refresh.github_status_check", "REFRESH_STATUS_CHECK", kindBool, nil},
+	{"refresh.enrich_cadence", "ENRICH_CADENCE", kindList, each(containing("=", "stage=duration"))},
+
+	{"github.token", "GITHUB_TOKEN", kindString, nil},
+	{"github.tokens", "GITHUB_TOKENS", kindList, nil},
+	{"github.app_id", "GITHUB_APP_ID", kindString, nil},
+	{"github.app_installation_id", "GITHUB_APP_INSTALLATION_ID", kindString, nil},
+	{"github.app_private_key_path", "GITHUB_APP_PRIVATE_KEY_PATH", kindString, nil},
+	{"github.concurrency", "GITHUB_CONCURRENCY", kindInt, atLeast(1)},
+	{"github.graphql", "GITHUB_GRAPHQL", kindBool, nil},
+	{"github.discovery_topics", "GITHUB_DISCOVERY_TOPICS", kindList, nil},
+	{"github.webhook_secret", "GITHUB_WEBHOOK_SECRET", kindString, nil},
+	{"github.employee_org", "EMPLOYEE_ORG", kindString, nil},
+	{"github.star_import_top", "STAR_IMPORT_TOP", kindInt, atLeast(0)},
+	{"github.star_import_pages", "STAR_IMPORT_PAGES", kindInt, atLeast(1)},
+	{"github.token_expiry_warn_days", "TOKEN_EXPIRY_WARN_DAYS", kindInt, atLeast(0)},
+	{"github.status_interval", "GITHUB_STATUS_INTERVAL", kindDuration, nil},
+
+	{"gitlab.token", "GITLAB_TOKEN", kindString, nil},
+	{"gitlab.url", "GITLAB_URL", kindString, nil},
+
+	{"notifications.max_per_run", "NOTIFY_MAX_PER_RUN", kindInt, atLeast(0)},
+	{"notifications.summary_threshold", "NOTIFY_SUMMARY_THRESHOLD", kindInt, atLeast(0)},
+	{"notifications.retry_attempts", "NOTIFY_RETRY_ATTEMPTS", kindInt, atLeast(0)},
+	{"notifications.retry_backoff", "NOTIFY_RETRY_BACKOFF", kindDuration, positive},
+	{"notifications.ops_alerts", "OPS_ALERT_NOTIFICATIONS", kindList, nil},
+	{"notifications.milestones", "MILESTONE_NOTIFICATIONS", kindList, nil},
+
+	{"log.level", "LOG_LEVEL", kindString, oneOf("debug", "info", "warn", "error")},
+	{"log.format", "LOG_FORMAT", kindString, oneOf("text", "json")},
+	{"log.dir", "LOG_DIR", kindString, nil},
+	{"log.max_size_mb", "LOG_MAX_SIZE_MB", kindInt, atLeast(0)},
+	{"log.rotate_daily", "LOG_ROTATE_DAILY", kindBool, nil},
+	{"log.max_backups", "LOG_MAX_BACKUPS", kindInt, atLeast(0)},
+	{"log.access", "ACCESS_LOG", kindString, oneOf("", "stderr")},
+	{"log.access_sample_rate", "ACCESS_LOG_SAMPLE_RATE", kindFloat, fraction},
+
+	{"publish.repo", "PUBLISH_REPO", kindString, containing("/", "owner/repo")},
+	{"publish.mode", "PUBLISH_MODE", kindString, oneOf("discussion", "file")},
+	{"publish.schedule", "PUBLISH_SCHEDULE", kindSchedule, nil},
+	{"publish.discussion_category", "PUBLISH_DISCUSSION_CATEGORY", kindString, nil},
+	{"publish.file_path", "PUBLISH_FILE_PATH", kindString, nil},
+	{"publish.branch", "PUBLISH_BRANCH", kindString, nil},
+	{"publish.locale", "PUBLISH_LOCALE", kindString, nil},
+	{"publish.github_token", "PUBLISH_GITHUB_TOKEN", kindString, nil},
+	{"publish.summary_api_url", "SUMMARY_API_URL", kindString, nil},
+	{"publish.summary_model", "SUMMARY_MODEL", kindString, nil},
+	{"publish.summary_api_key", "SUMMARY_API_KEY", kindString, nil},
+	{"publish.summary_timeout", "SUMMARY_TIMEOUT", kindDuration, positive},
+}
+
+// File is a validated configuration file
+type File struct {
+	Path string
+	env  map[string]string // environment variable -> value
+}
+
+// Load reads and validates the configuration file at path. Every problem is
+// reported, one per line with its line number, rather than just the first.
+func Load(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	values, err := parseTOML(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	byKey := make(map[string]setting, len(settings))
+	for _, s := range settings {
+		byKey[s.key] = s
+	}
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return values[keys[i]].line < values[keys[j]].line })
+
+	f := &File{Path: path, env: make(map[string]string)}
+	var errs []error
+	for _, key := range keys {
+		v := values[key]
+		s, ok := byKey[key]
+		if !ok {
+			msg := fmt.Sprintf("%s:%d: unknown setting %s", path, v.line, key)
+			if guess := closest(key); guess != "" {
+				msg += fmt.Sprintf(" (did you mean %s?)", guess)
+			}
+			errs = append(errs, errors.New(msg))
+			continue
+		}
+		env, err := s.format(v.v)
+		if err == nil && s.check != nil {
+			err = s.check(v.v)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s:%d: %s: %w", path, v.line, key, err))
+			continue
+		}
+		f.env[s.env] = env
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return f, nil
+}
+
+// Apply sets the environment variables of the file that aren't already set,
+// returning the ones left alone because the environment overrides them
+func (f *File) Apply() (overridden []string) {
+	for env, v := range f.env {
+		if os.Getenv(env) != "" {
+			overridden = append(overridden, env)
+			continue
+		}
+		os.Setenv(env, v)
+	}
+	sort.Strings(overridden)
+	return overridden
+}
+
+// Len returns how many settings the file has
+func (f *File) Len() int {
+	return len(f.env)
+}
+
+// format checks v is of the setting's kind and returns it as the server
+// reads it from the environment
+func (s setting) format(v interface{}) (string, error) {
+	switch s.kind {
+	case kindString:
+		if str, ok := v.(string); ok {
+			return str, nil
+		}
+		return "", fmt.Errorf("want a string, got %s", describe(v))
+	case kindInt:
+		if n, ok := v.(int64); ok {
+			return strconv.FormatInt(n, 10), nil
+		}
+		return "", fmt.Errorf("want an integer, got %s", describe(v))
+	case kindFloat:
+		switch n := v.(type) {
+		case int64:
+			return strconv.FormatInt(n, 10), nil
+		case float64:
+			return strconv.FormatFloat(n, 'g', -1, 64), nil
+		}
+		return "", fmt.Errorf("want a number, got %s", describe(v))
+	case kindBool:
+		if b, ok := v.(bool); ok {
+			return strconv.FormatBool(b), nil
+		}
+		return "", fmt.Errorf("want true or false, got %s", describe(v))
+	case kindDuration:
+		str, ok := v.(string)
+		if !ok {
+			return "", fmt.Errorf("want a duration like \"30s\" or \"5m\", got %s", describe(v))
+		}
+		if _, err := time.ParseDuration(str); err != nil {
+			return "", fmt.Errorf("invalid duration %q (want e.g. \"30s\", \"5m\" or \"1h30m\")", str)
+		}
+		return str, nil
+	case kindSchedule:
+		str, ok := v.(string)
+		if !ok {
+			return "", fmt.Errorf("want a cron expression or \"disabled\", got %s", describe(v))
+		}
+		if strings.ToLower(str) != "disabled" {
+			if _, err := cron.ParseStandard(str); err != nil {
+				return "", fmt.Errorf("invalid cron expression %q: %v", str, err)
+			}
+		}
+		return str, nil
+	case kindList:
+		items, ok := v.([]interface{})
+		if !ok {
+			return "", fmt.Errorf("want an array of strings, got %s", describe(v))
+		}
+		strs := make([]string, 0, len(items))
+		for _, item := range items {
+			str, ok := item.(string)
+			if !ok {
+				return "", fmt.Errorf("want an array of strings, got an array containing %s", describe(item))
+			}
+			if strings.Contains(str, ",") {
+				return "", fmt.Errorf("%q: list entries can't contain commas", str)
+			}
+			strs = append(strs, str)
+		}
+		return strings.Join(strs, ","), nil
+	}
+	return "", fmt.Errorf("unsupported setting kind")
+}
+
+func describe(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return fmt.Sprintf("the string %q", v)
+	case int64:
+		return fmt.Sprintf("the integer %d", v)
+	case float64:
+		return fmt.Sprintf("the number %g", v)
+	case bool:
+		return fmt.Sprintf("%t", v)
+	case []interface{}:
+		return "an array"
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// closest returns the known setting most like key, for typos, or ""
+func closest(key string) string {
+	best, bestDist := "", 4
+	for _, s := range settings {
+		if d := editDistance(key, s.key); d < bestDist {
+			best, bestDist = s.key, d
+		}
+	}
+	if best == "" {
+		// A known key in the wrong table, e.g. [server] schedule
+		name := key[strings.LastIndex(key, ".")+1:]
+		for _, s := range settings {
+			if strings.HasSuffix(s.key, "."+name) {
+				return s.key
+			}
+		}
+	}
+	return best
+}
+
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+func between(lo, hi int64) func(interface{}) error {
+	return func(v interface{}) error {
+		if n := v.(int64); n < lo || n > hi {
+			return fmt.Errorf("%d is out of range (%d to %d)", n, lo, hi)
+		}
+		return nil
+	}
+}
+
+func atLeast(lo int64) func(interface{}) error {
+	return func(v interface{}) error {
+		if n := v.(int64); n < lo {
+			return fmt.Errorf("%d is below the minimum of %d", n, lo)
+		}
+		return nil
+	}
+}
+
+func oneOf(allowed ...string) func(interface{}) error {
+	return func(v interface{}) error {
+		for _, a := range allowed {
+			if v.(string) == a {
+				return nil
+			}
+		}
+		var quoted []string
+		for _, a := range allowed {
+			quoted = append(quoted, strconv.Quote(a))
+		}
+		return fmt.Errorf("%q isn't one of %s", v, strings.Join(quoted, ", "))
+	}
+}
+
+func containing(sep, example string) func(interface{}) error {
+	return func(v interface{}) error {
+		if !strings.Contains(v.(string), sep) {
+			return fmt.Errorf("%q should look like %s", v, example)
+		}
+		return nil
+	}
+}
+
+// each applies check to every entry of a list
+func each(check func(interface{}) error) func(interface{}) error {
+	return func(v interface{}) error {
+		for _, item := range v.([]interface{}) {
+			if err := check(item); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func positive(v interface{}) error {
+	if d, _ := time.ParseDuration(v.(string)); d <= 0 {
+		return fmt.Errorf("%q must be longer than zero", v)
+	}
+	return nil
+}
+
+func fraction(v interface{}) error {
+	n, _ := strconv.ParseFloat(fmt.Sprint(v), 64)
+	if n < 0 || n > 1 {
+		return fmt.Errorf("%v is out of range (0 to 1)", v)
+	}
+	return nil
+}
+
+func origin(v interface{}) error {
+	if s := v.(string); s != "*" && !strings.Contains(s, "://") {
+		return fmt.Errorf("%q should look like https://dashboard.example.com, or * for any origin", v)
+	}
+	return nil
+}
+
+func date(v interface{}) error {
+	if _, err := time.Parse("2006-01-02", v.(string)); err != nil {
+		return fmt.Errorf("%q isn't a date (want YYYY-MM-DD)", v)
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeConfig writes src to a config file in a temporary directory
+func writeConfig(t *testing.T, src string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(path, []byte(src), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want map[string]string
+	}{
+		{
+			name: "string, int and bool",
+			src:  "[server]\nport = 8080\nbase_path = \"/usage\"\n[database]\nread_immutable = true\n",
+			want: map[string]string{"PORT": "8080", "BASE_PATH": "/usage", "DB_READ_IMMUTABLE": "true"},
+		},
+		{
+			name: "list joined with commas",
+			src:  "[github]\ntokens = [\n  \"a\",\n  \"b\",\n]\n",
+			want: map[string]string{"GITHUB_TOKENS": "a,b"},
+		},
+		{
+			name: "escaped string",
+			src:  "[server]\nadmin_token = \"x\\\"y\\u0041\"\n",
+			want: map[string]string{"ADMIN_TOKEN": "x\"yA"},
+		},
+		{
+			name: "duration",
+			src:  "[server]\nrequest_timeout = \"1m30s\"\n",
+			want: map[string]string{"REQUEST_TIMEOUT": "1m30s"},
+		},
+		{
+			name: "schedule",
+			src:  "[refresh]\nschedule = \"0 */6 * * *\"\n[publish]\nschedule = \"disabled\"\n",
+			want: map[string]string{"REFRESH_SCHEDULE": "0 */6 * * *", "PUBLISH_SCHEDULE": "disabled"},
+		},
+		{
+			name: "float from an integer",
+			src:  "[log]\naccess_sample_rate = 1\n",
+			want: map[string]string{"ACCESS_LOG_SAMPLE_RATE": "1"},
+		},
+		{
+			name: "float",
+			src:  "[log]\naccess_sample_rate = 0.25\n",
+			want: map[string]string{"ACCESS_LOG_SAMPLE_RATE": "0.25"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := Load(writeConfig(t, tt.src))
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if !reflect.DeepEqual(f.env, tt.want) {
+				t.Errorf("env = %v, want %v", f.env, tt.want)
+			}
+			if f.Len() != len(tt.want) {
+				t.Errorf("Len() = %d, want %d", f.Len(), len(tt.want))
+			}
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string // each line of the error, after the file path
+	}{
+		{
+			name: "syntax error",
+			src:  "[server]\nport = 80\nport = 81\n",
+			want: []string{": line 3: server.port is already set on line 2"},
+		},
+		{
+			name: "typo suggestion",
+			src:  "[server]\nprot = 80\n",
+			want: []string{":2: unknown setting server.prot (did you mean server.port?)"},
+		},
+		{
+			name: "key in the wrong table",
+			src:  "[server]\nschedule = \"@daily\"\n",
+			want: []string{":2: unknown setting server.schedule (did you mean refresh.schedule?)"},
+		},
+		{
+			name: "unknown key without a suggestion",
+			src:  "[nothing]\nlike_this_at_all = 1\n",
+			want: []string{":2: unknown setting nothing.like_this_at_all"},
+		},
+		{
+			name: "wrong type",
+			src:  "[server]\nport = \"80\"\n",
+			want: []string{`:2: server.port: want an integer, got the string "80"`},
+		},
+		{
+			name: "out of range",
+			src:  "[server]\nport = 70000\n",
+			want: []string{":2: server.port: 70000 is out of range (1 to 65535)"},
+		},
+		{
+			name: "invalid duration",
+			src:  "[server]\nrequest_timeout = \"soon\"\n",
+			want: []string{`:2: server.request_timeout: invalid duration "soon" (want e.g. "30s", "5m" or "1h30m")`},
+		},
+		{
+			name: "list entry with a comma",
+			src:  "[github]\ntokens = [\"a,b\"]\n",
+			want: []string{`:2: github.tokens: "a,b": list entries can't contain commas`},
+		},
+		{
+			name: "list of non-strings",
+			src:  "[github]\ntokens = [1]\n",
+			want: []string{":2: github.tokens: want an array of strings, got an array containing the integer 1"},
+		},
+		{
+			name: "not one of the allowed values",
+			src:  "[log]\nlevel = \"loud\"\n",
+			want: []string{`:2: log.level: "loud" isn't one of "debug", "info", "warn", "error"`},
+		},
+		{
+			name: "every problem reported in line order",
+			src:  "[server]\nport = 0\nprot = 1\n[log]\nformat = \"xml\"\n",
+			want: []string{
+				":2: server.port: 0 is out of range (1 to 65535)",
+				":3: unknown setting server.prot (did you mean server.port?)",
+				`:5: log.format: "xml" isn't one of "text", "json"`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeConfig(t, tt.src)
+			_, err := Load(path)
+			if err == nil {
+				t.Fatal("Load succeeded, want an error")
+			}
+			var want []string
+			for _, line := range tt.want {
+				want = append(want, path+line)
+			}
+			if got := strings.Split(err.Error(), "\n"); !reflect.DeepEqual(got, want) {
+				t.Errorf("error =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+			}
+		})
+	}
+}
+
+func TestLoadMissingFile(t *testing.T) {
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.toml")); !os.IsNotExist(err) {
+		t.Errorf("Load = %v, want a not-exist error", err)
+	}
+}
+
+func TestApply(t *testing.T) {
+	t.Setenv("PORT", "9000")
+	t.Setenv("BASE_PATH", "")
+	f, err := Load(writeConfig(t, "[server]\nport = 8080\nbase_path = \"/usage\"\n"))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	overridden := f.Apply()
+	if !reflect.DeepEqual(overridden, []string{"PORT"}) {
+		t.Errorf("overridden = %v, want [PORT]", overridden)
+	}
+	if got := os.Getenv("PORT"); got != "9000" {
+		t.Errorf("PORT = %q, want the environment's 9000", got)
+	}
+	if got := os.Getenv("BASE_PATH"); got != "/usage" {
+		t.Errorf("BASE_PATH = %q, want the file's /usage", got)
+	}
+}
+
+func TestClosest(t *testing.T) {
+	tests := []struct {
+		key, want string
+	}{
+		{"server.prot", "server.port"},
+		{"log.levle", "log.level"},
+		{"github.tokns", "github.tokens"},
+		{"server.schedule", "refresh.schedule"},
+		{"nothing.like_this_at_all", ""},
+	}
+	for _, tt := range tests {
+		if got := closest(tt.key); got != tt.want {
+			t.Errorf("closest(%q) = %q, want %q", tt.key, got, tt.want)
+		}
+	}
+}
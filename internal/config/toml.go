@@ -0,0 +1,266 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// value is a parsed TOML value: string, int64, float64, bool or []interface{}
+// of those, with the line it was set on for error messages
+type value struct {
+	v    interface{}
+	line int
+}
+
+// parseTOML parses the subset of TOML a configuration file needs: [table]
+// headers, key = value pairs, basic and literal strings, integers, floats,
+// booleans, arrays of those (which may span lines) and # comments. Keys are
+// returned as "table.key".
+func parseTOML(src string) (map[string]value, error) {
+	p := &parser{src: src, line: 1}
+	out := make(map[string]value)
+	table := ""
+	for {
+		p.skipBlank(true)
+		if p.eof() {
+			return out, nil
+		}
+		line := p.line
+		if p.peek() == '[' {
+			p.pos++
+			p.skipBlank(false)
+			name := p.bareKey()
+			p.skipBlank(false)
+			if name == "" || p.eof() || p.peek() != ']' {
+				return nil, p.errorf("invalid table header")
+			}
+			p.pos++
+			if err := p.endOfLine(); err != nil {
+				return nil, err
+			}
+			table = name
+			continue
+		}
+
+		key := p.bareKey()
+		if key == "" {
+			return nil, p.errorf("expected a key or [table]")
+		}
+		p.skipBlank(false)
+		if p.eof() || p.peek() != '=' {
+			return nil, p.errorf("expected = after %s", key)
+		}
+		p.pos++
+		p.skipBlank(false)
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.endOfLine(); err != nil {
+			return nil, err
+		}
+		if table != "" {
+			key = table + "." + key
+		}
+		if prev, ok := out[key]; ok {
+			return nil, fmt.Errorf("line %d: %s is already set on line %d", line, key, prev.line)
+		}
+		out[key] = value{v: v, line: line}
+	}
+}
+
+type parser struct {
+	src  string
+	pos  int
+	line int
+}
+
+func (p *parser) eof() bool  { return p.pos >= len(p.src) }
+func (p *parser) peek() byte { return p.src[p.pos] }
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("line %d: %s", p.line, fmt.Sprintf(format, args...))
+}
+
+// skipBlank skips spaces, tabs and comments, and newlines too if newlines is set
+func (p *parser) skipBlank(newlines bool) {
+	for !p.eof() {
+		switch c := p.peek(); {
+		case c == ' ' || c == '\t' || c == '\r':
+			p.pos++
+		case c == '#':
+			for !p.eof() && p.peek() != '\n' {
+				p.pos++
+			}
+		case c == '\n' && newlines:
+			p.pos++
+			p.line++
+		default:
+			return
+		}
+	}
+}
+
+// endOfLine requires the rest of the line to be blank or a comment
+func (p *parser) endOfLine() error {
+	p.skipBlank(false)
+	if !p.eof() && p.peek() != '\n' {
+		return p.errorf("unexpected %q after value", p.rest())
+	}
+	return nil
+}
+
+// rest returns the remainder of the current line, for error messages
+func (p *parser) rest() string {
+	end := strings.IndexByte(p.src[p.pos:], '\n')
+	if end < 0 {
+		return p.src[p.pos:]
+	}
+	return strings.TrimSpace(p.src[p.pos : p.pos+end])
+}
+
+func (p *parser) bareKey() string {
+	start := p.pos
+	for !p.eof() {
+		c := p.peek()
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-' {
+			p.pos++
+			continue
+		}
+		break
+	}
+	return p.src[start:p.pos]
+}
+
+func (p *parser) value() (interface{}, error) {
+	if p.eof() || p.peek() == '\n' {
+		return nil, p.errorf("missing value")
+	}
+	switch p.peek() {
+	case '"':
+		return p.basicString()
+	case '\'':
+		return p.literalString()
+	case '[':
+		return p.array()
+	}
+
+	start := p.pos
+	for !p.eof() && !strings.ContainsRune(" \t\r\n#,]", rune(p.peek())) {
+		p.pos++
+	}
+	word := p.src[start:p.pos]
+	switch word {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	digits := strings.ReplaceAll(word, "_", "")
+	if n, err := strconv.ParseInt(digits, 10, 64); err == nil {
+		return n, nil
+	}
+	if f, err := strconv.ParseFloat(digits, 64); err == nil && strings.ContainsAny(digits, "0123456789") {
+		return f, nil
+	}
+	return nil, p.errorf("invalid value %q (strings must be quoted)", word)
+}
+
+func (p *parser) basicString() (string, error) {
+	p.pos++ // opening quote
+	var b strings.Builder
+	for {
+		if p.eof() || p.peek() == '\n' {
+			return "", p.errorf("unterminated string")
+		}
+		c := p.peek()
+		p.pos++
+		switch c {
+		case '"':
+			return b.String(), nil
+		case '\\':
+			if p.eof() {
+				return "", p.errorf("unterminated string")
+			}
+			esc := p.peek()
+			p.pos++
+			switch esc {
+			case '"', '\\':
+				b.WriteByte(esc)
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			case 'u':
+				if p.pos+4 > len(p.src) {
+					return "", p.errorf("invalid \\u escape")
+				}
+				r, err := strconv.ParseUint(p.src[p.pos:p.pos+4], 16, 32)
+				if err != nil || !utf8.ValidRune(rune(r)) {
+					return "", p.errorf("invalid \\u escape")
+				}
+				b.WriteRune(rune(r))
+				p.pos += 4
+			default:
+				return "", p.errorf("invalid escape \\%c", esc)
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+}
+
+func (p *parser) literalString() (string, error) {
+	p.pos++ // opening quote
+	start := p.pos
+	for !p.eof() && p.peek() != '\'' {
+		if p.peek() == '\n' {
+			return "", p.errorf("unterminated string")
+		}
+		p.pos++
+	}
+	if p.eof() {
+		return "", p.errorf("unterminated string")
+	}
+	s := p.src[start:p.pos]
+	p.pos++
+	return s, nil
+}
+
+func (p *parser) array() ([]interface{}, error) {
+	p.pos++ // [
+	items := []interface{}{}
+	for {
+		p.skipBlank(true)
+		if p.eof() {
+			return nil, p.errorf("unterminated array")
+		}
+		if p.peek() == ']' {
+			p.pos++
+			return items, nil
+		}
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		if _, nested := v.([]interface{}); nested {
+			return nil, p.errorf("nested arrays aren't supported")
+		}
+		items = append(items, v)
+		p.skipBlank(true)
+		if p.eof() {
+			return nil, p.errorf("unterminated array")
+		}
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case ']':
+		default:
+			return nil, p.errorf("expected , or ] in array")
+		}
+	}
+}
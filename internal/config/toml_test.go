@@ -0,0 +1,158 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseTOML(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want map[string]interface{}
+	}{
+		{
+			name: "empty",
+			src:  "",
+			want: map[string]interface{}{},
+		},
+		{
+			name: "comments and blank lines",
+			src:  "# a comment\n\n  # another\n",
+			want: map[string]interface{}{},
+		},
+		{
+			name: "top-level and table keys",
+			src:  "a = 1\n[server]\nport = 8080 # trailing comment\n[log]\nlevel = \"debug\"\n",
+			want: map[string]interface{}{"a": int64(1), "server.port": int64(8080), "log.level": "debug"},
+		},
+		{
+			name: "table header with spaces",
+			src:  "[ server ]\nport = 1\n",
+			want: map[string]interface{}{"server.port": int64(1)},
+		},
+		{
+			name: "basic string",
+			src:  `s = "hello world"`,
+			want: map[string]interface{}{"s": "hello world"},
+		},
+		{
+			name: "basic string escapes",
+			src:  `s = "a\"b\\c\nd\te\rf\u00e9"`,
+			want: map[string]interface{}{"s": "a\"b\\c\nd\te\rf\u00e9"},
+		},
+		{
+			name: "literal string keeps backslashes",
+			src:  `s = 'C:\path\to "x"'`,
+			want: map[string]interface{}{"s": `C:\path\to "x"`},
+		},
+		{
+			name: "hash inside a string",
+			src:  `s = "a # b" # comment`,
+			want: map[string]interface{}{"s": "a # b"},
+		},
+		{
+			name: "integers",
+			src:  "a = 42\nb = -7\nc = 1_000_000\n",
+			want: map[string]interface{}{"a": int64(42), "b": int64(-7), "c": int64(1000000)},
+		},
+		{
+			name: "floats",
+			src:  "a = 0.25\nb = -1.5e3\n",
+			want: map[string]interface{}{"a": 0.25, "b": -1500.0},
+		},
+		{
+			name: "booleans",
+			src:  "a = true\nb = false\n",
+			want: map[string]interface{}{"a": true, "b": false},
+		},
+		{
+			name: "inline array",
+			src:  `a = ["x", 'y', 3, true]`,
+			want: map[string]interface{}{"a": []interface{}{"x", "y", int64(3), true}},
+		},
+		{
+			name: "empty array",
+			src:  "a = []",
+			want: map[string]interface{}{"a": []interface{}{}},
+		},
+		{
+			name: "multi-line array with comments and trailing comma",
+			src:  "a = [\n  \"x\", # first\n\n  \"y\",\n]\nb = 1\n",
+			want: map[string]interface{}{"a": []interface{}{"x", "y"}, "b": int64(1)},
+		},
+		{
+			name: "CRLF line endings",
+			src:  "[server]\r\nport = 1\r\n",
+			want: map[string]interface{}{"server.port": int64(1)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, err := parseTOML(tt.src)
+			if err != nil {
+				t.Fatalf("parseTOML: %v", err)
+			}
+			got := make(map[string]interface{}, len(values))
+			for k, v := range values {
+				got[k] = v.v
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTOMLLines(t *testing.T) {
+	values, err := parseTOML("# header\n\n[server]\nports = [\n  1,\n  2,\n]\nhost = \"x\"\n")
+	if err != nil {
+		t.Fatalf("parseTOML: %v", err)
+	}
+	if got := values["server.ports"].line; got != 4 {
+		t.Errorf("server.ports line = %d, want 4", got)
+	}
+	if got := values["server.host"].line; got != 8 {
+		t.Errorf("server.host line = %d, want 8", got)
+	}
+}
+
+func TestParseTOMLErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"duplicate key", "a = 1\na = 2\n", "line 2: a is already set on line 1"},
+		{"duplicate key in table", "[s]\na = 1\n[s]\na = 2\n", "line 4: s.a is already set on line 2"},
+		{"unquoted string", "a = hello", `line 1: invalid value "hello" (strings must be quoted)`},
+		{"missing value", "a =\n", "line 1: missing value"},
+		{"missing equals", "a 1", "line 1: expected = after a"},
+		{"no key", "= 1", "line 1: expected a key or [table]"},
+		{"unterminated table header", "[server\n", "line 1: invalid table header"},
+		{"empty table header", "[]\n", "line 1: invalid table header"},
+		{"text after table header", "[server] x\n", `line 1: unexpected "x" after value`},
+		{"text after value", "a = 1 2\n", `line 1: unexpected "2" after value`},
+		{"unterminated basic string", "a = \"abc\nb = 1\n", "line 1: unterminated string"},
+		{"unterminated literal string", "a = 'abc\n", "line 1: unterminated string"},
+		{"invalid escape", `a = "\q"`, `line 1: invalid escape \q`},
+		{"short unicode escape", `a = "\u12"`, `line 1: invalid \u escape`},
+		{"invalid unicode escape", `a = "\uzzzz"`, `line 1: invalid \u escape`},
+		{"surrogate unicode escape", `a = "\ud800"`, `line 1: invalid \u escape`},
+		{"unterminated array", "a = [1, 2\n", "line 2: unterminated array"},
+		{"array missing comma", "a = [1 2]", "line 1: expected , or ] in array"},
+		{"nested array", "a = [[1]]", "line 1: nested arrays aren't supported"},
+		{"error line inside multi-line array", "a = [\n  1,\n  nope,\n]\n", `line 3: invalid value "nope" (strings must be quoted)`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseTOML(tt.src)
+			if err == nil {
+				t.Fatalf("parseTOML succeeded, want error %q", tt.want)
+			}
+			if err.Error() != tt.want {
+				t.Errorf("error = %q, want %q", err.Error(), tt.want)
+			}
+		})
+	}
+}
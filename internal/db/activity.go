@@ -0,0 +1,13 @@
+package db
+
+import "encoding/json"
+
+// SetProjectCommitActivity stores a project's weekly commit counts, oldest first
+func (db *DB) SetProjectCommitActivity(id int64, weeks []int) error {
+	data, err := json.Marshal(weeks)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`UPDATE projects SET commit_activity = ?, commit_activity_at = CURRENT_TIMESTAMP WHERE id = ?`, string(data), id)
+	return err
+}
@@ -0,0 +1,34 @@
+package db
+
+import "database/sql"
+
+// ReplaceAggregates stores a new set of precomputed aggregates (JSON keyed by
+// name), dropping any not in values, in one transaction so readers never see
+// a mix of old and new results
+func (db *DB) ReplaceAggregates(values map[string][]byte) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM aggregates`); err != nil {
+		return err
+	}
+	for key, value := range values {
+		if _, err := tx.Exec(`INSERT INTO aggregates (key, value, computed_at) VALUES (?, ?, CURRENT_TIMESTAMP)`, key, value); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetAggregate returns the stored JSON of an aggregate, or nil if it hasn't been computed
+func (db *DB) GetAggregate(key string) ([]byte, error) {
+	var value []byte
+	err := db.QueryRow(`SELECT value FROM aggregates WHERE key = ?`, key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return value, err
+}
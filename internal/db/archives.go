@@ -0,0 +1,65 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+)
+
+// RefreshArchive is the full project list as of a refresh job, stored as
+// gzip-compressed JSON
+type RefreshArchive struct {
+	JobID     int64
+	Projects  int
+	Body      []byte // gzip-compressed JSON array of projects
+	CreatedAt time.Time
+}
+
+// SaveRefreshArchive stores the archive of a refresh job, replacing any earlier one
+func (db *DB) SaveRefreshArchive(jobID int64, projects int, body []byte) error {
+	_, err := db.Exec(`INSERT OR REPLACE INTO refresh_archives (job_id, projects, body, created_at) VALUES (?, ?, ?, CURRENT_TIMESTAMP)`,
+		jobID, projects, body)
+	return err
+}
+
+// GetRefreshArchive returns the archive of a refresh job, or nil if none was stored
+func (db *DB) GetRefreshArchive(jobID int64) (*RefreshArchive, error) {
+	a := RefreshArchive{JobID: jobID}
+	err := db.QueryRow(`SELECT projects, body, created_at FROM refresh_archives WHERE job_id = ?`, jobID).
+		Scan(&a.Projects, &a.Body, &a.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// GetRefreshArchiveBefore returns the newest archive stored before t, or nil if
+// there is none
+func (db *DB) GetRefreshArchiveBefore(t time.Time) (*RefreshArchive, error) {
+	var a RefreshArchive
+	err := db.QueryRow(`SELECT job_id, projects, body, created_at FROM refresh_archives
+	WHERE created_at < ? ORDER BY created_at DESC, job_id DESC LIMIT 1`, t.UTC().Format("2006-01-02 15:04:05")).
+		Scan(&a.JobID, &a.Projects, &a.Body, &a.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// PruneRefreshArchives deletes all but the newest keep archives and returns how
+// many were deleted
+func (db *DB) PruneRefreshArchives(keep int) (int64, error) {
+	result, err := db.Exec(`
+	DELETE FROM refresh_archives WHERE job_id NOT IN (
+		SELECT job_id FROM refresh_archives ORDER BY job_id DESC LIMIT ?
+	)`, keep)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,56 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+)
+
+// GetSnapshotBefore returns the newest snapshot recorded before t, or nil if
+// there is none
+func (db *DB) GetSnapshotBefore(t time.Time) (*RefreshSnapshot, error) {
+	var s RefreshSnapshot
+	err := db.QueryRow(`SELECT id, recorded_at, total_projects, total_stars, popular_count, notable_count FROM refresh_snapshots
+	WHERE recorded_at < ? ORDER BY recorded_at DESC, id DESC LIMIT 1`, t.UTC().Format("2006-01-02 15:04:05")).
+		Scan(&s.ID, &s.RecordedAt, &s.TotalProjects, &s.TotalStars, &s.PopularCount, &s.NotableCount)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// GetSnapshotProjects returns the projects active at a snapshot, from the star
+// history recorded with it. Stars are as of the snapshot; every other field is
+// current, and projects purged since are missing.
+func (db *DB) GetSnapshotProjects(snapshotID int64) ([]Project, error) {
+	projects, err := db.queryProjects(`SELECT `+projectColumns+` FROM projects
+	WHERE id IN (SELECT project_id FROM project_star_history WHERE snapshot_id = ?)`, snapshotID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`SELECT project_id, stars FROM project_star_history WHERE snapshot_id = ?`, snapshotID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	stars := make(map[int64]int, len(projects))
+	for rows.Next() {
+		var id int64
+		var n int
+		if err := rows.Scan(&id, &n); err != nil {
+			return nil, err
+		}
+		stars[id] = n
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range projects {
+		projects[i].Stars = stars[projects[i].ID]
+	}
+	return projects, nil
+}
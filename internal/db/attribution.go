@@ -0,0 +1,90 @@
+package db
+
+import "fmt"
+
+// breakdownDimensions maps each dimension of GetBreakdown to its projects column
+var breakdownDimensions = map[string]string{
+	"attribution": "attribution",
+	"source_type": "source_type",
+	"file_type":   "file_type",
+	"language":    "primary_language",
+	"provider":    "provider",
+	"use_case":    "use_case",
+}
+
+// BreakdownCount is the live projects and stars for one value of a dimension
+// (e.g. attribution = conference), and how many of them adopted DHI recently
+type BreakdownCount struct {
+	Value          string `json:"value"` // empty when the column isn't set (e.g. unattributed)
+	Projects       int    `json:"projects"`
+	Stars          int    `json:"stars"`
+	AdoptedLast30d int    `json:"adopted_last_30d"`
+}
+
+// IsBreakdownDimension reports whether GetBreakdown accepts dimension
+func IsBreakdownDimension(dimension string) bool {
+	_, ok := breakdownDimensions[dimension]
+	return ok
+}
+
+// GetBreakdown counts live projects by a dimension, most projects first
+func (db *DB) GetBreakdown(dimension string) ([]BreakdownCount, error) {
+	column, ok := breakdownDimensions[dimension]
+	if !ok {
+		return nil, fmt.Errorf("unknown breakdown dimension %q", dimension)
+	}
+	rows, err := db.Query(`
+	SELECT COALESCE(` + column + `, '') AS v, COUNT(*), COALESCE(SUM(stars), 0),
+		COUNT(CASE WHEN adopted_at >= date('now', '-30 days') THEN 1 END)
+	FROM projects WHERE ` + liveProject + `
+	GROUP BY v
+	ORDER BY COUNT(*) DESC, v`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var counts []BreakdownCount
+	for rows.Next() {
+		var c BreakdownCount
+		if err := rows.Scan(&c.Value, &c.Projects, &c.Stars, &c.AdoptedLast30d); err != nil {
+			return nil, err
+		}
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
+}
+
+// SetProjectAttribution tags projects with the campaign or channel they were
+// acquired through; an empty attribution clears it
+func (db *DB) SetProjectAttribution(ids []int64, attribution string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, id := range ids {
+		if _, err := tx.Exec(`UPDATE projects SET attribution = ? WHERE id = ?`, attribution, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// SetProjectUseCases records the use case of each project by ID; an empty use
+// case marks a project unclassified
+func (db *DB) SetProjectUseCases(useCases map[int64]string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for id, useCase := range useCases {
+		if _, err := tx.Exec(`UPDATE projects SET use_case = ? WHERE id = ?`, useCase, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
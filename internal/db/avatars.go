@@ -0,0 +1,38 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Avatar is a cached owner avatar image at one size
+type Avatar struct {
+	Owner       string
+	Size        int
+	ContentType string
+	Body        []byte
+	FetchedAt   time.Time
+}
+
+// GetAvatar returns the cached avatar of an owner at a size, or nil if there is none
+func (db *DB) GetAvatar(owner string, size int) (*Avatar, error) {
+	a := Avatar{Owner: owner, Size: size}
+	err := db.QueryRow(`SELECT content_type, body, fetched_at FROM avatars WHERE owner = ? AND size = ?`, owner, size).
+		Scan(&a.ContentType, &a.Body, &a.FetchedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// PutAvatar stores or replaces a cached avatar
+func (db *DB) PutAvatar(a *Avatar) error {
+	_, err := db.Exec(`
+	INSERT INTO avatars (owner, size, content_type, body, fetched_at) VALUES (?, ?, ?, ?, ?)
+	ON CONFLICT(owner, size) DO UPDATE SET content_type = excluded.content_type, body = excluded.body, fetched_at = excluded.fetched_at
+	`, a.Owner, a.Size, a.ContentType, a.Body, a.FetchedAt.UTC())
+	return err
+}
@@ -0,0 +1,66 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ChurnStats counts projects that stopped referencing DHI or whose repository
+// is no longer live
+type ChurnStats struct {
+	Removed           int `json:"removed"`              // all projects currently marked removed
+	RemovedLast30Days int `json:"removed_last_30_days"` // removed within the last 30 days
+	Deleted           int `json:"deleted"`              // repositories that no longer exist
+	Archived          int `json:"archived"`             // active projects in archived repositories
+}
+
+// MarkProjectMissed records that an active project wasn't found by a refresh.
+// Once it has been missed by threshold consecutive refreshes it is marked removed;
+// finding it again (UpsertProject) makes it active. Reports whether this call
+// removed the project.
+func (db *DB) MarkProjectMissed(id int64, threshold int) (bool, error) {
+	var status string
+	err := db.QueryRow(`
+	UPDATE projects SET
+		missed_refreshes = missed_refreshes + 1,
+		status = CASE WHEN missed_refreshes + 1 >= ? THEN 'removed' ELSE status END,
+		removed_at = CASE WHEN missed_refreshes + 1 >= ? THEN CURRENT_TIMESTAMP ELSE removed_at END,
+		updated_at = CURRENT_TIMESTAMP
+	WHERE id = ? AND status = 'active'
+	RETURNING status
+	`, threshold, threshold, id).Scan(&status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return status == "removed", err
+}
+
+// MarkProjectDeleted marks a project whose repository no longer exists. Reports
+// whether the project was tracked and not already marked deleted.
+func (db *DB) MarkProjectDeleted(repoFullName string) (bool, error) {
+	result, err := db.Exec(`
+	UPDATE projects SET status = 'deleted', removed_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+	WHERE repo_full_name = ? AND status != 'deleted'
+	`, repoFullName)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// GetChurnStats counts removed projects (in total and within the last 30 days),
+// deleted repositories and archived ones
+func (db *DB) GetChurnStats() (ChurnStats, error) {
+	var stats ChurnStats
+	err := db.QueryRow(`
+	SELECT
+		COALESCE(SUM(CASE WHEN status = 'removed' THEN 1 ELSE 0 END), 0),
+		COALESCE(SUM(CASE WHEN status = 'removed' AND removed_at >= ? THEN 1 ELSE 0 END), 0),
+		COALESCE(SUM(CASE WHEN status = 'deleted' THEN 1 ELSE 0 END), 0),
+		COALESCE(SUM(CASE WHEN status = 'active' AND archived = 1 THEN 1 ELSE 0 END), 0)
+	FROM projects WHERE deleted_at IS NULL
+	`, time.Now().UTC().AddDate(0, 0, -30).Format("2006-01-02 15:04:05")).Scan(&stats.Removed, &stats.RemovedLast30Days, &stats.Deleted, &stats.Archived)
+	return stats, err
+}
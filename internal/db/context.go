@@ -0,0 +1,70 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// WithContext returns a DB sharing this one's connection pool whose queries are
+// bound to ctx: once ctx is done, running queries are interrupted and their
+// connections released. Used to hold each API request to its deadline.
+func (db *DB) WithContext(ctx context.Context) Store {
+	return &DB{DB: db.DB, ctx: ctx, tx: db.tx}
+}
+
+// InTx runs fn with a Store whose writes are made in one transaction,
+// committed if fn succeeds and rolled back if it fails. Store methods that
+// start their own transaction can't be used inside fn.
+func (db *DB) InTx(fn func(Store) error) error {
+	if db.tx != nil {
+		return fn(db)
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := fn(&DB{DB: db.DB, ctx: db.ctx, tx: tx}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (db *DB) context() context.Context {
+	if db.ctx != nil {
+		return db.ctx
+	}
+	return context.Background()
+}
+
+// Query, QueryRow, Exec and Begin shadow the sql.DB methods so every store
+// method runs under the DB's context, and in its transaction if it has one
+
+func (db *DB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	if db.tx != nil {
+		return db.tx.QueryContext(db.context(), query, args...)
+	}
+	return db.DB.QueryContext(db.context(), query, args...)
+}
+
+func (db *DB) QueryRow(query string, args ...interface{}) *sql.Row {
+	if db.tx != nil {
+		return db.tx.QueryRowContext(db.context(), query, args...)
+	}
+	return db.DB.QueryRowContext(db.context(), query, args...)
+}
+
+func (db *DB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	if db.tx != nil {
+		return db.tx.ExecContext(db.context(), query, args...)
+	}
+	return db.DB.ExecContext(db.context(), query, args...)
+}
+
+func (db *DB) Begin() (*sql.Tx, error) {
+	if db.tx != nil {
+		return nil, errors.New("already in a transaction")
+	}
+	return db.DB.BeginTx(db.context(), nil)
+}
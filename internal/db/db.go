@@ -1,7 +1,9 @@
 package db
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"time"
 
@@ -10,34 +12,73 @@ import (
 
 type DB struct {
 	*sql.DB
+	ctx context.Context // bounds queries when set; see WithContext
+	tx  *sql.Tx         // runs queries in a transaction when set; see InTx
 }
 
 type Project struct {
-	ID              int64      `json:"id"`
-	RepoFullName    string     `json:"repo_full_name"`
-	GitHubURL       string     `json:"github_url"`
-	Stars           int        `json:"stars"`
-	Description     string     `json:"description"`
-	PrimaryLanguage string     `json:"primary_language"`
-	DockerfilePath  string     `json:"dockerfile_path"`
-	FileURL         string     `json:"file_url"`
-	SourceType      string     `json:"source_type"`
-	AdoptedAt       *time.Time `json:"adopted_at"`
-	AdoptionCommit  string     `json:"adoption_commit"`
-	FirstSeenAt     time.Time  `json:"first_seen_at"`
-	LastSeenAt      time.Time  `json:"last_seen_at"`
-	CreatedAt       time.Time  `json:"created_at"`
-	UpdatedAt       time.Time  `json:"updated_at"`
+	ID                 int64      `json:"id"`
+	RepoFullName       string     `json:"repo_full_name"` // owner/repo on GitHub, host/path on GitLab
+	Provider           string     `json:"provider"`       // github, gitlab
+	GitHubURL          string     `json:"github_url"`
+	Stars              int        `json:"stars"`
+	Description        string     `json:"description"`
+	PrimaryLanguage    string     `json:"primary_language"`
+	DockerfilePath     string     `json:"dockerfile_path"`
+	FileURL            string     `json:"file_url"`
+	SourceType         string     `json:"source_type"`
+	FileType           string     `json:"file_type"` // dockerfile, compose, helm, kubernetes, github_actions, gitlab_ci, other
+	AdoptedAt          *time.Time `json:"adopted_at"`
+	AdoptionCommit     string     `json:"adoption_commit"`
+	VerificationStatus string     `json:"verification_status"` // verified, file_missing, unreferenced (file no longer mentions dhi.io)
+	VerifiedAt         *time.Time `json:"verified_at"`
+	FirstSeenAt        time.Time  `json:"first_seen_at"`
+	LastSeenAt         time.Time  `json:"last_seen_at"`
+	CreatedAt          time.Time  `json:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at"`
+	Status             string     `json:"status"` // active, removed (missed by too many consecutive refreshes), deleted (repo gone)
+	RemovedAt          *time.Time `json:"removed_at"`
+	Archived           bool       `json:"archived"`
+	Fork               bool       `json:"fork"`
+	ForkParent         string     `json:"fork_parent"` // repository the fork was created from
+	License            string     `json:"license"`     // SPDX identifier, empty if none detected
+	Topics             []string   `json:"topics"`
+	CommitActivity     []int      `json:"commit_activity"` // commits per week, oldest first, for activity sparklines
+	Featured           bool       `json:"featured"`
+	FeaturedRank       int        `json:"featured_rank"` // position in the curated featured list (1 first), 0 if not featured
+	Attribution        string     `json:"attribution"`   // acquisition channel tagged by an admin, e.g. conference; empty if unknown
+	UseCase            string     `json:"use_case"`      // web_service, cli, ml_pipeline or infra, from the use_case enrichment stage; empty if unclassified
+
+	// Set when EMPLOYEE_ORG is configured, to tell organic adoption from dogfooding
+	EmployeeStars    int  `json:"employee_stars"`        // org members who starred the repo
+	EmployeeContribs int  `json:"employee_contributors"` // org members among its top 100 contributors
+	EmployeeEngaged  bool `json:"employee_engaged"`      // starred or contributed to by any member
+
+	// Set while an admin has the project in the trash, until restored or purged
+	DeletedAt *time.Time `json:"deleted_at"`
 }
 
 type RefreshJob struct {
-	ID            int64      `json:"id"`
-	Status        string     `json:"status"` // pending, running, completed, failed
-	StartedAt     *time.Time `json:"started_at"`
-	CompletedAt   *time.Time `json:"completed_at"`
-	ProjectsFound int        `json:"projects_found"`
-	ErrorMessage  string     `json:"error_message"`
-	CreatedAt     time.Time  `json:"created_at"`
+	ID            int64          `json:"id"`
+	Status        string         `json:"status"` // pending, running, completed, failed, interrupted (the server stopped during it)
+	StartedAt     *time.Time     `json:"started_at"`
+	CompletedAt   *time.Time     `json:"completed_at"`
+	ProjectsFound int            `json:"projects_found"`
+	ErrorMessage  string         `json:"error_message"`
+	ErrorCounts   map[string]int `json:"error_counts"`           // per-item errors by category
+	FailureCode   string         `json:"failure_code,omitempty"` // why a failed job failed: invalid_token, missing_scope, rate_limit, network, timeout, database or unknown
+	Remediation   string         `json:"remediation,omitempty"`  // what an operator can do about it
+	CreatedAt     time.Time      `json:"created_at"`
+	RefreshProgress
+}
+
+// RefreshProgress is how far a refresh job has got, updated as it runs. A
+// finished job keeps the phase it ended in, "done" once it completed.
+type RefreshProgress struct {
+	Phase           string `json:"phase"`            // searching, fetching_details, gitlab, saving, enriching_<stage>, notifying, snapshot or done
+	ReposDiscovered int    `json:"repos_discovered"` // repos found by the searches
+	ReposProcessed  int    `json:"repos_processed"`  // discovered repos whose details have been fetched
+	ErrorsCount     int    `json:"errors_count"`     // per-item errors so far (see ErrorCounts for the categories)
 }
 
 type RefreshSnapshot struct {
@@ -52,9 +93,11 @@ type RefreshSnapshot struct {
 type NotificationConfig struct {
 	ID              int64      `json:"id"`
 	Name            string     `json:"name"`
-	Type            string     `json:"type"` // slack, email
+	Type            string     `json:"type"` // slack, email, x, bluesky, webhook
 	Enabled         bool       `json:"enabled"`
 	ConfigJSON      string     `json:"config_json"`
+	RequireApproval bool       `json:"require_approval"` // hold messages in pending_messages until approved
+	Version         int64      `json:"version"`          // incremented on every update, for optimistic concurrency
 	LastTriggeredAt *time.Time `json:"last_triggered_at"`
 	CreatedAt       time.Time  `json:"created_at"`
 	UpdatedAt       time.Time  `json:"updated_at"`
@@ -64,9 +107,15 @@ type NotificationLog struct {
 	ID           int64     `json:"id"`
 	ConfigID     int64     `json:"config_id"`
 	ProjectID    *int64    `json:"project_id"`
-	Status       string    `json:"status"` // sent, failed
+	Status       string    `json:"status"` // sent, pending (failed, retry scheduled), failed, suppressed
 	ErrorMessage string    `json:"error_message"`
+	Payload      string    `json:"payload,omitempty"`    // request body of webhook deliveries, kept for redelivery
+	RedeliveryOf *int64    `json:"redelivery_of"`        // log entry this delivery replayed
+	Suppressed   int       `json:"suppressed,omitempty"` // new-project messages this entry stands in for: summarized, or dropped by the per-run cap
 	SentAt       time.Time `json:"sent_at"`
+
+	Attempts      int        `json:"attempts,omitempty"`        // sends so far, when the delivery was retried
+	NextAttemptAt *time.Time `json:"next_attempt_at,omitempty"` // while pending
 }
 
 func Open(path string) (*DB, error) {
@@ -79,7 +128,28 @@ func Open(path string) (*DB, error) {
 		return nil, fmt.Errorf("pinging database: %w", err)
 	}
 
-	return &DB{db}, nil
+	return &DB{DB: db}, nil
+}
+
+// OpenReadOnly opens a query-only connection pool, e.g. a replica or a second
+// pool on the primary file so reads don't contend with refresh writes.
+// With immutable set, SQLite skips locking entirely; only use it for a copy
+// that is not modified while open.
+func OpenReadOnly(path string, immutable bool) (*DB, error) {
+	dsn := "file:" + path + "?mode=ro&_query_only=true"
+	if immutable {
+		dsn += "&immutable=1"
+	}
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("opening read-only database: %w", err)
+	}
+
+	if err := db.Ping(); err != nil {
+		return nil, fmt.Errorf("pinging read-only database: %w", err)
+	}
+
+	return &DB{DB: db}, nil
 }
 
 func (db *DB) Migrate() error {
@@ -152,6 +222,193 @@ func (db *DB) Migrate() error {
 	CREATE INDEX IF NOT EXISTS idx_notification_logs_config ON notification_logs(config_id);
 	CREATE INDEX IF NOT EXISTS idx_notification_logs_sent ON notification_logs(sent_at DESC);
 
+	CREATE TABLE IF NOT EXISTS freshness_violations (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		started_at TIMESTAMP NOT NULL,
+		detected_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		resolved_at TIMESTAMP,
+		last_refresh_at TIMESTAMP
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_freshness_violations_started ON freshness_violations(started_at DESC);
+
+	CREATE TABLE IF NOT EXISTS settings (
+		key TEXT PRIMARY KEY,
+		value TEXT NOT NULL,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS publications (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		period TEXT NOT NULL,
+		target TEXT NOT NULL,
+		url TEXT DEFAULT '',
+		project_count INTEGER NOT NULL DEFAULT 0,
+		published_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE(period, target)
+	);
+
+	CREATE TABLE IF NOT EXISTS pending_messages (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		config_id INTEGER NOT NULL,
+		project_id INTEGER,
+		subject TEXT DEFAULT '',
+		body TEXT NOT NULL,
+		status TEXT NOT NULL DEFAULT 'pending',
+		error_message TEXT DEFAULT '',
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		decided_at TIMESTAMP,
+		FOREIGN KEY (config_id) REFERENCES notification_configs(id) ON DELETE CASCADE,
+		FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE SET NULL
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_pending_messages_status ON pending_messages(status, created_at);
+
+	CREATE TABLE IF NOT EXISTS notification_outbox (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		log_id INTEGER NOT NULL UNIQUE,
+		config_id INTEGER NOT NULL,
+		message TEXT NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 1,
+		next_attempt_at TIMESTAMP NOT NULL,
+		status TEXT NOT NULL DEFAULT 'pending',
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (log_id) REFERENCES notification_logs(id) ON DELETE CASCADE,
+		FOREIGN KEY (config_id) REFERENCES notification_configs(id) ON DELETE CASCADE
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_notification_outbox_due ON notification_outbox(status, next_attempt_at);
+
+	CREATE TABLE IF NOT EXISTS notified_projects (
+		config_id INTEGER NOT NULL,
+		project_id INTEGER NOT NULL,
+		notified_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (config_id, project_id),
+		FOREIGN KEY (config_id) REFERENCES notification_configs(id) ON DELETE CASCADE,
+		FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE
+	);
+
+	CREATE TABLE IF NOT EXISTS github_cache (
+		endpoint TEXT PRIMARY KEY,
+		etag TEXT NOT NULL,
+		body BLOB NOT NULL,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS project_images (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		project_id INTEGER NOT NULL,
+		image TEXT NOT NULL,
+		tag TEXT NOT NULL DEFAULT '',
+		digest TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE(project_id, image, tag, digest),
+		FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_project_images_image ON project_images(image);
+
+	CREATE TABLE IF NOT EXISTS project_stage_runs (
+		project_id INTEGER NOT NULL,
+		stage TEXT NOT NULL,
+		last_run_at TIMESTAMP NOT NULL,
+		PRIMARY KEY (project_id, stage),
+		FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE
+	);
+
+	CREATE TABLE IF NOT EXISTS image_snapshots (
+		snapshot_id INTEGER NOT NULL,
+		image TEXT NOT NULL,
+		projects INTEGER NOT NULL,
+		stars INTEGER NOT NULL,
+		PRIMARY KEY (snapshot_id, image),
+		FOREIGN KEY (snapshot_id) REFERENCES refresh_snapshots(id) ON DELETE CASCADE
+	);
+
+	CREATE TABLE IF NOT EXISTS project_star_history (
+		project_id INTEGER NOT NULL,
+		snapshot_id INTEGER NOT NULL,
+		stars INTEGER NOT NULL,
+		PRIMARY KEY (project_id, snapshot_id),
+		FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE,
+		FOREIGN KEY (snapshot_id) REFERENCES refresh_snapshots(id) ON DELETE CASCADE
+	);
+
+	CREATE TABLE IF NOT EXISTS project_star_imports (
+		project_id INTEGER NOT NULL,
+		day TEXT NOT NULL,
+		stars INTEGER NOT NULL,
+		PRIMARY KEY (project_id, day),
+		FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE
+	);
+
+	CREATE TABLE IF NOT EXISTS avatars (
+		owner TEXT NOT NULL,
+		size INTEGER NOT NULL,
+		content_type TEXT NOT NULL,
+		body BLOB NOT NULL,
+		fetched_at TIMESTAMP NOT NULL,
+		PRIMARY KEY (owner, size)
+	);
+
+	CREATE TABLE IF NOT EXISTS project_links (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		project_id INTEGER NOT NULL,
+		kind TEXT NOT NULL,
+		title TEXT NOT NULL DEFAULT '',
+		url TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_project_links_project ON project_links(project_id);
+
+	CREATE TABLE IF NOT EXISTS refresh_archives (
+		job_id INTEGER PRIMARY KEY,
+		projects INTEGER NOT NULL,
+		body BLOB NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (job_id) REFERENCES refresh_jobs(id) ON DELETE CASCADE
+	);
+
+	CREATE TABLE IF NOT EXISTS api_usage (
+		consumer TEXT NOT NULL,
+		method TEXT NOT NULL,
+		endpoint TEXT NOT NULL,
+		version INTEGER NOT NULL,
+		count INTEGER NOT NULL DEFAULT 0,
+		first_seen_at TIMESTAMP NOT NULL,
+		last_seen_at TIMESTAMP NOT NULL,
+		PRIMARY KEY (consumer, method, endpoint, version)
+	);
+
+	CREATE TABLE IF NOT EXISTS aggregates (
+		key TEXT PRIMARY KEY,
+		value BLOB NOT NULL,
+		computed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS snapshot_details (
+		snapshot_id INTEGER NOT NULL,
+		dimension TEXT NOT NULL,
+		value TEXT NOT NULL,
+		projects INTEGER NOT NULL,
+		stars INTEGER NOT NULL,
+		PRIMARY KEY (snapshot_id, dimension, value),
+		FOREIGN KEY (snapshot_id) REFERENCES refresh_snapshots(id) ON DELETE CASCADE
+	);
+
+	CREATE TABLE IF NOT EXISTS milestones (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		metric TEXT NOT NULL,
+		threshold INTEGER NOT NULL,
+		value INTEGER NOT NULL,
+		snapshot_id INTEGER NOT NULL,
+		reached_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE(metric, threshold),
+		FOREIGN KEY (snapshot_id) REFERENCES refresh_snapshots(id) ON DELETE CASCADE
+	);
 
 	`
 
@@ -163,47 +420,191 @@ func (db *DB) Migrate() error {
 	// Migration: add adopted_at column if it doesn't exist (ignore error if already exists)
 	db.Exec("ALTER TABLE projects ADD COLUMN adopted_at TIMESTAMP")
 	db.Exec("ALTER TABLE projects ADD COLUMN adoption_commit TEXT DEFAULT ''")
-
+	db.Exec("ALTER TABLE projects ADD COLUMN verification_status TEXT DEFAULT ''")
+	db.Exec("ALTER TABLE projects ADD COLUMN verified_at TIMESTAMP")
+	db.Exec("ALTER TABLE refresh_jobs ADD COLUMN report_json TEXT DEFAULT ''")
+	db.Exec("ALTER TABLE refresh_jobs ADD COLUMN error_counts TEXT NOT NULL DEFAULT '{}'")
+	db.Exec("ALTER TABLE notification_configs ADD COLUMN version INTEGER NOT NULL DEFAULT 1")
+	db.Exec("ALTER TABLE projects ADD COLUMN file_type TEXT DEFAULT ''")
+	db.Exec("ALTER TABLE projects ADD COLUMN provider TEXT NOT NULL DEFAULT 'github'")
+	db.Exec("ALTER TABLE notification_configs ADD COLUMN require_approval BOOLEAN NOT NULL DEFAULT 0")
+	db.Exec("ALTER TABLE projects ADD COLUMN status TEXT NOT NULL DEFAULT 'active'")
+	db.Exec("ALTER TABLE projects ADD COLUMN missed_refreshes INTEGER NOT NULL DEFAULT 0")
+	db.Exec("ALTER TABLE projects ADD COLUMN removed_at TIMESTAMP")
+	db.Exec("ALTER TABLE projects ADD COLUMN archived BOOLEAN NOT NULL DEFAULT 0")
+	db.Exec("ALTER TABLE projects ADD COLUMN fork BOOLEAN NOT NULL DEFAULT 0")
+	db.Exec("ALTER TABLE projects ADD COLUMN fork_parent TEXT NOT NULL DEFAULT ''")
+	db.Exec("ALTER TABLE projects ADD COLUMN license TEXT NOT NULL DEFAULT ''")
+	db.Exec("ALTER TABLE projects ADD COLUMN topics TEXT NOT NULL DEFAULT '[]'")
+	db.Exec("ALTER TABLE projects ADD COLUMN commit_activity TEXT NOT NULL DEFAULT '[]'")
+	db.Exec("ALTER TABLE projects ADD COLUMN commit_activity_at TIMESTAMP")
+	db.Exec("ALTER TABLE projects ADD COLUMN featured_rank INTEGER NOT NULL DEFAULT 0")
+	db.Exec("ALTER TABLE notification_logs ADD COLUMN payload TEXT NOT NULL DEFAULT ''")
+	db.Exec("ALTER TABLE notification_logs ADD COLUMN redelivery_of INTEGER")
+	db.Exec("ALTER TABLE projects ADD COLUMN employee_stars INTEGER NOT NULL DEFAULT 0")
+	db.Exec("ALTER TABLE projects ADD COLUMN employee_contributors INTEGER NOT NULL DEFAULT 0")
+	db.Exec("ALTER TABLE projects ADD COLUMN employee_checked_at TIMESTAMP")
+	db.Exec("ALTER TABLE projects ADD COLUMN attribution TEXT NOT NULL DEFAULT ''")
+	db.Exec("ALTER TABLE projects ADD COLUMN use_case TEXT NOT NULL DEFAULT ''")
+	db.Exec("ALTER TABLE projects ADD COLUMN deleted_at TIMESTAMP")
+	db.Exec("ALTER TABLE notification_logs ADD COLUMN suppressed INTEGER NOT NULL DEFAULT 0")
+	db.Exec("ALTER TABLE refresh_jobs ADD COLUMN failure_code TEXT NOT NULL DEFAULT ''")
+	db.Exec("ALTER TABLE refresh_jobs ADD COLUMN remediation TEXT NOT NULL DEFAULT ''")
+	db.Exec("ALTER TABLE refresh_jobs ADD COLUMN phase TEXT NOT NULL DEFAULT ''")
+	db.Exec("ALTER TABLE refresh_jobs ADD COLUMN repos_discovered INTEGER NOT NULL DEFAULT 0")
+	db.Exec("ALTER TABLE refresh_jobs ADD COLUMN repos_processed INTEGER NOT NULL DEFAULT 0")
+	db.Exec("ALTER TABLE refresh_jobs ADD COLUMN errors_count INTEGER NOT NULL DEFAULT 0")
+	db.Exec("ALTER TABLE refresh_jobs ADD COLUMN sample INTEGER NOT NULL DEFAULT 0") // repos ingested by a ?sample= refresh, 0 for a full one
+	// Sample refreshes completed before the column existed, from their reports
+	db.Exec(`UPDATE refresh_jobs SET sample = json_extract(report_json, '$.sample')
+		WHERE sample = 0 AND json_valid(report_json) AND json_extract(report_json, '$.sample') > 0`)
+	// Projects notified before notified_projects existed
+	db.Exec(`INSERT OR IGNORE INTO notified_projects (config_id, project_id, notified_at)
+		SELECT config_id, project_id, MIN(sent_at) FROM notification_logs
+		WHERE status = 'sent' AND project_id IS NOT NULL GROUP BY config_id, project_id`)
+	// Enrichment stages that kept their own timestamps before project_stage_runs existed
+	db.Exec(`INSERT OR IGNORE INTO project_stage_runs (project_id, stage, last_run_at)
+		SELECT id, 'activity', commit_activity_at FROM projects WHERE commit_activity_at IS NOT NULL`)
+	db.Exec(`INSERT OR IGNORE INTO project_stage_runs (project_id, stage, last_run_at)
+		SELECT id, 'employees', employee_checked_at FROM projects WHERE employee_checked_at IS NOT NULL`)
 
 	return nil
 }
 
 // Project operations
 
+// projectColumns is the column list matching scanProject
+const projectColumns = `id, repo_full_name, provider, github_url, stars, description, primary_language, dockerfile_path, file_url, source_type, file_type, adopted_at, adoption_commit, verification_status, verified_at, first_seen_at, last_seen_at, created_at, updated_at, status, removed_at, archived, fork, fork_parent, license, topics, commit_activity, featured_rank, attribution, use_case, employee_stars, employee_contributors, deleted_at`
+
+// scanner is implemented by *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanProject(row scanner) (Project, error) {
+	var p Project
+	var topics, activity string
+	err := row.Scan(&p.ID, &p.RepoFullName, &p.Provider, &p.GitHubURL, &p.Stars, &p.Description, &p.PrimaryLanguage, &p.DockerfilePath, &p.FileURL, &p.SourceType, &p.FileType, &p.AdoptedAt, &p.AdoptionCommit, &p.VerificationStatus, &p.VerifiedAt, &p.FirstSeenAt, &p.LastSeenAt, &p.CreatedAt, &p.UpdatedAt, &p.Status, &p.RemovedAt, &p.Archived, &p.Fork, &p.ForkParent, &p.License, &topics, &activity, &p.FeaturedRank, &p.Attribution, &p.UseCase, &p.EmployeeStars, &p.EmployeeContribs, &p.DeletedAt)
+	if err != nil {
+		return p, err
+	}
+	// Topics are stored as a JSON array so they can be matched with json_each
+	if err := json.Unmarshal([]byte(topics), &p.Topics); err != nil {
+		return p, fmt.Errorf("decoding topics of %s: %w", p.RepoFullName, err)
+	}
+	if p.Topics == nil {
+		p.Topics = []string{}
+	}
+	if err := json.Unmarshal([]byte(activity), &p.CommitActivity); err != nil {
+		return p, fmt.Errorf("decoding commit activity of %s: %w", p.RepoFullName, err)
+	}
+	if p.CommitActivity == nil {
+		p.CommitActivity = []int{}
+	}
+	p.Featured = p.FeaturedRank > 0
+	p.EmployeeEngaged = p.EmployeeStars > 0 || p.EmployeeContribs > 0
+	return p, nil
+}
+
+// queryProjects runs a query selecting projectColumns and scans the results
+func (db *DB) queryProjects(query string, args ...interface{}) ([]Project, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var projects []Project
+	for rows.Next() {
+		p, err := scanProject(rows)
+		if err != nil {
+			return nil, err
+		}
+		projects = append(projects, p)
+	}
+	return projects, rows.Err()
+}
+
 func (db *DB) UpsertProject(p *Project) error {
 	query := `
-	INSERT INTO projects (repo_full_name, github_url, stars, description, primary_language, dockerfile_path, file_url, source_type, adopted_at, first_seen_at, last_seen_at, updated_at)
-	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+	INSERT INTO projects (repo_full_name, provider, github_url, stars, description, primary_language, dockerfile_path, file_url, source_type, file_type, adopted_at, archived, fork, fork_parent, license, topics, verification_status, verified_at, first_seen_at, last_seen_at, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 'verified', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
 	ON CONFLICT(repo_full_name) DO UPDATE SET
+		provider = excluded.provider,
 		stars = excluded.stars,
 		description = excluded.description,
 		primary_language = excluded.primary_language,
 		dockerfile_path = excluded.dockerfile_path,
 		file_url = excluded.file_url,
 		source_type = excluded.source_type,
+		file_type = excluded.file_type,
+		archived = excluded.archived,
+		fork = excluded.fork,
+		fork_parent = excluded.fork_parent,
+		license = excluded.license,
+		topics = excluded.topics,
 		adopted_at = COALESCE(projects.adopted_at, excluded.adopted_at),
+		verification_status = 'verified',
+		verified_at = CURRENT_TIMESTAMP,
 		last_seen_at = CURRENT_TIMESTAMP,
+		status = 'active',
+		missed_refreshes = 0,
+		removed_at = NULL,
 		updated_at = CURRENT_TIMESTAMP
 	`
-	_, err := db.Exec(query, p.RepoFullName, p.GitHubURL, p.Stars, p.Description, p.PrimaryLanguage, p.DockerfilePath, p.FileURL, p.SourceType, p.AdoptedAt)
+	provider := p.Provider
+	if provider == "" {
+		provider = "github"
+	}
+	topics := p.Topics
+	if topics == nil {
+		topics = []string{}
+	}
+	topicsJSON, err := json.Marshal(topics)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(query, p.RepoFullName, provider, p.GitHubURL, p.Stars, p.Description, p.PrimaryLanguage, p.DockerfilePath, p.FileURL, p.SourceType, p.FileType, p.AdoptedAt, p.Archived, p.Fork, p.ForkParent, p.License, string(topicsJSON))
 	return err
 }
 
 type ProjectFilter struct {
-	MinStars   int
-	MaxStars   int
-	Search     string
-	SourceType string
-	SortBy     string // stars, name, first_seen
-	SortOrder  string // asc, desc
-	Limit      int
-	Offset     int
+	MinStars        int
+	MaxStars        int
+	Search          string
+	SourceType      string
+	FileType        string
+	Provider        string // github, gitlab
+	Status          string // active, removed, deleted; empty for all
+	ExcludeArchived bool
+	ExcludeForks    bool
+	Topic           string
+	License         string // SPDX identifier; "none" matches projects without one
+	Attribution     string // acquisition channel; "none" matches unattributed projects
+	UseCase         string // web_service, cli, ml_pipeline or infra; "none" matches unclassified projects
+	Employee        string // engaged (starred or contributed to by EMPLOYEE_ORG members) or organic; empty for both
+	Featured        bool   // only featured projects, in curated order (SortBy is ignored)
+	Deleted         string // only (the trash) or include; soft-deleted projects are left out by default
+	SortBy          string // stars, name, first_seen, deleted
+	SortOrder       string // asc, desc
+	Limit           int
+	Offset          int
 }
 
-func (db *DB) ListProjects(filter ProjectFilter) ([]Project, error) {
-	query := `SELECT id, repo_full_name, github_url, stars, description, primary_language, dockerfile_path, file_url, source_type, adopted_at, adoption_commit, first_seen_at, last_seen_at, created_at, updated_at FROM projects WHERE 1=1`
+// projectFilterWhere builds the WHERE clause shared by ListProjects and CountProjects
+func projectFilterWhere(filter ProjectFilter) (string, []interface{}) {
+	query := " WHERE 1=1"
 	args := []interface{}{}
 
+	switch filter.Deleted {
+	case "only":
+		query += " AND deleted_at IS NOT NULL"
+	case "include":
+		// every project
+	default:
+		query += " AND deleted_at IS NULL"
+	}
+
 	if filter.MinStars > 0 {
 		query += " AND stars >= ?"
 		args = append(args, filter.MinStars)
@@ -221,6 +622,89 @@ func (db *DB) ListProjects(filter ProjectFilter) ([]Project, error) {
 		query += " AND source_type = ?"
 		args = append(args, filter.SourceType)
 	}
+	if filter.FileType != "" {
+		query += " AND file_type = ?"
+		args = append(args, filter.FileType)
+	}
+	if filter.Provider != "" {
+		query += " AND provider = ?"
+		args = append(args, filter.Provider)
+	}
+	if filter.Status != "" {
+		query += " AND status = ?"
+		args = append(args, filter.Status)
+	}
+	if filter.ExcludeArchived {
+		query += " AND archived = 0"
+	}
+	if filter.ExcludeForks {
+		query += " AND fork = 0"
+	}
+	if filter.Topic != "" {
+		query += " AND EXISTS (SELECT 1 FROM json_each(projects.topics) WHERE value = ?)"
+		args = append(args, filter.Topic)
+	}
+	if filter.Featured {
+		query += " AND featured_rank > 0"
+	}
+	if filter.Attribution == "none" {
+		query += " AND attribution = ''"
+	} else if filter.Attribution != "" {
+		query += " AND attribution = ?"
+		args = append(args, filter.Attribution)
+	}
+	if filter.UseCase == "none" {
+		query += " AND use_case = ''"
+	} else if filter.UseCase != "" {
+		query += " AND use_case = ?"
+		args = append(args, filter.UseCase)
+	}
+	switch filter.Employee {
+	case "engaged":
+		query += " AND (employee_stars > 0 OR employee_contributors > 0)"
+	case "organic":
+		query += " AND employee_stars = 0 AND employee_contributors = 0"
+	}
+	if filter.License == "none" {
+		query += " AND license = ''"
+	} else if filter.License != "" {
+		query += " AND license = ?"
+		args = append(args, filter.License)
+	}
+	return query, args
+}
+
+func (db *DB) ListProjects(filter ProjectFilter) ([]Project, error) {
+	query, args := listProjectsQuery(filter)
+	return db.queryProjects(query, args...)
+}
+
+// EachProject calls fn for each project ListProjects would return, without
+// holding them all in memory. Iteration stops at the first error fn returns.
+func (db *DB) EachProject(filter ProjectFilter, fn func(Project) error) error {
+	query, args := listProjectsQuery(filter)
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		p, err := scanProject(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(p); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// listProjectsQuery builds the ListProjects query for a filter
+func listProjectsQuery(filter ProjectFilter) (string, []interface{}) {
+	where, args := projectFilterWhere(filter)
+	query := `SELECT ` + projectColumns + ` FROM projects` + where
 
 	// Sorting
 	sortCol := "stars"
@@ -229,6 +713,8 @@ func (db *DB) ListProjects(filter ProjectFilter) ([]Project, error) {
 		sortCol = "repo_full_name"
 	case "first_seen":
 		sortCol = "first_seen_at"
+	case "deleted":
+		sortCol = "deleted_at"
 	case "stars":
 		sortCol = "stars"
 	}
@@ -236,37 +722,75 @@ func (db *DB) ListProjects(filter ProjectFilter) ([]Project, error) {
 	if filter.SortOrder == "asc" {
 		sortOrder = "ASC"
 	}
-	query += fmt.Sprintf(" ORDER BY %s %s", sortCol, sortOrder)
+	if filter.Featured {
+		query += " ORDER BY featured_rank ASC"
+	} else {
+		query += fmt.Sprintf(" ORDER BY %s %s", sortCol, sortOrder)
+	}
 
 	if filter.Limit > 0 {
 		query += " LIMIT ?"
 		args = append(args, filter.Limit)
 	}
 	if filter.Offset > 0 {
+		if filter.Limit <= 0 {
+			query += " LIMIT -1" // SQLite only takes OFFSET after a LIMIT
+		}
 		query += " OFFSET ?"
 		args = append(args, filter.Offset)
 	}
+	return query, args
+}
 
-	rows, err := db.Query(query, args...)
+// GetProject returns a project by ID, or nil if there is none
+func (db *DB) GetProject(id int64) (*Project, error) {
+	p, err := scanProject(db.QueryRow(`SELECT `+projectColumns+` FROM projects WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
+	return &p, nil
+}
 
-	var projects []Project
-	for rows.Next() {
-		var p Project
-		err := rows.Scan(&p.ID, &p.RepoFullName, &p.GitHubURL, &p.Stars, &p.Description, &p.PrimaryLanguage, &p.DockerfilePath, &p.FileURL, &p.SourceType, &p.AdoptedAt, &p.AdoptionCommit, &p.FirstSeenAt, &p.LastSeenAt, &p.CreatedAt, &p.UpdatedAt)
-		if err != nil {
-			return nil, err
-		}
-		projects = append(projects, p)
+// GetProjectByName returns a project by repo_full_name, or nil if there is none
+func (db *DB) GetProjectByName(repoFullName string) (*Project, error) {
+	p, err := scanProject(db.QueryRow(`SELECT `+projectColumns+` FROM projects WHERE repo_full_name = ?`, repoFullName))
+	if err == sql.ErrNoRows {
+		return nil, nil
 	}
-	return projects, rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// CountProjects returns how many projects match the filter, ignoring sort and paging
+func (db *DB) CountProjects(filter ProjectFilter) (int, error) {
+	where, args := projectFilterWhere(filter)
+	var count int
+	err := db.QueryRow(`SELECT COUNT(*) FROM projects`+where, args...).Scan(&count)
+	return count, err
 }
 
 func (db *DB) GetSourceTypes() ([]string, error) {
-	rows, err := db.Query(`SELECT DISTINCT source_type FROM projects WHERE source_type != '' ORDER BY source_type`)
+	return db.distinctProjectValues("source_type")
+}
+
+// GetFileTypes returns the distinct kinds of file (dockerfile, compose, ...) DHI was found in
+func (db *DB) GetFileTypes() ([]string, error) {
+	return db.distinctProjectValues("file_type")
+}
+
+// GetProviders returns the distinct code hosts (github, gitlab) projects were found on
+func (db *DB) GetProviders() ([]string, error) {
+	return db.distinctProjectValues("provider")
+}
+
+// distinctProjectValues returns the distinct non-empty values of a projects column
+func (db *DB) distinctProjectValues(column string) ([]string, error) {
+	rows, err := db.Query(`SELECT DISTINCT ` + column + ` FROM projects WHERE ` + column + ` != '' ORDER BY ` + column)
 	if err != nil {
 		return nil, err
 	}
@@ -283,21 +807,51 @@ func (db *DB) GetSourceTypes() ([]string, error) {
 	return types, rows.Err()
 }
 
-func (db *DB) GetStats() (total int, totalStars int, popular int, notable int, err error) {
-	err = db.QueryRow(`SELECT COUNT(*), COALESCE(SUM(stars), 0) FROM projects`).Scan(&total, &totalStars)
+// liveProject is the condition for projects counted in stats: still using DHI
+// in a repository that exists and isn't archived, and not in the trash
+const liveProject = `status = 'active' AND archived = 0 AND deleted_at IS NULL`
+
+// GetStats counts live projects, leaving out forks when excludeForks is set;
+// removed, deleted and archived ones are counted by GetChurnStats
+func (db *DB) GetStats(excludeForks bool) (total int, totalStars int, popular int, notable int, err error) {
+	where := liveProject
+	if excludeForks {
+		where += ` AND fork = 0`
+	}
+	err = db.QueryRow(`SELECT COUNT(*), COALESCE(SUM(stars), 0) FROM projects WHERE `+where).Scan(&total, &totalStars)
 	if err != nil {
 		return
 	}
-	err = db.QueryRow(`SELECT COUNT(*) FROM projects WHERE stars >= 1000`).Scan(&popular)
+	err = db.QueryRow(`SELECT COUNT(*) FROM projects WHERE ` + where + ` AND stars >= 1000`).Scan(&popular)
 	if err != nil {
 		return
 	}
-	err = db.QueryRow(`SELECT COUNT(*) FROM projects WHERE stars >= 100 AND stars < 1000`).Scan(&notable)
+	err = db.QueryRow(`SELECT COUNT(*) FROM projects WHERE ` + where + ` AND stars >= 100 AND stars < 1000`).Scan(&notable)
 	return
 }
 
 // Refresh job operations
 
+// refreshJobColumns is the column list matching scanRefreshJob
+const refreshJobColumns = `id, status, started_at, completed_at, projects_found, error_message, error_counts, failure_code, remediation, created_at, phase, repos_discovered, repos_processed, errors_count`
+
+// scanRefreshJob scans a refresh job row, returning nil if there is none
+func scanRefreshJob(row scanner) (*RefreshJob, error) {
+	var job RefreshJob
+	var errorCounts string
+	err := row.Scan(&job.ID, &job.Status, &job.StartedAt, &job.CompletedAt, &job.ProjectsFound, &job.ErrorMessage, &errorCounts, &job.FailureCode, &job.Remediation, &job.CreatedAt, &job.Phase, &job.ReposDiscovered, &job.ReposProcessed, &job.ErrorsCount)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(errorCounts), &job.ErrorCounts); err != nil {
+		return nil, fmt.Errorf("decoding error counts of job %d: %w", job.ID, err)
+	}
+	return &job, nil
+}
+
 func (db *DB) CreateRefreshJob() (int64, error) {
 	result, err := db.Exec(`INSERT INTO refresh_jobs (status) VALUES ('pending')`)
 	if err != nil {
@@ -311,75 +865,163 @@ func (db *DB) StartRefreshJob(id int64) error {
 	return err
 }
 
-func (db *DB) CompleteRefreshJob(id int64, projectsFound int) error {
-	_, err := db.Exec(`UPDATE refresh_jobs SET status = 'completed', completed_at = CURRENT_TIMESTAMP, projects_found = ? WHERE id = ?`, projectsFound, id)
+// CompleteRefreshJob marks a job completed. sample is the ?sample= size of a
+// smoke-test refresh, 0 for a full one.
+func (db *DB) CompleteRefreshJob(id int64, projectsFound, sample int) error {
+	_, err := db.Exec(`UPDATE refresh_jobs SET status = 'completed', completed_at = CURRENT_TIMESTAMP, projects_found = ?, sample = ? WHERE id = ?`, projectsFound, sample, id)
 	return err
 }
 
-func (db *DB) FailRefreshJob(id int64, errMsg string) error {
-	_, err := db.Exec(`UPDATE refresh_jobs SET status = 'failed', completed_at = CURRENT_TIMESTAMP, error_message = ? WHERE id = ?`, errMsg, id)
+// FailRefreshJob marks a job failed with its error, the code of its cause and
+// a hint for fixing it
+func (db *DB) FailRefreshJob(id int64, errMsg, failureCode, remediation string) error {
+	_, err := db.Exec(`UPDATE refresh_jobs SET status = 'failed', completed_at = CURRENT_TIMESTAMP, error_message = ?, failure_code = ?, remediation = ? WHERE id = ?`, errMsg, failureCode, remediation, id)
 	return err
 }
 
+// InterruptRefreshJob records that a job stopped because the server shut down
+func (db *DB) InterruptRefreshJob(id int64, errMsg, remediation string) error {
+	_, err := db.Exec(`UPDATE refresh_jobs SET status = 'interrupted', completed_at = CURRENT_TIMESTAMP, error_message = ?, failure_code = 'interrupted', remediation = ? WHERE id = ?`, errMsg, remediation, id)
+	return err
+}
+
+// InterruptUnfinishedRefreshJobs marks jobs still pending or running as
+// interrupted, for use at startup after the server was killed during a
+// refresh, and returns how many there were
+func (db *DB) InterruptUnfinishedRefreshJobs(errMsg, remediation string) (int64, error) {
+	result, err := db.Exec(`UPDATE refresh_jobs SET status = 'interrupted', completed_at = CURRENT_TIMESTAMP, error_message = ?, failure_code = 'interrupted', remediation = ? WHERE status IN ('pending', 'running')`, errMsg, remediation)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 func (db *DB) GetLatestRefreshJob() (*RefreshJob, error) {
-	row := db.QueryRow(`SELECT id, status, started_at, completed_at, projects_found, error_message, created_at FROM refresh_jobs ORDER BY id DESC LIMIT 1`)
-	var job RefreshJob
-	err := row.Scan(&job.ID, &job.Status, &job.StartedAt, &job.CompletedAt, &job.ProjectsFound, &job.ErrorMessage, &job.CreatedAt)
-	if err == sql.ErrNoRows {
-		return nil, nil
+	row := db.QueryRow(`SELECT ` + refreshJobColumns + ` FROM refresh_jobs ORDER BY id DESC LIMIT 1`)
+	return scanRefreshJob(row)
+}
+
+// GetRefreshJob returns a refresh job by ID, or nil if it doesn't exist
+func (db *DB) GetRefreshJob(id int64) (*RefreshJob, error) {
+	row := db.QueryRow(`SELECT `+refreshJobColumns+` FROM refresh_jobs WHERE id = ?`, id)
+	return scanRefreshJob(row)
+}
+
+// UpdateRefreshProgress records how far a refresh job has got
+func (db *DB) UpdateRefreshProgress(id int64, p RefreshProgress) error {
+	_, err := db.Exec(`UPDATE refresh_jobs SET phase = ?, repos_discovered = ?, repos_processed = ?, errors_count = ? WHERE id = ?`, p.Phase, p.ReposDiscovered, p.ReposProcessed, p.ErrorsCount, id)
+	return err
+}
+
+// SaveRefreshReport stores the JSON report for a refresh job
+func (db *DB) SaveRefreshReport(id int64, reportJSON string) error {
+	_, err := db.Exec(`UPDATE refresh_jobs SET report_json = ? WHERE id = ?`, reportJSON, id)
+	return err
+}
+
+// SaveRefreshErrorCounts stores a refresh job's error counts by category
+// (rate_limit, not_found, timeout, parse, network, database, other)
+func (db *DB) SaveRefreshErrorCounts(id int64, counts map[string]int) error {
+	if counts == nil {
+		counts = map[string]int{}
 	}
+	data, err := json.Marshal(counts)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	return &job, nil
+	_, err = db.Exec(`UPDATE refresh_jobs SET error_counts = ? WHERE id = ?`, string(data), id)
+	return err
 }
 
-func (db *DB) GetRunningRefreshJob() (*RefreshJob, error) {
-	row := db.QueryRow(`SELECT id, status, started_at, completed_at, projects_found, error_message, created_at FROM refresh_jobs WHERE status = 'running' ORDER BY id DESC LIMIT 1`)
-	var job RefreshJob
-	err := row.Scan(&job.ID, &job.Status, &job.StartedAt, &job.CompletedAt, &job.ProjectsFound, &job.ErrorMessage, &job.CreatedAt)
-	if err == sql.ErrNoRows {
-		return nil, nil
-	}
+// ListRefreshJobs returns the most recent refresh jobs, newest first
+func (db *DB) ListRefreshJobs(limit int) ([]RefreshJob, error) {
+	rows, err := db.Query(`SELECT `+refreshJobColumns+` FROM refresh_jobs ORDER BY id DESC LIMIT ?`, limit)
 	if err != nil {
 		return nil, err
 	}
-	return &job, nil
+	defer rows.Close()
+
+	var jobs []RefreshJob
+	for rows.Next() {
+		job, err := scanRefreshJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, *job)
+	}
+	return jobs, rows.Err()
 }
 
-func (db *DB) GetLastCompletedRefreshJob() (*RefreshJob, error) {
-	row := db.QueryRow(`SELECT id, status, started_at, completed_at, projects_found, error_message, created_at FROM refresh_jobs WHERE status = 'completed' ORDER BY completed_at DESC LIMIT 1`)
-	var job RefreshJob
-	err := row.Scan(&job.ID, &job.Status, &job.StartedAt, &job.CompletedAt, &job.ProjectsFound, &job.ErrorMessage, &job.CreatedAt)
+// GetRefreshReport returns the JSON report for a refresh job, or "" if none was recorded
+func (db *DB) GetRefreshReport(id int64) (string, error) {
+	var report sql.NullString
+	err := db.QueryRow(`SELECT report_json FROM refresh_jobs WHERE id = ?`, id).Scan(&report)
 	if err == sql.ErrNoRows {
-		return nil, nil
+		return "", nil
 	}
-	if err != nil {
-		return nil, err
-	}
-	return &job, nil
+	return report.String, err
+}
+
+func (db *DB) GetRunningRefreshJob() (*RefreshJob, error) {
+	row := db.QueryRow(`SELECT ` + refreshJobColumns + ` FROM refresh_jobs WHERE status = 'running' ORDER BY id DESC LIMIT 1`)
+	return scanRefreshJob(row)
+}
+
+// GetLastCompletedRefreshJob returns the last full refresh that completed.
+// Sample refreshes don't ingest the whole dataset, so they don't count.
+func (db *DB) GetLastCompletedRefreshJob() (*RefreshJob, error) {
+	row := db.QueryRow(`SELECT ` + refreshJobColumns + ` FROM refresh_jobs WHERE status = 'completed' AND sample = 0 ORDER BY completed_at DESC LIMIT 1`)
+	return scanRefreshJob(row)
 }
 
 // Snapshot operations
 
 // RecordSnapshot saves current stats as a snapshot
-func (db *DB) RecordSnapshot() error {
-	total, totalStars, popular, notable, err := db.GetStats()
+func (db *DB) RecordSnapshot() ([]Milestone, error) {
+	total, totalStars, popular, notable, err := db.GetStats(false)
 	if err != nil {
-		return fmt.Errorf("getting stats for snapshot: %w", err)
+		return nil, fmt.Errorf("getting stats for snapshot: %w", err)
+	}
+
+	// The snapshot and the rows recorded alongside it are written together, so
+	// history never reads a snapshot with only part of its details
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
 	}
+	defer tx.Rollback()
 
-	_, err = db.Exec(`INSERT INTO refresh_snapshots (total_projects, total_stars, popular_count, notable_count) VALUES (?, ?, ?, ?)`,
+	result, err := tx.Exec(`INSERT INTO refresh_snapshots (total_projects, total_stars, popular_count, notable_count) VALUES (?, ?, ?, ?)`,
 		total, totalStars, popular, notable)
-	return err
+	if err != nil {
+		return nil, err
+	}
+	snapshotID, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	if err := recordImageSnapshot(tx, snapshotID); err != nil {
+		return nil, fmt.Errorf("recording image snapshot: %w", err)
+	}
+	if err := recordSnapshotDetails(tx, snapshotID); err != nil {
+		return nil, fmt.Errorf("recording snapshot details: %w", err)
+	}
+	if err := recordStarHistory(tx, snapshotID); err != nil {
+		return nil, fmt.Errorf("recording star history: %w", err)
+	}
+	milestones, err := recordMilestones(tx, snapshotID, map[string]int{"projects": total, "stars": totalStars})
+	if err != nil {
+		return nil, fmt.Errorf("recording milestones: %w", err)
+	}
+	return milestones, tx.Commit()
 }
 
 // AdoptionByDate represents adoption count for a specific date
 type AdoptionByDate struct {
-	Date           string `json:"date"`
-	Count          int    `json:"count"`
-	CumulativeCount int   `json:"cumulative_count"`
-	CumulativeStars int   `json:"cumulative_stars"`
+	Date            string `json:"date"`
+	Count           int    `json:"count"`
+	CumulativeCount int    `json:"cumulative_count"`
+	CumulativeStars int    `json:"cumulative_stars"`
 }
 
 // GetAdoptionByDate returns daily adoption counts with cumulative totals
@@ -393,17 +1035,18 @@ func (db *DB) GetAdoptionByDate(days int) ([]AdoptionByDate, error) {
 			FROM projects 
 			WHERE adopted_at IS NOT NULL 
 				AND adopted_at >= date('now', ?)
+				AND deleted_at IS NULL
 			GROUP BY date(adopted_at)
 			ORDER BY date(adopted_at)
 		)
 		SELECT 
 			date,
 			count,
-			(SELECT COUNT(*) FROM projects WHERE adopted_at IS NOT NULL AND date(adopted_at) <= daily_adoptions.date) as cumulative_count,
-			(SELECT COALESCE(SUM(stars), 0) FROM projects WHERE adopted_at IS NOT NULL AND date(adopted_at) <= daily_adoptions.date) as cumulative_stars
+			(SELECT COUNT(*) FROM projects WHERE adopted_at IS NOT NULL AND deleted_at IS NULL AND date(adopted_at) <= daily_adoptions.date) as cumulative_count,
+			(SELECT COALESCE(SUM(stars), 0) FROM projects WHERE adopted_at IS NOT NULL AND deleted_at IS NULL AND date(adopted_at) <= daily_adoptions.date) as cumulative_stars
 		FROM daily_adoptions
 	`
-	
+
 	sinceArg := fmt.Sprintf("-%d days", days)
 	rows, err := db.Query(query, sinceArg)
 	if err != nil {
@@ -450,55 +1093,27 @@ func (db *DB) GetSnapshots(limit int) ([]RefreshSnapshot, error) {
 
 // GetNewProjectsSince returns projects adopted after the given time
 func (db *DB) GetNewProjectsSince(since time.Time) ([]Project, error) {
-	query := `SELECT id, repo_full_name, github_url, stars, description, primary_language, dockerfile_path, file_url, source_type, adopted_at, adoption_commit, first_seen_at, last_seen_at, created_at, updated_at 
-		FROM projects WHERE adopted_at IS NOT NULL AND adopted_at > ? ORDER BY adopted_at DESC`
-
-	rows, err := db.Query(query, since)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
+	query := `SELECT ` + projectColumns + `
+		FROM projects WHERE adopted_at IS NOT NULL AND adopted_at > ? AND ` + liveProject + ` ORDER BY adopted_at DESC`
 
-	var projects []Project
-	for rows.Next() {
-		var p Project
-		err := rows.Scan(&p.ID, &p.RepoFullName, &p.GitHubURL, &p.Stars, &p.Description, &p.PrimaryLanguage, &p.DockerfilePath, &p.FileURL, &p.SourceType, &p.AdoptedAt, &p.AdoptionCommit, &p.FirstSeenAt, &p.LastSeenAt, &p.CreatedAt, &p.UpdatedAt)
-		if err != nil {
-			return nil, err
-		}
-		projects = append(projects, p)
-	}
-	return projects, rows.Err()
+	return db.queryProjects(query, since)
 }
 
 // GetNewProjectsCount returns count of projects adopted after the given time
 func (db *DB) GetNewProjectsCount(since time.Time) (int, error) {
 	var count int
-	err := db.QueryRow(`SELECT COUNT(*) FROM projects WHERE adopted_at IS NOT NULL AND adopted_at > ?`, since).Scan(&count)
+	err := db.QueryRow(`SELECT COUNT(*) FROM projects WHERE adopted_at IS NOT NULL AND adopted_at > ? AND `+liveProject, since).Scan(&count)
 	return count, err
 }
 
-// GetProjectsWithoutAdoptionDate returns projects that need adoption date fetched
+// GetProjectsWithoutAdoptionDate returns projects that need adoption date fetched,
+// excluding projects whose adoption file is known to be missing. Most recently seen first.
 func (db *DB) GetProjectsWithoutAdoptionDate() ([]Project, error) {
-	query := `SELECT id, repo_full_name, github_url, stars, description, primary_language, dockerfile_path, file_url, source_type, adopted_at, adoption_commit, first_seen_at, last_seen_at, created_at, updated_at 
-		FROM projects WHERE adopted_at IS NULL`
-
-	rows, err := db.Query(query)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
+	query := `SELECT ` + projectColumns + `
+		FROM projects WHERE adopted_at IS NULL AND verification_status != 'file_missing' AND deleted_at IS NULL
+		ORDER BY last_seen_at DESC`
 
-	var projects []Project
-	for rows.Next() {
-		var p Project
-		err := rows.Scan(&p.ID, &p.RepoFullName, &p.GitHubURL, &p.Stars, &p.Description, &p.PrimaryLanguage, &p.DockerfilePath, &p.FileURL, &p.SourceType, &p.AdoptedAt, &p.AdoptionCommit, &p.FirstSeenAt, &p.LastSeenAt, &p.CreatedAt, &p.UpdatedAt)
-		if err != nil {
-			return nil, err
-		}
-		projects = append(projects, p)
-	}
-	return projects, rows.Err()
+	return db.queryProjects(query)
 }
 
 // UpdateProjectAdoption sets the adoption date and commit URL for a project
@@ -507,12 +1122,18 @@ func (db *DB) UpdateProjectAdoption(id int64, adoptedAt time.Time, commitURL str
 	return err
 }
 
+// SetProjectVerification records the verification status of a project's adoption file
+func (db *DB) SetProjectVerification(id int64, status string) error {
+	_, err := db.Exec(`UPDATE projects SET verification_status = ?, verified_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, status, id)
+	return err
+}
+
 // Notification configuration operations
 
 func (db *DB) CreateNotificationConfig(config *NotificationConfig) (int64, error) {
 	result, err := db.Exec(
-		`INSERT INTO notification_configs (name, type, enabled, config_json, created_at, updated_at) VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`,
-		config.Name, config.Type, config.Enabled, config.ConfigJSON,
+		`INSERT INTO notification_configs (name, type, enabled, config_json, require_approval, created_at, updated_at) VALUES (?, ?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`,
+		config.Name, config.Type, config.Enabled, config.ConfigJSON, config.RequireApproval,
 	)
 	if err != nil {
 		return 0, err
@@ -522,12 +1143,29 @@ func (db *DB) CreateNotificationConfig(config *NotificationConfig) (int64, error
 
 func (db *DB) UpdateNotificationConfig(config *NotificationConfig) error {
 	_, err := db.Exec(
-		`UPDATE notification_configs SET name = ?, type = ?, enabled = ?, config_json = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`,
-		config.Name, config.Type, config.Enabled, config.ConfigJSON, config.ID,
+		`UPDATE notification_configs SET name = ?, type = ?, enabled = ?, config_json = ?, require_approval = ?, version = version + 1, updated_at = CURRENT_TIMESTAMP WHERE id = ?`,
+		config.Name, config.Type, config.Enabled, config.ConfigJSON, config.RequireApproval, config.ID,
 	)
 	return err
 }
 
+// UpdateNotificationConfigIfVersion updates the config only if its stored version still
+// matches version. It returns false if the config was modified (or deleted) in the meantime.
+func (db *DB) UpdateNotificationConfigIfVersion(config *NotificationConfig, version int64) (bool, error) {
+	result, err := db.Exec(
+		`UPDATE notification_configs SET name = ?, type = ?, enabled = ?, config_json = ?, require_approval = ?, version = version + 1, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND version = ?`,
+		config.Name, config.Type, config.Enabled, config.ConfigJSON, config.RequireApproval, config.ID, version,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
 func (db *DB) DeleteNotificationConfig(id int64) error {
 	_, err := db.Exec(`DELETE FROM notification_configs WHERE id = ?`, id)
 	return err
@@ -536,9 +1174,9 @@ func (db *DB) DeleteNotificationConfig(id int64) error {
 func (db *DB) GetNotificationConfig(id int64) (*NotificationConfig, error) {
 	var config NotificationConfig
 	err := db.QueryRow(
-		`SELECT id, name, type, enabled, config_json, last_triggered_at, created_at, updated_at FROM notification_configs WHERE id = ?`,
+		`SELECT id, name, type, enabled, config_json, require_approval, version, last_triggered_at, created_at, updated_at FROM notification_configs WHERE id = ?`,
 		id,
-	).Scan(&config.ID, &config.Name, &config.Type, &config.Enabled, &config.ConfigJSON, &config.LastTriggeredAt, &config.CreatedAt, &config.UpdatedAt)
+	).Scan(&config.ID, &config.Name, &config.Type, &config.Enabled, &config.ConfigJSON, &config.RequireApproval, &config.Version, &config.LastTriggeredAt, &config.CreatedAt, &config.UpdatedAt)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -550,7 +1188,7 @@ func (db *DB) GetNotificationConfig(id int64) (*NotificationConfig, error) {
 
 func (db *DB) ListNotificationConfigs() ([]NotificationConfig, error) {
 	rows, err := db.Query(
-		`SELECT id, name, type, enabled, config_json, last_triggered_at, created_at, updated_at FROM notification_configs ORDER BY created_at DESC`,
+		`SELECT id, name, type, enabled, config_json, require_approval, version, last_triggered_at, created_at, updated_at FROM notification_configs ORDER BY created_at DESC`,
 	)
 	if err != nil {
 		return nil, err
@@ -560,7 +1198,7 @@ func (db *DB) ListNotificationConfigs() ([]NotificationConfig, error) {
 	var configs []NotificationConfig
 	for rows.Next() {
 		var c NotificationConfig
-		err := rows.Scan(&c.ID, &c.Name, &c.Type, &c.Enabled, &c.ConfigJSON, &c.LastTriggeredAt, &c.CreatedAt, &c.UpdatedAt)
+		err := rows.Scan(&c.ID, &c.Name, &c.Type, &c.Enabled, &c.ConfigJSON, &c.RequireApproval, &c.Version, &c.LastTriggeredAt, &c.CreatedAt, &c.UpdatedAt)
 		if err != nil {
 			return nil, err
 		}
@@ -571,7 +1209,7 @@ func (db *DB) ListNotificationConfigs() ([]NotificationConfig, error) {
 
 func (db *DB) GetEnabledNotificationConfigs() ([]NotificationConfig, error) {
 	rows, err := db.Query(
-		`SELECT id, name, type, enabled, config_json, last_triggered_at, created_at, updated_at FROM notification_configs WHERE enabled = 1 ORDER BY created_at DESC`,
+		`SELECT id, name, type, enabled, config_json, require_approval, version, last_triggered_at, created_at, updated_at FROM notification_configs WHERE enabled = 1 ORDER BY created_at DESC`,
 	)
 	if err != nil {
 		return nil, err
@@ -581,7 +1219,7 @@ func (db *DB) GetEnabledNotificationConfigs() ([]NotificationConfig, error) {
 	var configs []NotificationConfig
 	for rows.Next() {
 		var c NotificationConfig
-		err := rows.Scan(&c.ID, &c.Name, &c.Type, &c.Enabled, &c.ConfigJSON, &c.LastTriggeredAt, &c.CreatedAt, &c.UpdatedAt)
+		err := rows.Scan(&c.ID, &c.Name, &c.Type, &c.Enabled, &c.ConfigJSON, &c.RequireApproval, &c.Version, &c.LastTriggeredAt, &c.CreatedAt, &c.UpdatedAt)
 		if err != nil {
 			return nil, err
 		}
@@ -597,16 +1235,49 @@ func (db *DB) UpdateNotificationTriggered(configID int64) error {
 
 // Notification log operations
 
+// CreateNotificationLog records a delivery attempt, setting log.ID
 func (db *DB) CreateNotificationLog(log *NotificationLog) error {
-	_, err := db.Exec(
-		`INSERT INTO notification_logs (config_id, project_id, status, error_message, sent_at) VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP)`,
-		log.ConfigID, log.ProjectID, log.Status, log.ErrorMessage,
+	result, err := db.Exec(
+		`INSERT INTO notification_logs (config_id, project_id, status, error_message, payload, redelivery_of, suppressed, sent_at) VALUES (?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)`,
+		log.ConfigID, log.ProjectID, log.Status, log.ErrorMessage, log.Payload, log.RedeliveryOf, log.Suppressed,
 	)
+	if err != nil {
+		return err
+	}
+	log.ID, err = result.LastInsertId()
 	return err
 }
 
+// notificationLogColumns is the column list matching scanNotificationLog, over
+// notificationLogTables
+const notificationLogColumns = `l.id, l.config_id, l.project_id, l.status, l.error_message, l.payload, l.redelivery_of, l.suppressed, l.sent_at, COALESCE(o.attempts, 0), o.next_attempt_at`
+
+// notificationLogTables joins each log entry to its retries, if any
+const notificationLogTables = `notification_logs l LEFT JOIN notification_outbox o ON o.log_id = l.id`
+
+func scanNotificationLog(row scanner) (NotificationLog, error) {
+	var l NotificationLog
+	err := row.Scan(&l.ID, &l.ConfigID, &l.ProjectID, &l.Status, &l.ErrorMessage, &l.Payload, &l.RedeliveryOf, &l.Suppressed, &l.SentAt, &l.Attempts, &l.NextAttemptAt)
+	if l.Status != "pending" {
+		l.NextAttemptAt = nil
+	}
+	return l, err
+}
+
+// GetNotificationLog returns a log entry by ID, or nil if there is none
+func (db *DB) GetNotificationLog(id int64) (*NotificationLog, error) {
+	l, err := scanNotificationLog(db.QueryRow(`SELECT `+notificationLogColumns+` FROM `+notificationLogTables+` WHERE l.id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
 func (db *DB) GetNotificationLogs(configID int64, limit int) ([]NotificationLog, error) {
-	query := `SELECT id, config_id, project_id, status, error_message, sent_at FROM notification_logs WHERE config_id = ? ORDER BY sent_at DESC`
+	query := `SELECT ` + notificationLogColumns + ` FROM ` + notificationLogTables + ` WHERE l.config_id = ? ORDER BY l.sent_at DESC`
 	if limit > 0 {
 		query += fmt.Sprintf(" LIMIT %d", limit)
 	}
@@ -619,8 +1290,7 @@ func (db *DB) GetNotificationLogs(configID int64, limit int) ([]NotificationLog,
 
 	var logs []NotificationLog
 	for rows.Next() {
-		var l NotificationLog
-		err := rows.Scan(&l.ID, &l.ConfigID, &l.ProjectID, &l.Status, &l.ErrorMessage, &l.SentAt)
+		l, err := scanNotificationLog(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -628,3 +1298,36 @@ func (db *DB) GetNotificationLogs(configID int64, limit int) ([]NotificationLog,
 	}
 	return logs, rows.Err()
 }
+
+// ProjectNotification is a notification sent (or attempted) about a project
+type ProjectNotification struct {
+	NotificationLog
+	ConfigName string `json:"config_name"`
+	ConfigType string `json:"config_type"`
+}
+
+// GetProjectNotifications returns the notifications logged for a project, newest first
+func (db *DB) GetProjectNotifications(projectID int64, limit int) ([]ProjectNotification, error) {
+	rows, err := db.Query(`
+	SELECT l.id, l.config_id, l.project_id, l.status, l.error_message, l.payload, l.redelivery_of, l.sent_at, c.name, c.type
+	FROM notification_logs l
+	JOIN notification_configs c ON c.id = l.config_id
+	WHERE l.project_id = ?
+	ORDER BY l.sent_at DESC, l.id DESC
+	LIMIT ?
+	`, projectID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notifications []ProjectNotification
+	for rows.Next() {
+		var n ProjectNotification
+		if err := rows.Scan(&n.ID, &n.ConfigID, &n.ProjectID, &n.Status, &n.ErrorMessage, &n.Payload, &n.RedeliveryOf, &n.SentAt, &n.ConfigName, &n.ConfigType); err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, n)
+	}
+	return notifications, rows.Err()
+}
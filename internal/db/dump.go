@@ -0,0 +1,258 @@
+package db
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// DumpTables are the tables in a database dump: projects, refresh snapshots and
+// the adoption data recorded against them. Parents come before children so
+// foreign keys resolve as rows are imported in order.
+var DumpTables = []string{
+	"projects",
+	"refresh_snapshots",
+	"snapshot_details",
+	"milestones",
+	"image_snapshots",
+	"project_images",
+	"project_star_history",
+	"project_star_imports",
+	"project_links",
+}
+
+// DumpRow is one line of a database dump. Columns are keyed by name, so dumps
+// from an older schema import into a newer one with the added columns defaulted.
+type DumpRow struct {
+	Table string                 `json:"table"`
+	Row   map[string]interface{} `json:"row"`
+}
+
+// dumpColumn is a column of a dumped table
+type dumpColumn struct {
+	name      string
+	timestamp bool
+}
+
+// querier is implemented by both DB and sql.Tx
+type querier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// dumpColumns returns the columns of a dumped table
+func dumpColumns(q querier, table string) ([]dumpColumn, error) {
+	rows, err := q.Query(`SELECT name, type FROM pragma_table_info(?)`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cols []dumpColumn
+	for rows.Next() {
+		var name, typ string
+		if err := rows.Scan(&name, &typ); err != nil {
+			return nil, err
+		}
+		cols = append(cols, dumpColumn{name: name, timestamp: strings.EqualFold(typ, "TIMESTAMP")})
+	}
+	return cols, rows.Err()
+}
+
+// WriteDump writes every row of DumpTables to w as gzip-compressed NDJSON.
+// Timestamps are written as stored so an import reproduces them exactly.
+func (db *DB) WriteDump(w io.Writer) error {
+	zw := gzip.NewWriter(w)
+	enc := json.NewEncoder(zw)
+	for _, table := range DumpTables {
+		if err := db.dumpTable(table, enc); err != nil {
+			return fmt.Errorf("dumping %s: %w", table, err)
+		}
+	}
+	return zw.Close()
+}
+
+func (db *DB) dumpTable(table string, enc *json.Encoder) error {
+	cols, err := dumpColumns(db, table)
+	if err != nil {
+		return err
+	}
+	selects := make([]string, len(cols))
+	for i, c := range cols {
+		selects[i] = c.name
+		if c.timestamp {
+			// Read timestamps as text; the driver would otherwise reformat them
+			selects[i] = fmt.Sprintf("CAST(%s AS TEXT)", c.name)
+		}
+	}
+
+	rows, err := db.Query(`SELECT ` + strings.Join(selects, ", ") + ` FROM ` + table + ` ORDER BY rowid`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	values := make([]interface{}, len(cols))
+	ptrs := make([]interface{}, len(cols))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return err
+		}
+		row := make(map[string]interface{}, len(cols))
+		for i, c := range cols {
+			if b, ok := values[i].([]byte); ok {
+				values[i] = string(b)
+			}
+			row[c.name] = values[i]
+		}
+		if err := enc.Encode(DumpRow{Table: table, Row: row}); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// ImportDump replaces the contents of DumpTables with a dump written by
+// WriteDump (plain NDJSON is accepted too), in a single transaction so a bad
+// dump leaves the database untouched. Tables outside the dump that refer to
+// projects keep their rows for projects the dump still has. Returns the rows
+// imported per table.
+func (db *DB) ImportDump(r io.Reader) (map[string]int, error) {
+	br := bufio.NewReader(r)
+	var src io.Reader = br
+	if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		src = zr
+	}
+
+	// Deleting projects would cascade to state kept outside the dump, such as
+	// notified_projects and project_stage_runs, so the import runs with foreign
+	// keys off on its own connection and settles orphans itself afterwards
+	ctx := db.context()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, `PRAGMA foreign_keys = OFF`); err != nil {
+		return nil, fmt.Errorf("disabling foreign keys: %w", err)
+	}
+	defer func() {
+		// Not under ctx, which may be done by now: the connection must not go
+		// back to the pool with foreign keys off, so it is discarded if this fails
+		if _, err := conn.ExecContext(context.Background(), `PRAGMA foreign_keys = ON`); err != nil {
+			conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+		}
+	}()
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	columns := make(map[string]map[string]bool, len(DumpTables))
+	for i := len(DumpTables) - 1; i >= 0; i-- {
+		table := DumpTables[i]
+		if _, err := tx.Exec(`DELETE FROM ` + table); err != nil {
+			return nil, fmt.Errorf("clearing %s: %w", table, err)
+		}
+		cols, err := dumpColumns(tx, table)
+		if err != nil {
+			return nil, err
+		}
+		columns[table] = make(map[string]bool, len(cols))
+		for _, c := range cols {
+			columns[table][c.name] = true
+		}
+	}
+
+	counts := make(map[string]int, len(DumpTables))
+	dec := json.NewDecoder(src)
+	dec.UseNumber()
+	for line := 1; ; line++ {
+		var d DumpRow
+		if err := dec.Decode(&d); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		known, ok := columns[d.Table]
+		if !ok {
+			return nil, fmt.Errorf("line %d: unknown table %q", line, d.Table)
+		}
+
+		names := make([]string, 0, len(d.Row))
+		args := make([]interface{}, 0, len(d.Row))
+		for name, v := range d.Row {
+			if !known[name] {
+				return nil, fmt.Errorf("line %d: unknown column %s.%s", line, d.Table, name)
+			}
+			if n, ok := v.(json.Number); ok {
+				if i, err := n.Int64(); err == nil {
+					v = i
+				} else if v, err = n.Float64(); err != nil {
+					return nil, fmt.Errorf("line %d: %s.%s: %w", line, d.Table, name, err)
+				}
+			}
+			names = append(names, name)
+			args = append(args, v)
+		}
+		if len(names) == 0 {
+			return nil, fmt.Errorf("line %d: empty %s row", line, d.Table)
+		}
+		query := fmt.Sprintf(`INSERT INTO %s (%s) VALUES (?%s)`, d.Table, strings.Join(names, ", "), strings.Repeat(", ?", len(names)-1))
+		if _, err := tx.Exec(query, args...); err != nil {
+			return nil, fmt.Errorf("line %d: inserting into %s: %w", line, d.Table, err)
+		}
+		counts[d.Table]++
+	}
+
+	if err := settleImportOrphans(tx); err != nil {
+		return nil, err
+	}
+	return counts, tx.Commit()
+}
+
+// settleImportOrphans does what the foreign key actions would have done for
+// projects missing from an imported dump, then checks every reference resolves
+func settleImportOrphans(tx *sql.Tx) error {
+	for _, stmt := range []string{
+		`DELETE FROM notified_projects WHERE project_id NOT IN (SELECT id FROM projects)`,
+		`DELETE FROM project_stage_runs WHERE project_id NOT IN (SELECT id FROM projects)`,
+		`UPDATE notification_logs SET project_id = NULL WHERE project_id NOT IN (SELECT id FROM projects)`,
+		`UPDATE pending_messages SET project_id = NULL WHERE project_id NOT IN (SELECT id FROM projects)`,
+	} {
+		if _, err := tx.Exec(stmt); err != nil {
+			return fmt.Errorf("settling references to removed projects: %w", err)
+		}
+	}
+
+	rows, err := tx.Query(`PRAGMA foreign_key_check`)
+	if err != nil {
+		return fmt.Errorf("checking foreign keys: %w", err)
+	}
+	defer rows.Close()
+	if rows.Next() {
+		var table, parent string
+		var rowid sql.NullInt64
+		var fkid int
+		if err := rows.Scan(&table, &rowid, &parent, &fkid); err != nil {
+			return fmt.Errorf("checking foreign keys: %w", err)
+		}
+		return fmt.Errorf("%s row %d references a missing %s row", table, rowid.Int64, parent)
+	}
+	return rows.Err()
+}
@@ -0,0 +1,8 @@
+package db
+
+// SetProjectEmployeeEngagement stores how many employee org members starred and
+// contributed to a project
+func (db *DB) SetProjectEmployeeEngagement(id int64, stars, contributors int) error {
+	_, err := db.Exec(`UPDATE projects SET employee_stars = ?, employee_contributors = ?, employee_checked_at = CURRENT_TIMESTAMP WHERE id = ?`, stars, contributors, id)
+	return err
+}
@@ -0,0 +1,21 @@
+package db
+
+// SetFeaturedProjects replaces the curated featured list: ids are featured in
+// the given order and every other project is unfeatured
+func (db *DB) SetFeaturedProjects(ids []int64) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`UPDATE projects SET featured_rank = 0 WHERE featured_rank > 0`); err != nil {
+		return err
+	}
+	for i, id := range ids {
+		if _, err := tx.Exec(`UPDATE projects SET featured_rank = ? WHERE id = ?`, i+1, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
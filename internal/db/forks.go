@@ -0,0 +1,26 @@
+package db
+
+// adoptionKey groups a live project with the forks of it: forks count under the
+// repository they were created from, so 50 forks of a template are one adoption
+const adoptionKey = `CASE WHEN fork = 1 AND fork_parent != '' THEN fork_parent ELSE repo_full_name END`
+
+// ForkStats counts live forks and the adoptions left once forks of the same
+// upstream are grouped
+type ForkStats struct {
+	Forks     int `json:"forks"`     // live projects that are forks
+	Upstreams int `json:"upstreams"` // distinct repositories the live forks were created from
+	Adoptions int `json:"adoptions"` // live projects, counting an upstream and its forks once
+}
+
+// GetForkStats counts live forks and grouped adoptions. A fork whose upstream is
+// also tracked is grouped with it.
+func (db *DB) GetForkStats() (ForkStats, error) {
+	var stats ForkStats
+	err := db.QueryRow(`
+	SELECT
+		COALESCE(SUM(fork), 0),
+		COUNT(DISTINCT CASE WHEN fork = 1 AND fork_parent != '' THEN fork_parent END),
+		COUNT(DISTINCT `+adoptionKey+`)
+	FROM projects WHERE `+liveProject).Scan(&stats.Forks, &stats.Upstreams, &stats.Adoptions)
+	return stats, err
+}
@@ -0,0 +1,28 @@
+package db
+
+import "database/sql"
+
+// GitHub response cache operations
+
+// GetCachedResponse returns the stored ETag and body for a GitHub API endpoint
+func (db *DB) GetCachedResponse(endpoint string) (string, []byte, bool, error) {
+	var etag string
+	var body []byte
+	err := db.QueryRow(`SELECT etag, body FROM github_cache WHERE endpoint = ?`, endpoint).Scan(&etag, &body)
+	if err == sql.ErrNoRows {
+		return "", nil, false, nil
+	}
+	if err != nil {
+		return "", nil, false, err
+	}
+	return etag, body, true, nil
+}
+
+// PutCachedResponse stores the ETag and body for a GitHub API endpoint
+func (db *DB) PutCachedResponse(endpoint, etag string, body []byte) error {
+	_, err := db.Exec(`
+	INSERT INTO github_cache (endpoint, etag, body, updated_at) VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+	ON CONFLICT(endpoint) DO UPDATE SET etag = excluded.etag, body = excluded.body, updated_at = CURRENT_TIMESTAMP
+	`, endpoint, etag, body)
+	return err
+}
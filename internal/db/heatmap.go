@@ -0,0 +1,34 @@
+package db
+
+import (
+	"fmt"
+	"time"
+)
+
+// GetAdoptionCommitTimes returns when the adoption commit of each project
+// adopted in the last days days (0 = ever) was authored. Only projects whose
+// adoption date came from a commit are included. Trashed projects are left out.
+func (db *DB) GetAdoptionCommitTimes(days int) ([]time.Time, error) {
+	query := `SELECT adopted_at FROM projects
+	WHERE adopted_at IS NOT NULL AND COALESCE(adoption_commit, '') != '' AND deleted_at IS NULL`
+	var args []interface{}
+	if days > 0 {
+		query += ` AND adopted_at >= date('now', ?)`
+		args = append(args, fmt.Sprintf("-%d days", days))
+	}
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var times []time.Time
+	for rows.Next() {
+		var t time.Time
+		if err := rows.Scan(&t); err != nil {
+			return nil, err
+		}
+		times = append(times, t)
+	}
+	return times, rows.Err()
+}
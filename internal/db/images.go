@@ -0,0 +1,245 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ProjectImage is a DHI image a project's Dockerfile builds from
+type ProjectImage struct {
+	ProjectID int64     `json:"project_id"`
+	Image     string    `json:"image"`  // e.g. python for dhi.io/python:3.12
+	Tag       string    `json:"tag"`    // empty when pinned by digest only
+	Digest    string    `json:"digest"` // e.g. sha256:..., empty when not pinned
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ImageUsage counts the live (active, unarchived) projects using one DHI image
+type ImageUsage struct {
+	Image        string     `json:"image"`
+	Projects     int        `json:"projects"`
+	DigestPinned int        `json:"digest_pinned"` // projects pinning a digest
+	Tags         []TagUsage `json:"tags"`
+}
+
+// TagUsage counts the active projects using one tag of an image
+type TagUsage struct {
+	Tag      string `json:"tag"`
+	Projects int    `json:"projects"`
+}
+
+// Project image operations
+
+// SetProjectImages replaces the images recorded for a project
+func (db *DB) SetProjectImages(projectID int64, images []ProjectImage) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM project_images WHERE project_id = ?`, projectID); err != nil {
+		return err
+	}
+	for _, img := range images {
+		if _, err := tx.Exec(`INSERT OR IGNORE INTO project_images (project_id, image, tag, digest) VALUES (?, ?, ?, ?)`,
+			projectID, img.Image, img.Tag, img.Digest); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetProjectImages returns the images recorded for a project
+func (db *DB) GetProjectImages(projectID int64) ([]ProjectImage, error) {
+	rows, err := db.Query(`SELECT project_id, image, tag, digest, created_at FROM project_images WHERE project_id = ? ORDER BY image, tag`, projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var images []ProjectImage
+	for rows.Next() {
+		var img ProjectImage
+		if err := rows.Scan(&img.ProjectID, &img.Image, &img.Tag, &img.Digest, &img.CreatedAt); err != nil {
+			return nil, err
+		}
+		images = append(images, img)
+	}
+	return images, rows.Err()
+}
+
+// GetImageUsage returns every DHI image used by active projects with its project
+// count and per-tag counts, most used first
+func (db *DB) GetImageUsage() ([]ImageUsage, error) {
+	rows, err := db.Query(`
+	SELECT i.image, COUNT(DISTINCT i.project_id), COUNT(DISTINCT CASE WHEN i.digest != '' THEN i.project_id END)
+	FROM project_images i JOIN projects p ON p.id = i.project_id
+	WHERE p.status = 'active' AND p.archived = 0 AND p.deleted_at IS NULL
+	GROUP BY i.image
+	ORDER BY 2 DESC, i.image`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var usage []ImageUsage
+	index := make(map[string]int)
+	for rows.Next() {
+		var u ImageUsage
+		if err := rows.Scan(&u.Image, &u.Projects, &u.DigestPinned); err != nil {
+			return nil, err
+		}
+		u.Tags = []TagUsage{}
+		index[u.Image] = len(usage)
+		usage = append(usage, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	tagRows, err := db.Query(`
+	SELECT i.image, i.tag, COUNT(DISTINCT i.project_id)
+	FROM project_images i JOIN projects p ON p.id = i.project_id
+	WHERE p.status = 'active' AND p.archived = 0 AND p.deleted_at IS NULL AND i.tag != ''
+	GROUP BY i.image, i.tag
+	ORDER BY 3 DESC, i.tag`)
+	if err != nil {
+		return nil, err
+	}
+	defer tagRows.Close()
+
+	for tagRows.Next() {
+		var image string
+		var t TagUsage
+		if err := tagRows.Scan(&image, &t.Tag, &t.Projects); err != nil {
+			return nil, err
+		}
+		if i, ok := index[image]; ok {
+			usage[i].Tags = append(usage[i].Tags, t)
+		}
+	}
+	return usage, tagRows.Err()
+}
+
+// ImageRank is a DHI image's current usage across active projects
+type ImageRank struct {
+	Image    string `json:"image"`
+	Projects int    `json:"projects"`
+	Stars    int    `json:"stars"` // combined stars of the projects using it
+}
+
+// ImageTrendPoint is an image's usage as of one snapshot day
+type ImageTrendPoint struct {
+	Date     string `json:"date"`
+	Projects int    `json:"projects"`
+	Stars    int    `json:"stars"`
+}
+
+// imageRankQuery counts each image once per project, however many tags it uses
+const imageRankQuery = `
+	SELECT i.image, COUNT(*), COALESCE(SUM(p.stars), 0)
+	FROM (SELECT DISTINCT project_id, image FROM project_images) i
+	JOIN projects p ON p.id = i.project_id
+	WHERE p.status = 'active' AND p.archived = 0 AND p.deleted_at IS NULL
+	GROUP BY i.image`
+
+// GetTopImages returns the most used DHI images by project count, then stars
+func (db *DB) GetTopImages(limit int) ([]ImageRank, error) {
+	rows, err := db.Query(imageRankQuery+` ORDER BY 2 DESC, 3 DESC, i.image LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ranks []ImageRank
+	for rows.Next() {
+		var r ImageRank
+		if err := rows.Scan(&r.Image, &r.Projects, &r.Stars); err != nil {
+			return nil, err
+		}
+		ranks = append(ranks, r)
+	}
+	return ranks, rows.Err()
+}
+
+// recordImageSnapshot stores per-image usage alongside a refresh snapshot
+func recordImageSnapshot(tx *sql.Tx, snapshotID int64) error {
+	_, err := tx.Exec(`INSERT INTO image_snapshots (snapshot_id, image, projects, stars) SELECT ?, * FROM (`+imageRankQuery+`)`, snapshotID)
+	return err
+}
+
+// GetImageTrends returns daily usage of the given images over the last days days,
+// from the last snapshot of each day. Days on which an image wasn't used have
+// zero counts, so every image has a point for every snapshot day.
+func (db *DB) GetImageTrends(images []string, days int) (map[string][]ImageTrendPoint, error) {
+	trends := make(map[string][]ImageTrendPoint, len(images))
+	if len(images) == 0 {
+		return trends, nil
+	}
+
+	rows, err := db.Query(`
+	SELECT date(s.recorded_at), s.id FROM refresh_snapshots s
+	WHERE s.id IN (`+dailySnapshotIDs+`)
+	ORDER BY s.recorded_at`, fmt.Sprintf("-%d days", days))
+	if err != nil {
+		return nil, err
+	}
+	var dates []string
+	var ids []interface{}
+	for rows.Next() {
+		var date string
+		var id int64
+		if err := rows.Scan(&date, &id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		dates = append(dates, date)
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// usage[image][snapshot id]
+	usage := make(map[string]map[int64]ImageTrendPoint, len(images))
+	for _, image := range images {
+		usage[image] = make(map[int64]ImageTrendPoint)
+	}
+	if len(ids) > 0 {
+		rows, err := db.Query(`SELECT snapshot_id, image, projects, stars FROM image_snapshots WHERE snapshot_id IN (?`+
+			strings.Repeat(", ?", len(ids)-1)+`)`, ids...)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var id int64
+			var image string
+			var p ImageTrendPoint
+			if err := rows.Scan(&id, &image, &p.Projects, &p.Stars); err != nil {
+				return nil, err
+			}
+			if byID, ok := usage[image]; ok {
+				byID[id] = p
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, image := range images {
+		points := make([]ImageTrendPoint, len(dates))
+		for i, date := range dates {
+			p := usage[image][ids[i].(int64)]
+			p.Date = date
+			points[i] = p
+		}
+		trends[image] = points
+	}
+	return trends, nil
+}
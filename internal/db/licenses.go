@@ -0,0 +1,31 @@
+package db
+
+// LicenseCount is the number of live projects under one license
+type LicenseCount struct {
+	License  string `json:"license"` // SPDX identifier, "none" if GitHub detected no license
+	Projects int    `json:"projects"`
+	Stars    int    `json:"stars"`
+}
+
+// GetLicenseCounts counts live projects by license, most common first
+func (db *DB) GetLicenseCounts() ([]LicenseCount, error) {
+	rows, err := db.Query(`
+	SELECT CASE WHEN license = '' THEN 'none' ELSE license END AS l, COUNT(*), COALESCE(SUM(stars), 0)
+	FROM projects WHERE ` + liveProject + `
+	GROUP BY l
+	ORDER BY COUNT(*) DESC, l`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var counts []LicenseCount
+	for rows.Next() {
+		var c LicenseCount
+		if err := rows.Scan(&c.License, &c.Projects, &c.Stars); err != nil {
+			return nil, err
+		}
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
+}
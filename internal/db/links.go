@@ -0,0 +1,51 @@
+package db
+
+import "time"
+
+// ProjectLink is an external write-up of a project's DHI adoption (blog post,
+// case study, talk, ...) attached by an admin
+type ProjectLink struct {
+	ID        int64     `json:"id"`
+	ProjectID int64     `json:"project_id"`
+	Kind      string    `json:"kind"` // blog, case_study, talk, other
+	Title     string    `json:"title"`
+	URL       string    `json:"url"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AddProjectLink stores a link, setting its ID and CreatedAt
+func (db *DB) AddProjectLink(link *ProjectLink) error {
+	return db.QueryRow(`
+	INSERT INTO project_links (project_id, kind, title, url) VALUES (?, ?, ?, ?)
+	RETURNING id, created_at
+	`, link.ProjectID, link.Kind, link.Title, link.URL).Scan(&link.ID, &link.CreatedAt)
+}
+
+// GetProjectLinks returns a project's links, oldest first
+func (db *DB) GetProjectLinks(projectID int64) ([]ProjectLink, error) {
+	rows, err := db.Query(`SELECT id, project_id, kind, title, url, created_at FROM project_links WHERE project_id = ? ORDER BY id`, projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var links []ProjectLink
+	for rows.Next() {
+		var l ProjectLink
+		if err := rows.Scan(&l.ID, &l.ProjectID, &l.Kind, &l.Title, &l.URL, &l.CreatedAt); err != nil {
+			return nil, err
+		}
+		links = append(links, l)
+	}
+	return links, rows.Err()
+}
+
+// DeleteProjectLink removes a link. Reports whether it existed.
+func (db *DB) DeleteProjectLink(id int64) (bool, error) {
+	result, err := db.Exec(`DELETE FROM project_links WHERE id = ?`, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
@@ -0,0 +1,94 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Milestone is a round number an aggregate metric crossed, detected when a
+// snapshot is recorded. Each is reached once, even if the metric dips below
+// it and crosses it again.
+type Milestone struct {
+	ID         int64     `json:"id"`
+	Metric     string    `json:"metric"` // projects or stars
+	Threshold  int       `json:"threshold"`
+	Value      int       `json:"value"` // the metric at the snapshot that crossed it
+	SnapshotID int64     `json:"snapshot_id"`
+	ReachedAt  time.Time `json:"reached_at"`
+}
+
+// milestoneMetrics are the metrics with milestones, in the order they're
+// detected, and the first milestone of each. Every power of ten from there is
+// a milestone, and so are 2.5 and 5 times it: 100, 250, 500, 1000, ...
+var milestoneMetrics = []struct {
+	name  string
+	first int
+}{
+	{"projects", 100},
+	{"stars", 100000},
+}
+
+// milestoneThresholds returns the milestones of a metric at or below value
+func milestoneThresholds(first, value int) []int {
+	var thresholds []int
+	for base := first; base <= value; base *= 10 {
+		for _, t := range []int{base, base * 5 / 2, base * 5} {
+			if t <= value {
+				thresholds = append(thresholds, t)
+			}
+		}
+	}
+	return thresholds
+}
+
+// recordMilestones stores the milestones crossed by a snapshot's totals and
+// returns those not reached before
+func recordMilestones(tx *sql.Tx, snapshotID int64, values map[string]int) ([]Milestone, error) {
+	var reached []Milestone
+	for _, metric := range milestoneMetrics {
+		for _, threshold := range milestoneThresholds(metric.first, values[metric.name]) {
+			result, err := tx.Exec(`INSERT OR IGNORE INTO milestones (metric, threshold, value, snapshot_id) VALUES (?, ?, ?, ?)`,
+				metric.name, threshold, values[metric.name], snapshotID)
+			if err != nil {
+				return nil, fmt.Errorf("recording %s milestone %d: %w", metric.name, threshold, err)
+			}
+			if n, err := result.RowsAffected(); err != nil || n == 0 {
+				continue
+			}
+			id, err := result.LastInsertId()
+			if err != nil {
+				return nil, err
+			}
+			reached = append(reached, Milestone{
+				ID:         id,
+				Metric:     metric.name,
+				Threshold:  threshold,
+				Value:      values[metric.name],
+				SnapshotID: snapshotID,
+				ReachedAt:  time.Now().UTC(),
+			})
+		}
+	}
+	return reached, nil
+}
+
+// GetMilestones returns the milestones reached since a time, oldest first
+func (db *DB) GetMilestones(since time.Time) ([]Milestone, error) {
+	rows, err := db.Query(`SELECT id, metric, threshold, value, snapshot_id, reached_at FROM milestones
+	WHERE reached_at >= ? ORDER BY reached_at, metric, threshold`, since.UTC().Format("2006-01-02 15:04:05"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var milestones []Milestone
+	for rows.Next() {
+		var m Milestone
+		if err := rows.Scan(&m.ID, &m.Metric, &m.Threshold, &m.Value, &m.SnapshotID, &m.ReachedAt); err != nil {
+			return nil, err
+		}
+		milestones = append(milestones, m)
+	}
+	return milestones, rows.Err()
+}
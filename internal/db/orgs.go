@@ -0,0 +1,84 @@
+package db
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// OrgAdoption aggregates the live projects of one GitHub owner (or GitLab group)
+type OrgAdoption struct {
+	Org            string     `json:"org"` // owner on GitHub, host/group path on GitLab
+	Provider       string     `json:"provider"`
+	Repos          int        `json:"repos"`
+	Stars          int        `json:"stars"`
+	FirstAdoptedAt *time.Time `json:"first_adopted_at"`
+	Languages      []string   `json:"languages"` // most used first
+}
+
+// GetOrgAdoption groups live projects by owner, most starred first
+func (db *DB) GetOrgAdoption() ([]OrgAdoption, error) {
+	rows, err := db.Query(`SELECT repo_full_name, provider, stars, adopted_at, primary_language FROM projects WHERE ` + liveProject)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orgs := make(map[string]*OrgAdoption)
+	languages := make(map[string]map[string]int)
+	for rows.Next() {
+		var name, provider, language string
+		var stars int
+		var adoptedAt *time.Time
+		if err := rows.Scan(&name, &provider, &stars, &adoptedAt, &language); err != nil {
+			return nil, err
+		}
+		// The owner is everything before the repository name, so GitLab
+		// subgroups and the host prefix stay part of the org
+		i := strings.LastIndex(name, "/")
+		if i < 0 {
+			continue
+		}
+		org := orgs[name[:i]]
+		if org == nil {
+			org = &OrgAdoption{Org: name[:i], Provider: provider}
+			orgs[name[:i]] = org
+			languages[name[:i]] = make(map[string]int)
+		}
+		org.Repos++
+		org.Stars += stars
+		if adoptedAt != nil && (org.FirstAdoptedAt == nil || adoptedAt.Before(*org.FirstAdoptedAt)) {
+			org.FirstAdoptedAt = adoptedAt
+		}
+		if language != "" {
+			languages[name[:i]][language]++
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	result := make([]OrgAdoption, 0, len(orgs))
+	for name, org := range orgs {
+		counts := languages[name]
+		org.Languages = make([]string, 0, len(counts))
+		for l := range counts {
+			org.Languages = append(org.Languages, l)
+		}
+		sort.Slice(org.Languages, func(i, j int) bool {
+			a, b := org.Languages[i], org.Languages[j]
+			if counts[a] != counts[b] {
+				return counts[a] > counts[b]
+			}
+			return a < b
+		})
+		result = append(result, *org)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Stars != result[j].Stars {
+			return result[i].Stars > result[j].Stars
+		}
+		return result[i].Org < result[j].Org
+	})
+	return result, nil
+}
@@ -0,0 +1,83 @@
+package db
+
+import (
+	"time"
+)
+
+// OutboxEntry is a failed notification waiting to be retried. Its log entry
+// says how it went: pending while retries remain, then sent or failed.
+type OutboxEntry struct {
+	ID            int64
+	LogID         int64 // notification_logs entry of the first attempt
+	ConfigID      int64
+	Message       string // JSON of the message to send again
+	Attempts      int
+	NextAttemptAt time.Time
+	Status        string // pending, delivered or failed
+}
+
+// Outbox operations
+
+// CreateOutboxEntry schedules a retry of a logged delivery, setting e.ID
+func (db *DB) CreateOutboxEntry(e *OutboxEntry) error {
+	result, err := db.Exec(
+		`INSERT INTO notification_outbox (log_id, config_id, message, attempts, next_attempt_at, status, created_at, updated_at) VALUES (?, ?, ?, ?, ?, 'pending', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`,
+		e.LogID, e.ConfigID, e.Message, e.Attempts, e.NextAttemptAt.UTC(),
+	)
+	if err != nil {
+		return err
+	}
+	e.ID, err = result.LastInsertId()
+	return err
+}
+
+// DueOutboxEntries returns pending retries due by now, oldest first
+func (db *DB) DueOutboxEntries(now time.Time, limit int) ([]OutboxEntry, error) {
+	rows, err := db.Query(`
+	SELECT id, log_id, config_id, message, attempts, next_attempt_at, status
+	FROM notification_outbox
+	WHERE status = 'pending' AND next_attempt_at <= ?
+	ORDER BY next_attempt_at, id
+	LIMIT ?
+	`, now.UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []OutboxEntry
+	for rows.Next() {
+		var e OutboxEntry
+		if err := rows.Scan(&e.ID, &e.LogID, &e.ConfigID, &e.Message, &e.Attempts, &e.NextAttemptAt, &e.Status); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// RecordOutboxAttempt saves the outcome of a retry: e's attempts, status and
+// next attempt, with its log entry's status (sent once delivered) and error
+func (db *DB) RecordOutboxAttempt(e *OutboxEntry, errMsg string) error {
+	logStatus := e.Status
+	if logStatus == "delivered" {
+		logStatus = "sent"
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(
+		`UPDATE notification_outbox SET attempts = ?, next_attempt_at = ?, status = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`,
+		e.Attempts, e.NextAttemptAt.UTC(), e.Status, e.ID,
+	); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE notification_logs SET status = ?, error_message = ? WHERE id = ?`, logStatus, errMsg, e.LogID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,133 @@
+package db
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// PendingMessage is a notification held for manual approval before it is sent
+type PendingMessage struct {
+	ID           int64      `json:"id"`
+	ConfigID     int64      `json:"config_id"`
+	ProjectID    *int64     `json:"project_id"`
+	Subject      string     `json:"subject"`
+	Body         string     `json:"body"`
+	Status       string     `json:"status"` // pending, sending, sent, rejected, failed
+	ErrorMessage string     `json:"error_message"`
+	CreatedAt    time.Time  `json:"created_at"`
+	DecidedAt    *time.Time `json:"decided_at"`
+}
+
+// Pending message operations
+
+const pendingMessageColumns = `id, config_id, project_id, subject, body, status, error_message, created_at, decided_at`
+
+func scanPendingMessage(row scanner) (PendingMessage, error) {
+	var m PendingMessage
+	err := row.Scan(&m.ID, &m.ConfigID, &m.ProjectID, &m.Subject, &m.Body, &m.Status, &m.ErrorMessage, &m.CreatedAt, &m.DecidedAt)
+	return m, err
+}
+
+// HasNotified reports whether a config was already sent a new-project message
+// about a project, alone or in a summary, or has one queued for approval or
+// waiting to be retried
+func (db *DB) HasNotified(configID, projectID int64) (bool, error) {
+	var n int
+	err := db.QueryRow(`
+	SELECT (SELECT COUNT(*) FROM notified_projects WHERE config_id = ? AND project_id = ?)
+	     + (SELECT COUNT(*) FROM notification_logs WHERE config_id = ? AND project_id = ? AND status = 'pending')
+	     + (SELECT COUNT(*) FROM pending_messages WHERE config_id = ? AND project_id = ?)
+	`, configID, projectID, configID, projectID, configID, projectID).Scan(&n)
+	return n > 0, err
+}
+
+// MarkNotified records that a config was sent a new-project message about
+// each of projectIDs
+func (db *DB) MarkNotified(configID int64, projectIDs []int64) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, id := range projectIDs {
+		if _, err := tx.Exec(`INSERT OR IGNORE INTO notified_projects (config_id, project_id, notified_at) VALUES (?, ?, CURRENT_TIMESTAMP)`, configID, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// CreatePendingMessage queues a message for approval
+func (db *DB) CreatePendingMessage(m *PendingMessage) (int64, error) {
+	result, err := db.Exec(
+		`INSERT INTO pending_messages (config_id, project_id, subject, body, status, created_at) VALUES (?, ?, ?, ?, 'pending', CURRENT_TIMESTAMP)`,
+		m.ConfigID, m.ProjectID, m.Subject, m.Body,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// GetPendingMessage returns a queued message, or nil if not found
+func (db *DB) GetPendingMessage(id int64) (*PendingMessage, error) {
+	m, err := scanPendingMessage(db.QueryRow(`SELECT `+pendingMessageColumns+` FROM pending_messages WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// ListPendingMessages returns queued messages, oldest first, optionally filtered by status
+func (db *DB) ListPendingMessages(status string, limit int) ([]PendingMessage, error) {
+	query := `SELECT ` + pendingMessageColumns + ` FROM pending_messages`
+	args := []interface{}{}
+	if status != "" {
+		query += ` WHERE status = ?`
+		args = append(args, status)
+	}
+	query += ` ORDER BY created_at, id LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []PendingMessage
+	for rows.Next() {
+		m, err := scanPendingMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, m)
+	}
+	return messages, rows.Err()
+}
+
+// TransitionPendingMessage moves a message to status to if its current status is one
+// of from. It returns false if the message doesn't exist or was already moved, so
+// two reviewers can't both send the same message.
+func (db *DB) TransitionPendingMessage(id int64, from []string, to, errMsg string) (bool, error) {
+	args := []interface{}{to, errMsg, id}
+	for _, s := range from {
+		args = append(args, s)
+	}
+	result, err := db.Exec(
+		`UPDATE pending_messages SET status = ?, error_message = ?, decided_at = CURRENT_TIMESTAMP WHERE id = ? AND status IN (?`+strings.Repeat(", ?", len(from)-1)+`)`,
+		args...,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
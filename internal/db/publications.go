@@ -0,0 +1,65 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Publication is an adoption summary posted to an external target
+type Publication struct {
+	ID           int64     `json:"id"`
+	Period       string    `json:"period"` // e.g. "2026-W41"
+	Target       string    `json:"target"` // e.g. "discussion:owner/repo" or "file:owner/repo/ADOPTERS.md"
+	URL          string    `json:"url"`
+	ProjectCount int       `json:"project_count"`
+	PublishedAt  time.Time `json:"published_at"`
+}
+
+// Publication operations
+
+// GetPublication returns the publication for a period and target, or nil if none
+func (db *DB) GetPublication(period, target string) (*Publication, error) {
+	var p Publication
+	err := db.QueryRow(
+		`SELECT id, period, target, url, project_count, published_at FROM publications WHERE period = ? AND target = ?`,
+		period, target,
+	).Scan(&p.ID, &p.Period, &p.Target, &p.URL, &p.ProjectCount, &p.PublishedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// RecordPublication stores a publication, replacing any earlier one for the same period and target
+func (db *DB) RecordPublication(pub *Publication) error {
+	_, err := db.Exec(`
+	INSERT INTO publications (period, target, url, project_count, published_at) VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP)
+	ON CONFLICT(period, target) DO UPDATE SET url = excluded.url, project_count = excluded.project_count, published_at = CURRENT_TIMESTAMP
+	`, pub.Period, pub.Target, pub.URL, pub.ProjectCount)
+	return err
+}
+
+// ListPublications returns the most recent publications
+func (db *DB) ListPublications(limit int) ([]Publication, error) {
+	rows, err := db.Query(
+		`SELECT id, period, target, url, project_count, published_at FROM publications ORDER BY published_at DESC LIMIT ?`,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pubs []Publication
+	for rows.Next() {
+		var p Publication
+		if err := rows.Scan(&p.ID, &p.Period, &p.Target, &p.URL, &p.ProjectCount, &p.PublishedAt); err != nil {
+			return nil, err
+		}
+		pubs = append(pubs, p)
+	}
+	return pubs, rows.Err()
+}
@@ -0,0 +1,139 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// snapshotDimensions maps each dimension recorded in snapshot_details to its projects column
+var snapshotDimensions = map[string]string{
+	"source_type": "source_type",
+	"file_type":   "file_type",
+	"language":    "primary_language",
+	"provider":    "provider",
+}
+
+// dailySnapshotIDs selects the last snapshot of each day within a window given
+// as a date('now', ?) modifier such as "-30 days"
+const dailySnapshotIDs = `
+	SELECT MAX(id) FROM refresh_snapshots
+	WHERE recorded_at >= date('now', ?)
+	GROUP BY date(recorded_at)`
+
+// SnapshotSegment is the live project count and stars for one value of a
+// dimension (e.g. language = Go) as of one snapshot day
+type SnapshotSegment struct {
+	Date     string `json:"date"`
+	Value    string `json:"value"` // empty when the column wasn't set (e.g. no detected language)
+	Projects int    `json:"projects"`
+	Stars    int    `json:"stars"`
+}
+
+// IsSnapshotDimension reports whether segments are recorded for dimension
+func IsSnapshotDimension(dimension string) bool {
+	_, ok := snapshotDimensions[dimension]
+	return ok
+}
+
+// recordSnapshotDetails stores per-dimension counts of live projects alongside a refresh snapshot
+func recordSnapshotDetails(tx *sql.Tx, snapshotID int64) error {
+	for dimension, column := range snapshotDimensions {
+		_, err := tx.Exec(`INSERT INTO snapshot_details (snapshot_id, dimension, value, projects, stars)
+		SELECT ?, ?, COALESCE(`+column+`, ''), COUNT(*), COALESCE(SUM(stars), 0)
+		FROM projects WHERE `+liveProject+`
+		GROUP BY COALESCE(`+column+`, '')`, snapshotID, dimension)
+		if err != nil {
+			return fmt.Errorf("recording %s: %w", dimension, err)
+		}
+	}
+	return nil
+}
+
+// GetSnapshotSegments returns a dimension's per-value counts from the last
+// snapshot of each day over the last days days, oldest first
+func (db *DB) GetSnapshotSegments(dimension string, days int) ([]SnapshotSegment, error) {
+	if !IsSnapshotDimension(dimension) {
+		return nil, fmt.Errorf("unknown snapshot dimension %q", dimension)
+	}
+	rows, err := db.Query(`
+	SELECT date(s.recorded_at), d.value, d.projects, d.stars
+	FROM snapshot_details d JOIN refresh_snapshots s ON s.id = d.snapshot_id
+	WHERE d.dimension = ? AND s.id IN (`+dailySnapshotIDs+`)
+	ORDER BY s.recorded_at, d.projects DESC, d.value`, dimension, fmt.Sprintf("-%d days", days))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var segments []SnapshotSegment
+	for rows.Next() {
+		var s SnapshotSegment
+		if err := rows.Scan(&s.Date, &s.Value, &s.Projects, &s.Stars); err != nil {
+			return nil, err
+		}
+		segments = append(segments, s)
+	}
+	return segments, rows.Err()
+}
+
+// AdoptionBySegment is the number of live projects of one segment (e.g. source
+// type) adopted on a date, and the running total up to that date
+type AdoptionBySegment struct {
+	Date            string `json:"date"`
+	Value           string `json:"value"`
+	Count           int    `json:"count"`
+	CumulativeCount int    `json:"cumulative_count"`
+}
+
+// GetAdoptionBySegment returns daily adoptions over the last days days split by
+// source_type or file_type, oldest first. Cumulative counts include adoptions
+// before the window.
+func (db *DB) GetAdoptionBySegment(dimension string, days int) ([]AdoptionBySegment, error) {
+	if dimension != "source_type" && dimension != "file_type" {
+		return nil, fmt.Errorf("unknown adoption dimension %q", dimension)
+	}
+	since := fmt.Sprintf("-%d days", days)
+
+	// Running totals start from everything adopted before the window
+	totals := make(map[string]int)
+	rows, err := db.Query(`SELECT `+dimension+`, COUNT(*) FROM projects
+	WHERE `+liveProject+` AND adopted_at IS NOT NULL AND adopted_at < date('now', ?)
+	GROUP BY `+dimension, since)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var value string
+		var n int
+		if err := rows.Scan(&value, &n); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		totals[value] = n
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.Query(`SELECT date(adopted_at), `+dimension+`, COUNT(*) FROM projects
+	WHERE `+liveProject+` AND adopted_at IS NOT NULL AND adopted_at >= date('now', ?)
+	GROUP BY date(adopted_at), `+dimension+`
+	ORDER BY date(adopted_at), `+dimension, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []AdoptionBySegment
+	for rows.Next() {
+		var a AdoptionBySegment
+		if err := rows.Scan(&a.Date, &a.Value, &a.Count); err != nil {
+			return nil, err
+		}
+		totals[a.Value] += a.Count
+		a.CumulativeCount = totals[a.Value]
+		results = append(results, a)
+	}
+	return results, rows.Err()
+}
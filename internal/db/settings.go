@@ -0,0 +1,51 @@
+package db
+
+import "database/sql"
+
+// Settings operations
+
+// GetSetting returns the value for a key and whether it was set
+func (db *DB) GetSetting(key string) (string, bool, error) {
+	var value string
+	err := db.QueryRow(`SELECT value FROM settings WHERE key = ?`, key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return value, true, nil
+}
+
+// SetSetting creates or updates a setting
+func (db *DB) SetSetting(key, value string) error {
+	_, err := db.Exec(`
+	INSERT INTO settings (key, value, updated_at) VALUES (?, ?, CURRENT_TIMESTAMP)
+	ON CONFLICT(key) DO UPDATE SET value = excluded.value, updated_at = CURRENT_TIMESTAMP
+	`, key, value)
+	return err
+}
+
+func (db *DB) DeleteSetting(key string) error {
+	_, err := db.Exec(`DELETE FROM settings WHERE key = ?`, key)
+	return err
+}
+
+// ListSettings returns all settings as a key/value map
+func (db *DB) ListSettings() (map[string]string, error) {
+	rows, err := db.Query(`SELECT key, value FROM settings ORDER BY key`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	settings := make(map[string]string)
+	for rows.Next() {
+		var k, v string
+		if err := rows.Scan(&k, &v); err != nil {
+			return nil, err
+		}
+		settings[k] = v
+	}
+	return settings, rows.Err()
+}
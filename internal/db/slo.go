@@ -0,0 +1,64 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+)
+
+// FreshnessViolation is a period during which data was older than the freshness SLO
+type FreshnessViolation struct {
+	ID            int64      `json:"id"`
+	StartedAt     time.Time  `json:"started_at"`  // when the data crossed the SLO threshold
+	DetectedAt    time.Time  `json:"detected_at"` // when the monitor noticed
+	ResolvedAt    *time.Time `json:"resolved_at"`
+	LastRefreshAt *time.Time `json:"last_refresh_at"` // last successful refresh when the violation began
+}
+
+// Freshness violation operations
+
+func (db *DB) CreateFreshnessViolation(startedAt time.Time, lastRefreshAt *time.Time) (int64, error) {
+	result, err := db.Exec(`INSERT INTO freshness_violations (started_at, last_refresh_at) VALUES (?, ?)`, startedAt.UTC(), lastRefreshAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+func (db *DB) ResolveFreshnessViolation(id int64, resolvedAt time.Time) error {
+	_, err := db.Exec(`UPDATE freshness_violations SET resolved_at = ? WHERE id = ?`, resolvedAt.UTC(), id)
+	return err
+}
+
+// GetOpenFreshnessViolation returns the unresolved violation, or nil if data is within SLO
+func (db *DB) GetOpenFreshnessViolation() (*FreshnessViolation, error) {
+	row := db.QueryRow(`SELECT id, started_at, detected_at, resolved_at, last_refresh_at FROM freshness_violations WHERE resolved_at IS NULL ORDER BY started_at DESC LIMIT 1`)
+	var v FreshnessViolation
+	err := row.Scan(&v.ID, &v.StartedAt, &v.DetectedAt, &v.ResolvedAt, &v.LastRefreshAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// ListFreshnessViolations returns violations that overlap the period after since, most recent first
+func (db *DB) ListFreshnessViolations(since time.Time) ([]FreshnessViolation, error) {
+	rows, err := db.Query(`SELECT id, started_at, detected_at, resolved_at, last_refresh_at FROM freshness_violations
+		WHERE resolved_at IS NULL OR resolved_at > ? ORDER BY started_at DESC`, since.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var violations []FreshnessViolation
+	for rows.Next() {
+		var v FreshnessViolation
+		if err := rows.Scan(&v.ID, &v.StartedAt, &v.DetectedAt, &v.ResolvedAt, &v.LastRefreshAt); err != nil {
+			return nil, err
+		}
+		violations = append(violations, v)
+	}
+	return violations, rows.Err()
+}
@@ -0,0 +1,38 @@
+package db
+
+import "time"
+
+// GetStageRuns returns when an enrichment stage last ran for each project it
+// has run for, keyed by project ID
+func (db *DB) GetStageRuns(stage string) (map[int64]time.Time, error) {
+	rows, err := db.Query(`SELECT project_id, last_run_at FROM project_stage_runs WHERE stage = ?`, stage)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := make(map[int64]time.Time)
+	for rows.Next() {
+		var id int64
+		var at time.Time
+		if err := rows.Scan(&id, &at); err != nil {
+			return nil, err
+		}
+		runs[id] = at
+	}
+	return runs, rows.Err()
+}
+
+// RecordStageRun records that an enrichment stage has run for a project now
+func (db *DB) RecordStageRun(projectID int64, stage string) error {
+	_, err := db.Exec(`INSERT INTO project_stage_runs (project_id, stage, last_run_at) VALUES (?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(project_id, stage) DO UPDATE SET last_run_at = excluded.last_run_at`, projectID, stage)
+	return err
+}
+
+// GetLiveGitHubProjects returns live GitHub projects, most starred first
+func (db *DB) GetLiveGitHubProjects() ([]Project, error) {
+	return db.queryProjects(`SELECT ` + projectColumns + ` FROM projects
+	WHERE ` + liveProject + ` AND provider = 'github'
+	ORDER BY stars DESC`)
+}
@@ -0,0 +1,133 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// StarHistoryPoint is a project's star count as of one snapshot day
+type StarHistoryPoint struct {
+	Date     string `json:"date"`
+	Stars    int    `json:"stars"`
+	Imported bool   `json:"imported,omitempty"` // from the stargazer list, before the project was tracked
+}
+
+// recordStarHistory stores the star count of every active project alongside a
+// refresh snapshot. Archived projects are included, as their stars still change.
+func recordStarHistory(tx *sql.Tx, snapshotID int64) error {
+	_, err := tx.Exec(`INSERT INTO project_star_history (project_id, snapshot_id, stars)
+	SELECT id, ?, stars FROM projects WHERE status = 'active' AND deleted_at IS NULL`, snapshotID)
+	return err
+}
+
+// GetStarHistory returns a project's stars from the last snapshot of each day over
+// the last days days, oldest first. Days on which the project wasn't active are absent.
+// Days before the project's first snapshot come from imported star history, if any.
+func (db *DB) GetStarHistory(projectID int64, days int) ([]StarHistoryPoint, error) {
+	window := fmt.Sprintf("-%d days", days)
+	rows, err := db.Query(`
+	SELECT day, stars, 1 FROM project_star_imports
+	WHERE project_id = ? AND day >= date('now', ?) AND day < COALESCE((
+		SELECT MIN(date(s.recorded_at))
+		FROM project_star_history h JOIN refresh_snapshots s ON s.id = h.snapshot_id
+		WHERE h.project_id = ?), '9999-12-31')
+	UNION ALL
+	SELECT date(s.recorded_at), h.stars, 0
+	FROM project_star_history h JOIN refresh_snapshots s ON s.id = h.snapshot_id
+	WHERE h.project_id = ? AND s.id IN (`+dailySnapshotIDs+`)
+	ORDER BY 1`, projectID, window, projectID, projectID, window)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var points []StarHistoryPoint
+	for rows.Next() {
+		var p StarHistoryPoint
+		if err := rows.Scan(&p.Date, &p.Stars, &p.Imported); err != nil {
+			return nil, err
+		}
+		points = append(points, p)
+	}
+	return points, rows.Err()
+}
+
+// SetImportedStarHistory replaces a project's imported star history: its star
+// count at the end of each day, read from when its stargazers starred it
+func (db *DB) SetImportedStarHistory(projectID int64, points []StarHistoryPoint) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM project_star_imports WHERE project_id = ?`, projectID); err != nil {
+		return err
+	}
+	for _, p := range points {
+		if _, err := tx.Exec(`INSERT OR REPLACE INTO project_star_imports (project_id, day, stars) VALUES (?, ?, ?)`,
+			projectID, p.Date, p.Stars); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// AdoptionStars is a project adopted in a period with its stars then and now.
+// StarsAtAdoption is the last known count on or before the adoption day and
+// StarsAfterAdoption the first known count after it; either is nil when star
+// history (snapshots or imported) has none.
+type AdoptionStars struct {
+	ProjectID          int64
+	RepoFullName       string
+	Fork               bool
+	AdoptedAt          time.Time
+	Stars              int
+	StarsAtAdoption    *int
+	StarsAfterAdoption *int
+}
+
+// GetAdoptionStars returns the live projects adopted from since up to until
+// with their star counts around the adoption day, from snapshot star history
+// and imported star history (snapshots win on the same day)
+func (db *DB) GetAdoptionStars(since, until time.Time) ([]AdoptionStars, error) {
+	rows, err := db.Query(`
+	WITH points AS (
+		SELECT project_id, day, 0 AS tracked, '' AS at, stars FROM project_star_imports
+		UNION ALL
+		SELECT h.project_id, date(s.recorded_at), 1, s.recorded_at, h.stars
+		FROM project_star_history h JOIN refresh_snapshots s ON s.id = h.snapshot_id
+	)
+	SELECT id, repo_full_name, fork, adopted_at, stars,
+		(SELECT stars FROM points WHERE project_id = projects.id AND day <= date(projects.adopted_at)
+			ORDER BY day DESC, tracked DESC, at DESC LIMIT 1),
+		(SELECT stars FROM points WHERE project_id = projects.id AND day > date(projects.adopted_at)
+			ORDER BY day, tracked DESC, at LIMIT 1)
+	FROM projects
+	WHERE adopted_at IS NOT NULL AND adopted_at >= ? AND adopted_at < ? AND `+liveProject+`
+	ORDER BY adopted_at`, since, until)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var projects []AdoptionStars
+	for rows.Next() {
+		var p AdoptionStars
+		var at, after sql.NullInt64
+		if err := rows.Scan(&p.ProjectID, &p.RepoFullName, &p.Fork, &p.AdoptedAt, &p.Stars, &at, &after); err != nil {
+			return nil, err
+		}
+		if at.Valid {
+			n := int(at.Int64)
+			p.StarsAtAdoption = &n
+		}
+		if after.Valid {
+			n := int(after.Int64)
+			p.StarsAfterAdoption = &n
+		}
+		projects = append(projects, p)
+	}
+	return projects, rows.Err()
+}
@@ -0,0 +1,183 @@
+package db
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// ProjectStore persists tracked projects, their adoption data and aggregate snapshots
+type ProjectStore interface {
+	UpsertProject(p *Project) error
+	ListProjects(filter ProjectFilter) ([]Project, error)
+	EachProject(filter ProjectFilter, fn func(Project) error) error
+	GetProject(id int64) (*Project, error)
+	GetProjectByName(repoFullName string) (*Project, error)
+	CountProjects(filter ProjectFilter) (int, error)
+	GetSourceTypes() ([]string, error)
+	GetFileTypes() ([]string, error)
+	GetProviders() ([]string, error)
+	GetStats(excludeForks bool) (total int, totalStars int, popular int, notable int, err error)
+	GetNewProjectsSince(since time.Time) ([]Project, error)
+	GetNewProjectsCount(since time.Time) (int, error)
+	GetProjectsWithoutAdoptionDate() ([]Project, error)
+	UpdateProjectAdoption(id int64, adoptedAt time.Time, commitURL string) error
+	SetProjectVerification(id int64, status string) error
+	GetLiveGitHubProjects() ([]Project, error)
+	SetProjectCommitActivity(id int64, weeks []int) error
+	SetProjectEmployeeEngagement(id int64, stars, contributors int) error
+	GetStageRuns(stage string) (map[int64]time.Time, error)
+	RecordStageRun(projectID int64, stage string) error
+	SetFeaturedProjects(ids []int64) error
+	SetProjectAttribution(ids []int64, attribution string) error
+	SetProjectUseCases(useCases map[int64]string) error
+	SoftDeleteProjects(ids []int64) (int, error)
+	RestoreProjects(ids []int64) (int, error)
+	PurgeDeletedProjects(before time.Time) (int, error)
+	GetBreakdown(dimension string) ([]BreakdownCount, error)
+	AddProjectLink(link *ProjectLink) error
+	GetProjectLinks(projectID int64) ([]ProjectLink, error)
+	DeleteProjectLink(id int64) (bool, error)
+	MarkProjectMissed(id int64, threshold int) (bool, error)
+	MarkProjectDeleted(repoFullName string) (bool, error)
+	GetChurnStats() (ChurnStats, error)
+	GetForkStats() (ForkStats, error)
+	GetLicenseCounts() ([]LicenseCount, error)
+	GetOrgAdoption() ([]OrgAdoption, error)
+	SetProjectImages(projectID int64, images []ProjectImage) error
+	GetProjectImages(projectID int64) ([]ProjectImage, error)
+	GetImageUsage() ([]ImageUsage, error)
+	GetTopImages(limit int) ([]ImageRank, error)
+	GetImageTrends(images []string, days int) (map[string][]ImageTrendPoint, error)
+	GetAdoptionByDate(days int) ([]AdoptionByDate, error)
+	GetAdoptionCommitTimes(days int) ([]time.Time, error)
+	RecordSnapshot() ([]Milestone, error)
+	GetMilestones(since time.Time) ([]Milestone, error)
+	GetSnapshots(limit int) ([]RefreshSnapshot, error)
+	GetSnapshotBefore(t time.Time) (*RefreshSnapshot, error)
+	GetSnapshotProjects(snapshotID int64) ([]Project, error)
+	GetSnapshotSegments(dimension string, days int) ([]SnapshotSegment, error)
+	GetStarHistory(projectID int64, days int) ([]StarHistoryPoint, error)
+	SetImportedStarHistory(projectID int64, points []StarHistoryPoint) error
+	GetAdoptionStars(since, until time.Time) ([]AdoptionStars, error)
+	GetAdoptionBySegment(dimension string, days int) ([]AdoptionBySegment, error)
+	ReplaceAggregates(values map[string][]byte) error
+	GetAggregate(key string) ([]byte, error)
+}
+
+// JobStore persists refresh jobs and their reports
+type JobStore interface {
+	CreateRefreshJob() (int64, error)
+	StartRefreshJob(id int64) error
+	CompleteRefreshJob(id int64, projectsFound, sample int) error
+	FailRefreshJob(id int64, errMsg, failureCode, remediation string) error
+	InterruptRefreshJob(id int64, errMsg, remediation string) error
+	InterruptUnfinishedRefreshJobs(errMsg, remediation string) (int64, error)
+	GetRefreshJob(id int64) (*RefreshJob, error)
+	GetLatestRefreshJob() (*RefreshJob, error)
+	GetRunningRefreshJob() (*RefreshJob, error)
+	GetLastCompletedRefreshJob() (*RefreshJob, error)
+	UpdateRefreshProgress(id int64, p RefreshProgress) error
+	SaveRefreshReport(id int64, reportJSON string) error
+	SaveRefreshErrorCounts(id int64, counts map[string]int) error
+	ListRefreshJobs(limit int) ([]RefreshJob, error)
+	GetRefreshReport(id int64) (string, error)
+	SaveRefreshArchive(jobID int64, projects int, body []byte) error
+	GetRefreshArchive(jobID int64) (*RefreshArchive, error)
+	GetRefreshArchiveBefore(t time.Time) (*RefreshArchive, error)
+	PruneRefreshArchives(keep int) (int64, error)
+}
+
+// NotificationStore persists notification configs and delivery logs
+type NotificationStore interface {
+	CreateNotificationConfig(config *NotificationConfig) (int64, error)
+	UpdateNotificationConfig(config *NotificationConfig) error
+	UpdateNotificationConfigIfVersion(config *NotificationConfig, version int64) (bool, error)
+	DeleteNotificationConfig(id int64) error
+	GetNotificationConfig(id int64) (*NotificationConfig, error)
+	ListNotificationConfigs() ([]NotificationConfig, error)
+	GetEnabledNotificationConfigs() ([]NotificationConfig, error)
+	UpdateNotificationTriggered(configID int64) error
+	CreateNotificationLog(log *NotificationLog) error
+	GetNotificationLogs(configID int64, limit int) ([]NotificationLog, error)
+	GetNotificationLog(id int64) (*NotificationLog, error)
+	GetProjectNotifications(projectID int64, limit int) ([]ProjectNotification, error)
+	HasNotified(configID, projectID int64) (bool, error)
+	MarkNotified(configID int64, projectIDs []int64) error
+	CreatePendingMessage(m *PendingMessage) (int64, error)
+	GetPendingMessage(id int64) (*PendingMessage, error)
+	ListPendingMessages(status string, limit int) ([]PendingMessage, error)
+	TransitionPendingMessage(id int64, from []string, to, errMsg string) (bool, error)
+	CreateOutboxEntry(e *OutboxEntry) error
+	DueOutboxEntries(now time.Time, limit int) ([]OutboxEntry, error)
+	RecordOutboxAttempt(e *OutboxEntry, errMsg string) error
+}
+
+// SettingsStore persists free-form key/value settings
+type SettingsStore interface {
+	GetSetting(key string) (string, bool, error)
+	SetSetting(key, value string) error
+	DeleteSetting(key string) error
+	ListSettings() (map[string]string, error)
+}
+
+// FreshnessStore persists data freshness SLO violations
+type FreshnessStore interface {
+	CreateFreshnessViolation(startedAt time.Time, lastRefreshAt *time.Time) (int64, error)
+	ResolveFreshnessViolation(id int64, resolvedAt time.Time) error
+	GetOpenFreshnessViolation() (*FreshnessViolation, error)
+	ListFreshnessViolations(since time.Time) ([]FreshnessViolation, error)
+}
+
+// GitHubCacheStore persists GitHub response validators (ETags) and bodies between refreshes
+type GitHubCacheStore interface {
+	GetCachedResponse(endpoint string) (etag string, body []byte, ok bool, err error)
+	PutCachedResponse(endpoint, etag string, body []byte) error
+}
+
+// AvatarStore caches owner avatars served by the avatar proxy
+type AvatarStore interface {
+	GetAvatar(owner string, size int) (*Avatar, error)
+	PutAvatar(avatar *Avatar) error
+}
+
+// UsageStore counts API requests per consumer and endpoint
+type UsageStore interface {
+	RecordAPIUsage(usage []APIUsage) error
+	ListAPIUsage(consumer string) ([]APIUsage, error)
+}
+
+// PublicationStore records published adoption summaries so each period is posted once
+type PublicationStore interface {
+	GetPublication(period, target string) (*Publication, error)
+	RecordPublication(pub *Publication) error
+	ListPublications(limit int) ([]Publication, error)
+}
+
+// DumpStore moves projects, snapshots and adoption data between instances
+type DumpStore interface {
+	WriteDump(w io.Writer) error
+	ImportDump(r io.Reader) (map[string]int, error)
+}
+
+// Store is the full storage backend used by the server. *DB implements it on
+// SQLite; other backends can be added by implementing the same interfaces.
+type Store interface {
+	ProjectStore
+	JobStore
+	NotificationStore
+	SettingsStore
+	FreshnessStore
+	GitHubCacheStore
+	PublicationStore
+	AvatarStore
+	UsageStore
+	DumpStore
+
+	WithContext(ctx context.Context) Store
+	InTx(fn func(Store) error) error
+	PingContext(ctx context.Context) error
+	Close() error
+}
+
+var _ Store = (*DB)(nil)
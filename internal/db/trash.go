@@ -0,0 +1,51 @@
+package db
+
+import "time"
+
+// SoftDeleteProjects moves projects to the trash: they drop out of listings and
+// stats but keep their history until restored or purged. Returns how many were
+// moved, leaving out those already in the trash.
+func (db *DB) SoftDeleteProjects(ids []int64) (int, error) {
+	return db.setProjectsDeleted(ids, `UPDATE projects SET deleted_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND deleted_at IS NULL`)
+}
+
+// RestoreProjects takes projects out of the trash. Returns how many were restored.
+func (db *DB) RestoreProjects(ids []int64) (int, error) {
+	return db.setProjectsDeleted(ids, `UPDATE projects SET deleted_at = NULL, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND deleted_at IS NOT NULL`)
+}
+
+// setProjectsDeleted runs an update of one project per id in a transaction,
+// counting the rows changed
+func (db *DB) setProjectsDeleted(ids []int64, query string) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	changed := 0
+	for _, id := range ids {
+		result, err := tx.Exec(query, id)
+		if err != nil {
+			return 0, err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		changed += int(n)
+	}
+	return changed, tx.Commit()
+}
+
+// PurgeDeletedProjects permanently deletes projects in the trash since before
+// now, along with their images, star history and links. Notification logs
+// keep their entries without the project. Returns how many were purged.
+func (db *DB) PurgeDeletedProjects(before time.Time) (int, error) {
+	result, err := db.Exec(`DELETE FROM projects WHERE deleted_at IS NOT NULL AND deleted_at < ?`, before.UTC().Format("2006-01-02 15:04:05"))
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	return int(n), err
+}
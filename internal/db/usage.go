@@ -0,0 +1,64 @@
+package db
+
+import "time"
+
+// APIUsage counts one consumer's requests to one endpoint
+type APIUsage struct {
+	Consumer    string    `json:"consumer"` // API key name, or "anonymous"
+	Method      string    `json:"method"`
+	Endpoint    string    `json:"endpoint"` // route with IDs replaced, e.g. /api/projects/:id/stars
+	Version     int       `json:"version"`
+	Count       int64     `json:"count"`
+	FirstSeenAt time.Time `json:"first_seen_at"`
+	LastSeenAt  time.Time `json:"last_seen_at"`
+}
+
+// RecordAPIUsage adds request counts, widening each row's first/last seen times
+func (db *DB) RecordAPIUsage(usage []APIUsage) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, u := range usage {
+		if _, err := tx.Exec(`
+		INSERT INTO api_usage (consumer, method, endpoint, version, count, first_seen_at, last_seen_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(consumer, method, endpoint, version) DO UPDATE SET
+			count = api_usage.count + excluded.count,
+			first_seen_at = MIN(api_usage.first_seen_at, excluded.first_seen_at),
+			last_seen_at = MAX(api_usage.last_seen_at, excluded.last_seen_at)
+		`, u.Consumer, u.Method, u.Endpoint, u.Version, u.Count, u.FirstSeenAt.UTC(), u.LastSeenAt.UTC()); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ListAPIUsage returns usage counts by consumer and endpoint, optionally for one consumer
+func (db *DB) ListAPIUsage(consumer string) ([]APIUsage, error) {
+	query := `SELECT consumer, method, endpoint, version, count, first_seen_at, last_seen_at FROM api_usage`
+	var args []interface{}
+	if consumer != "" {
+		query += ` WHERE consumer = ?`
+		args = append(args, consumer)
+	}
+	query += ` ORDER BY consumer, endpoint, method, version`
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var usage []APIUsage
+	for rows.Next() {
+		var u APIUsage
+		if err := rows.Scan(&u.Consumer, &u.Method, &u.Endpoint, &u.Version, &u.Count, &u.FirstSeenAt, &u.LastSeenAt); err != nil {
+			return nil, err
+		}
+		usage = append(usage, u)
+	}
+	return usage, rows.Err()
+}
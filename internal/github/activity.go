@@ -0,0 +1,30 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+)
+
+// ErrStatsPending is returned while GitHub computes a repository's statistics
+// (a 202 response with no data); the request should be retried later
+var ErrStatsPending = errors.New("repository statistics are still being computed")
+
+// GetWeeklyCommits returns a repository's commit counts for each of the last 52
+// weeks, oldest first, from the participation statistics API
+func (c *Client) GetWeeklyCommits(ctx context.Context, repoFullName string) ([]int, error) {
+	body, err := c.doRequest(ctx, "GET", "/repos/"+repoFullName+"/stats/participation")
+	if err != nil {
+		return nil, err
+	}
+	var participation struct {
+		All []int `json:"all"`
+	}
+	if err := json.Unmarshal(body, &participation); err != nil {
+		return nil, err
+	}
+	if len(participation.All) == 0 {
+		return nil, ErrStatsPending
+	}
+	return participation.All, nil
+}
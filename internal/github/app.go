@@ -0,0 +1,188 @@
+package github
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"dhi-oss-usage/internal/logging"
+)
+
+const (
+	// appJWTLifetime is how long app JWTs are valid; GitHub allows at most 10 minutes
+	appJWTLifetime = 9 * time.Minute
+	// tokenRenewBefore renews an installation token this long before it expires
+	// (tokens last an hour), so a request never goes out with an expiring token
+	tokenRenewBefore = 5 * time.Minute
+)
+
+// AppAuth authenticates as a GitHub App installation. Installation tokens are
+// minted from a JWT signed with the app's private key and renewed before they expire.
+type AppAuth struct {
+	appID          int64
+	installationID int64 // 0 until discovered, if not configured
+	key            *rsa.PrivateKey
+	httpClient     *http.Client
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// NewAppAuth parses the app's PEM private key. installationID may be 0 when the
+// app has exactly one installation; it is then looked up on first use.
+func NewAppAuth(appID, installationID int64, privateKeyPEM []byte) (*AppAuth, error) {
+	if appID <= 0 {
+		return nil, fmt.Errorf("invalid GitHub App ID %d", appID)
+	}
+	key, err := parsePrivateKey(privateKeyPEM)
+	if err != nil {
+		return nil, err
+	}
+	return &AppAuth{
+		appID:          appID,
+		installationID: installationID,
+		key:            key,
+		httpClient:     &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+func parsePrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("GitHub App private key is not PEM encoded")
+	}
+	// GitHub issues PKCS#1 keys; accept PKCS#8 for keys converted by other tools
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing GitHub App private key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("GitHub App private key must be an RSA key")
+	}
+	return key, nil
+}
+
+// Token returns a valid installation token, minting a new one when the current
+// token is missing or about to expire
+func (a *AppAuth) Token(ctx context.Context) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.token != "" && time.Until(a.expires) > tokenRenewBefore {
+		return a.token, nil
+	}
+
+	jwt, err := a.jwt()
+	if err != nil {
+		return "", err
+	}
+	if a.installationID == 0 {
+		if a.installationID, err = a.findInstallation(ctx, jwt); err != nil {
+			return "", err
+		}
+	}
+
+	body, err := a.appRequest(ctx, "POST", fmt.Sprintf("/app/installations/%d/access_tokens", a.installationID), jwt)
+	if err != nil {
+		return "", fmt.Errorf("creating installation token: %w", err)
+	}
+	var result struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", fmt.Errorf("parsing installation token: %w", err)
+	}
+	a.token, a.expires = result.Token, result.ExpiresAt
+	logging.Refresh.Ctx(ctx).Infof("Renewed GitHub App installation token (expires %s)", a.expires.Format(time.RFC3339))
+	return a.token, nil
+}
+
+// findInstallation returns the app's only installation
+func (a *AppAuth) findInstallation(ctx context.Context, jwt string) (int64, error) {
+	body, err := a.appRequest(ctx, "GET", "/app/installations", jwt)
+	if err != nil {
+		return 0, fmt.Errorf("listing app installations: %w", err)
+	}
+	var installations []struct {
+		ID      int64 `json:"id"`
+		Account struct {
+			Login string `json:"login"`
+		} `json:"account"`
+	}
+	if err := json.Unmarshal(body, &installations); err != nil {
+		return 0, fmt.Errorf("parsing app installations: %w", err)
+	}
+	if len(installations) != 1 {
+		return 0, fmt.Errorf("GitHub App has %d installations; set the installation ID", len(installations))
+	}
+	logging.Refresh.Ctx(ctx).Infof("Using GitHub App installation %d (%s)", installations[0].ID, installations[0].Account.Login)
+	return installations[0].ID, nil
+}
+
+// appRequest calls an /app endpoint authenticated with the app JWT. These don't
+// count against the installation's rate limit, so they skip the core limiter.
+func (a *AppAuth) appRequest(ctx context.Context, method, endpoint, jwt string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, baseURL+endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+jwt)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+
+	resp, err := a.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("API error %d: %s", resp.StatusCode, string(body))
+	}
+	return body, nil
+}
+
+// jwt signs a short-lived RS256 token identifying the app. iat is backdated a
+// minute to allow for clock drift, as GitHub recommends.
+func (a *AppAuth) jwt() (string, error) {
+	now := time.Now()
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`))
+	claims, err := json.Marshal(map[string]interface{}{
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(appJWTLifetime).Unix(),
+		"iss": strconv.FormatInt(a.appID, 10),
+	})
+	if err != nil {
+		return "", err
+	}
+	signingInput := header + "." + base64.RawURLEncoding.EncodeToString(claims)
+
+	digest := sha256.Sum256([]byte(signingInput))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, a.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("signing GitHub App JWT: %w", err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
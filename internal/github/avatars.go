@@ -0,0 +1,47 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// avatarURL serves GitHub owner avatars; it isn't part of the API, so requests
+// need no token and don't count against the rate limit
+const avatarURL = "https://avatars.githubusercontent.com/"
+
+// maxAvatarBytes bounds how much of an avatar response is read
+const maxAvatarBytes = 1 << 20
+
+// GetAvatar fetches an owner's avatar resized to size pixels, returning the image
+// and its content type
+func (c *Client) GetAvatar(ctx context.Context, owner string, size int) ([]byte, string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s%s?s=%d", avatarURL, url.PathEscape(owner), size), nil)
+	if err != nil {
+		return nil, "", err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("avatar error %d for %s", resp.StatusCode, owner)
+	}
+	contentType := resp.Header.Get("Content-Type")
+	if !strings.HasPrefix(contentType, "image/") {
+		return nil, "", fmt.Errorf("avatar for %s has content type %q", owner, contentType)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxAvatarBytes+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if len(body) > maxAvatarBytes {
+		return nil, "", fmt.Errorf("avatar for %s is larger than %d bytes", owner, maxAvatarBytes)
+	}
+	return body, contentType, nil
+}
@@ -1,15 +1,23 @@
 package github
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"net"
 	"net/http"
 	"net/url"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+
+	"dhi-oss-usage/internal/logging"
 )
 
 const (
@@ -18,19 +26,134 @@ const (
 )
 
 type Client struct {
-	token      string
-	httpClient *http.Client
+	tokens      *tokenPool // personal access tokens, rotated by remaining quota
+	app         *AppAuth   // authenticates as an App installation instead of tokens
+	httpClient  *http.Client
+	coreLimiter *rateLimiter // shared by all non-search REST calls
+	concurrency int
+	useGraphQL  bool // batch repo details through GraphQL, falling back to REST
+
+	discoveryTopics []string // repo topics checked for DHI alongside code search
+
+	coreRequests    int64 // REST requests made, for rate limit accounting
+	searchRequests  int64 // code search requests made
+	graphqlRequests int64 // GraphQL queries made
+
+	quotaMu sync.Mutex
+	quotas  map[string]RateLimitStatus // by X-RateLimit-Resource
+
+	cache       ResponseCache // optional ETag cache for conditional requests
+	notModified int64         // conditional requests answered with 304
+}
+
+// ResponseCache persists ETags and response bodies so unchanged resources can be
+// revalidated with If-None-Match. 304 responses don't count against the rate limit.
+type ResponseCache interface {
+	GetCachedResponse(endpoint string) (etag string, body []byte, ok bool, err error)
+	PutCachedResponse(endpoint, etag string, body []byte) error
 }
 
 func NewClient(token string) *Client {
 	return &Client{
-		token: token,
+		tokens: newTokenPool([]string{token}),
 		httpClient: &http.Client{
 			Timeout: 30 * time.Second,
 		},
+		coreLimiter: newRateLimiter(coreRatePerHour, coreBurst),
+		concurrency: defaultConcurrency,
+		useGraphQL:  true,
+	}
+}
+
+// SetAppAuth authenticates as a GitHub App installation instead of with the token.
+// Installation tokens are renewed automatically before they expire.
+func (c *Client) SetAppAuth(app *AppAuth) {
+	c.app = app
+}
+
+// SetTokens replaces the client's token with several tokens. Each request uses the
+// token with the most quota left for its resource.
+func (c *Client) SetTokens(tokens []string) {
+	c.tokens = newTokenPool(tokens)
+}
+
+// TokenStatuses returns the quota last seen for each token when rotating several
+func (c *Client) TokenStatuses() []TokenStatus {
+	if c.app != nil || c.tokens.size() < 2 {
+		return nil
+	}
+	return c.tokens.status()
+}
+
+// AuthMode reports how the client authenticates: "app", "tokens", "token" or "none"
+func (c *Client) AuthMode() string {
+	switch {
+	case c.app != nil:
+		return "app"
+	case c.tokens.size() > 1:
+		return "tokens"
+	case c.tokens.size() == 1:
+		return "token"
+	default:
+		return "none"
 	}
 }
 
+// tokenCount is the number of independent rate limit budgets the client draws from
+func (c *Client) tokenCount() int {
+	if c.app != nil || c.tokens.size() < 1 {
+		return 1
+	}
+	return c.tokens.size()
+}
+
+// searchDelay paces code search pages; each token has its own search limit
+func (c *Client) searchDelay() time.Duration {
+	return searchRateDelay / time.Duration(c.tokenCount())
+}
+
+// authorization returns the Authorization header value for a request charged to
+// resource, and the index of the pool token used (-1 for App auth or no token)
+func (c *Client) authorization(ctx context.Context, resource string) (string, int, error) {
+	if c.app == nil {
+		tok, value := c.tokens.pick(resource)
+		return "Bearer " + value, tok, nil
+	}
+	token, err := c.app.Token(ctx)
+	if err != nil {
+		return "", -1, fmt.Errorf("GitHub App authentication: %w", err)
+	}
+	return "Bearer " + token, -1, nil
+}
+
+// SetResponseCache enables conditional requests for repo details using cache
+func (c *Client) SetResponseCache(cache ResponseCache) {
+	c.cache = cache
+}
+
+// NotModifiedCount returns the number of conditional requests answered from the cache
+func (c *Client) NotModifiedCount() int64 {
+	return atomic.LoadInt64(&c.notModified)
+}
+
+// SetGraphQL enables or disables batched GraphQL fetching of repo details
+func (c *Client) SetGraphQL(enabled bool) {
+	c.useGraphQL = enabled
+}
+
+// SetConcurrency sets the number of parallel workers used for per-repo API calls
+func (c *Client) SetConcurrency(n int) {
+	if n < 1 {
+		n = 1
+	}
+	c.concurrency = n
+}
+
+// RequestCounts returns the number of core REST and code search requests made so far
+func (c *Client) RequestCounts() (core, search int64) {
+	return atomic.LoadInt64(&c.coreRequests), atomic.LoadInt64(&c.searchRequests)
+}
+
 // CodeSearchResult represents a single code search hit
 type CodeSearchResult struct {
 	Path       string `json:"path"`
@@ -49,11 +172,26 @@ type CodeSearchResponse struct {
 
 // RepoDetails represents repository metadata
 type RepoDetails struct {
-	FullName        string `json:"full_name"`
-	HTMLURL         string `json:"html_url"`
-	Description     string `json:"description"`
-	StargazersCount int    `json:"stargazers_count"`
-	Language        string `json:"language"`
+	FullName        string       `json:"full_name"`
+	HTMLURL         string       `json:"html_url"`
+	Description     string       `json:"description"`
+	StargazersCount int          `json:"stargazers_count"`
+	Language        string       `json:"language"`
+	License         *RepoLicense `json:"license"`
+	Archived        bool         `json:"archived"`
+	Fork            bool         `json:"fork"`
+	Parent          *RepoParent  `json:"parent"` // set for forks
+	Topics          []string     `json:"topics"`
+}
+
+// RepoParent is the repository a fork was created from
+type RepoParent struct {
+	FullName string `json:"full_name"`
+}
+
+// RepoLicense is the license GitHub detected for a repository
+type RepoLicense struct {
+	SPDXID string `json:"spdx_id"`
 }
 
 // Project combines search result with repo details
@@ -63,42 +201,124 @@ type Project struct {
 	Stars           int
 	Description     string
 	PrimaryLanguage string
+	License         string // SPDX identifier, empty if none detected
+	Topics          []string
 	DockerfilePath  string
 	FileURL         string
 	SourceType      string
+	FileType        string
+	Archived        bool
+	Fork            bool
+	ForkParent      string // repository the fork was created from
 }
 
 func (c *Client) doRequest(ctx context.Context, method, endpoint string) ([]byte, error) {
-	req, err := http.NewRequestWithContext(ctx, method, baseURL+endpoint, nil)
+	body, _, err := c.doRequestWithHeaders(ctx, method, endpoint)
+	return body, err
+}
+
+// doRequestWithHeaders is doRequest that also returns the response headers (e.g. for Link pagination)
+func (c *Client) doRequestWithHeaders(ctx context.Context, method, endpoint string) ([]byte, http.Header, error) {
+	body, headers, _, err := c.doConditionalRequest(ctx, method, endpoint, "")
+	return body, headers, err
+}
+
+// doConditionalRequest sends If-None-Match when etag is set. A 304 response returns
+// notModified with a nil body; the caller should use its cached copy.
+func (c *Client) doConditionalRequest(ctx context.Context, method, endpoint, etag string) (body []byte, headers http.Header, notModified bool, err error) {
+	return c.send(ctx, method, endpoint, nil, etag)
+}
+
+// send performs a REST request with an optional JSON payload and If-None-Match etag
+func (c *Client) send(ctx context.Context, method, endpoint string, payload []byte, etag string) (body []byte, headers http.Header, notModified bool, err error) {
+	// Code search has its own, much lower limit and is paced by searchRateDelay
+	if !strings.HasPrefix(endpoint, "/search/") {
+		if err := c.coreLimiter.Wait(ctx); err != nil {
+			return nil, nil, false, err
+		}
+	}
+
+	var reqBody io.Reader
+	if payload != nil {
+		reqBody = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, baseURL+endpoint, reqBody)
 	if err != nil {
-		return nil, err
+		return nil, nil, false, err
+	}
+
+	if strings.HasPrefix(endpoint, "/search/") {
+		atomic.AddInt64(&c.searchRequests, 1)
+	} else {
+		atomic.AddInt64(&c.coreRequests, 1)
 	}
 
-	req.Header.Set("Authorization", "Bearer "+c.token)
-	req.Header.Set("Accept", "application/vnd.github+json")
+	auth, tok, err := c.authorization(ctx, requestResource(endpoint))
+	if err != nil {
+		return nil, nil, false, err
+	}
+	req.Header.Set("Authorization", auth)
+	req.Header.Set("Accept", acceptHeader(endpoint))
 	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return nil, err
+		return nil, nil, false, err
 	}
 	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	body, err = io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, err
+		return nil, nil, false, err
+	}
+
+	resource, quota, hasQuota := c.recordQuota(resp.Header, tok)
+	if resource == "" {
+		resource = requestResource(endpoint)
+	}
+	isSearch := strings.HasPrefix(endpoint, "/search/")
+	if resource == "core" && quota.Limit > 0 {
+		// App installations get 5,000/hr or more depending on org size; pace to what GitHub reports
+		c.coreLimiter.SetRate(quota.Limit * c.tokenCount())
 	}
 
-	if resp.StatusCode == 403 {
-		// Rate limited - check headers
-		return nil, fmt.Errorf("rate limited: %s", string(body))
+	if isRateLimited(resp.StatusCode, resp.Header, body) {
+		wait := rateLimitDelay(resp.Header, quota, hasQuota)
+		if c.tokens.exhaust(tok, resource, wait) {
+			// Another token still has quota: retry on it rather than pausing
+			return nil, nil, false, &RateLimitError{Resource: resource, RetryAfter: tokenSwitchDelay, Message: string(body)}
+		}
+		// Rate limited - pause every worker sharing this client until GitHub says to retry
+		if !isSearch {
+			c.coreLimiter.Backoff(wait)
+		}
+		return nil, nil, false, &RateLimitError{Resource: resource, RetryAfter: wait, Message: string(body)}
 	}
 
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("API error %d: %s", resp.StatusCode, string(body))
+	// Out of quota: hold off core requests until the window resets rather than
+	// spending the next one on a guaranteed 403
+	if hasQuota && quota.Remaining == 0 && !isSearch && (tok < 0 || !c.tokens.available(resource)) {
+		c.coreLimiter.Backoff(rateLimitDelay(resp.Header, quota, hasQuota))
 	}
 
-	return body, nil
+	if resp.StatusCode == http.StatusNotModified && etag != "" {
+		// Not charged against the rate limit, so give the token back
+		c.coreLimiter.Refund()
+		atomic.AddInt64(&c.notModified, 1)
+		return nil, resp.Header, true, nil
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, nil, false, fmt.Errorf("API error %d: %s", resp.StatusCode, string(body))
+	}
+
+	return body, resp.Header, false, nil
 }
 
 // SearchQuery represents a single search query configuration
@@ -114,6 +334,11 @@ func GetSearchQueries() []SearchQuery {
 		// FROM dhi.io in actual Dockerfiles (not docs/READMEs)
 		// filename:Dockerfile is a substring match, so catches Dockerfile.dev, app.Dockerfile, etc.
 		{"Dockerfiles", `"FROM dhi.io" filename:Dockerfile`},
+		// Compose files: filename:compose matches docker-compose.yml, compose.yaml, etc.
+		// Listed before the general YAML query so these are labelled as Compose
+		{"Docker Compose", `"image: dhi.io/" filename:compose`},
+		// Helm values set the registry separately from the tag, e.g. repository: dhi.io/python
+		{"Helm", `"dhi.io/" filename:values language:YAML`},
 		// image: dhi.io/ - K8s/docker-compose image references with trailing slash
 		// The "image: " prefix distinguishes from URLs like siddhi.io
 		{"YAML/K8s", `"image: dhi.io/" language:YAML`},
@@ -128,87 +353,198 @@ type SearchResult struct {
 	FilePath     string
 	FileURL      string
 	SourceType   string // e.g., "Dockerfile", "YAML", "GitHub Actions"
+	FileType     string // see ClassifyFileType
+}
+
+// ClassifyFileType buckets the file DHI was found in by its path:
+// dockerfile, compose, helm, kubernetes, github_actions, gitlab_ci or other
+func ClassifyFileType(path string) string {
+	lower := strings.ToLower(path)
+	base := lower[strings.LastIndex(lower, "/")+1:]
+	isYAML := strings.HasSuffix(base, ".yml") || strings.HasSuffix(base, ".yaml")
+	switch {
+	case strings.Contains(base, "dockerfile") || strings.HasSuffix(base, ".containerfile") || base == "containerfile":
+		return "dockerfile"
+	case strings.HasPrefix(lower, ".github/workflows/") || strings.Contains(lower, "/.github/workflows/"):
+		return "github_actions"
+	case base == ".gitlab-ci.yml":
+		return "gitlab_ci"
+	case isYAML && strings.Contains(base, "compose"):
+		return "compose"
+	case isYAML && (strings.HasPrefix(base, "values") || strings.Contains(lower, "/charts/") || strings.HasPrefix(lower, "charts/")):
+		return "helm"
+	case isYAML:
+		return "kubernetes"
+	default:
+		return "other"
+	}
+}
+
+const (
+	// searchResultCap is the most results GitHub code search returns for one query (10 pages of 100)
+	searchResultCap = 1000
+	// maxIndexedFileSize is the largest file GitHub code search indexes, in bytes
+	maxIndexedFileSize = 384 * 1024
+)
+
+// sizeRange is an inclusive file size range used to segment a code search
+type sizeRange struct {
+	lo, hi int
 }
 
 // SearchDHIUsage searches for dhi.io references across multiple file types
-// Returns unique repos found with their file paths
+// Returns unique repos found with their file paths.
+// GitHub returns at most 1000 results per query, so a query that matches more is
+// split into file size ranges (size:lo..hi), bisecting until each range fits.
 func (c *Client) SearchDHIUsage(ctx context.Context, progressFn func(queryName string, found int, page int)) (map[string]SearchResult, error) {
 	repos := make(map[string]SearchResult) // repo full name -> search result
 	queries := GetSearchQueries()
 
 	for _, sq := range queries {
-		log.Printf("Starting search: %s", sq.Name)
-		page := 1
-		perPage := 100
-
-		for {
-			select {
-			case <-ctx.Done():
-				return repos, ctx.Err()
-			default:
-			}
+		logging.Refresh.Ctx(ctx).Infof("Starting search: %s", sq.Name)
 
-			query := url.QueryEscape(sq.Query)
-			endpoint := fmt.Sprintf("/search/code?q=%s&per_page=%d&page=%d", query, perPage, page)
-
-			log.Printf("[%s] Searching page %d...", sq.Name, page)
-			body, err := c.doRequest(ctx, "GET", endpoint)
-			if err != nil {
-				// If rate limited, wait and retry
-				if strings.Contains(err.Error(), "rate limited") {
-					log.Printf("Rate limited, waiting 60s...")
-					time.Sleep(60 * time.Second)
-					continue
-				}
-				return repos, err
-			}
+		total, err := c.searchPages(ctx, sq, sq.Query, true, repos, progressFn)
+		if err != nil {
+			return repos, err
+		}
 
-			var searchResp CodeSearchResponse
-			if err := json.Unmarshal(body, &searchResp); err != nil {
-				return repos, err
-			}
+		if total > searchResultCap {
+			logging.Refresh.Ctx(ctx).Infof("[%s] %d results exceed the %d cap, segmenting by file size", sq.Name, total, searchResultCap)
+			segments := []sizeRange{{0, maxIndexedFileSize}}
+			for len(segments) > 0 {
+				seg := segments[0]
+				segments = segments[1:]
 
-			for _, item := range searchResp.Items {
-				if _, exists := repos[item.Repository.FullName]; !exists {
-					fileURL := fmt.Sprintf("https://github.com/%s/blob/HEAD/%s", item.Repository.FullName, item.Path)
-					repos[item.Repository.FullName] = SearchResult{
-						RepoFullName: item.Repository.FullName,
-						FilePath:     item.Path,
-						FileURL:      fileURL,
-						SourceType:   sq.Name,
-					}
+				query := fmt.Sprintf("%s size:%d..%d", sq.Query, seg.lo, seg.hi)
+				canSplit := seg.hi > seg.lo
+				total, err := c.searchPages(ctx, sq, query, canSplit, repos, progressFn)
+				if err != nil {
+					return repos, err
+				}
+				if total > searchResultCap && canSplit {
+					mid := seg.lo + (seg.hi-seg.lo)/2
+					segments = append(segments, sizeRange{seg.lo, mid}, sizeRange{mid + 1, seg.hi})
+					logging.Refresh.Ctx(ctx).Infof("[%s] size:%d..%d has %d results, splitting", sq.Name, seg.lo, seg.hi, total)
+				} else if total > searchResultCap {
+					logging.Refresh.Ctx(ctx).Warnf("[%s] size:%d..%d has %d results and can't be split further; some repos will be missed", sq.Name, seg.lo, seg.hi, total)
 				}
 			}
+		}
 
-			if progressFn != nil {
-				progressFn(sq.Name, len(repos), page)
-			}
+		logging.Refresh.Ctx(ctx).Infof("[%s] Done, total unique repos: %d", sq.Name, len(repos))
+	}
 
-			log.Printf("[%s] Page %d: found %d items, total unique repos: %d", sq.Name, page, len(searchResp.Items), len(repos))
+	return repos, nil
+}
 
-			// Check if we've got all results
-			if len(searchResp.Items) < perPage || page*perPage >= searchResp.TotalCount {
-				break
-			}
+// searchPages runs one code search query page by page, merging hits into repos,
+// and returns the query's total_count. If stopOverCap is set and the total exceeds
+// searchResultCap, it stops after the first page so the caller can segment instead.
+func (c *Client) searchPages(ctx context.Context, sq SearchQuery, query string, stopOverCap bool, repos map[string]SearchResult, progressFn func(queryName string, found int, page int)) (int, error) {
+	page := 1
+	perPage := 100
+
+	for {
+		searchResp, err := c.searchPage(ctx, sq, query, page, perPage, repos)
+		if err != nil {
+			return 0, err
+		}
+
+		if progressFn != nil {
+			progressFn(sq.Name, len(repos), page)
+		}
+
+		logging.Refresh.Ctx(ctx).Debugf("[%s] Page %d: found %d items, total unique repos: %d", sq.Name, page, len(searchResp.Items), len(repos))
+
+		// Rate limit delay for code search
+		time.Sleep(c.searchDelay())
 
-			// GitHub only returns first 1000 results per query
-			if page >= 10 {
-				log.Printf("[%s] Reached GitHub's 1000 result limit", sq.Name)
-				break
+		if stopOverCap && searchResp.TotalCount > searchResultCap {
+			return searchResp.TotalCount, nil
+		}
+
+		// Check if we've got all results
+		if len(searchResp.Items) < perPage || page*perPage >= searchResp.TotalCount {
+			return searchResp.TotalCount, nil
+		}
+
+		// GitHub only returns first 1000 results per query
+		if page*perPage >= searchResultCap {
+			logging.Refresh.Ctx(ctx).Infof("[%s] Reached GitHub's 1000 result limit", sq.Name)
+			return searchResp.TotalCount, nil
+		}
+
+		page++
+	}
+}
+
+// searchPage fetches one page of a code search query, waiting out rate limits,
+// and merges hits for repos not yet seen into repos
+func (c *Client) searchPage(ctx context.Context, sq SearchQuery, query string, page, perPage int, repos map[string]SearchResult) (*CodeSearchResponse, error) {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+
+		endpoint := fmt.Sprintf("/search/code?q=%s&per_page=%d&page=%d", url.QueryEscape(query), perPage, page)
+
+		logging.Refresh.Ctx(ctx).Debugf("[%s] Searching page %d...", sq.Name, page)
+		body, err := c.doRequest(ctx, "GET", endpoint)
+		if err != nil {
+			// If rate limited, wait until GitHub allows it and retry
+			if strings.Contains(err.Error(), "rate limited") {
+				if err := waitForRateLimit(ctx, err); err != nil {
+					return nil, err
+				}
+				continue
 			}
+			return nil, err
+		}
 
-			page++
-			// Rate limit delay for code search
-			time.Sleep(searchRateDelay)
+		var searchResp CodeSearchResponse
+		if err := json.Unmarshal(body, &searchResp); err != nil {
+			return nil, err
 		}
 
-		// Delay between different search queries
-		time.Sleep(searchRateDelay)
+		for _, item := range searchResp.Items {
+			if _, exists := repos[item.Repository.FullName]; !exists {
+				fileURL := fmt.Sprintf("https://github.com/%s/blob/HEAD/%s", item.Repository.FullName, item.Path)
+				repos[item.Repository.FullName] = SearchResult{
+					RepoFullName: item.Repository.FullName,
+					FilePath:     item.Path,
+					FileURL:      fileURL,
+					SourceType:   sq.Name,
+					FileType:     ClassifyFileType(item.Path),
+				}
+			}
+		}
+		return &searchResp, nil
 	}
+}
 
+// SearchDHISample runs the first page of each search query until n repos are
+// found. It takes one search request per query, for quick smoke refreshes.
+func (c *Client) SearchDHISample(ctx context.Context, n int) (map[string]SearchResult, error) {
+	repos := make(map[string]SearchResult)
+	for _, sq := range GetSearchQueries() {
+		if len(repos) >= n {
+			break
+		}
+		if _, err := c.searchPage(ctx, sq, sq.Query, 1, min(n, 100), repos); err != nil {
+			return repos, err
+		}
+		time.Sleep(c.searchDelay())
+	}
+	logging.Refresh.Ctx(ctx).Infof("Sample search found %d unique repositories", len(repos))
 	return repos, nil
 }
 
+// ErrFileNotFound is returned when a file has no commit history at HEAD,
+// i.e. it has been deleted or the repository no longer exists
+var ErrFileNotFound = errors.New("file not found")
+
 // CommitInfo represents a commit from GitHub API
 type CommitInfo struct {
 	SHA    string `json:"sha"`
@@ -227,131 +563,280 @@ type AdoptionInfo struct {
 	CommitURL string
 }
 
-// GetFileFirstCommit gets the first commit for a file (when DHI was adopted)
+// maxRenameDepth bounds how many renames GetFileFirstCommit follows
+const maxRenameDepth = 5
+
+// commitDetails is the subset of a single-commit response used to detect renames
+type commitDetails struct {
+	Files []struct {
+		Filename         string `json:"filename"`
+		Status           string `json:"status"`
+		PreviousFilename string `json:"previous_filename"`
+	} `json:"files"`
+}
+
+// GetFileFirstCommit gets the first commit for a file (when DHI was adopted).
+// The commits API lists newest first and doesn't follow renames, so this jumps
+// to the last page of the file's history and, if that commit renamed the file,
+// continues with the previous path.
 func (c *Client) GetFileFirstCommit(ctx context.Context, repoFullName, filePath string) (*AdoptionInfo, error) {
-	// Get commits for this file, oldest first (we want the first commit)
-	// GitHub returns newest first by default, so we need to get all and take the last
-	// Or we can use per_page=1 and check if there's a Link header for "last" page
-	
-	path := url.PathEscape(filePath)
-	// First, try to get a small page to see total
+	path := filePath
+	var oldest *CommitInfo
+	for depth := 0; depth <= maxRenameDepth; depth++ {
+		commit, err := c.getOldestCommit(ctx, repoFullName, path)
+		if err != nil {
+			if oldest != nil && errors.Is(err, ErrFileNotFound) {
+				break // previous path has no history of its own; keep what we have
+			}
+			return nil, err
+		}
+		oldest = commit
+
+		previous, err := c.getRenamedFrom(ctx, repoFullName, commit.SHA, path)
+		if err != nil {
+			logging.Refresh.Ctx(ctx).Errorf("Error checking %s@%s for renames: %v", repoFullName, commit.SHA, err)
+			break
+		}
+		if previous == "" {
+			break
+		}
+		logging.Refresh.Ctx(ctx).Infof("%s: %s was renamed from %s, following history", repoFullName, path, previous)
+		path = previous
+	}
+
+	return &AdoptionInfo{
+		Date:      oldest.Commit.Author.Date,
+		CommitSHA: oldest.SHA,
+		CommitURL: oldest.HTMLURL,
+	}, nil
+}
+
+// getOldestCommit returns the oldest commit touching path. It requests one commit
+// per page so the "last" page in the Link header is exactly the oldest commit.
+func (c *Client) getOldestCommit(ctx context.Context, repoFullName, filePath string) (*CommitInfo, error) {
+	path := url.QueryEscape(filePath)
 	endpoint := fmt.Sprintf("/repos/%s/commits?path=%s&per_page=1", repoFullName, path)
-	
-	body, err := c.doRequest(ctx, "GET", endpoint)
+
+	body, headers, err := c.doRequestWithHeaders(ctx, "GET", endpoint)
 	if err != nil {
+		if strings.HasPrefix(err.Error(), "API error 404") {
+			return nil, fmt.Errorf("%w: %s", ErrFileNotFound, repoFullName)
+		}
 		return nil, err
 	}
-	
+
+	if lastPage := parseLastPage(headers.Get("Link")); lastPage > 1 {
+		endpoint = fmt.Sprintf("/repos/%s/commits?path=%s&per_page=1&page=%d", repoFullName, path, lastPage)
+		body, err = c.doRequest(ctx, "GET", endpoint)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	var commits []CommitInfo
 	if err := json.Unmarshal(body, &commits); err != nil {
 		return nil, err
 	}
-	
 	if len(commits) == 0 {
-		return nil, fmt.Errorf("no commits found for file %s", filePath)
-	}
-	
-	// If only one commit, return it
-	if len(commits) == 1 {
-		return &AdoptionInfo{
-			Date:      commits[0].Commit.Author.Date,
-			CommitSHA: commits[0].SHA,
-			CommitURL: commits[0].HTMLURL,
-		}, nil
-	}
-	
-	// Otherwise, need to paginate to get the oldest commit
-	// Get up to 100 commits and take the oldest
-	endpoint = fmt.Sprintf("/repos/%s/commits?path=%s&per_page=100", repoFullName, path)
-	body, err = c.doRequest(ctx, "GET", endpoint)
+		return nil, fmt.Errorf("%w: no commits found for file %s", ErrFileNotFound, filePath)
+	}
+	return &commits[len(commits)-1], nil
+}
+
+// getRenamedFrom returns the previous filename if the commit renamed filePath, or ""
+func (c *Client) getRenamedFrom(ctx context.Context, repoFullName, sha, filePath string) (string, error) {
+	body, err := c.doRequest(ctx, "GET", fmt.Sprintf("/repos/%s/commits/%s", repoFullName, sha))
 	if err != nil {
-		return nil, err
+		return "", err
 	}
-	
-	if err := json.Unmarshal(body, &commits); err != nil {
-		return nil, err
+
+	var details commitDetails
+	if err := json.Unmarshal(body, &details); err != nil {
+		return "", err
 	}
-	
-	if len(commits) == 0 {
-		return nil, fmt.Errorf("no commits found for file %s", filePath)
+	for _, f := range details.Files {
+		if f.Filename == filePath && f.Status == "renamed" {
+			return f.PreviousFilename, nil
+		}
 	}
-	
-	// Return the oldest commit (last in the array since GitHub returns newest first)
-	oldest := commits[len(commits)-1]
-	return &AdoptionInfo{
-		Date:      oldest.Commit.Author.Date,
-		CommitSHA: oldest.SHA,
-		CommitURL: oldest.HTMLURL,
-	}, nil
+	return "", nil
 }
 
-// GetRepoDetails fetches details for a single repository
+// parseLastPage extracts the page number of the rel="last" link, or 0 if absent
+func parseLastPage(link string) int {
+	for _, part := range strings.Split(link, ",") {
+		segments := strings.Split(strings.TrimSpace(part), ";")
+		if len(segments) < 2 || strings.TrimSpace(segments[1]) != `rel="last"` {
+			continue
+		}
+		u, err := url.Parse(strings.Trim(strings.TrimSpace(segments[0]), "<>"))
+		if err != nil {
+			return 0
+		}
+		page, err := strconv.Atoi(u.Query().Get("page"))
+		if err != nil {
+			return 0
+		}
+		return page
+	}
+	return 0
+}
+
+// GetRepoDetails fetches details for a single repository. With a response cache set,
+// it revalidates the cached copy with If-None-Match and reuses it on 304.
 func (c *Client) GetRepoDetails(ctx context.Context, repoFullName string) (*RepoDetails, error) {
 	endpoint := "/repos/" + repoFullName
-	body, err := c.doRequest(ctx, "GET", endpoint)
+
+	var etag string
+	var cached []byte
+	if c.cache != nil {
+		var ok bool
+		var err error
+		etag, cached, ok, err = c.cache.GetCachedResponse(endpoint)
+		if err != nil {
+			logging.Refresh.Ctx(ctx).Errorf("Error reading cached response for %s: %v", endpoint, err)
+		}
+		if !ok {
+			etag = ""
+		}
+	}
+
+	// Entries cached before topics were stored must be refetched in full
+	if etag != "" && !bytes.Contains(cached, []byte(`"topics"`)) {
+		etag = ""
+	}
+
+	body, headers, notModified, err := c.doConditionalRequest(ctx, "GET", endpoint, etag)
 	if err != nil {
 		return nil, err
 	}
+	if notModified {
+		body = cached
+	}
 
 	var repo RepoDetails
 	if err := json.Unmarshal(body, &repo); err != nil {
 		return nil, err
 	}
 
+	if c.cache != nil && !notModified {
+		if newETag := headers.Get("ETag"); newETag != "" {
+			// Store only the fields we use; full repo responses are several KB each
+			trimmed, _ := json.Marshal(repo)
+			if err := c.cache.PutCachedResponse(endpoint, newETag, trimmed); err != nil {
+				logging.Refresh.Ctx(ctx).Errorf("Error caching response for %s: %v", endpoint, err)
+			}
+		}
+	}
+
 	return &repo, nil
 }
 
+// FetchStats summarizes a FetchAllProjects run
+type FetchStats struct {
+	ReposDiscovered int            `json:"repos_discovered"`
+	DetailsFetched  int            `json:"details_fetched"`
+	DetailsFailed   int            `json:"details_failed"`
+	GraphQLBatches  int            `json:"graphql_batches"`
+	RESTFallbacks   int            `json:"rest_fallbacks"` // repos fetched via REST after a GraphQL batch failed
+	Errors          map[string]int `json:"errors"`         // by ClassifyError category
+	NotFound        []string       `json:"not_found"`      // search hits whose repo no longer exists (deleted, or private)
+	TopicRepos      int            `json:"topic_repos"`    // repos found only by topic discovery
+	TopicErrors     int            `json:"topic_errors"`   // topic searches and repo checks that failed
+}
+
+// recordDetailsError counts a failed details lookup. A repo that no longer
+// exists is listed in NotFound rather than counted as a failure.
+func (s *FetchStats) recordDetailsError(name string, err error) {
+	s.addError(err)
+	if ClassifyError(err) == "not_found" {
+		s.NotFound = append(s.NotFound, name)
+		return
+	}
+	s.DetailsFailed++
+}
+
+func (s *FetchStats) addError(err error) {
+	if s.Errors == nil {
+		s.Errors = make(map[string]int)
+	}
+	s.Errors[ClassifyError(err)]++
+}
+
 // FetchAllProjects searches for DHI usage and fetches details for each repo
-func (c *Client) FetchAllProjects(ctx context.Context, progressFn func(status string, current, total int)) ([]Project, error) {
+func (c *Client) FetchAllProjects(ctx context.Context, progressFn func(status string, current, total int)) ([]Project, *FetchStats, error) {
+	stats := &FetchStats{}
+
 	// Step 1: Search for all repos across multiple file types
 	if progressFn != nil {
 		progressFn("searching", 0, 0)
 	}
 
-	repos, err := c.SearchDHIUsage(ctx, nil)
+	var searchProgress func(queryName string, found int, page int)
+	if progressFn != nil {
+		searchProgress = func(_ string, found, _ int) { progressFn("searching", found, 0) }
+	}
+	repos, err := c.SearchDHIUsage(ctx, searchProgress)
 	if err != nil {
-		return nil, fmt.Errorf("searching for dhi.io usage: %w", err)
+		stats.addError(err)
+		return nil, stats, fmt.Errorf("searching for dhi.io usage: %w", err)
 	}
 
-	log.Printf("Found %d unique repositories", len(repos))
+	// Step 1b: Check repos tagged with the discovery topics that code search missed
+	stats.TopicRepos = c.DiscoverByTopic(ctx, repos, stats)
 
-	// Step 2: Fetch details for each repo
-	projects := make([]Project, 0, len(repos))
-	i := 0
-	for repoName, searchResult := range repos {
-		select {
-		case <-ctx.Done():
-			return projects, ctx.Err()
-		default:
-		}
+	logging.Refresh.Ctx(ctx).Infof("Found %d unique repositories", len(repos))
+	stats.ReposDiscovered = len(repos)
 
-		i++
-		if progressFn != nil {
-			progressFn("fetching_details", i, len(repos))
-		}
+	names := make([]string, 0, len(repos))
+	for name := range repos {
+		names = append(names, name)
+	}
+	sort.Strings(names)
 
-		log.Printf("Fetching details for %s (%d/%d)", repoName, i, len(repos))
+	// Step 2: Fetch details for each repo, in GraphQL batches when enabled
+	projects, err := c.fetchProjectDetails(ctx, repos, names, stats, progressFn)
+	return projects, stats, err
+}
 
-		details, err := c.GetRepoDetails(ctx, repoName)
-		if err != nil {
-			// Log error but continue with other repos
-			log.Printf("Error fetching %s: %v", repoName, err)
-			// If rate limited, wait
-			if strings.Contains(err.Error(), "rate limited") {
-				log.Printf("Rate limited, waiting 60s...")
-				time.Sleep(60 * time.Second)
-				// Retry
-				details, err = c.GetRepoDetails(ctx, repoName)
-				if err != nil {
-					log.Printf("Retry failed for %s: %v", repoName, err)
-					continue
-				}
-			} else {
-				continue
-			}
-		}
+// FetchSampleProjects is FetchAllProjects for at most n repos, found by one page
+// of each search query. It exercises the whole pipeline quickly, e.g. after a
+// configuration change, but its results are incomplete.
+func (c *Client) FetchSampleProjects(ctx context.Context, n int, progressFn func(status string, current, total int)) ([]Project, *FetchStats, error) {
+	stats := &FetchStats{}
+	if progressFn != nil {
+		progressFn("searching", 0, 0)
+	}
+
+	repos, err := c.SearchDHISample(ctx, n)
+	if err != nil {
+		stats.addError(err)
+		return nil, stats, fmt.Errorf("searching for dhi.io usage: %w", err)
+	}
+	stats.ReposDiscovered = len(repos)
+
+	names := make([]string, 0, len(repos))
+	for name := range repos {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if len(names) > n {
+		names = names[:n]
+	}
+
+	projects, err := c.fetchProjectDetails(ctx, repos, names, stats, progressFn)
+	return projects, stats, err
+}
 
-		projects = append(projects, Project{
+// fetchProjectDetails fetches details for the named search results, in GraphQL
+// batches when enabled, and combines the two into projects
+func (c *Client) fetchProjectDetails(ctx context.Context, repos map[string]SearchResult, names []string, stats *FetchStats, progressFn func(status string, current, total int)) ([]Project, error) {
+
+	projects := make([]Project, 0, len(names))
+	addProject := func(repoName string, details *RepoDetails) {
+		searchResult := repos[repoName]
+		stats.DetailsFetched++
+		p := Project{
 			RepoFullName:    details.FullName,
 			GitHubURL:       details.HTMLURL,
 			Stars:           details.StargazersCount,
@@ -360,12 +845,125 @@ func (c *Client) FetchAllProjects(ctx context.Context, progressFn func(status st
 			DockerfilePath:  searchResult.FilePath,
 			FileURL:         searchResult.FileURL,
 			SourceType:      searchResult.SourceType,
-		})
+			FileType:        searchResult.FileType,
+			Archived:        details.Archived,
+			Fork:            details.Fork,
+			Topics:          details.Topics,
+		}
+		if details.License != nil {
+			p.License = details.License.SPDXID
+		}
+		if details.Parent != nil {
+			p.ForkParent = details.Parent.FullName
+		}
+		projects = append(projects, p)
+	}
 
-		// Small delay to avoid hitting rate limits on repo API
-		// Repo API limit is 5000/hour = ~1.4/sec, so 1s delay is safe
-		time.Sleep(1 * time.Second)
+	if !c.useGraphQL {
+		err := c.fetchDetailsREST(ctx, names, addProject, stats, progressFn)
+		return projects, err
+	}
+
+	for start := 0; start < len(names); start += graphQLBatchSize {
+		end := start + graphQLBatchSize
+		if end > len(names) {
+			end = len(names)
+		}
+		batch := names[start:end]
+		if progressFn != nil {
+			progressFn("fetching_details", end, len(names))
+		}
+		logging.Refresh.Ctx(ctx).Infof("Fetching details for repos %d-%d of %d via GraphQL", start+1, end, len(names))
+
+		details, missing, err := c.GetRepoDetailsBatch(ctx, batch)
+		if err != nil {
+			if ctx.Err() != nil {
+				return projects, ctx.Err()
+			}
+			logging.Refresh.Ctx(ctx).Warnf("GraphQL batch failed, falling back to REST: %v", err)
+			stats.addError(err)
+			stats.RESTFallbacks += len(batch)
+			if err := c.fetchDetailsREST(ctx, batch, addProject, stats, nil); err != nil {
+				return projects, err
+			}
+			continue
+		}
+
+		stats.GraphQLBatches++
+		for _, name := range batch {
+			if d, ok := details[name]; ok {
+				addProject(name, d)
+				continue
+			}
+			logging.Refresh.Ctx(ctx).Errorf("Error fetching %s: %v", name, missing[name])
+			stats.recordDetailsError(name, missing[name])
+		}
 	}
 
 	return projects, nil
 }
+
+// fetchDetailsREST fetches repo details from the REST API using the client's worker
+// pool. Workers share the core rate limiter, which also pauses them all after a
+// rate limit response, so a rate limited repo is simply retried once.
+func (c *Client) fetchDetailsREST(ctx context.Context, names []string, addProject func(string, *RepoDetails), stats *FetchStats, progressFn func(status string, current, total int)) error {
+	var mu sync.Mutex // guards stats and addProject
+	var done int64
+
+	c.Parallel(ctx, len(names), func(i int) {
+		repoName := names[i]
+		logging.Refresh.Ctx(ctx).Debugf("Fetching details for %s", repoName)
+
+		details, err := c.GetRepoDetails(ctx, repoName)
+		if err != nil && strings.Contains(err.Error(), "rate limited") {
+			logging.Refresh.Ctx(ctx).Warnf("Rate limited fetching %s, retrying after backoff", repoName)
+			mu.Lock()
+			stats.addError(err)
+			mu.Unlock()
+			details, err = c.GetRepoDetails(ctx, repoName)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			// Log error but continue with other repos
+			logging.Refresh.Ctx(ctx).Errorf("Error fetching %s: %v", repoName, err)
+			stats.recordDetailsError(repoName, err)
+		} else {
+			addProject(repoName, details)
+		}
+
+		n := atomic.AddInt64(&done, 1)
+		if progressFn != nil {
+			progressFn("fetching_details", int(n), len(names))
+		}
+	})
+
+	return ctx.Err()
+}
+
+// ClassifyError buckets a GitHub client error into a coarse category:
+// rate_limit, not_found, timeout, parse, network or other
+func ClassifyError(err error) string {
+	if err == nil {
+		return ""
+	}
+	msg := err.Error()
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var netErr net.Error
+	switch {
+	case strings.Contains(msg, "rate limited"):
+		return "rate_limit"
+	case errors.Is(err, ErrFileNotFound) || strings.Contains(msg, "API error 404"):
+		return "not_found"
+	case errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()):
+		return "timeout"
+	case errors.As(err, &syntaxErr) || errors.As(err, &typeErr):
+		return "parse"
+	case errors.As(err, &netErr):
+		return "network"
+	default:
+		return "other"
+	}
+}
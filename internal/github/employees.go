@@ -0,0 +1,81 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// userList is a page of users, e.g. org members or repo contributors
+type userList []struct {
+	Login string `json:"login"`
+}
+
+// GetOrgMembers returns the logins of an org's members, lowercased. Only public
+// members are listed unless the token belongs to a member of the org.
+func (c *Client) GetOrgMembers(ctx context.Context, org string) ([]string, error) {
+	var logins []string
+	for page := 1; ; page++ {
+		body, err := c.doRequest(ctx, "GET", fmt.Sprintf("/orgs/%s/members?per_page=100&page=%d", org, page))
+		if err != nil {
+			return nil, err
+		}
+		var users userList
+		if err := json.Unmarshal(body, &users); err != nil {
+			return nil, err
+		}
+		for _, u := range users {
+			logins = append(logins, strings.ToLower(u.Login))
+		}
+		if len(users) < 100 {
+			return logins, nil
+		}
+	}
+}
+
+// GetStarredRepos returns the full names of the repos a user has starred, most
+// recent first and lowercased, reading at most maxPages pages of 100
+func (c *Client) GetStarredRepos(ctx context.Context, user string, maxPages int) ([]string, error) {
+	var repos []string
+	for page := 1; page <= maxPages; page++ {
+		body, err := c.doRequest(ctx, "GET", fmt.Sprintf("/users/%s/starred?per_page=100&page=%d", user, page))
+		if err != nil {
+			return nil, err
+		}
+		var starred []struct {
+			FullName string `json:"full_name"`
+		}
+		if err := json.Unmarshal(body, &starred); err != nil {
+			return nil, err
+		}
+		for _, r := range starred {
+			repos = append(repos, strings.ToLower(r.FullName))
+		}
+		if len(starred) < 100 {
+			break
+		}
+	}
+	return repos, nil
+}
+
+// GetTopContributors returns the logins of a repository's top 100 contributors
+// by commits, lowercased. An empty repository has none.
+func (c *Client) GetTopContributors(ctx context.Context, repoFullName string) ([]string, error) {
+	body, err := c.doRequest(ctx, "GET", "/repos/"+repoFullName+"/contributors?per_page=100")
+	if err != nil {
+		return nil, err
+	}
+	if len(body) == 0 {
+		return nil, nil // 204 for a repository without commits
+	}
+	var users userList
+	if err := json.Unmarshal(body, &users); err != nil {
+		return nil, err
+	}
+	logins := make([]string, len(users))
+	for i, u := range users {
+		logins[i] = strings.ToLower(u.Login)
+	}
+	return logins, nil
+}
@@ -0,0 +1,205 @@
+package github
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// graphQLBatchSize is the number of repositories fetched per GraphQL query.
+// Each repository costs one node, so a batch stays well within GitHub's query limits.
+const graphQLBatchSize = 100
+
+// graphQLRepoFields are the repository fields requested for each aliased repo
+const graphQLRepoFields = `nameWithOwner url description stargazerCount isArchived isFork parent { nameWithOwner } primaryLanguage { name } licenseInfo { spdxId } repositoryTopics(first: 20) { nodes { topic { name } } }`
+
+// graphQLRepo is a repository node in a GraphQL response
+type graphQLRepo struct {
+	NameWithOwner   string `json:"nameWithOwner"`
+	URL             string `json:"url"`
+	Description     string `json:"description"`
+	StargazerCount  int    `json:"stargazerCount"`
+	IsArchived      bool   `json:"isArchived"`
+	IsFork          bool   `json:"isFork"`
+	PrimaryLanguage *struct {
+		Name string `json:"name"`
+	} `json:"primaryLanguage"`
+	LicenseInfo *struct {
+		SPDXID string `json:"spdxId"`
+	} `json:"licenseInfo"`
+	Parent *struct {
+		NameWithOwner string `json:"nameWithOwner"`
+	} `json:"parent"`
+	RepositoryTopics struct {
+		Nodes []struct {
+			Topic struct {
+				Name string `json:"name"`
+			} `json:"topic"`
+		} `json:"nodes"`
+	} `json:"repositoryTopics"`
+}
+
+// graphQLError is an entry in a GraphQL response's errors array
+type graphQLError struct {
+	Type    string   `json:"type"`
+	Path    []string `json:"path"`
+	Message string   `json:"message"`
+}
+
+// GraphQLRequestCount returns the number of GraphQL requests made so far
+func (c *Client) GraphQLRequestCount() int64 {
+	return atomic.LoadInt64(&c.graphqlRequests)
+}
+
+// doGraphQL posts a query (or mutation) to the GraphQL API and returns the raw data and errors.
+// GraphQL has its own point budget, so it doesn't draw from the REST token bucket.
+func (c *Client) doGraphQL(ctx context.Context, query string, variables map[string]interface{}) (json.RawMessage, []graphQLError, error) {
+	payload, err := json.Marshal(map[string]interface{}{"query": query, "variables": variables})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", baseURL+"/graphql", bytes.NewReader(payload))
+	if err != nil {
+		return nil, nil, err
+	}
+	atomic.AddInt64(&c.graphqlRequests, 1)
+
+	auth, tok, err := c.authorization(ctx, "graphql")
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Authorization", auth)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	resource, quota, hasQuota := c.recordQuota(resp.Header, tok)
+	if isRateLimited(resp.StatusCode, resp.Header, body) {
+		wait := rateLimitDelay(resp.Header, quota, hasQuota)
+		if c.tokens.exhaust(tok, "graphql", wait) {
+			wait = tokenSwitchDelay
+		}
+		return nil, nil, &RateLimitError{Resource: resource, RetryAfter: wait, Message: string(body)}
+	}
+	if resp.StatusCode != 200 {
+		return nil, nil, fmt.Errorf("API error %d: %s", resp.StatusCode, string(body))
+	}
+
+	var result struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []graphQLError  `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, nil, err
+	}
+	for _, e := range result.Errors {
+		if e.Type == "RATE_LIMITED" {
+			wait := rateLimitDelay(resp.Header, quota, hasQuota)
+			if c.tokens.exhaust(tok, "graphql", wait) {
+				wait = tokenSwitchDelay
+			}
+			return nil, nil, &RateLimitError{Resource: resource, RetryAfter: wait, Message: e.Message}
+		}
+	}
+	if len(result.Data) == 0 || string(result.Data) == "null" {
+		if len(result.Errors) > 0 {
+			return nil, nil, fmt.Errorf("GraphQL error: %s", result.Errors[0].Message)
+		}
+		return nil, nil, fmt.Errorf("GraphQL error: empty response")
+	}
+	return result.Data, result.Errors, nil
+}
+
+// GetRepoDetailsBatch fetches details for up to graphQLBatchSize repositories in a
+// single GraphQL query. Repositories that don't exist or aren't accessible are
+// returned in the missing map with their error; a non-nil error means the whole
+// batch failed and the caller should fall back to REST.
+func (c *Client) GetRepoDetailsBatch(ctx context.Context, repoFullNames []string) (map[string]*RepoDetails, map[string]error, error) {
+	if len(repoFullNames) > graphQLBatchSize {
+		return nil, nil, fmt.Errorf("batch of %d repos exceeds limit of %d", len(repoFullNames), graphQLBatchSize)
+	}
+
+	var q strings.Builder
+	q.WriteString("query {")
+	for i, name := range repoFullNames {
+		owner, repo, ok := strings.Cut(name, "/")
+		if !ok {
+			return nil, nil, fmt.Errorf("invalid repository name %q", name)
+		}
+		ownerJSON, _ := json.Marshal(owner)
+		repoJSON, _ := json.Marshal(repo)
+		fmt.Fprintf(&q, " r%d: repository(owner: %s, name: %s) { %s }", i, ownerJSON, repoJSON, graphQLRepoFields)
+	}
+	q.WriteString(" }")
+
+	data, gqlErrors, err := c.doGraphQL(ctx, q.String(), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var nodes map[string]*graphQLRepo
+	if err := json.Unmarshal(data, &nodes); err != nil {
+		return nil, nil, err
+	}
+
+	errorsByAlias := make(map[string]graphQLError)
+	for _, e := range gqlErrors {
+		if len(e.Path) > 0 {
+			errorsByAlias[e.Path[0]] = e
+		}
+	}
+
+	details := make(map[string]*RepoDetails, len(repoFullNames))
+	missing := make(map[string]error)
+	for i, name := range repoFullNames {
+		alias := fmt.Sprintf("r%d", i)
+		node := nodes[alias]
+		if node == nil {
+			if e, ok := errorsByAlias[alias]; ok && e.Type != "NOT_FOUND" {
+				missing[name] = fmt.Errorf("GraphQL error: %s", e.Message)
+			} else {
+				missing[name] = fmt.Errorf("API error 404: repository %s not found", name)
+			}
+			continue
+		}
+
+		d := &RepoDetails{
+			FullName:        node.NameWithOwner,
+			HTMLURL:         node.URL,
+			Description:     node.Description,
+			StargazersCount: node.StargazerCount,
+			Archived:        node.IsArchived,
+			Fork:            node.IsFork,
+		}
+		if node.PrimaryLanguage != nil {
+			d.Language = node.PrimaryLanguage.Name
+		}
+		if node.LicenseInfo != nil {
+			d.License = &RepoLicense{SPDXID: node.LicenseInfo.SPDXID}
+		}
+		if node.Parent != nil {
+			d.Parent = &RepoParent{FullName: node.Parent.NameWithOwner}
+		}
+		for _, t := range node.RepositoryTopics.Nodes {
+			d.Topics = append(d.Topics, t.Topic.Name)
+		}
+		details[name] = d
+	}
+
+	return details, missing, nil
+}
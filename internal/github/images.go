@@ -0,0 +1,174 @@
+package github
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"dhi-oss-usage/internal/logging"
+)
+
+// ImageRef is a DHI image a file builds from, e.g. dhi.io/python:3.12 is
+// {Image: "python", Tag: "3.12"}
+type ImageRef struct {
+	Image  string `json:"image"`
+	Tag    string `json:"tag"`
+	Digest string `json:"digest"`
+}
+
+// argPattern matches $NAME and ${NAME} in FROM lines
+var argPattern = regexp.MustCompile(`\$\{?([A-Za-z_][A-Za-z0-9_]*)\}?`)
+
+// ParseDockerfileImages returns the dhi.io images referenced by FROM lines, in
+// order and without duplicates. Line continuations are joined, and ARG defaults
+// are substituted so `ARG BASE=dhi.io/python:3.12` / `FROM $BASE` is found.
+// Other registries and earlier build stages are ignored.
+func ParseDockerfileImages(content string) []ImageRef {
+	args := make(map[string]string)
+	seen := make(map[ImageRef]bool)
+	var refs []ImageRef
+
+	for _, line := range dockerfileInstructions(content) {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		switch strings.ToUpper(fields[0]) {
+		case "ARG":
+			for _, f := range fields[1:] {
+				if name, value, ok := strings.Cut(f, "="); ok {
+					args[name] = expandArgs(strings.Trim(value, `"'`), args)
+				}
+			}
+		case "FROM":
+			operands := fields[1:]
+			for len(operands) > 0 && strings.HasPrefix(operands[0], "--") {
+				operands = operands[1:] // --platform=...
+			}
+			if len(operands) == 0 {
+				continue
+			}
+			if ref, ok := ParseImageRef(expandArgs(operands[0], args)); ok && !seen[ref] {
+				seen[ref] = true
+				refs = append(refs, ref)
+			}
+		}
+	}
+	return refs
+}
+
+// expandArgs substitutes known ARG values; unknown ones expand to "" as in a build
+func expandArgs(s string, args map[string]string) string {
+	return argPattern.ReplaceAllStringFunc(s, func(m string) string {
+		return args[argPattern.FindStringSubmatch(m)[1]]
+	})
+}
+
+// dockerfileInstructions splits a Dockerfile into instructions, joining
+// backslash continuations and dropping comments and blank lines
+func dockerfileInstructions(content string) []string {
+	var out []string
+	var current strings.Builder
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "#") || (line == "" && current.Len() == 0) {
+			continue
+		}
+		if strings.HasSuffix(line, `\`) {
+			current.WriteString(strings.TrimSuffix(line, `\`))
+			current.WriteString(" ")
+			continue
+		}
+		current.WriteString(line)
+		out = append(out, current.String())
+		current.Reset()
+	}
+	if current.Len() > 0 {
+		out = append(out, current.String())
+	}
+	return out
+}
+
+// ParseImageRef parses a dhi.io image reference. References without a tag or
+// digest get the implicit "latest" tag, as Docker does.
+func ParseImageRef(ref string) (ImageRef, bool) {
+	lower := strings.ToLower(ref)
+	if !strings.HasPrefix(lower, "dhi.io/") {
+		return ImageRef{}, false
+	}
+	rest := ref[len("dhi.io/"):]
+
+	var r ImageRef
+	if name, digest, ok := strings.Cut(rest, "@"); ok {
+		rest, r.Digest = name, digest
+	}
+	// A colon after the last slash separates the tag
+	if i := strings.LastIndex(rest, ":"); i > strings.LastIndex(rest, "/") {
+		rest, r.Tag = rest[:i], rest[i+1:]
+	}
+	r.Image = strings.ToLower(rest)
+	if r.Image == "" {
+		return ImageRef{}, false
+	}
+	if r.Tag == "" && r.Digest == "" {
+		r.Tag = "latest"
+	}
+	return r, true
+}
+
+// GetFileContentCached fetches a file from the repo's default branch. With a
+// response cache set, the cached copy is revalidated with If-None-Match, so
+// unchanged files don't count against the rate limit.
+func (c *Client) GetFileContentCached(ctx context.Context, repoFullName, filePath string) (string, error) {
+	endpoint := fmt.Sprintf("/repos/%s/contents/%s", repoFullName, escapePath(filePath))
+
+	var etag string
+	var cached []byte
+	if c.cache != nil {
+		var ok bool
+		var err error
+		etag, cached, ok, err = c.cache.GetCachedResponse(endpoint)
+		if err != nil {
+			logging.Refresh.Ctx(ctx).Errorf("Error reading cached response for %s: %v", endpoint, err)
+		}
+		if !ok {
+			etag = ""
+		}
+	}
+
+	body, headers, notModified, err := c.doConditionalRequest(ctx, "GET", endpoint, etag)
+	if err != nil {
+		if strings.HasPrefix(err.Error(), "API error 404") {
+			return "", fmt.Errorf("%w: %s/%s", ErrFileNotFound, repoFullName, filePath)
+		}
+		return "", err
+	}
+	if notModified {
+		body = cached
+	}
+
+	var file fileContents
+	if err := json.Unmarshal(body, &file); err != nil {
+		return "", err
+	}
+	content, err := file.decode(filePath)
+	if err != nil {
+		return "", err
+	}
+
+	if c.cache != nil && !notModified {
+		if newETag := headers.Get("ETag"); newETag != "" {
+			trimmed, _ := json.Marshal(fileContents{Content: file.Content, Encoding: file.Encoding})
+			if err := c.cache.PutCachedResponse(endpoint, newETag, trimmed); err != nil {
+				logging.Refresh.Ctx(ctx).Errorf("Error caching response for %s: %v", endpoint, err)
+			}
+		}
+	}
+
+	return content, nil
+}
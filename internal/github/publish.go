@@ -0,0 +1,180 @@
+package github
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// doJSONRequest sends payload as JSON to a REST endpoint and returns the response body
+func (c *Client) doJSONRequest(ctx context.Context, method, endpoint string, payload interface{}) ([]byte, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	body, _, _, err := c.send(ctx, method, endpoint, data, "")
+	return body, err
+}
+
+// CreateDiscussion starts a discussion in the named category of a repository and
+// returns its URL. The token needs write access to the repository's discussions.
+func (c *Client) CreateDiscussion(ctx context.Context, repoFullName, category, title, body string) (string, error) {
+	owner, name, ok := strings.Cut(repoFullName, "/")
+	if !ok {
+		return "", fmt.Errorf("invalid repository name %q", repoFullName)
+	}
+
+	data, _, err := c.doGraphQL(ctx, `query($owner: String!, $name: String!) {
+		repository(owner: $owner, name: $name) {
+			id
+			discussionCategories(first: 100) { nodes { id name } }
+		}
+	}`, map[string]interface{}{"owner": owner, "name": name})
+	if err != nil {
+		return "", err
+	}
+
+	var repo struct {
+		Repository *struct {
+			ID                   string `json:"id"`
+			DiscussionCategories struct {
+				Nodes []struct {
+					ID   string `json:"id"`
+					Name string `json:"name"`
+				} `json:"nodes"`
+			} `json:"discussionCategories"`
+		} `json:"repository"`
+	}
+	if err := json.Unmarshal(data, &repo); err != nil {
+		return "", err
+	}
+	if repo.Repository == nil {
+		return "", fmt.Errorf("API error 404: repository %s not found", repoFullName)
+	}
+
+	var categoryID string
+	for _, n := range repo.Repository.DiscussionCategories.Nodes {
+		if strings.EqualFold(n.Name, category) {
+			categoryID = n.ID
+			break
+		}
+	}
+	if categoryID == "" {
+		return "", fmt.Errorf("discussion category %q not found in %s", category, repoFullName)
+	}
+
+	data, _, err = c.doGraphQL(ctx, `mutation($input: CreateDiscussionInput!) {
+		createDiscussion(input: $input) { discussion { url } }
+	}`, map[string]interface{}{"input": map[string]string{
+		"repositoryId": repo.Repository.ID,
+		"categoryId":   categoryID,
+		"title":        title,
+		"body":         body,
+	}})
+	if err != nil {
+		return "", err
+	}
+
+	var created struct {
+		CreateDiscussion *struct {
+			Discussion struct {
+				URL string `json:"url"`
+			} `json:"discussion"`
+		} `json:"createDiscussion"`
+	}
+	if err := json.Unmarshal(data, &created); err != nil {
+		return "", err
+	}
+	if created.CreateDiscussion == nil {
+		return "", fmt.Errorf("GraphQL error: discussion not created")
+	}
+	return created.CreateDiscussion.Discussion.URL, nil
+}
+
+// GetFileContent returns a file's decoded content and blob SHA. A missing file
+// returns ErrFileNotFound.
+func (c *Client) GetFileContent(ctx context.Context, repoFullName, path, branch string) (string, string, error) {
+	endpoint := fmt.Sprintf("/repos/%s/contents/%s", repoFullName, escapePath(path))
+	if branch != "" {
+		endpoint += "?ref=" + url.QueryEscape(branch)
+	}
+
+	body, err := c.doRequest(ctx, "GET", endpoint)
+	if err != nil {
+		if strings.HasPrefix(err.Error(), "API error 404") {
+			return "", "", fmt.Errorf("%w: %s/%s", ErrFileNotFound, repoFullName, path)
+		}
+		return "", "", err
+	}
+
+	var file fileContents
+	if err := json.Unmarshal(body, &file); err != nil {
+		return "", "", err
+	}
+	content, err := file.decode(path)
+	if err != nil {
+		return "", "", err
+	}
+	return content, file.SHA, nil
+}
+
+// fileContents holds the fields used from the contents API
+type fileContents struct {
+	SHA      string `json:"sha"`
+	Content  string `json:"content"`
+	Encoding string `json:"encoding"`
+}
+
+// decode returns the file's content. Files over 1 MB come back without content.
+func (f *fileContents) decode(path string) (string, error) {
+	if f.Encoding != "base64" {
+		return "", fmt.Errorf("unsupported content encoding %q for %s", f.Encoding, path)
+	}
+	content, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(f.Content, "\n", ""))
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
+
+// PutFile creates or updates a file with a single commit and returns the file's URL.
+// sha must be the current blob SHA when updating, or empty when creating.
+func (c *Client) PutFile(ctx context.Context, repoFullName, path, branch, sha, message, content string) (string, error) {
+	payload := map[string]string{
+		"message": message,
+		"content": base64.StdEncoding.EncodeToString([]byte(content)),
+	}
+	if sha != "" {
+		payload["sha"] = sha
+	}
+	if branch != "" {
+		payload["branch"] = branch
+	}
+
+	body, err := c.doJSONRequest(ctx, "PUT", fmt.Sprintf("/repos/%s/contents/%s", repoFullName, escapePath(path)), payload)
+	if err != nil {
+		return "", err
+	}
+
+	var result struct {
+		Content struct {
+			HTMLURL string `json:"html_url"`
+		} `json:"content"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", err
+	}
+	return result.Content.HTMLURL, nil
+}
+
+// escapePath escapes each segment of a repository file path
+func escapePath(path string) string {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,268 @@
+package github
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"dhi-oss-usage/internal/logging"
+)
+
+const (
+	// coreRatePerHour is GitHub's authenticated REST API limit
+	coreRatePerHour = 5000
+	// coreBurst lets a backfill run quickly while the hourly budget refills
+	coreBurst = 1000
+	// rateLimitBackoff is how long all workers pause after a rate limit response
+	// that doesn't say when to retry (e.g. a secondary rate limit without Retry-After)
+	rateLimitBackoff = 60 * time.Second
+	// maxRateLimitWait caps a header-derived wait in case of clock skew or a bad header
+	maxRateLimitWait = time.Hour
+	// defaultConcurrency is the number of parallel workers for per-repo API calls
+	defaultConcurrency = 4
+)
+
+// rateLimiter is a token bucket shared by every goroutine using a Client.
+// A rate limit response pauses all callers until the backoff expires.
+type rateLimiter struct {
+	mu          sync.Mutex
+	tokens      float64
+	burst       float64
+	perSecond   float64
+	last        time.Time
+	pausedUntil time.Time
+}
+
+func newRateLimiter(perHour int, burst int) *rateLimiter {
+	return &rateLimiter{
+		tokens:    float64(burst),
+		burst:     float64(burst),
+		perSecond: float64(perHour) / 3600,
+		last:      time.Now(),
+	}
+}
+
+// Wait blocks until a request may be made or ctx is done
+func (l *rateLimiter) Wait(ctx context.Context) error {
+	for {
+		delay := l.reserve()
+		if delay == 0 {
+			return nil
+		}
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// reserve takes a token if available, otherwise returns how long to wait before trying again
+func (l *rateLimiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Before(l.pausedUntil) {
+		return l.pausedUntil.Sub(now)
+	}
+
+	l.tokens += now.Sub(l.last).Seconds() * l.perSecond
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+
+	if l.tokens >= 1 {
+		l.tokens--
+		return 0
+	}
+	return time.Duration((1 - l.tokens) / l.perSecond * float64(time.Second))
+}
+
+// Refund returns a token for a request GitHub didn't charge (e.g. a 304)
+func (l *rateLimiter) Refund() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.tokens++
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+}
+
+// SetRate changes the hourly rate, e.g. to the limit GitHub reports for the token
+func (l *rateLimiter) SetRate(perHour int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.perSecond = float64(perHour) / 3600
+}
+
+// Backoff pauses all callers for d
+func (l *rateLimiter) Backoff(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	until := time.Now().Add(d)
+	if until.After(l.pausedUntil) {
+		l.pausedUntil = until
+	}
+}
+
+// Parallel calls fn for each index in [0, n) using the client's worker pool.
+// Workers share the client's rate limiter. Dispatch stops when ctx is done.
+func (c *Client) Parallel(ctx context.Context, n int, fn func(i int)) {
+	workers := c.concurrency
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > n {
+		workers = n
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				fn(i)
+			}
+		}()
+	}
+
+dispatch:
+	for i := 0; i < n; i++ {
+		select {
+		case <-ctx.Done():
+			break dispatch
+		case jobs <- i:
+		}
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// RateLimitStatus is the quota GitHub last reported for an API resource (core, search, graphql, ...)
+type RateLimitStatus struct {
+	Limit     int       `json:"limit"`
+	Remaining int       `json:"remaining"`
+	Reset     time.Time `json:"reset"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// RateLimitError is returned when GitHub rejects a request for exceeding a rate limit.
+// RetryAfter is how long GitHub asked us to wait.
+type RateLimitError struct {
+	Resource   string
+	RetryAfter time.Duration
+	Message    string
+}
+
+func (e *RateLimitError) Error() string {
+	return "rate limited: " + e.Message
+}
+
+// RateLimits returns the most recent quota reported by GitHub for each API resource
+func (c *Client) RateLimits() map[string]RateLimitStatus {
+	c.quotaMu.Lock()
+	defer c.quotaMu.Unlock()
+
+	out := make(map[string]RateLimitStatus, len(c.quotas))
+	for k, v := range c.quotas {
+		out[k] = v
+	}
+	return out
+}
+
+// recordQuota stores the X-RateLimit-* headers of a response, for the client and for
+// pool token tok if one was used, and returns the resource they apply to
+func (c *Client) recordQuota(h http.Header, tok int) (string, RateLimitStatus, bool) {
+	resource := h.Get("X-RateLimit-Resource")
+	remaining, err := strconv.Atoi(h.Get("X-RateLimit-Remaining"))
+	if resource == "" || err != nil {
+		return resource, RateLimitStatus{}, false
+	}
+	limit, _ := strconv.Atoi(h.Get("X-RateLimit-Limit"))
+	reset, _ := strconv.ParseInt(h.Get("X-RateLimit-Reset"), 10, 64)
+
+	status := RateLimitStatus{
+		Limit:     limit,
+		Remaining: remaining,
+		Reset:     time.Unix(reset, 0).UTC(),
+		UpdatedAt: time.Now().UTC(),
+	}
+
+	c.tokens.record(tok, resource, status)
+
+	c.quotaMu.Lock()
+	defer c.quotaMu.Unlock()
+	if c.quotas == nil {
+		c.quotas = make(map[string]RateLimitStatus)
+	}
+	c.quotas[resource] = status
+	return resource, status, true
+}
+
+// isRateLimited reports whether a response is GitHub refusing a request for a
+// rate limit. Other 403s, such as missing permissions or SSO enforcement, are
+// ordinary errors: retrying them or pausing every worker wouldn't help.
+func isRateLimited(status int, h http.Header, body []byte) bool {
+	if status != http.StatusForbidden && status != http.StatusTooManyRequests {
+		return false
+	}
+	if h.Get("X-RateLimit-Remaining") == "0" || h.Get("Retry-After") != "" {
+		return true
+	}
+	// Primary ("API rate limit exceeded") and secondary limits say so in the message
+	return bytes.Contains(bytes.ToLower(body), []byte("rate limit"))
+}
+
+// rateLimitDelay works out how long to wait from a rate limited response's headers:
+// Retry-After if present, otherwise until X-RateLimit-Reset when the quota is exhausted,
+// otherwise rateLimitBackoff.
+func rateLimitDelay(h http.Header, status RateLimitStatus, hasQuota bool) time.Duration {
+	var d time.Duration
+	if secs, err := strconv.Atoi(h.Get("Retry-After")); err == nil && secs >= 0 {
+		d = time.Duration(secs) * time.Second
+	} else if hasQuota && status.Remaining == 0 && !status.Reset.IsZero() {
+		d = time.Until(status.Reset) + time.Second // reset is at whole-second resolution
+	} else {
+		return rateLimitBackoff
+	}
+	if d < time.Second {
+		d = time.Second
+	}
+	if d > maxRateLimitWait {
+		d = maxRateLimitWait
+	}
+	return d
+}
+
+// waitForRateLimit sleeps for as long as a rate limit error asks, or rateLimitBackoff
+// for other errors. It returns early with ctx's error if ctx is done.
+func waitForRateLimit(ctx context.Context, err error) error {
+	d := rateLimitBackoff
+	var rlErr *RateLimitError
+	if errors.As(err, &rlErr) && rlErr.RetryAfter > 0 {
+		d = rlErr.RetryAfter
+	}
+	logging.Refresh.Ctx(ctx).Warnf("Rate limited, waiting %s...", d.Round(time.Second))
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
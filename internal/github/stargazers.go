@@ -0,0 +1,106 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// stargazerPageLimit is the last page of stargazers GitHub lists: 400 pages of
+// 100, so the first 40,000 stars of a repository
+const stargazerPageLimit = 400
+
+// StarCount is how many stars a repository had at a point in time
+type StarCount struct {
+	At    time.Time
+	Stars int
+}
+
+// GetStarTimeline returns when a repository's stars were given, as the running
+// count after each, oldest first. The stargazer list is read with timestamps,
+// at most maxPages pages of 100: if it has more, pages spread evenly over it
+// are read (always the first and last), which is enough for a growth chart.
+// Stars removed since are missing from the list, so counts can fall short of
+// the repository's history; beyond the 40,000th star GitHub lists no more.
+func (c *Client) GetStarTimeline(ctx context.Context, repoFullName string, maxPages int) ([]StarCount, error) {
+	first, headers, err := c.getStargazerPage(ctx, repoFullName, 1)
+	if err != nil {
+		return nil, err
+	}
+	last := min(parseLastPage(headers.Get("Link")), stargazerPageLimit)
+
+	timeline := starCounts(first, 1)
+	for _, page := range samplePages(last, maxPages) {
+		if page == 1 {
+			continue
+		}
+		starredAt, _, err := c.getStargazerPage(ctx, repoFullName, page)
+		if err != nil {
+			return nil, err
+		}
+		timeline = append(timeline, starCounts(starredAt, page)...)
+	}
+	return timeline, nil
+}
+
+// getStargazerPage returns when the stargazers on a page of 100 starred the repo
+func (c *Client) getStargazerPage(ctx context.Context, repoFullName string, page int) ([]time.Time, http.Header, error) {
+	body, headers, err := c.doRequestWithHeaders(ctx, "GET", fmt.Sprintf("/repos/%s/stargazers?per_page=100&page=%d", repoFullName, page))
+	if err != nil {
+		return nil, nil, err
+	}
+	var stargazers []struct {
+		StarredAt time.Time `json:"starred_at"`
+	}
+	if err := json.Unmarshal(body, &stargazers); err != nil {
+		return nil, nil, err
+	}
+	starredAt := make([]time.Time, len(stargazers))
+	for i, s := range stargazers {
+		starredAt[i] = s.StarredAt
+	}
+	return starredAt, headers, nil
+}
+
+// starCounts numbers the stars on a page of 100 by their position in the list
+func starCounts(starredAt []time.Time, page int) []StarCount {
+	counts := make([]StarCount, len(starredAt))
+	for i, at := range starredAt {
+		counts[i] = StarCount{At: at, Stars: (page-1)*100 + i + 1}
+	}
+	return counts
+}
+
+// samplePages picks at most n of pages 1 to last, evenly spaced and including
+// both ends. A list without a last page (0) is a single page.
+func samplePages(last, n int) []int {
+	if last < 1 {
+		last = 1
+	}
+	if n >= last {
+		n = last
+	}
+	if n <= 1 {
+		return []int{1}
+	}
+	pages := make([]int, 0, n)
+	for i := 0; i < n; i++ {
+		page := 1 + i*(last-1)/(n-1)
+		if len(pages) == 0 || pages[len(pages)-1] != page {
+			pages = append(pages, page)
+		}
+	}
+	return pages
+}
+
+// acceptHeader is the media type a request asks for. Stargazers are listed
+// with when they starred the repository only in the star format.
+func acceptHeader(endpoint string) string {
+	if strings.Contains(endpoint, "/stargazers") {
+		return "application/vnd.github.star+json"
+	}
+	return "application/vnd.github+json"
+}
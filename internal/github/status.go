@@ -0,0 +1,96 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// statusURL is the API of githubstatus.com, GitHub's public status page
+const statusURL = "https://www.githubstatus.com/api/v2/summary.json"
+
+// APIComponent is the status page component covering the REST and GraphQL APIs
+const APIComponent = "API Requests"
+
+// ServiceStatus is GitHub's health as reported on githubstatus.com
+type ServiceStatus struct {
+	Indicator   string            `json:"indicator"`   // none, minor, major, critical or maintenance
+	Description string            `json:"description"` // e.g. "All Systems Operational"
+	Components  map[string]string `json:"components"`  // name -> operational, degraded_performance, partial_outage, major_outage or under_maintenance
+	Incidents   []string          `json:"incidents"`   // names of unresolved incidents and maintenance in progress
+}
+
+// Disrupted reports whether a component is down or under maintenance.
+// Degraded performance alone doesn't count: requests still succeed.
+func (s *ServiceStatus) Disrupted(component string) bool {
+	switch s.Components[component] {
+	case "partial_outage", "major_outage", "under_maintenance":
+		return true
+	}
+	return false
+}
+
+// GetServiceStatus reads GitHub's status page. It needs no token and doesn't
+// count against the rate limit.
+func GetServiceStatus(ctx context.Context) (*ServiceStatus, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", statusURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status page error %d", resp.StatusCode)
+	}
+
+	var summary struct {
+		Status struct {
+			Indicator   string `json:"indicator"`
+			Description string `json:"description"`
+		} `json:"status"`
+		Components []struct {
+			Name   string `json:"name"`
+			Status string `json:"status"`
+		} `json:"components"`
+		Incidents []struct {
+			Name string `json:"name"`
+		} `json:"incidents"`
+		ScheduledMaintenances []struct {
+			Name   string `json:"name"`
+			Status string `json:"status"`
+		} `json:"scheduled_maintenances"`
+	}
+	if err := json.Unmarshal(body, &summary); err != nil {
+		return nil, err
+	}
+	status := &ServiceStatus{
+		Indicator:   summary.Status.Indicator,
+		Description: summary.Status.Description,
+		Components:  make(map[string]string, len(summary.Components)),
+		Incidents:   []string{},
+	}
+	for _, c := range summary.Components {
+		status.Components[c.Name] = c.Status
+	}
+	for _, i := range summary.Incidents {
+		status.Incidents = append(status.Incidents, i.Name)
+	}
+	for _, m := range summary.ScheduledMaintenances {
+		if m.Status == "in_progress" || m.Status == "verifying" {
+			status.Incidents = append(status.Incidents, m.Name)
+		}
+	}
+	return status, nil
+}
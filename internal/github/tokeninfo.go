@@ -0,0 +1,157 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// TokenInfo is what GitHub says about one of the client's credentials: its
+// scopes, quota and, for tokens that have one, expiry
+type TokenInfo struct {
+	Token      string                     `json:"token"` // last 4 characters only, or "app"
+	Kind       string                     `json:"kind"`  // classic, fine-grained, oauth, app or unknown
+	Valid      bool                       `json:"valid"`
+	Scopes     []string                   `json:"scopes"`               // OAuth scopes of classic tokens; fine-grained tokens and apps have permissions instead
+	ExpiresAt  *time.Time                 `json:"expires_at,omitempty"` // nil if the token never expires, or GitHub didn't say
+	RateLimits map[string]RateLimitStatus `json:"rate_limits,omitempty"`
+	CheckedAt  time.Time                  `json:"checked_at"`
+	Error      string                     `json:"error,omitempty"`
+}
+
+// tokenExpirationLayouts are the formats GitHub uses in the
+// GitHub-Authentication-Token-Expiration header
+var tokenExpirationLayouts = []string{"2006-01-02 15:04:05 MST", "2006-01-02 15:04:05 -0700"}
+
+// InspectTokens checks each credential of the client against /rate_limit,
+// which doesn't count against any quota. App installation tokens are renewed
+// automatically, so only their quota is of interest.
+func (c *Client) InspectTokens(ctx context.Context) []TokenInfo {
+	if c.app != nil {
+		info := TokenInfo{Token: "app", Kind: "app"}
+		token, err := c.app.Token(ctx)
+		if err != nil {
+			info.CheckedAt = time.Now().UTC()
+			info.Error = err.Error()
+			return []TokenInfo{info}
+		}
+		info = c.inspectToken(ctx, token)
+		info.Token, info.Kind, info.ExpiresAt = "app", "app", nil
+		return []TokenInfo{info}
+	}
+
+	var out []TokenInfo
+	for _, token := range c.tokens.values() {
+		out = append(out, c.inspectToken(ctx, token))
+	}
+	return out
+}
+
+// inspectToken asks GitHub about one token
+func (c *Client) inspectToken(ctx context.Context, token string) TokenInfo {
+	info := TokenInfo{Token: tokenSuffix(token), Kind: tokenKind(token), CheckedAt: time.Now().UTC()}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", baseURL+"/rate_limit", nil)
+	if err != nil {
+		info.Error = err.Error()
+		return info
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		info.Error = err.Error()
+		return info
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		info.Error = err.Error()
+		return info
+	}
+	if resp.StatusCode != http.StatusOK {
+		info.Error = fmt.Sprintf("API error %d: %s", resp.StatusCode, string(body))
+		return info
+	}
+
+	info.Valid = true
+	info.Scopes = parseScopes(resp.Header.Get("X-OAuth-Scopes"))
+	info.ExpiresAt = parseTokenExpiration(resp.Header.Get("GitHub-Authentication-Token-Expiration"))
+
+	var result struct {
+		Resources map[string]struct {
+			Limit     int   `json:"limit"`
+			Remaining int   `json:"remaining"`
+			Reset     int64 `json:"reset"`
+		} `json:"resources"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		info.Error = fmt.Sprintf("parsing rate limits: %v", err)
+		return info
+	}
+	info.RateLimits = make(map[string]RateLimitStatus, len(result.Resources))
+	for resource, r := range result.Resources {
+		info.RateLimits[resource] = RateLimitStatus{
+			Limit:     r.Limit,
+			Remaining: r.Remaining,
+			Reset:     time.Unix(r.Reset, 0).UTC(),
+			UpdatedAt: info.CheckedAt,
+		}
+	}
+	return info
+}
+
+// tokenKind tells token types apart by their prefix
+func tokenKind(token string) string {
+	switch {
+	case strings.HasPrefix(token, "ghp_"):
+		return "classic"
+	case strings.HasPrefix(token, "github_pat_"):
+		return "fine-grained"
+	case strings.HasPrefix(token, "gho_"):
+		return "oauth"
+	case strings.HasPrefix(token, "ghs_"):
+		return "app"
+	default:
+		return "unknown"
+	}
+}
+
+// tokenSuffix identifies a token by its last 4 characters
+func tokenSuffix(token string) string {
+	if len(token) > 4 {
+		token = token[len(token)-4:]
+	}
+	return "…" + token
+}
+
+// parseScopes splits an X-OAuth-Scopes header, which is empty for tokens
+// without scopes and missing for fine-grained tokens
+func parseScopes(header string) []string {
+	scopes := []string{}
+	for _, s := range strings.Split(header, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes
+}
+
+func parseTokenExpiration(header string) *time.Time {
+	if header == "" {
+		return nil
+	}
+	for _, layout := range tokenExpirationLayouts {
+		if t, err := time.Parse(layout, header); err == nil {
+			t = t.UTC()
+			return &t
+		}
+	}
+	return nil
+}
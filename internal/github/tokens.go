@@ -0,0 +1,165 @@
+package github
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tokenSwitchDelay is how long a rate limited request waits before retrying on
+// another token that still has quota
+const tokenSwitchDelay = time.Second
+
+// tokenPool spreads requests over several personal access tokens. Each token's
+// quota is tracked per resource from the X-RateLimit-* headers of its responses,
+// and every request uses the token with the most quota left for its resource, so
+// a token nearing its limit is rotated out until its window resets.
+type tokenPool struct {
+	mu     sync.Mutex
+	tokens []*poolToken
+}
+
+type poolToken struct {
+	value  string
+	quotas map[string]RateLimitStatus // by resource
+}
+
+// TokenStatus is the quota last seen for one token of a pool, for diagnostics
+type TokenStatus struct {
+	Token  string                     `json:"token"` // last 4 characters only
+	Quotas map[string]RateLimitStatus `json:"quotas"`
+}
+
+// newTokenPool builds a pool of the distinct non-empty tokens of values. A
+// token listed twice would draw on the same quota under two entries.
+func newTokenPool(values []string) *tokenPool {
+	p := &tokenPool{}
+	seen := make(map[string]bool)
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" && !seen[v] {
+			seen[v] = true
+			p.tokens = append(p.tokens, &poolToken{value: v, quotas: make(map[string]RateLimitStatus)})
+		}
+	}
+	return p
+}
+
+func (p *tokenPool) size() int {
+	return len(p.tokens)
+}
+
+// remaining returns a token's quota for resource. A token that hasn't been used for
+// the resource yet, or whose window has reset, is assumed to have its full quota.
+func (t *poolToken) remaining(resource string, now time.Time) int {
+	q, ok := t.quotas[resource]
+	if !ok || now.After(q.Reset) {
+		return math.MaxInt32
+	}
+	return q.Remaining
+}
+
+// pick returns the index and value of the token with the most quota left for
+// resource, or -1 if the pool is empty
+func (p *tokenPool) pick(resource string) (int, string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	best, bestRemaining := -1, -1
+	now := time.Now()
+	for i, t := range p.tokens {
+		if r := t.remaining(resource, now); r > bestRemaining {
+			best, bestRemaining = i, r
+		}
+	}
+	if best < 0 {
+		return -1, ""
+	}
+	return best, p.tokens[best].value
+}
+
+// record stores the quota a response reported for token i
+func (p *tokenPool) record(i int, resource string, status RateLimitStatus) {
+	if i < 0 || resource == "" {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.tokens[i].quotas[resource] = status
+}
+
+// exhaust marks token i as out of quota for resource for d, and reports whether
+// another token still has quota (so the request can be retried right away)
+func (p *tokenPool) exhaust(i int, resource string, d time.Duration) bool {
+	if i < 0 || resource == "" {
+		return false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	q := p.tokens[i].quotas[resource]
+	q.Remaining = 0
+	q.Reset = now.Add(d)
+	q.UpdatedAt = now
+	p.tokens[i].quotas[resource] = q
+	return p.availableLocked(resource, now)
+}
+
+// available reports whether any token has quota left for resource
+func (p *tokenPool) available(resource string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.availableLocked(resource, time.Now())
+}
+
+func (p *tokenPool) availableLocked(resource string, now time.Time) bool {
+	for _, t := range p.tokens {
+		if t.remaining(resource, now) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// values returns the pool's tokens
+func (p *tokenPool) values() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	out := make([]string, len(p.tokens))
+	for i, t := range p.tokens {
+		out[i] = t.value
+	}
+	return out
+}
+
+// status returns each token's last seen quotas, identified by its last 4 characters
+func (p *tokenPool) status() []TokenStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	out := make([]TokenStatus, len(p.tokens))
+	for i, t := range p.tokens {
+		quotas := make(map[string]RateLimitStatus, len(t.quotas))
+		for k, v := range t.quotas {
+			quotas[k] = v
+		}
+		out[i] = TokenStatus{Token: tokenSuffix(t.value), Quotas: quotas}
+	}
+	return out
+}
+
+// requestResource returns the rate limit resource a request is charged to
+func requestResource(endpoint string) string {
+	switch {
+	case strings.HasPrefix(endpoint, "/search/code"):
+		return "code_search"
+	case strings.HasPrefix(endpoint, "/search/"):
+		return "search"
+	case endpoint == "/graphql":
+		return "graphql"
+	default:
+		return "core"
+	}
+}
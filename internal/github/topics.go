@@ -0,0 +1,189 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"dhi-oss-usage/internal/logging"
+)
+
+// TopicSourceType is the source type of repos found by topic discovery
+const TopicSourceType = "Topics"
+
+// maxTopicDockerfiles bounds the Dockerfiles read per topic-tagged repo, so a
+// monorepo with hundreds of them doesn't eat the core rate limit
+const maxTopicDockerfiles = 5
+
+// SetDiscoveryTopics enables topic discovery: repos tagged with any of these
+// topics are checked for dhi.io in their Dockerfiles, catching adopters the
+// code search index has missed. Empty disables it.
+func (c *Client) SetDiscoveryTopics(topics []string) {
+	c.discoveryTopics = nil
+	for _, t := range topics {
+		if t = strings.ToLower(strings.TrimSpace(t)); t != "" {
+			c.discoveryTopics = append(c.discoveryTopics, t)
+		}
+	}
+}
+
+// repoSearchResponse is a page of /search/repositories
+type repoSearchResponse struct {
+	TotalCount int `json:"total_count"`
+	Items      []struct {
+		FullName string `json:"full_name"`
+	} `json:"items"`
+}
+
+// gitTree is a recursive listing of /repos/:repo/git/trees
+type gitTree struct {
+	Tree []struct {
+		Path string `json:"path"`
+		Type string `json:"type"`
+	} `json:"tree"`
+	Truncated bool `json:"truncated"`
+}
+
+// DiscoverByTopic adds repos tagged with the discovery topics that build from
+// dhi.io to repos, skipping those code search already found. Returns how many
+// were added. Failed topic searches and repo checks are counted in
+// stats.TopicErrors, since a repo that couldn't be checked may still use DHI.
+func (c *Client) DiscoverByTopic(ctx context.Context, repos map[string]SearchResult, stats *FetchStats) int {
+	if len(c.discoveryTopics) == 0 {
+		return 0
+	}
+
+	seen := make(map[string]bool)
+	var candidates []string
+	for _, topic := range c.discoveryTopics {
+		names, err := c.searchTopicRepos(ctx, topic)
+		if err != nil {
+			logging.Refresh.Ctx(ctx).Errorf("[topic:%s] Search failed: %v", topic, err)
+			stats.addError(err)
+			stats.TopicErrors++
+		}
+		for _, name := range names {
+			if _, found := repos[name]; !found && !seen[name] {
+				seen[name] = true
+				candidates = append(candidates, name)
+			}
+		}
+	}
+	sort.Strings(candidates)
+	logging.Refresh.Ctx(ctx).Infof("Topic discovery: checking %d repos not found by code search", len(candidates))
+
+	var mu sync.Mutex // guards repos and stats
+	added := 0
+	c.Parallel(ctx, len(candidates), func(i int) {
+		name := candidates[i]
+		result, ok, err := c.checkTopicRepo(ctx, name)
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			logging.Refresh.Ctx(ctx).Errorf("[topic] Error checking %s: %v", name, err)
+			stats.addError(err)
+			stats.TopicErrors++
+			return
+		}
+		if ok {
+			repos[name] = result
+			added++
+		}
+	})
+	logging.Refresh.Ctx(ctx).Infof("Topic discovery: found %d repos using dhi.io", added)
+	return added
+}
+
+// searchTopicRepos returns the repos tagged with a topic, up to GitHub's 1000
+// result limit
+func (c *Client) searchTopicRepos(ctx context.Context, topic string) ([]string, error) {
+	const perPage = 100
+	var names []string
+	for page := 1; ; page++ {
+		endpoint := fmt.Sprintf("/search/repositories?q=%s&per_page=%d&page=%d", url.QueryEscape("topic:"+topic), perPage, page)
+		body, err := c.doRequest(ctx, "GET", endpoint)
+		if err != nil {
+			// If rate limited, wait until GitHub allows it and retry the page
+			if strings.Contains(err.Error(), "rate limited") {
+				if err := waitForRateLimit(ctx, err); err != nil {
+					return names, err
+				}
+				page--
+				continue
+			}
+			return names, err
+		}
+
+		var resp repoSearchResponse
+		if err := json.Unmarshal(body, &resp); err != nil {
+			return names, err
+		}
+		for _, item := range resp.Items {
+			names = append(names, item.FullName)
+		}
+		logging.Refresh.Ctx(ctx).Debugf("[topic:%s] Page %d: %d repos", topic, page, len(resp.Items))
+
+		time.Sleep(c.searchDelay())
+
+		if len(resp.Items) < perPage || page*perPage >= resp.TotalCount {
+			return names, nil
+		}
+		if page*perPage >= searchResultCap {
+			logging.Refresh.Ctx(ctx).Infof("[topic:%s] Reached GitHub's 1000 result limit", topic)
+			return names, nil
+		}
+	}
+}
+
+// checkTopicRepo reads a repo's Dockerfiles and returns a search result for the
+// first that builds from dhi.io. An empty repo is not an error.
+func (c *Client) checkTopicRepo(ctx context.Context, name string) (SearchResult, bool, error) {
+	body, err := c.doRequest(ctx, "GET", fmt.Sprintf("/repos/%s/git/trees/HEAD?recursive=1", name))
+	if err != nil {
+		if ClassifyError(err) == "not_found" {
+			return SearchResult{}, false, nil
+		}
+		return SearchResult{}, false, err
+	}
+	var tree gitTree
+	if err := json.Unmarshal(body, &tree); err != nil {
+		return SearchResult{}, false, err
+	}
+	if tree.Truncated {
+		logging.Refresh.Ctx(ctx).Warnf("[topic] Tree of %s is truncated; only listed Dockerfiles are checked", name)
+	}
+
+	checked := 0
+	for _, entry := range tree.Tree {
+		if entry.Type != "blob" || ClassifyFileType(entry.Path) != "dockerfile" {
+			continue
+		}
+		if checked == maxTopicDockerfiles {
+			break
+		}
+		checked++
+
+		content, err := c.GetFileContentCached(ctx, name, entry.Path)
+		if err != nil {
+			if ClassifyError(err) == "not_found" {
+				continue
+			}
+			return SearchResult{}, false, err
+		}
+		if len(ParseDockerfileImages(content)) > 0 {
+			return SearchResult{
+				RepoFullName: name,
+				FilePath:     entry.Path,
+				FileURL:      fmt.Sprintf("https://github.com/%s/blob/HEAD/%s", name, entry.Path),
+				SourceType:   TopicSourceType,
+				FileType:     "dockerfile",
+			}, true, nil
+		}
+	}
+	return SearchResult{}, false, nil
+}
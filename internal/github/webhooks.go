@@ -0,0 +1,73 @@
+package github
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// PushEvent is the subset of a GitHub push webhook payload used to detect DHI
+// references in changed files
+type PushEvent struct {
+	Ref        string `json:"ref"`
+	Repository struct {
+		FullName      string `json:"full_name"`
+		DefaultBranch string `json:"default_branch"`
+		Private       bool   `json:"private"`
+	} `json:"repository"`
+	Commits []struct {
+		Added    []string `json:"added"`
+		Removed  []string `json:"removed"`
+		Modified []string `json:"modified"`
+	} `json:"commits"`
+}
+
+// ToDefaultBranch reports whether the push updated the repository's default branch
+func (e *PushEvent) ToDefaultBranch() bool {
+	return e.Ref == "refs/heads/"+e.Repository.DefaultBranch
+}
+
+// ChangedFiles returns the files the push left in place (added or modified) and
+// those it removed, applying its commits in order
+func (e *PushEvent) ChangedFiles() (changed, removed []string) {
+	state := make(map[string]bool) // path -> exists after the push
+	var order []string
+	set := func(paths []string, exists bool) {
+		for _, p := range paths {
+			if _, ok := state[p]; !ok {
+				order = append(order, p)
+			}
+			state[p] = exists
+		}
+	}
+	for _, c := range e.Commits {
+		set(c.Added, true)
+		set(c.Modified, true)
+		set(c.Removed, false)
+	}
+	for _, p := range order {
+		if state[p] {
+			changed = append(changed, p)
+		} else {
+			removed = append(removed, p)
+		}
+	}
+	return changed, removed
+}
+
+// VerifyWebhookSignature checks an X-Hub-Signature-256 header ("sha256=<hex>")
+// against the HMAC-SHA256 of the payload with the webhook secret
+func VerifyWebhookSignature(secret string, payload []byte, header string) bool {
+	sig, ok := strings.CutPrefix(header, "sha256=")
+	if !ok {
+		return false
+	}
+	got, err := hex.DecodeString(sig)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hmac.Equal(got, mac.Sum(nil))
+}
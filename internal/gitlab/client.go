@@ -0,0 +1,341 @@
+// Package gitlab searches GitLab for dhi.io references, mirroring internal/github
+// for the subset of features the tracker needs.
+package gitlab
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"dhi-oss-usage/internal/logging"
+)
+
+const (
+	defaultBaseURL  = "https://gitlab.com"
+	searchRateDelay = 2 * time.Second // GitLab.com search: 30 req/min per user
+	maxSearchPages  = 10
+)
+
+// ErrFileNotFound is returned when a file has no commit history
+var ErrFileNotFound = errors.New("file not found")
+
+type Client struct {
+	token      string
+	baseURL    string
+	host       string
+	httpClient *http.Client
+}
+
+// NewClient creates a client for a GitLab instance. An empty baseURL uses gitlab.com.
+func NewClient(token, baseURL string) (*Client, error) {
+	if baseURL == "" {
+		baseURL = defaultBaseURL
+	}
+	u, err := url.Parse(baseURL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid GitLab URL %q", baseURL)
+	}
+	return &Client{
+		token:   token,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		host:    u.Host,
+		httpClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}, nil
+}
+
+// Host returns the GitLab hostname, used to namespace project names
+func (c *Client) Host() string {
+	return c.host
+}
+
+// BlobResult is a single code search hit
+type BlobResult struct {
+	Path      string `json:"path"`
+	Ref       string `json:"ref"`
+	ProjectID int64  `json:"project_id"`
+}
+
+// ProjectDetails is the subset of project metadata the tracker stores
+type ProjectDetails struct {
+	ID                int64    `json:"id"`
+	PathWithNamespace string   `json:"path_with_namespace"`
+	WebURL            string   `json:"web_url"`
+	Description       string   `json:"description"`
+	StarCount         int      `json:"star_count"`
+	Archived          bool     `json:"archived"`
+	Topics            []string `json:"topics"`
+	ForkedFromProject *struct {
+		PathWithNamespace string `json:"path_with_namespace"`
+	} `json:"forked_from_project"`
+}
+
+// Project combines a search hit with project details
+type Project struct {
+	FullName        string // path_with_namespace
+	WebURL          string
+	Stars           int
+	Description     string
+	PrimaryLanguage string
+	FilePath        string
+	FileURL         string
+	SourceType      string
+	Archived        bool
+	ForkParent      string // path_with_namespace of the project this was forked from; empty if not a fork
+	Topics          []string
+}
+
+// SearchQuery represents a single search query configuration
+type SearchQuery struct {
+	Name  string
+	Query string
+}
+
+// GetSearchQueries returns the blob searches used to find DHI usage. Names match
+// the GitHub queries so source types line up across providers.
+func GetSearchQueries() []SearchQuery {
+	return []SearchQuery{
+		{"Dockerfiles", `"FROM dhi.io" filename:Dockerfile`},
+		{"Docker Compose", `"image: dhi.io/" filename:compose`},
+		{"GitLab CI", `"dhi.io/" filename:.gitlab-ci.yml`},
+		{"YAML/K8s", `"image: dhi.io/" extension:yaml`},
+		{"YAML/K8s", `"image: dhi.io/" extension:yml`},
+	}
+}
+
+func (c *Client) doRequest(ctx context.Context, endpoint string) ([]byte, http.Header, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.baseURL+"/api/v4"+endpoint, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	if c.token != "" {
+		req.Header.Set("PRIVATE-TOKEN", c.token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return nil, nil, fmt.Errorf("rate limited: %s", string(body))
+	}
+	if resp.StatusCode != 200 {
+		return nil, nil, fmt.Errorf("API error %d: %s", resp.StatusCode, string(body))
+	}
+	return body, resp.Header, nil
+}
+
+// searchResult holds a project ID and the file where dhi.io was found
+type searchResult struct {
+	Path       string
+	Ref        string
+	SourceType string
+}
+
+// SearchDHIUsage runs every blob search and returns the first hit per project ID
+func (c *Client) SearchDHIUsage(ctx context.Context) (map[int64]searchResult, error) {
+	found := make(map[int64]searchResult)
+
+	for _, sq := range GetSearchQueries() {
+		logging.Refresh.Ctx(ctx).Infof("[GitLab] Starting search: %s", sq.Name)
+		for page := 1; page <= maxSearchPages; page++ {
+			endpoint := fmt.Sprintf("/search?scope=blobs&search=%s&per_page=100&page=%d", url.QueryEscape(sq.Query), page)
+			body, headers, err := c.doRequest(ctx, endpoint)
+			if err != nil {
+				if strings.Contains(err.Error(), "rate limited") {
+					logging.Refresh.Ctx(ctx).Warnf("[GitLab] Rate limited, waiting 60s...")
+					if err := sleep(ctx, 60*time.Second); err != nil {
+						return found, err
+					}
+					page--
+					continue
+				}
+				return found, err
+			}
+
+			var blobs []BlobResult
+			if err := json.Unmarshal(body, &blobs); err != nil {
+				return found, err
+			}
+			for _, b := range blobs {
+				if _, exists := found[b.ProjectID]; !exists {
+					found[b.ProjectID] = searchResult{Path: b.Path, Ref: b.Ref, SourceType: sq.Name}
+				}
+			}
+			logging.Refresh.Ctx(ctx).Debugf("[GitLab] [%s] Page %d: found %d blobs, total unique projects: %d", sq.Name, page, len(blobs), len(found))
+
+			if err := sleep(ctx, searchRateDelay); err != nil {
+				return found, err
+			}
+			if headers.Get("X-Next-Page") == "" || len(blobs) == 0 {
+				break
+			}
+		}
+	}
+
+	return found, nil
+}
+
+// GetProject fetches a project's metadata by numeric ID or path
+func (c *Client) GetProject(ctx context.Context, id string) (*ProjectDetails, error) {
+	body, _, err := c.doRequest(ctx, "/projects/"+url.PathEscape(id))
+	if err != nil {
+		return nil, err
+	}
+	var p ProjectDetails
+	if err := json.Unmarshal(body, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// GetPrimaryLanguage returns the language with the largest share of the project
+func (c *Client) GetPrimaryLanguage(ctx context.Context, id int64) (string, error) {
+	body, _, err := c.doRequest(ctx, fmt.Sprintf("/projects/%d/languages", id))
+	if err != nil {
+		return "", err
+	}
+	var languages map[string]float64
+	if err := json.Unmarshal(body, &languages); err != nil {
+		return "", err
+	}
+	names := make([]string, 0, len(languages))
+	for name := range languages {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if languages[names[i]] != languages[names[j]] {
+			return languages[names[i]] > languages[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	if len(names) == 0 {
+		return "", nil
+	}
+	return names[0], nil
+}
+
+// FetchStats summarizes a FetchAllProjects run
+type FetchStats struct {
+	ReposDiscovered int
+	DetailsFetched  int
+	DetailsFailed   int
+}
+
+// FetchAllProjects searches for DHI usage and fetches details for each project
+func (c *Client) FetchAllProjects(ctx context.Context) ([]Project, *FetchStats, error) {
+	stats := &FetchStats{}
+
+	found, err := c.SearchDHIUsage(ctx)
+	if err != nil {
+		return nil, stats, fmt.Errorf("searching GitLab for dhi.io usage: %w", err)
+	}
+	stats.ReposDiscovered = len(found)
+	logging.Refresh.Ctx(ctx).Infof("[GitLab] Found %d unique projects", len(found))
+
+	projects := make([]Project, 0, len(found))
+	for id, hit := range found {
+		if ctx.Err() != nil {
+			return projects, stats, ctx.Err()
+		}
+
+		details, err := c.GetProject(ctx, strconv.FormatInt(id, 10))
+		if err != nil {
+			logging.Refresh.Ctx(ctx).Errorf("[GitLab] Error fetching project %d: %v", id, err)
+			stats.DetailsFailed++
+			continue
+		}
+		language, err := c.GetPrimaryLanguage(ctx, id)
+		if err != nil {
+			logging.Refresh.Ctx(ctx).Errorf("[GitLab] Error fetching languages for %s: %v", details.PathWithNamespace, err)
+		}
+
+		stats.DetailsFetched++
+		p := Project{
+			FullName:        details.PathWithNamespace,
+			WebURL:          details.WebURL,
+			Stars:           details.StarCount,
+			Description:     details.Description,
+			PrimaryLanguage: language,
+			FilePath:        hit.Path,
+			FileURL:         fmt.Sprintf("%s/-/blob/%s/%s", details.WebURL, hit.Ref, hit.Path),
+			SourceType:      hit.SourceType,
+			Archived:        details.Archived,
+			Topics:          details.Topics,
+		}
+		if details.ForkedFromProject != nil {
+			p.ForkParent = details.ForkedFromProject.PathWithNamespace
+		}
+		projects = append(projects, p)
+	}
+
+	return projects, stats, nil
+}
+
+// CommitInfo represents a commit from the GitLab API
+type CommitInfo struct {
+	ID          string    `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	AuthoredAt  time.Time `json:"authored_date"`
+	WebURL      string    `json:"web_url"`
+	ParentIDs   []string  `json:"parent_ids"`
+	Title       string    `json:"title"`
+	AuthorEmail string    `json:"author_email"`
+}
+
+// GetFileFirstCommit returns the oldest commit touching filePath in a project.
+// Like the GitHub client, it requests one commit per page and jumps to the last page.
+func (c *Client) GetFileFirstCommit(ctx context.Context, projectPath, filePath string) (*CommitInfo, error) {
+	base := fmt.Sprintf("/projects/%s/repository/commits?path=%s&per_page=1", url.PathEscape(projectPath), url.QueryEscape(filePath))
+
+	body, headers, err := c.doRequest(ctx, base)
+	if err != nil {
+		if strings.HasPrefix(err.Error(), "API error 404") {
+			return nil, fmt.Errorf("%w: %s", ErrFileNotFound, projectPath)
+		}
+		return nil, err
+	}
+
+	if lastPage, _ := strconv.Atoi(headers.Get("X-Total-Pages")); lastPage > 1 {
+		body, _, err = c.doRequest(ctx, fmt.Sprintf("%s&page=%d", base, lastPage))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var commits []CommitInfo
+	if err := json.Unmarshal(body, &commits); err != nil {
+		return nil, err
+	}
+	if len(commits) == 0 {
+		return nil, fmt.Errorf("%w: no commits found for file %s", ErrFileNotFound, filePath)
+	}
+	return &commits[len(commits)-1], nil
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,174 @@
+// Package i18n translates server-generated display strings, such as the weekly
+// adopters summary and badge labels, using locale bundles compiled into the binary.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Default is the locale used when none is requested or none matches
+const Default = "en"
+
+//go:embed locales/*.json
+var bundleFS embed.FS
+
+// Locale is a bundle of translated messages and formatting rules. Messages are
+// fmt formats; a missing message falls back to English.
+type Locale struct {
+	Tag                string            `json:"tag"` // BCP 47 language tag, e.g. de
+	Name               string            `json:"name"`
+	ThousandsSeparator string            `json:"thousands_separator"`
+	DateShort          string            `json:"date_short"` // Go layout, e.g. "Jan 2"
+	DateLong           string            `json:"date_long"`
+	Months             []string          `json:"months,omitempty"` // replace English month abbreviations ("Jan") in dates
+	Messages           map[string]string `json:"messages"`
+}
+
+var locales = loadBundles()
+
+// loadBundles parses every embedded bundle, keyed by tag (its file name)
+func loadBundles() map[string]*Locale {
+	entries, err := bundleFS.ReadDir("locales")
+	if err != nil {
+		panic(err)
+	}
+	bundles := make(map[string]*Locale, len(entries))
+	for _, e := range entries {
+		data, err := bundleFS.ReadFile("locales/" + e.Name())
+		if err != nil {
+			panic(err)
+		}
+		var l Locale
+		if err := json.Unmarshal(data, &l); err != nil {
+			panic(fmt.Sprintf("parsing locale bundle %s: %v", e.Name(), err))
+		}
+		l.Tag = strings.TrimSuffix(e.Name(), path.Ext(e.Name()))
+		bundles[l.Tag] = &l
+	}
+	if bundles[Default] == nil {
+		panic("missing default locale bundle")
+	}
+	return bundles
+}
+
+// Tags returns the supported locale tags, sorted
+func Tags() []string {
+	tags := make([]string, 0, len(locales))
+	for tag := range locales {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// Get returns the locale for a tag, matching its base language if the region
+// isn't supported (de-AT gets de)
+func Get(tag string) (*Locale, bool) {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if l, ok := locales[tag]; ok {
+		return l, true
+	}
+	if base, _, ok := strings.Cut(tag, "-"); ok {
+		if l, ok := locales[base]; ok {
+			return l, true
+		}
+	}
+	return nil, false
+}
+
+// Match returns the best supported locale for an Accept-Language header,
+// honoring q-values, or the default locale if none is supported
+func Match(acceptLanguage string) *Locale {
+	type choice struct {
+		tag string
+		q   float64
+	}
+	var choices []choice
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		if tag != "" && tag != "*" && q > 0 {
+			choices = append(choices, choice{tag, q})
+		}
+	}
+	sort.SliceStable(choices, func(i, j int) bool { return choices[i].q > choices[j].q })
+	for _, c := range choices {
+		if l, ok := Get(c.tag); ok {
+			return l
+		}
+	}
+	return locales[Default]
+}
+
+// T formats the message for key with args
+func (l *Locale) T(key string, args ...interface{}) string {
+	return fmt.Sprintf(l.message(key), args...)
+}
+
+// Plural formats the key.one message when n is 1 and key.other otherwise.
+// Locales without singular forms (e.g. ja) only define key.other.
+func (l *Locale) Plural(key string, n int, args ...interface{}) string {
+	if n == 1 {
+		if msg, ok := l.Messages[key+".one"]; ok {
+			return fmt.Sprintf(msg, args...)
+		}
+	}
+	return l.T(key+".other", args...)
+}
+
+// message returns the message for key, falling back to English and then to the key
+func (l *Locale) message(key string) string {
+	if msg, ok := l.Messages[key]; ok {
+		return msg
+	}
+	if msg, ok := locales[Default].Messages[key]; ok {
+		return msg
+	}
+	return key
+}
+
+// Number formats n with the locale's thousands separator, e.g. 1,234 or 1.234
+func (l *Locale) Number(n int) string {
+	if n < 0 {
+		return "-" + l.Number(-n)
+	}
+	s := strconv.Itoa(n)
+	var b strings.Builder
+	for i, c := range s {
+		if i > 0 && (len(s)-i)%3 == 0 {
+			b.WriteString(l.ThousandsSeparator)
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// ShortDate formats a day and month, e.g. Jan 2 or 2. Jan.
+func (l *Locale) ShortDate(t time.Time) string {
+	return l.formatDate(t, l.DateShort)
+}
+
+// LongDate formats a full date, e.g. Jan 2, 2006 or 2. Jan. 2006
+func (l *Locale) LongDate(t time.Time) string {
+	return l.formatDate(t, l.DateLong)
+}
+
+func (l *Locale) formatDate(t time.Time, layout string) string {
+	s := t.Format(layout)
+	if len(l.Months) == 12 && strings.Contains(layout, "Jan") {
+		s = strings.Replace(s, t.Format("Jan"), l.Months[t.Month()-1], 1)
+	}
+	return s
+}
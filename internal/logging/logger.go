@@ -0,0 +1,106 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+)
+
+// Logger writes printf-style messages to a log stream through slog. Loggers
+// derived with With and Ctx add attributes, such as the ID of the request or
+// refresh job a message is about, so lines can be correlated across streams.
+type Logger struct {
+	sl *slog.Logger
+}
+
+var (
+	// level is the minimum level written to every stream
+	level = new(slog.LevelVar)
+	// jsonFormat writes JSON lines instead of key=value text
+	jsonFormat bool
+)
+
+func newLogger(w io.Writer) *Logger {
+	return &Logger{sl: slog.New(newHandler(w))}
+}
+
+func newHandler(w io.Writer) slog.Handler {
+	opts := &slog.HandlerOptions{Level: level}
+	if jsonFormat {
+		return slog.NewJSONHandler(w, opts)
+	}
+	return slog.NewTextHandler(w, opts)
+}
+
+// With returns a Logger that adds the given key-value pairs to each message
+func (l *Logger) With(args ...any) *Logger {
+	return &Logger{sl: l.sl.With(args...)}
+}
+
+// Ctx returns a Logger that adds the attributes carried by ctx (see With)
+func (l *Logger) Ctx(ctx context.Context) *Logger {
+	attrs, _ := ctx.Value(attrsKey{}).([]any)
+	if len(attrs) == 0 {
+		return l
+	}
+	return l.With(attrs...)
+}
+
+func (l *Logger) Debugf(format string, args ...any) { l.logf(slog.LevelDebug, format, args) }
+func (l *Logger) Infof(format string, args ...any)  { l.logf(slog.LevelInfo, format, args) }
+func (l *Logger) Warnf(format string, args ...any)  { l.logf(slog.LevelWarn, format, args) }
+func (l *Logger) Errorf(format string, args ...any) { l.logf(slog.LevelError, format, args) }
+
+// Fatalf logs at error level and exits with status 1
+func (l *Logger) Fatalf(format string, args ...any) {
+	l.logf(slog.LevelError, format, args)
+	os.Exit(1)
+}
+
+func (l *Logger) logf(lvl slog.Level, format string, args []any) {
+	ctx := context.Background()
+	if !l.sl.Enabled(ctx, lvl) {
+		return
+	}
+	l.sl.Log(ctx, lvl, fmt.Sprintf(format, args...))
+}
+
+type attrsKey struct{}
+
+// With returns a context carrying the given key-value pairs in addition to
+// those ctx already carries, for loggers derived with Logger.Ctx
+func With(ctx context.Context, args ...any) context.Context {
+	attrs, _ := ctx.Value(attrsKey{}).([]any)
+	merged := make([]any, 0, len(attrs)+len(args))
+	merged = append(append(merged, attrs...), args...)
+	return context.WithValue(ctx, attrsKey{}, merged)
+}
+
+// RequestID returns the ID AccessMiddleware gave the request ctx belongs to,
+// or "" outside a request
+func RequestID(ctx context.Context) string {
+	attrs, _ := ctx.Value(attrsKey{}).([]any)
+	for i := 0; i+1 < len(attrs); i += 2 {
+		if attrs[i] == "request_id" {
+			id, _ := attrs[i+1].(string)
+			return id
+		}
+	}
+	return ""
+}
+
+// requestID returns the ID of a request: the X-Request-ID a trusted proxy
+// sent, so lines can be matched with the proxy's, or else a new random one
+func requestID(r *http.Request) string {
+	if id := r.Header.Get("X-Request-ID"); id != "" && len(id) <= 128 && FromTrustedProxy(r) {
+		return id
+	}
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,255 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Separate log streams. Server, refresh and notification logs go to stderr
+// until Setup points them at files; access logs are discarded unless file
+// logging is enabled or Config.AccessStderr is set.
+var (
+	Server        = newLogger(os.Stderr)
+	Access        = newLogger(io.Discard)
+	Refresh       = newLogger(os.Stderr)
+	Notifications = newLogger(os.Stderr)
+)
+
+// Config controls the log format and level, and optional file logging
+type Config struct {
+	Format string     // "text" (key=value pairs, the default) or "json"
+	Level  slog.Level // messages below this level are dropped
+
+	Dir        string // directory for log files; empty disables file logging
+	MaxSizeMB  int    // rotate when a file exceeds this size (0 = no size limit)
+	Daily      bool   // rotate at the start of each day
+	MaxBackups int    // rotated files to keep per stream (0 = keep all)
+
+	AccessStderr     bool    // write access logs to stderr when file logging is disabled
+	AccessSampleRate float64 // fraction of successful requests logged; errors are always logged
+}
+
+// accessSampleRate is the fraction of 1xx-3xx responses written to the access log
+var accessSampleRate = 1.0
+
+// Setup sets the format and level of every stream, and with a Dir enables
+// file logging with one file per stream: server.log (general log, also written
+// to stderr), access.log, refresh.log and notifications.log. It must be called
+// before loggers are derived with With or Ctx. The standard library's log
+// package writes to the server stream at info level afterwards.
+func Setup(cfg Config) error {
+	switch cfg.Format {
+	case "", "text":
+		jsonFormat = false
+	case "json":
+		jsonFormat = true
+	default:
+		return fmt.Errorf("unknown log format %q (want text or json)", cfg.Format)
+	}
+	level.Set(cfg.Level)
+	if cfg.AccessSampleRate >= 0 && cfg.AccessSampleRate < 1 {
+		accessSampleRate = cfg.AccessSampleRate
+	}
+	if cfg.Dir == "" {
+		access := io.Discard
+		if cfg.AccessStderr {
+			access = os.Stderr
+		}
+		setOutputs(os.Stderr, access, os.Stderr, os.Stderr)
+		return nil
+	}
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return fmt.Errorf("creating log directory: %w", err)
+	}
+
+	open := func(name string) (*RotatingFile, error) {
+		return OpenRotatingFile(filepath.Join(cfg.Dir, name), int64(cfg.MaxSizeMB)*1024*1024, cfg.Daily, cfg.MaxBackups)
+	}
+
+	server, err := open("server.log")
+	if err != nil {
+		return err
+	}
+	access, err := open("access.log")
+	if err != nil {
+		return err
+	}
+	refresh, err := open("refresh.log")
+	if err != nil {
+		return err
+	}
+	notifications, err := open("notifications.log")
+	if err != nil {
+		return err
+	}
+
+	setOutputs(io.MultiWriter(os.Stderr, server), access, refresh, notifications)
+	return nil
+}
+
+// setOutputs points the streams at their writers with the configured handler
+func setOutputs(server, access, refresh, notifications io.Writer) {
+	Server.sl = slog.New(newHandler(server))
+	Access.sl = slog.New(newHandler(access))
+	Refresh.sl = slog.New(newHandler(refresh))
+	Notifications.sl = slog.New(newHandler(notifications))
+	slog.SetDefault(Server.sl)
+}
+
+// statusRecorder captures the response status and size for access logging
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += int64(n)
+	return n, err
+}
+
+// Flush lets streaming handlers flush through the recorder
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// AccessMiddleware gives each request an ID, returned in X-Request-ID and
+// carried by the request's context for Logger.Ctx, and logs the request to
+// the access stream. Successful requests are sampled at the configured rate;
+// 4xx and 5xx responses are always logged so failures are visible even when a
+// handler doesn't log them, 4xx at warn and 5xx at error level.
+func AccessMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		id := requestID(r)
+		w.Header().Set("X-Request-ID", id)
+		r = r.WithContext(With(r.Context(), "request_id", id))
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		if rec.status < 400 && accessSampleRate < 1 && rand.Float64() >= accessSampleRate {
+			return
+		}
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.RequestURI()),
+			slog.Int("status", rec.status),
+			slog.Duration("duration", time.Since(start).Round(time.Microsecond)),
+			slog.Int64("bytes", rec.bytes),
+			slog.String("caller", ClientIP(r)),
+			slog.String("request_id", id),
+		}
+		if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+			attrs = append(attrs, slog.String("forwarded_for", fwd))
+		}
+		if ua := r.UserAgent(); ua != "" {
+			attrs = append(attrs, slog.String("user_agent", ua))
+		}
+		lvl := slog.LevelInfo
+		if rec.status >= 500 {
+			lvl = slog.LevelError
+		} else if rec.status >= 400 {
+			lvl = slog.LevelWarn
+		}
+		Access.sl.LogAttrs(context.Background(), lvl, "request", attrs...)
+	})
+}
+
+// trustedProxies are the proxies whose X-Forwarded-* headers are believed
+var trustedProxies []*net.IPNet
+
+// SetTrustedProxies sets the proxies, as IPs or CIDRs, whose X-Forwarded-For
+// and X-Forwarded-Prefix headers are believed. Headers from anyone else are
+// ignored, since clients control them.
+func SetTrustedProxies(proxies []string) error {
+	var nets []*net.IPNet
+	for _, p := range proxies {
+		if p = strings.TrimSpace(p); p == "" {
+			continue
+		}
+		if !strings.Contains(p, "/") {
+			if ip := net.ParseIP(p); ip != nil && ip.To4() != nil {
+				p += "/32"
+			} else {
+				p += "/128"
+			}
+		}
+		_, n, err := net.ParseCIDR(p)
+		if err != nil {
+			return fmt.Errorf("invalid trusted proxy %q: %w", p, err)
+		}
+		nets = append(nets, n)
+	}
+	trustedProxies = nets
+	return nil
+}
+
+func trusted(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, n := range trustedProxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// FromTrustedProxy reports whether r came straight from a trusted proxy
+func FromTrustedProxy(r *http.Request) bool {
+	return trusted(callerIP(r))
+}
+
+// ClientIP returns the address of the client: the connection's, or when that
+// is a trusted proxy, the right-most X-Forwarded-For address that isn't one
+func ClientIP(r *http.Request) string {
+	ip := callerIP(r)
+	if !trusted(ip) {
+		return ip
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		ip = hop
+		if !trusted(hop) {
+			break
+		}
+	}
+	return ip
+}
+
+// callerIP returns the address of the client connection
+func callerIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
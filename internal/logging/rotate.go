@@ -0,0 +1,145 @@
+package logging
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// RotatingFile is an io.Writer that rotates the underlying file by size and/or day.
+// Rotated files are renamed with a timestamp suffix, e.g.
+// refresh.log.20260105-030000.123, plus a counter (refresh.log.20260105-030000.123-001)
+// if a backup with that name already exists.
+type RotatingFile struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	daily      bool
+	maxBackups int
+
+	file   *os.File
+	size   int64
+	opened time.Time
+	reopen bool // file was renamed to a backup but a new file couldn't be opened yet
+}
+
+// OpenRotatingFile opens (or creates) path for appending
+func OpenRotatingFile(path string, maxSize int64, daily bool, maxBackups int) (*RotatingFile, error) {
+	f := &RotatingFile{path: path, maxSize: maxSize, daily: daily, maxBackups: maxBackups}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("opening log file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("stat log file: %w", err)
+	}
+	f.file = file
+	f.size = info.Size()
+	f.opened = info.ModTime()
+	if f.size == 0 {
+		f.opened = time.Now()
+	}
+	return nil
+}
+
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// A failed rotation leaves the current file open, so the line is still
+	// written and the next write tries to rotate again
+	var rotateErr error
+	if f.shouldRotate(len(p)) {
+		rotateErr = f.rotate()
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	if err == nil {
+		err = rotateErr
+	}
+	return n, err
+}
+
+func (f *RotatingFile) shouldRotate(next int) bool {
+	if f.size == 0 {
+		return false
+	}
+	if f.maxSize > 0 && f.size+int64(next) > f.maxSize {
+		return true
+	}
+	if f.daily {
+		y1, m1, d1 := f.opened.Date()
+		y2, m2, d2 := time.Now().Date()
+		return y1 != y2 || m1 != m2 || d1 != d2
+	}
+	return false
+}
+
+// rotate renames the file to a backup and opens a new one. The current file
+// is only closed once the new one is open, so f.file stays usable if either
+// step fails; a rename that succeeded isn't repeated when the open is retried.
+func (f *RotatingFile) rotate() error {
+	if !f.reopen {
+		if err := os.Rename(f.path, f.backupName(time.Now())); err != nil {
+			return fmt.Errorf("rotating log file: %w", err)
+		}
+		f.reopen = true
+	}
+	old := f.file
+	if err := f.open(); err != nil {
+		return err
+	}
+	f.reopen = false
+	old.Close()
+	f.prune()
+	return nil
+}
+
+// backupName returns a name for the file rotated at t that no backup has yet,
+// so rotations within the same millisecond don't overwrite each other
+func (f *RotatingFile) backupName(t time.Time) string {
+	base := fmt.Sprintf("%s.%s", f.path, t.Format("20060102-150405.000"))
+	name := base
+	for i := 1; ; i++ {
+		if _, err := os.Lstat(name); os.IsNotExist(err) {
+			return name
+		}
+		name = fmt.Sprintf("%s-%03d", base, i)
+	}
+}
+
+// prune removes the oldest rotated files beyond maxBackups
+func (f *RotatingFile) prune() {
+	if f.maxBackups <= 0 {
+		return
+	}
+	matches, err := filepath.Glob(f.path + ".*")
+	if err != nil || len(matches) <= f.maxBackups {
+		return
+	}
+	// Timestamp suffixes sort chronologically
+	sort.Strings(matches)
+	for _, m := range matches[:len(matches)-f.maxBackups] {
+		os.Remove(m)
+	}
+}
+
+// Close closes the underlying file
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Close()
+}
@@ -0,0 +1,118 @@
+package notifications
+
+import (
+	"errors"
+	"fmt"
+
+	"dhi-oss-usage/internal/db"
+)
+
+var (
+	// ErrPendingNotFound is returned when a queued message doesn't exist
+	ErrPendingNotFound = errors.New("pending message not found")
+	// ErrPendingDecided is returned when a queued message was already approved or rejected
+	ErrPendingDecided = errors.New("pending message already decided")
+)
+
+// queueMessage renders the message for a project and holds it for approval.
+// The rendered text is stored so exactly what was reviewed is sent.
+func (s *Service) queueMessage(config *db.NotificationConfig, provider Provider, project *db.Project) {
+	projectID := project.ID
+	pending := &db.PendingMessage{ConfigID: config.ID, ProjectID: &projectID}
+	if social, ok := provider.(*socialProvider); ok {
+		text, err := social.render(project)
+		if err != nil {
+			s.logger.Errorf("Failed to render %s post for %s: %v", social.kind, project.RepoFullName, err)
+			s.logNotification(config.ID, &projectID, "failed", err.Error())
+			return
+		}
+		pending.Body = text
+	} else {
+		message := s.buildNewProjectMessage(project)
+		pending.Subject, pending.Body = message.Subject, message.Body
+	}
+
+	id, err := s.db.CreatePendingMessage(pending)
+	if err != nil {
+		s.logger.Errorf("Failed to queue message to %q about %s: %v", config.Name, project.RepoFullName, err)
+		s.logNotification(config.ID, &projectID, "failed", err.Error())
+		return
+	}
+	s.logger.Infof("Queued message %d to %q about %s for approval", id, config.Name, project.RepoFullName)
+}
+
+// ListPendingMessages returns queued messages, optionally filtered by status
+func (s *Service) ListPendingMessages(status string, limit int) ([]db.PendingMessage, error) {
+	return s.db.ListPendingMessages(status, limit)
+}
+
+// ApprovePendingMessage publishes a queued message exactly as it was reviewed.
+// Failed messages can be approved again to retry.
+func (s *Service) ApprovePendingMessage(id int64) (*db.PendingMessage, error) {
+	m, err := s.claimPendingMessage(id, []string{"pending", "failed"}, "sending")
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := s.sendPendingMessage(m)
+	status, errMsg := "sent", ""
+	if err != nil {
+		status, errMsg = "failed", err.Error()
+		s.logger.Errorf("Approved message %d failed to send: %v", id, err)
+	} else {
+		s.logger.Infof("Approved message %d sent", id)
+	}
+	s.logDelivery(m.ConfigID, m.ProjectID, payload, err)
+	if _, err := s.db.TransitionPendingMessage(id, []string{"sending"}, status, errMsg); err != nil {
+		return nil, fmt.Errorf("recording result: %w", err)
+	}
+	return s.db.GetPendingMessage(id)
+}
+
+// RejectPendingMessage discards a queued message without sending it
+func (s *Service) RejectPendingMessage(id int64) (*db.PendingMessage, error) {
+	if _, err := s.claimPendingMessage(id, []string{"pending", "failed"}, "rejected"); err != nil {
+		return nil, err
+	}
+	s.logger.Infof("Rejected message %d", id)
+	return s.db.GetPendingMessage(id)
+}
+
+// claimPendingMessage moves a message from one of the from statuses to to
+func (s *Service) claimPendingMessage(id int64, from []string, to string) (*db.PendingMessage, error) {
+	ok, err := s.db.TransitionPendingMessage(id, from, to, "")
+	if err != nil {
+		return nil, err
+	}
+	m, err := s.db.GetPendingMessage(id)
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		return nil, ErrPendingNotFound
+	}
+	if !ok {
+		return nil, ErrPendingDecided
+	}
+	return m, nil
+}
+
+// sendPendingMessage sends a reviewed message, returning the webhook payload if any
+func (s *Service) sendPendingMessage(m *db.PendingMessage) (string, error) {
+	config, err := s.db.GetNotificationConfig(m.ConfigID)
+	if err != nil {
+		return "", fmt.Errorf("getting notification config: %w", err)
+	}
+	if config == nil {
+		return "", fmt.Errorf("notification config %d no longer exists", m.ConfigID)
+	}
+	provider, err := s.createProvider(config)
+	if err != nil {
+		return "", fmt.Errorf("creating provider: %w", err)
+	}
+	if social, ok := provider.(*socialProvider); ok {
+		return "", social.client.post(m.Body)
+	}
+	// Without a project, providers send the subject and body as written
+	return s.send(provider, Message{Subject: m.Subject, Body: m.Body})
+}
@@ -0,0 +1,92 @@
+package notifications
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"dhi-oss-usage/internal/db"
+)
+
+// Backpressure keeps a huge refresh, like the first one of an install that
+// finds hundreds of adopters "new this week", from flooding channels with a
+// message per project.
+
+// summaryListed is how many projects a summary message names
+const summaryListed = 10
+
+// SetBackpressure limits the new-project messages sent to each config per
+// refresh. Above summaryThreshold projects a config gets one summary message
+// instead; otherwise at most maxPerRun messages go out, most-starred first.
+// 0 disables either.
+func (s *Service) SetBackpressure(maxPerRun, summaryThreshold int) {
+	s.maxPerRun = maxPerRun
+	s.summaryThreshold = summaryThreshold
+}
+
+// deliverNewProjects sends a config its new-project messages, applying
+// backpressure. Webhooks are exempt: receivers are programs that want every
+// event. Social posts can't carry a summary, so they're only capped; as they
+// are sent once per project, the rest go out with later refreshes.
+func (s *Service) deliverNewProjects(config *db.NotificationConfig, provider Provider, projects []db.Project) {
+	if len(projects) == 0 {
+		return
+	}
+	_, isWebhook := provider.(*outboundWebhook)
+	_, isSocial := provider.(*socialProvider)
+
+	if !isWebhook {
+		sort.SliceStable(projects, func(i, j int) bool { return projects[i].Stars > projects[j].Stars })
+
+		if !isSocial && s.summaryThreshold > 0 && len(projects) > s.summaryThreshold {
+			summary := buildSummaryMessage(projects)
+			payload, err := s.send(provider, summary)
+			if err != nil {
+				s.logger.Errorf("Failed to send %q a summary of %d new projects: %v", config.Name, len(projects), err)
+			} else {
+				s.logger.Infof("Sent %q a summary of %d new projects instead of individual messages", config.Name, len(projects))
+			}
+			s.logOutgoing(&db.NotificationLog{ConfigID: config.ID, Payload: payload, Suppressed: len(projects)}, summary, err)
+			return
+		}
+
+		if s.maxPerRun > 0 && len(projects) > s.maxPerRun {
+			dropped := len(projects) - s.maxPerRun
+			s.logger.Infof("Capping %q at %d new-project messages this run; %d suppressed", config.Name, s.maxPerRun, dropped)
+			s.db.CreateNotificationLog(&db.NotificationLog{ConfigID: config.ID, Status: "suppressed", Suppressed: dropped})
+			projects = projects[:s.maxPerRun]
+		}
+	}
+
+	for _, project := range projects {
+		message := s.buildNewProjectMessage(&project)
+		payload, err := s.send(provider, message)
+
+		projectID := project.ID
+		if err != nil {
+			s.logger.Errorf("Failed to notify %q about %s: %v", config.Name, project.RepoFullName, err)
+		} else {
+			s.logger.Infof("Notified %q about %s", config.Name, project.RepoFullName)
+		}
+		s.logOutgoing(&db.NotificationLog{ConfigID: config.ID, ProjectID: &projectID, Payload: payload}, message, err)
+	}
+}
+
+// buildSummaryMessage lists the most-starred of many new projects, which must
+// be sorted by stars
+func buildSummaryMessage(projects []db.Project) Message {
+	var body strings.Builder
+	fmt.Fprintf(&body, "%d projects adopted Docker Hardened Images this week. Top projects by stars:\n\n", len(projects))
+	for _, p := range projects[:min(len(projects), summaryListed)] {
+		fmt.Fprintf(&body, "• %s (%d ⭐) %s\n", p.RepoFullName, p.Stars, p.GitHubURL)
+	}
+	if rest := len(projects) - summaryListed; rest > 0 {
+		fmt.Fprintf(&body, "\n...and %d more.\n", rest)
+	}
+
+	return Message{
+		Subject:  fmt.Sprintf("%d New DHI Adoptions", len(projects)),
+		Body:     body.String(),
+		Projects: projects,
+	}
+}
@@ -0,0 +1,59 @@
+package notifications
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Compact messages are a single line, for busy channels that prefer terse
+// alerts to the rich layout. Slack and email configs pick them with
+// "format": "compact". Social posts are short already, and webhooks carry the
+// event itself, so they have no format.
+
+// formatCompact is the "format" of configs sending compact messages
+const formatCompact = "compact"
+
+// compactListed is how many projects a compact summary names
+const compactListed = 3
+
+// compactLine renders msg as one line, with link formatting a project's name
+// and URL the way the provider shows links
+func compactLine(msg Message, link func(name, url string) string) string {
+	switch {
+	case len(msg.Projects) > 0:
+		names := make([]string, 0, compactListed)
+		for _, p := range msg.Projects[:min(len(msg.Projects), compactListed)] {
+			names = append(names, fmt.Sprintf("%s %d ⭐", link(p.RepoFullName, p.GitHubURL), p.Stars))
+		}
+		line := fmt.Sprintf("🐳 %d new DHI adoptions: %s", len(msg.Projects), strings.Join(names, ", "))
+		if rest := len(msg.Projects) - len(names); rest > 0 {
+			line += fmt.Sprintf(" and %d more", rest)
+		}
+		return line
+	case msg.Project != nil:
+		line := fmt.Sprintf("🐳 New DHI adoption: %s · %d ⭐", link(msg.Project.RepoFullName, msg.Project.GitHubURL), msg.Project.Stars)
+		if msg.Project.SourceType != "" {
+			line += " · " + msg.Project.SourceType
+		}
+		return line
+	}
+	// Tests and alerts: the subject and the first line of the body
+	first, _, _ := strings.Cut(strings.TrimSpace(msg.Body), "\n")
+	if msg.Subject == "" {
+		return first
+	}
+	if first == "" {
+		return msg.Subject
+	}
+	return msg.Subject + ": " + first
+}
+
+// slackLink is a mrkdwn link
+func slackLink(name, url string) string {
+	return fmt.Sprintf("<%s|%s>", url, name)
+}
+
+// plainLink spells a link out for plain text
+func plainLink(name, url string) string {
+	return name + " " + url
+}
@@ -0,0 +1,60 @@
+package notifications
+
+import (
+	"errors"
+	"fmt"
+
+	"dhi-oss-usage/internal/db"
+)
+
+// Every refresh hands NotifyNewProjects the whole week's adopters, so each
+// config remembers which projects it was sent, alone or in a summary, and
+// isn't told about them again. A project counts as notified once its message
+// is delivered, on the first attempt or a retry; queued and pending messages
+// hold it back too. Resend bypasses this for when a message was lost.
+
+var (
+	// ErrConfigNotFound is returned when a notification config doesn't exist
+	ErrConfigNotFound = errors.New("notification config not found")
+	// ErrConfigDisabled is returned when sending through a disabled config
+	ErrConfigDisabled = errors.New("notification config is disabled")
+)
+
+// markNotified records the projects a delivered new-project message was about.
+// Events, tests and alerts aren't recorded.
+func (s *Service) markNotified(configID int64, msg Message) {
+	if msg.Event != nil {
+		return
+	}
+	var ids []int64
+	switch {
+	case len(msg.Projects) > 0:
+		for _, p := range msg.Projects {
+			ids = append(ids, p.ID)
+		}
+	case msg.Project != nil:
+		ids = []int64{msg.Project.ID}
+	default:
+		return
+	}
+	if err := s.db.MarkNotified(configID, ids); err != nil {
+		s.logger.Errorf("Failed to record projects notified to config %d: %v", configID, err)
+	}
+}
+
+// Resend sends a config the messages about projects again, including ones it
+// was already notified about. Filters, approval and backpressure apply as in
+// a refresh. It returns how many projects passed the filters.
+func (s *Service) Resend(configID int64, projects []db.Project) (int, error) {
+	config, err := s.db.GetNotificationConfig(configID)
+	if err != nil {
+		return 0, fmt.Errorf("getting notification config: %w", err)
+	}
+	if config == nil {
+		return 0, ErrConfigNotFound
+	}
+	if !config.Enabled {
+		return 0, ErrConfigDisabled
+	}
+	return s.notifyConfig(config, projects, true), nil
+}
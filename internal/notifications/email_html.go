@@ -0,0 +1,113 @@
+package notifications
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+
+	"dhi-oss-usage/internal/db"
+)
+
+// New-project emails carry an HTML part, a table of the projects with links,
+// next to the plain text one for clients that don't render HTML. Other emails,
+// like tests and alerts, stay plain text.
+
+// emailHTMLData is what emailHTMLTemplate renders
+type emailHTMLData struct {
+	Heading  string
+	Projects []db.Project
+	More     int // projects left out of the table
+}
+
+// Inline styles only: most email clients drop <style> blocks
+var emailHTMLTemplate = template.Must(template.New("email").Parse(`<!DOCTYPE html>
+<html>
+<body style="margin: 0; padding: 24px; background: #f5f5f5; font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif; color: #333;">
+<div style="max-width: 720px; margin: 0 auto; background: #fff; border-radius: 8px; padding: 24px;">
+<h2 style="margin: 0 0 16px; color: #1d63ed;">{{.Heading}}</h2>
+<table style="width: 100%; border-collapse: collapse; font-size: 14px;">
+<thead>
+<tr style="text-align: left; border-bottom: 2px solid #e0e0e0;">
+<th style="padding: 8px;">Repository</th>
+<th style="padding: 8px; text-align: right;">Stars</th>
+<th style="padding: 8px;">Language</th>
+<th style="padding: 8px;">Adopted</th>
+</tr>
+</thead>
+<tbody>
+{{- range .Projects}}
+<tr style="border-bottom: 1px solid #eee;">
+<td style="padding: 8px;"><a href="{{.GitHubURL}}" style="color: #1d63ed; font-weight: 600; text-decoration: none;">{{.RepoFullName}}</a>{{if .Description}}<div style="color: #666; font-size: 13px; margin-top: 2px;">{{.Description}}</div>{{end}}</td>
+<td style="padding: 8px; text-align: right; white-space: nowrap;">{{.Stars}} ⭐</td>
+<td style="padding: 8px;">{{.PrimaryLanguage}}</td>
+<td style="padding: 8px; white-space: nowrap;">{{if .AdoptedAt}}{{if .AdoptionCommit}}<a href="{{.AdoptionCommit}}" style="color: #1d63ed;">{{.AdoptedAt.Format "2006-01-02"}}</a>{{else}}{{.AdoptedAt.Format "2006-01-02"}}{{end}}{{else}}—{{end}}</td>
+</tr>
+{{- end}}
+</tbody>
+</table>
+{{- if .More}}
+<p style="color: #666;">...and {{.More}} more.</p>
+{{- end}}
+<p style="color: #999; font-size: 12px; margin-top: 24px;">Sent by DHI OSS Tracker</p>
+</div>
+</body>
+</html>
+`))
+
+// renderHTML returns the HTML part of msg, or "" when it has none: it isn't
+// about new projects, or the config asks for plain text or compact messages
+func (p *emailProvider) renderHTML(msg Message) (string, error) {
+	if p.config.Format == "text" || p.config.Format == formatCompact {
+		return "", nil
+	}
+	data := emailHTMLData{Heading: "New DHI Adoption Detected!"}
+	switch {
+	case len(msg.Projects) > 0:
+		data.Heading = fmt.Sprintf("%d projects adopted Docker Hardened Images this week", len(msg.Projects))
+		data.Projects = msg.Projects[:min(len(msg.Projects), summaryListed)]
+		data.More = len(msg.Projects) - len(data.Projects)
+	case msg.Project != nil:
+		data.Projects = []db.Project{*msg.Project}
+	default:
+		return "", nil
+	}
+
+	var buf bytes.Buffer
+	if err := emailHTMLTemplate.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("rendering HTML email: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// multipartBody builds a multipart/alternative body of a plain text and an
+// HTML part, returning its Content-Type header
+func multipartBody(text, html string) (contentType string, body []byte, err error) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=\"utf-8\"", text}, // last part is preferred, so plain text goes first
+		{"text/html; charset=\"utf-8\"", html},
+	} {
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return "", nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write([]byte(part.content)); err != nil {
+			return "", nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return "", nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return "", nil, err
+	}
+	return "multipart/alternative; boundary=" + mw.Boundary(), buf.Bytes(), nil
+}
@@ -0,0 +1,92 @@
+package notifications
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+
+	"dhi-oss-usage/internal/db"
+)
+
+// Filters narrow the new projects a config is notified about, so a channel
+// can get, say, only 500+ star Python projects. They are the "filters" object
+// of any provider's config_json. Each list matches any of its entries, unset
+// criteria match every project, and a project must match all that are set.
+type Filters struct {
+	MinStars    int      `json:"min_stars,omitempty"`
+	SourceTypes []string `json:"source_types,omitempty"`
+	Languages   []string `json:"languages,omitempty"` // primary language, case-insensitive
+	Repos       []string `json:"repos,omitempty"`     // repo_full_name patterns, e.g. acme/* (path.Match syntax, case-insensitive)
+}
+
+// filtersProperty is the schema of Filters, shared by every provider
+const filtersProperty = `"filters": {
+	"type": "object",
+	"title": "Filters",
+	"additionalProperties": false,
+	"description": "Only notify about new projects matching all of these",
+	"properties": {
+		"min_stars": {"type": "integer", "title": "Minimum stars"},
+		"source_types": {"type": "array", "title": "Source types", "items": {"type": "string"}, "description": "Searches that found the project, e.g. Dockerfiles"},
+		"languages": {"type": "array", "title": "Languages", "items": {"type": "string"}, "description": "Primary languages, e.g. Python"},
+		"repos": {"type": "array", "title": "Repositories", "items": {"type": "string"}, "description": "owner/repo patterns, e.g. acme/* or */*-operator"}
+	}
+}`
+
+// parseFilters reads the filters of a config_json document
+func parseFilters(configJSON string) (Filters, error) {
+	var config struct {
+		Filters Filters `json:"filters"`
+	}
+	if err := json.Unmarshal([]byte(configJSON), &config); err != nil {
+		return Filters{}, fmt.Errorf("parsing filters: %w", err)
+	}
+	return config.Filters, nil
+}
+
+// validateFilters checks the repo patterns of a config_json document compile
+func validateFilters(configJSON string) error {
+	filters, err := parseFilters(configJSON)
+	if err != nil {
+		return err
+	}
+	for _, pattern := range filters.Repos {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("filters.repos: invalid pattern %q", pattern)
+		}
+	}
+	return nil
+}
+
+// matches reports whether a project passes the filters
+func (f Filters) matches(project *db.Project) bool {
+	if project.Stars < f.MinStars {
+		return false
+	}
+	if len(f.SourceTypes) > 0 && !containsFold(f.SourceTypes, project.SourceType) {
+		return false
+	}
+	if len(f.Languages) > 0 && !containsFold(f.Languages, project.PrimaryLanguage) {
+		return false
+	}
+	if len(f.Repos) > 0 {
+		name := strings.ToLower(project.RepoFullName)
+		for _, pattern := range f.Repos {
+			if ok, _ := path.Match(strings.ToLower(pattern), name); ok {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func containsFold(values []string, s string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -2,13 +2,17 @@ package notifications
 
 import (
 	"bytes"
+	"context"
 	"dhi-oss-usage/internal/db"
+	"dhi-oss-usage/internal/logging"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/smtp"
 	"os"
 	"strings"
+	"sync"
+	"text/template"
 	"time"
 )
 
@@ -20,18 +24,33 @@ type Provider interface {
 
 // Message represents a notification message
 type Message struct {
-	Subject string
-	Body    string
-	Project *db.Project
+	Subject  string
+	Body     string
+	Project  *db.Project
+	Projects []db.Project // every project of a summary, most-starred first
+	Event    *Event       // sent as is by webhooks, which other providers ignore
 }
 
 // Service handles sending notifications
 type Service struct {
-	db *db.DB
+	db               db.NotificationStore
+	maxPerRun        int // new-project messages per config per run (0 = unlimited)
+	summaryThreshold int // more new projects than this are sent as one summary (0 = never)
+	maxAttempts      int // sends of a failed delivery in all, counting the first (< 2 = no retries)
+	retryBackoff     time.Duration
+	logger           *logging.Logger
 }
 
-func NewService(database *db.DB) *Service {
-	return &Service{db: database}
+func NewService(database db.NotificationStore) *Service {
+	return &Service{db: database, logger: logging.Notifications}
+}
+
+// WithContext returns a Service that logs with the attributes ctx carries,
+// such as the ID of the request or refresh job the notifications are sent for
+func (s *Service) WithContext(ctx context.Context) *Service {
+	c := *s
+	c.logger = logging.Notifications.Ctx(ctx)
+	return &c
 }
 
 // NotifyNewProjects sends notifications about new projects to all enabled configs
@@ -46,31 +65,64 @@ func (s *Service) NotifyNewProjects(projects []db.Project) error {
 	}
 
 	for _, config := range configs {
-		provider, err := s.createProvider(&config)
-		if err != nil {
-			// Log error but continue with other configs
-			s.logNotification(config.ID, nil, "failed", fmt.Sprintf("failed to create provider: %v", err))
+		s.notifyConfig(&config, projects, false)
+	}
+
+	return nil
+}
+
+// notifyConfig sends one config the messages about new projects that pass its
+// filters, returning how many projects that was. Unless forced, projects the
+// config was already notified about are skipped: refreshes re-notify the
+// whole week's adopters.
+func (s *Service) notifyConfig(config *db.NotificationConfig, projects []db.Project, force bool) int {
+	provider, err := s.createProvider(config)
+	if err != nil {
+		// Log error but continue with other configs
+		s.logger.Errorf("Error creating %s provider for %q: %v", config.Type, config.Name, err)
+		s.logNotification(config.ID, nil, "failed", fmt.Sprintf("failed to create provider: %v", err))
+		return 0
+	}
+
+	social, isSocial := provider.(*socialProvider)
+	queue := config.RequireApproval || (isSocial && social.queued())
+	hook, isWebhook := provider.(*outboundWebhook)
+	if isWebhook && !hook.subscribed(EventProjectAdopted) {
+		return 0
+	}
+
+	filters, err := parseFilters(config.ConfigJSON)
+	if err != nil {
+		s.logger.Errorf("Error reading filters of %q: %v", config.Name, err)
+		return 0
+	}
+
+	var outgoing []db.Project
+	matched := 0
+	for _, project := range projects {
+		if !filters.matches(&project) || (isSocial && !social.accepts(&project)) {
 			continue
 		}
-
-		// Send notification for each new project
-		for _, project := range projects {
-			message := s.buildNewProjectMessage(&project)
-			err := provider.Send(message)
-			
-			projectID := project.ID
-			if err != nil {
-				s.logNotification(config.ID, &projectID, "failed", err.Error())
-			} else {
-				s.logNotification(config.ID, &projectID, "sent", "")
+		if !force {
+			if done, err := s.db.HasNotified(config.ID, project.ID); err != nil || done {
+				if err != nil {
+					s.logger.Errorf("Error checking previous messages to %q about %s: %v", config.Name, project.RepoFullName, err)
+				}
+				continue
 			}
 		}
-
-		// Update last triggered time
-		s.db.UpdateNotificationTriggered(config.ID)
+		matched++
+		if queue {
+			s.queueMessage(config, provider, &project)
+			continue
+		}
+		outgoing = append(outgoing, project)
 	}
+	s.deliverNewProjects(config, provider, outgoing)
 
-	return nil
+	// Update last triggered time
+	s.db.UpdateNotificationTriggered(config.ID)
+	return matched
 }
 
 // SendTestNotification sends a test notification for a specific config
@@ -83,6 +135,55 @@ func (s *Service) SendTestNotification(configID int64) error {
 		return fmt.Errorf("notification config not found")
 	}
 
+	return s.sendTest(config)
+}
+
+// TestResult is the outcome of sending a test notification to one config
+type TestResult struct {
+	ConfigID   int64  `json:"config_id"`
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	Success    bool   `json:"success"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// SendTestToAll sends a test notification through every enabled config concurrently.
+// Results are returned in the same order as the configs.
+func (s *Service) SendTestToAll() ([]TestResult, error) {
+	configs, err := s.db.GetEnabledNotificationConfigs()
+	if err != nil {
+		return nil, fmt.Errorf("getting enabled notification configs: %w", err)
+	}
+
+	results := make([]TestResult, len(configs))
+	var wg sync.WaitGroup
+	for i := range configs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			config := &configs[i]
+			start := time.Now()
+			err := s.sendTest(config)
+			results[i] = TestResult{
+				ConfigID:   config.ID,
+				Name:       config.Name,
+				Type:       config.Type,
+				Success:    err == nil,
+				DurationMs: time.Since(start).Milliseconds(),
+			}
+			if err != nil {
+				results[i].Error = err.Error()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	return results, nil
+}
+
+// sendTest sends a test message through a config and logs the outcome
+func (s *Service) sendTest(config *db.NotificationConfig) error {
 	provider, err := s.createProvider(config)
 	if err != nil {
 		return fmt.Errorf("creating provider: %w", err)
@@ -93,13 +194,53 @@ func (s *Service) SendTestNotification(configID int64) error {
 		Body:    fmt.Sprintf("This is a test notification from DHI OSS Tracker.\n\nNotification: %s\nType: %s\nTime: %s", config.Name, config.Type, time.Now().Format(time.RFC1123)),
 	}
 
-	err = provider.Send(message)
+	payload, err := s.send(provider, message)
+	s.logDelivery(config.ID, nil, payload, err)
 	if err != nil {
-		s.logNotification(configID, nil, "failed", err.Error())
+		s.logger.Errorf("Test notification to %q failed: %v", config.Name, err)
 		return err
 	}
 
-	s.logNotification(configID, nil, "sent", "")
+	s.logger.Infof("Test notification sent to %q", config.Name)
+	return nil
+}
+
+// SendAlert sends an operational alert to the named notification configs.
+// Disabled configs are skipped.
+func (s *Service) SendAlert(configNames []string, subject, body string) error {
+	configs, err := s.db.GetEnabledNotificationConfigs()
+	if err != nil {
+		return fmt.Errorf("getting enabled notification configs: %w", err)
+	}
+
+	wanted := make(map[string]bool, len(configNames))
+	for _, name := range configNames {
+		wanted[name] = true
+	}
+
+	message := Message{Subject: subject, Body: body}
+	var failed []string
+	for _, config := range configs {
+		if !wanted[config.Name] {
+			continue
+		}
+		var payload string
+		provider, err := s.createProvider(&config)
+		if err == nil {
+			payload, err = s.send(provider, message)
+		}
+		s.logOutgoing(&db.NotificationLog{ConfigID: config.ID, Payload: payload}, message, err)
+		if err != nil {
+			s.logger.Errorf("Alert to %q failed: %v", config.Name, err)
+			failed = append(failed, config.Name)
+			continue
+		}
+		s.logger.Infof("Alert sent to %q: %s", config.Name, subject)
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("alert failed for: %s", strings.Join(failed, ", "))
+	}
 	return nil
 }
 
@@ -109,6 +250,12 @@ func (s *Service) createProvider(config *db.NotificationConfig) (Provider, error
 		return newSlackProvider(config.ConfigJSON)
 	case "email":
 		return newEmailProvider(config.ConfigJSON)
+	case "x":
+		return newXProvider(config.ConfigJSON)
+	case "bluesky":
+		return newBlueskyProvider(config.ConfigJSON)
+	case "webhook":
+		return newWebhookProvider(config.ConfigJSON)
 	default:
 		return nil, fmt.Errorf("unknown notification type: %s", config.Type)
 	}
@@ -156,12 +303,17 @@ func (s *Service) logNotification(configID int64, projectID *int64, status strin
 // Slack Provider
 
 type SlackConfig struct {
-	WebhookURL string `json:"webhook_url"`
-	Channel    string `json:"channel,omitempty"`
+	WebhookURL     string `json:"webhook_url"`
+	Channel        string `json:"channel,omitempty"`
+	Template       string `json:"template,omitempty"`        // mrkdwn text of new-project messages, replacing the default fields
+	BlocksTemplate string `json:"blocks_template,omitempty"` // Block Kit JSON array of new-project messages; wins over template
+	Format         string `json:"format,omitempty"`          // rich (default) or compact; templates win over compact for new-project messages
 }
 
 type slackProvider struct {
-	config SlackConfig
+	config     SlackConfig
+	tmpl       *template.Template
+	blocksTmpl *template.Template
 }
 
 func newSlackProvider(configJSON string) (*slackProvider, error) {
@@ -172,7 +324,39 @@ func newSlackProvider(configJSON string) (*slackProvider, error) {
 	if config.WebhookURL == "" {
 		return nil, fmt.Errorf("webhook_url is required")
 	}
-	return &slackProvider{config: config}, nil
+	p := &slackProvider{config: config}
+	var err error
+	if p.tmpl, err = parseTemplate("template", config.Template); err != nil {
+		return nil, err
+	}
+	if p.blocksTmpl, err = parseTemplate("blocks_template", config.BlocksTemplate); err != nil {
+		return nil, err
+	}
+	if p.blocksTmpl != nil {
+		sample := sampleProject
+		if _, err := p.renderBlocks(&sample); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+func validateSlackConfig(configJSON string) error {
+	_, err := newSlackProvider(configJSON)
+	return err
+}
+
+// renderBlocks renders the blocks template, which must produce a JSON array
+func (p *slackProvider) renderBlocks(project *db.Project) ([]interface{}, error) {
+	text, err := execute(p.blocksTmpl, project)
+	if err != nil {
+		return nil, err
+	}
+	var blocks []interface{}
+	if err := json.Unmarshal([]byte(text), &blocks); err != nil {
+		return nil, fmt.Errorf("blocks_template must render a JSON array of blocks: %v", err)
+	}
+	return blocks, nil
 }
 
 func (p *slackProvider) Type() string {
@@ -180,18 +364,56 @@ func (p *slackProvider) Type() string {
 }
 
 func (p *slackProvider) Send(msg Message) error {
+	payload, err := p.payload(msg)
+	if err != nil {
+		return err
+	}
+	return p.deliver(payload)
+}
+
+// payload builds the Slack message for msg
+func (p *slackProvider) payload(msg Message) ([]byte, error) {
+	header := "🐳 New DHI Adoption"
+	if msg.Project == nil && msg.Subject != "" {
+		header = msg.Subject
+	}
+
+	if msg.Project != nil && p.blocksTmpl != nil {
+		blocks, err := p.renderBlocks(msg.Project)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(map[string]interface{}{"blocks": blocks})
+	}
+
+	if p.config.Format == formatCompact && (msg.Project == nil || p.tmpl == nil) {
+		return json.Marshal(map[string]string{"text": compactLine(msg, slackLink)})
+	}
+
 	// Build Slack message with blocks for better formatting
 	blocks := []map[string]interface{}{
 		{
 			"type": "header",
 			"text": map[string]string{
 				"type": "plain_text",
-				"text": "🐳 New DHI Adoption",
+				"text": header,
 			},
 		},
 	}
 
-	if msg.Project != nil {
+	if msg.Project != nil && p.tmpl != nil {
+		text, err := execute(p.tmpl, msg.Project)
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, map[string]interface{}{
+			"type": "section",
+			"text": map[string]string{
+				"type": "mrkdwn",
+				"text": text,
+			},
+		})
+	} else if msg.Project != nil {
 		// Project notification
 		fields := []map[string]interface{}{
 			{
@@ -236,7 +458,7 @@ func (p *slackProvider) Send(msg Message) error {
 			})
 		}
 	} else {
-		// Test notification
+		// Test or alert notification
 		blocks = append(blocks, map[string]interface{}{
 			"type": "section",
 			"text": map[string]string{
@@ -252,10 +474,14 @@ func (p *slackProvider) Send(msg Message) error {
 
 	jsonData, err := json.Marshal(payload)
 	if err != nil {
-		return fmt.Errorf("marshaling slack payload: %w", err)
+		return nil, fmt.Errorf("marshaling slack payload: %w", err)
 	}
+	return jsonData, nil
+}
 
-	resp, err := http.Post(p.config.WebhookURL, "application/json", bytes.NewBuffer(jsonData))
+// deliver posts a built payload to the webhook
+func (p *slackProvider) deliver(payload []byte) error {
+	resp, err := http.Post(p.config.WebhookURL, "application/json", bytes.NewBuffer(payload))
 	if err != nil {
 		return fmt.Errorf("sending slack webhook: %w", err)
 	}
@@ -271,12 +497,17 @@ func (p *slackProvider) Send(msg Message) error {
 // Email Provider
 
 type EmailConfig struct {
-	To   string `json:"to"`
-	From string `json:"from,omitempty"`
+	To              string `json:"to"`
+	From            string `json:"from,omitempty"`
+	SubjectTemplate string `json:"subject_template,omitempty"` // subject of new-project messages
+	Template        string `json:"template,omitempty"`         // body of new-project messages
+	Format          string `json:"format,omitempty"`           // html (default) adds an HTML part to new-project messages; text doesn't; compact sends one line of text
 }
 
 type emailProvider struct {
 	config       EmailConfig
+	subjectTmpl  *template.Template
+	bodyTmpl     *template.Template
 	smtpHost     string
 	smtpPort     string
 	smtpUsername string
@@ -284,7 +515,8 @@ type emailProvider struct {
 	smtpFrom     string
 }
 
-func newEmailProvider(configJSON string) (*emailProvider, error) {
+// parseEmailConfig parses config_json of the email provider with its templates
+func parseEmailConfig(configJSON string) (*emailProvider, error) {
 	var config EmailConfig
 	if err := json.Unmarshal([]byte(configJSON), &config); err != nil {
 		return nil, fmt.Errorf("parsing email config: %w", err)
@@ -292,6 +524,28 @@ func newEmailProvider(configJSON string) (*emailProvider, error) {
 	if config.To == "" {
 		return nil, fmt.Errorf("recipient email (to) is required")
 	}
+	p := &emailProvider{config: config}
+	var err error
+	if p.subjectTmpl, err = parseTemplate("subject_template", config.SubjectTemplate); err != nil {
+		return nil, err
+	}
+	if p.bodyTmpl, err = parseTemplate("template", config.Template); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func validateEmailConfig(configJSON string) error {
+	_, err := parseEmailConfig(configJSON)
+	return err
+}
+
+func newEmailProvider(configJSON string) (*emailProvider, error) {
+	p, err := parseEmailConfig(configJSON)
+	if err != nil {
+		return nil, err
+	}
+	config := p.config
 
 	// Get SendGrid credentials from environment
 	smtpHost := getEnv("SENDGRID_SMTP_HOST", "smtp.sendgrid.net")
@@ -309,24 +563,52 @@ func newEmailProvider(configJSON string) (*emailProvider, error) {
 		smtpFrom = config.From
 	}
 
-	return &emailProvider{
-		config:       config,
-		smtpHost:     smtpHost,
-		smtpPort:     smtpPort,
-		smtpUsername: smtpUsername,
-		smtpPassword: smtpPassword,
-		smtpFrom:     smtpFrom,
-	}, nil
+	p.smtpHost = smtpHost
+	p.smtpPort = smtpPort
+	p.smtpUsername = smtpUsername
+	p.smtpPassword = smtpPassword
+	p.smtpFrom = smtpFrom
+	return p, nil
 }
 
 func (p *emailProvider) Type() string {
 	return "email"
 }
 
+// render returns the subject and body of msg, from the templates for new-project messages
+func (p *emailProvider) render(msg Message) (subject, body string, err error) {
+	subject, body = msg.Subject, msg.Body
+	if p.config.Format == formatCompact && (msg.Project == nil || p.bodyTmpl == nil) {
+		body = compactLine(msg, plainLink)
+	}
+	if msg.Project == nil {
+		return subject, body, nil
+	}
+	if p.subjectTmpl != nil {
+		if subject, err = execute(p.subjectTmpl, msg.Project); err != nil {
+			return "", "", err
+		}
+		subject = strings.Join(strings.Fields(subject), " ") // headers are one line
+	}
+	if p.bodyTmpl != nil {
+		if body, err = execute(p.bodyTmpl, msg.Project); err != nil {
+			return "", "", err
+		}
+	}
+	return subject, body, nil
+}
+
 func (p *emailProvider) Send(msg Message) error {
 	// Build email
-	subject := msg.Subject
-	body := msg.Body
+	subject, body, err := p.render(msg)
+	if err != nil {
+		return err
+	}
+
+	html, err := p.renderHTML(msg)
+	if err != nil {
+		return err
+	}
 
 	headers := make(map[string]string)
 	headers["From"] = p.smtpFrom
@@ -335,18 +617,25 @@ func (p *emailProvider) Send(msg Message) error {
 	headers["MIME-Version"] = "1.0"
 	headers["Content-Type"] = "text/plain; charset=\"utf-8\""
 
+	content := []byte(body)
+	if html != "" {
+		if headers["Content-Type"], content, err = multipartBody(body, html); err != nil {
+			return fmt.Errorf("building email: %w", err)
+		}
+	}
+
 	var emailMsg strings.Builder
 	for k, v := range headers {
 		emailMsg.WriteString(fmt.Sprintf("%s: %s\r\n", k, v))
 	}
 	emailMsg.WriteString("\r\n")
-	emailMsg.WriteString(body)
+	emailMsg.Write(content)
 
 	// Send email via SendGrid
 	addr := fmt.Sprintf("%s:%s", p.smtpHost, p.smtpPort)
 	auth := smtp.PlainAuth("", p.smtpUsername, p.smtpPassword, p.smtpHost)
 
-	err := smtp.SendMail(addr, auth, p.smtpFrom, []string{p.config.To}, []byte(emailMsg.String()))
+	err = smtp.SendMail(addr, auth, p.smtpFrom, []string{p.config.To}, []byte(emailMsg.String()))
 	if err != nil {
 		return fmt.Errorf("sending email via SendGrid: %w", err)
 	}
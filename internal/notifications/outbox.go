@@ -0,0 +1,143 @@
+package notifications
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"dhi-oss-usage/internal/db"
+)
+
+// Failed deliveries of refresh notifications, alerts and webhook events go to
+// an outbox and are retried with exponential backoff, so a Slack outage or an
+// SMTP hiccup doesn't lose them. Their log entry stays pending until a retry
+// succeeds (sent) or the attempts run out (failed). Test notifications and
+// approved messages aren't retried: someone is waiting on the result.
+
+// retryBatch is how many due retries RetryDue sends at most
+const retryBatch = 50
+
+// SetRetries sets how many times a delivery is attempted in all, and the delay
+// before the first retry, which doubles after each. Fewer than 2 attempts
+// turns retries off.
+func (s *Service) SetRetries(maxAttempts int, backoff time.Duration) {
+	s.maxAttempts = maxAttempts
+	s.retryBackoff = backoff
+}
+
+// logOutgoing logs a delivery like logDelivery, scheduling a retry of msg if
+// it failed and retries are on
+func (s *Service) logOutgoing(log *db.NotificationLog, msg Message, sendErr error) {
+	log.Status = "sent"
+	if sendErr != nil {
+		log.Status, log.ErrorMessage = "failed", sendErr.Error()
+	}
+	retry := sendErr != nil && s.maxAttempts > 1
+	var message []byte
+	if retry {
+		var err error
+		if message, err = json.Marshal(msg); err != nil {
+			s.logger.Errorf("Can't retry delivery to config %d: %v", log.ConfigID, err)
+			retry = false
+		} else {
+			log.Status = "pending"
+		}
+	}
+	if err := s.db.CreateNotificationLog(log); err != nil || !retry {
+		if sendErr == nil {
+			s.markNotified(log.ConfigID, msg)
+		}
+		return
+	}
+
+	entry := &db.OutboxEntry{
+		LogID:         log.ID,
+		ConfigID:      log.ConfigID,
+		Message:       string(message),
+		Attempts:      1,
+		NextAttemptAt: time.Now().Add(s.retryBackoff),
+	}
+	if err := s.db.CreateOutboxEntry(entry); err != nil {
+		s.logger.Errorf("Failed to schedule retry of log %d: %v", log.ID, err)
+		// Settle the log entry, which would otherwise stay pending
+		s.db.RecordOutboxAttempt(&db.OutboxEntry{ID: entry.ID, LogID: log.ID, Attempts: 1, Status: "failed"}, log.ErrorMessage)
+		return
+	}
+	s.logger.Infof("Retrying delivery %d to config %d in %s", log.ID, log.ConfigID, s.retryBackoff)
+}
+
+// RetryDue retries the deliveries in the outbox that are due
+func (s *Service) RetryDue() error {
+	entries, err := s.db.DueOutboxEntries(time.Now(), retryBatch)
+	if err != nil {
+		return fmt.Errorf("getting due retries: %w", err)
+	}
+	for i := range entries {
+		s.retry(&entries[i])
+	}
+	return nil
+}
+
+// retry makes one more attempt at a delivery and records the outcome
+func (s *Service) retry(entry *db.OutboxEntry) {
+	entry.Attempts++
+	msg, err := s.resend(entry)
+	switch {
+	case err == nil:
+		entry.Status = "delivered"
+		s.markNotified(entry.ConfigID, msg)
+		s.logger.Infof("Delivered %d to config %d on attempt %d", entry.LogID, entry.ConfigID, entry.Attempts)
+	case entry.Attempts >= s.maxAttempts:
+		entry.Status = "failed"
+		s.logger.Errorf("Giving up on delivery %d to config %d after %d attempts: %v", entry.LogID, entry.ConfigID, entry.Attempts, err)
+	default:
+		delay := s.retryBackoff << (entry.Attempts - 1)
+		entry.NextAttemptAt = time.Now().Add(delay)
+		s.logger.Warnf("Attempt %d of delivery %d to config %d failed, retrying in %s: %v", entry.Attempts, entry.LogID, entry.ConfigID, delay, err)
+	}
+
+	errMsg := ""
+	if err != nil {
+		errMsg = err.Error()
+	}
+	if err := s.db.RecordOutboxAttempt(entry, errMsg); err != nil {
+		s.logger.Errorf("Failed to record retry of delivery %d: %v", entry.LogID, err)
+	}
+}
+
+// resend sends an outbox entry's message through its config as it is now,
+// returning the message. Webhooks get the payload of the first attempt, so
+// receivers can dedupe on the event ID.
+func (s *Service) resend(entry *db.OutboxEntry) (Message, error) {
+	var msg Message
+	if err := json.Unmarshal([]byte(entry.Message), &msg); err != nil {
+		return msg, fmt.Errorf("decoding message: %w", err)
+	}
+	config, err := s.db.GetNotificationConfig(entry.ConfigID)
+	if err != nil {
+		return msg, fmt.Errorf("getting notification config: %w", err)
+	}
+	if config == nil {
+		return msg, fmt.Errorf("notification config %d no longer exists", entry.ConfigID)
+	}
+	if !config.Enabled {
+		return msg, fmt.Errorf("notification config %q is disabled", config.Name)
+	}
+	provider, err := s.createProvider(config)
+	if err != nil {
+		return msg, fmt.Errorf("creating provider: %w", err)
+	}
+
+	if hook, ok := provider.(webhookProvider); ok {
+		logged, err := s.db.GetNotificationLog(entry.LogID)
+		if err != nil {
+			return msg, fmt.Errorf("getting notification log: %w", err)
+		}
+		if logged != nil && logged.Payload != "" {
+			return msg, hook.deliver([]byte(logged.Payload))
+		}
+	}
+
+	_, err = s.send(provider, msg)
+	return msg, err
+}
@@ -0,0 +1,176 @@
+package notifications
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+)
+
+// ProviderInfo describes a notification provider type so clients can render config forms
+type ProviderInfo struct {
+	Type         string          `json:"type"`
+	Name         string          `json:"name"`
+	Description  string          `json:"description"`
+	ConfigSchema json.RawMessage `json:"config_schema"` // JSON Schema for config_json
+	EnvVars      []EnvVar        `json:"env_vars"`
+	Configured   bool            `json:"configured"` // every required env var is set
+
+	validate func(configJSON string) error // checks beyond the schema, if any
+}
+
+// EnvVar is a server-side environment variable a provider reads
+type EnvVar struct {
+	Name        string `json:"name"`
+	Required    bool   `json:"required"`
+	Default     string `json:"default,omitempty"`
+	Description string `json:"description"`
+	Set         bool   `json:"set"`
+}
+
+// providers lists every supported provider type. createProvider must handle each Type,
+// and ValidateConfig checks config_json against ConfigSchema on create and update.
+// Every schema includes the shared filters property.
+var providers = []ProviderInfo{
+	{
+		Type:        "slack",
+		Name:        "Slack",
+		Description: "Posts to a Slack channel through an incoming webhook",
+		ConfigSchema: json.RawMessage(`{
+			"type": "object",
+			"required": ["webhook_url"],
+			"properties": {
+				` + filtersProperty + `,
+				"webhook_url": {"type": "string", "title": "Webhook URL", "format": "uri", "pattern": "^https?://", "description": "Incoming webhook URL from your Slack app"},
+				"channel": {"type": "string", "title": "Channel", "description": "Override the webhook's default channel"},
+				"template": {"type": "string", "title": "Message template", "description": "Go text/template over the project (.RepoFullName, .Stars, .Description, .PrimaryLanguage, .GitHubURL, .SourceType, .AdoptionCommit) rendered as mrkdwn in place of the default fields"},
+				"blocks_template": {"type": "string", "title": "Block Kit template", "description": "Go text/template rendering a JSON array of Block Kit blocks; use {{json .Description}} to quote values. Overrides template"},
+				"format": {"type": "string", "title": "Format", "enum": ["rich", "compact"], "description": "rich (default) posts blocks with a header and fields; compact posts one line per message, for busy channels. Templates still apply to new-project messages"}
+			}
+		}`),
+		validate: validateSlackConfig,
+	},
+	{
+		Type:        "email",
+		Name:        "Email",
+		Description: "Sends email through SendGrid SMTP",
+		ConfigSchema: json.RawMessage(`{
+			"type": "object",
+			"required": ["to"],
+			"properties": {
+				` + filtersProperty + `,
+				"to": {"type": "string", "title": "Recipient", "format": "email", "description": "Address to send notifications to"},
+				"from": {"type": "string", "title": "From", "format": "email", "description": "Override SENDGRID_FROM_EMAIL"},
+				"subject_template": {"type": "string", "title": "Subject template", "description": "Go text/template over the project for the subject of new-project emails"},
+				"template": {"type": "string", "title": "Body template", "description": "Go text/template over the project for the body of new-project emails"},
+				"format": {"type": "string", "title": "Format", "enum": ["html", "text", "compact"], "description": "html (default) adds a table of the new projects to new-project emails, next to the plain text; text sends plain text only; compact sends a one-line body. A body template still applies to new-project emails"}
+			}
+		}`),
+		EnvVars: []EnvVar{
+			{Name: "SENDGRID_API_KEY", Required: true, Description: "SendGrid API key"},
+			{Name: "SENDGRID_FROM_EMAIL", Default: "noreply@dhi-tracker.local", Description: "Default sender address"},
+			{Name: "SENDGRID_SMTP_HOST", Default: "smtp.sendgrid.net", Description: "SMTP host"},
+			{Name: "SENDGRID_SMTP_PORT", Default: "587", Description: "SMTP port"},
+			{Name: "SENDGRID_USERNAME", Default: "apikey", Description: "SMTP username"},
+		},
+		validate: validateEmailConfig,
+	},
+	{
+		Type:        "x",
+		Name:        "X (Twitter)",
+		Description: "Posts a celebratory message when a project above a star threshold adopts DHI",
+		ConfigSchema: json.RawMessage(`{
+			"type": "object",
+			"additionalProperties": false,
+			"properties": {
+				` + filtersProperty + `,
+				"min_stars": {"type": "integer", "title": "Minimum stars", "description": "Only post about projects with at least this many stars"},
+				"template": {"type": "string", "title": "Template", "description": "Go text/template over the project (.RepoFullName, .Stars, .Description, .PrimaryLanguage, .GitHubURL, .SourceType); defaults to a short celebratory post"},
+				"mode": {"type": "string", "title": "Mode", "enum": ["post", "queue"], "description": "post publishes immediately; queue holds posts for approval"}
+			}
+		}`),
+		EnvVars: []EnvVar{
+			{Name: "X_API_KEY", Required: true, Description: "API key (consumer key) of the X app"},
+			{Name: "X_API_SECRET", Required: true, Description: "API key secret"},
+			{Name: "X_ACCESS_TOKEN", Required: true, Description: "Access token of the posting account"},
+			{Name: "X_ACCESS_TOKEN_SECRET", Required: true, Description: "Access token secret"},
+		},
+		validate: validateSocialConfig,
+	},
+	{
+		Type:        "bluesky",
+		Name:        "Bluesky",
+		Description: "Posts a celebratory message when a project above a star threshold adopts DHI",
+		ConfigSchema: json.RawMessage(`{
+			"type": "object",
+			"additionalProperties": false,
+			"properties": {
+				` + filtersProperty + `,
+				"min_stars": {"type": "integer", "title": "Minimum stars", "description": "Only post about projects with at least this many stars"},
+				"template": {"type": "string", "title": "Template", "description": "Go text/template over the project (.RepoFullName, .Stars, .Description, .PrimaryLanguage, .GitHubURL, .SourceType); defaults to a short celebratory post"},
+				"mode": {"type": "string", "title": "Mode", "enum": ["post", "queue"], "description": "post publishes immediately; queue holds posts for approval"}
+			}
+		}`),
+		EnvVars: []EnvVar{
+			{Name: "BLUESKY_HANDLE", Required: true, Description: "Handle of the posting account, e.g. dhi.bsky.social"},
+			{Name: "BLUESKY_APP_PASSWORD", Required: true, Description: "App password for the account"},
+			{Name: "BLUESKY_SERVICE", Default: "https://bsky.social", Description: "PDS host of the account"},
+		},
+		validate: validateSocialConfig,
+	},
+	{
+		Type:        "webhook",
+		Name:        "Webhook",
+		Description: "POSTs a JSON event, optionally signed with HMAC-SHA256, to any URL",
+		ConfigSchema: json.RawMessage(`{
+			"type": "object",
+			"required": ["url"],
+			"additionalProperties": false,
+			"properties": {
+				` + filtersProperty + `,
+				"url": {"type": "string", "title": "URL", "format": "uri", "pattern": "^https?://", "description": "Endpoint that receives events"},
+				"secret": {"type": "string", "title": "Secret", "minLength": 16, "description": "Signs each delivery in the X-DHI-Signature-256 header (sha256=<hex HMAC of the body>)"},
+				"events": {"type": "array", "title": "Events", "items": {"type": "string", "enum": ["project.adopted", "project.removed", "refresh.failed", "milestone.reached"]}, "description": "Event types to send; all when empty"}
+			}
+		}`),
+	},
+}
+
+// Providers describes the available provider types, including whether their
+// environment variables are set on this server
+func Providers() []ProviderInfo {
+	out := make([]ProviderInfo, len(providers))
+	for i, p := range providers {
+		p.Configured = true
+		env := make([]EnvVar, len(p.EnvVars))
+		for j, v := range p.EnvVars {
+			v.Set = os.Getenv(v.Name) != ""
+			if v.Required && !v.Set {
+				p.Configured = false
+			}
+			env[j] = v
+		}
+		p.EnvVars = env
+		p.ConfigSchema = compactJSON(p.ConfigSchema)
+		out[i] = p
+	}
+	return out
+}
+
+// LookupProvider returns the description of a provider type
+func LookupProvider(providerType string) (ProviderInfo, bool) {
+	for _, p := range Providers() {
+		if p.Type == providerType {
+			return p, true
+		}
+	}
+	return ProviderInfo{}, false
+}
+
+// compactJSON strips the indentation used to keep schemas readable in source
+func compactJSON(raw json.RawMessage) json.RawMessage {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, raw); err != nil {
+		return raw
+	}
+	return buf.Bytes()
+}
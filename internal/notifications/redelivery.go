@@ -0,0 +1,102 @@
+package notifications
+
+import (
+	"errors"
+	"fmt"
+
+	"dhi-oss-usage/internal/db"
+)
+
+var (
+	// ErrLogNotFound is returned when a delivery doesn't exist for the config
+	ErrLogNotFound = errors.New("notification log not found")
+	// ErrNotRedeliverable is returned when a delivery has no stored payload,
+	// either because its provider isn't a webhook or it predates payload storage
+	ErrNotRedeliverable = errors.New("delivery has no stored payload")
+)
+
+// webhookProvider is a provider that POSTs a JSON payload. Payloads are built
+// separately from delivery so they can be logged and replayed byte for byte.
+type webhookProvider interface {
+	Provider
+	payload(msg Message) ([]byte, error)
+	deliver(payload []byte) error
+}
+
+// send sends a message through a provider, returning the payload delivered
+// when the provider is a webhook
+func (s *Service) send(provider Provider, msg Message) (string, error) {
+	hook, ok := provider.(webhookProvider)
+	if !ok {
+		return "", provider.Send(msg)
+	}
+	payload, err := hook.payload(msg)
+	if err != nil {
+		return "", err
+	}
+	return string(payload), hook.deliver(payload)
+}
+
+// logDelivery logs the outcome of a send along with its webhook payload
+func (s *Service) logDelivery(configID int64, projectID *int64, payload string, sendErr error) {
+	log := &db.NotificationLog{
+		ConfigID:  configID,
+		ProjectID: projectID,
+		Status:    "sent",
+		Payload:   payload,
+	}
+	if sendErr != nil {
+		log.Status, log.ErrorMessage = "failed", sendErr.Error()
+	}
+	s.db.CreateNotificationLog(log)
+}
+
+// Redeliver replays a logged webhook delivery of a config with its stored
+// payload, as GitHub's redelivery does. The replay is logged as a new entry
+// pointing back at the original, which is returned whether or not it succeeded.
+func (s *Service) Redeliver(configID, logID int64) (*db.NotificationLog, error) {
+	original, err := s.db.GetNotificationLog(logID)
+	if err != nil {
+		return nil, fmt.Errorf("getting notification log: %w", err)
+	}
+	if original == nil || original.ConfigID != configID {
+		return nil, ErrLogNotFound
+	}
+	if original.Payload == "" {
+		return nil, ErrNotRedeliverable
+	}
+
+	config, err := s.db.GetNotificationConfig(configID)
+	if err != nil {
+		return nil, fmt.Errorf("getting notification config: %w", err)
+	}
+	if config == nil {
+		return nil, ErrLogNotFound
+	}
+	provider, err := s.createProvider(config)
+	if err != nil {
+		return nil, fmt.Errorf("creating provider: %w", err)
+	}
+	hook, ok := provider.(webhookProvider)
+	if !ok {
+		return nil, ErrNotRedeliverable
+	}
+
+	redelivery := &db.NotificationLog{
+		ConfigID:     configID,
+		ProjectID:    original.ProjectID,
+		Status:       "sent",
+		Payload:      original.Payload,
+		RedeliveryOf: &original.ID,
+	}
+	if err := hook.deliver([]byte(original.Payload)); err != nil {
+		s.logger.Errorf("Redelivery of %d to %q failed: %v", logID, config.Name, err)
+		redelivery.Status, redelivery.ErrorMessage = "failed", err.Error()
+	} else {
+		s.logger.Infof("Redelivered %d to %q", logID, config.Name)
+	}
+	if err := s.db.CreateNotificationLog(redelivery); err != nil {
+		return nil, fmt.Errorf("logging redelivery: %w", err)
+	}
+	return s.db.GetNotificationLog(redelivery.ID)
+}
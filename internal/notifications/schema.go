@@ -0,0 +1,183 @@
+package notifications
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// schema is the subset of JSON Schema used by provider config schemas:
+// type, required, properties, additionalProperties, items, enum, minLength,
+// pattern and the "email" and "uri" formats.
+type schema struct {
+	Type                 string             `json:"type"`
+	Required             []string           `json:"required"`
+	Properties           map[string]*schema `json:"properties"`
+	AdditionalProperties *bool              `json:"additionalProperties"`
+	Items                *schema            `json:"items"`
+	Enum                 []interface{}      `json:"enum"`
+	MinLength            int                `json:"minLength"`
+	Pattern              string             `json:"pattern"`
+	Format               string             `json:"format"`
+}
+
+// ValidateConfig checks a config_json document against the provider's schema
+func ValidateConfig(providerType, configJSON string) error {
+	var info *ProviderInfo
+	types := make([]string, 0, len(providers))
+	for i := range providers {
+		types = append(types, providers[i].Type)
+		if providers[i].Type == providerType {
+			info = &providers[i]
+		}
+	}
+	if info == nil {
+		return fmt.Errorf("type must be one of: %s", strings.Join(types, ", "))
+	}
+
+	var s schema
+	if err := json.Unmarshal(info.ConfigSchema, &s); err != nil {
+		return fmt.Errorf("invalid %s config schema: %w", providerType, err)
+	}
+
+	var doc interface{}
+	if err := json.Unmarshal([]byte(configJSON), &doc); err != nil {
+		return fmt.Errorf("config_json is not valid JSON: %v", err)
+	}
+
+	if errs := s.validate("", doc); len(errs) > 0 {
+		return fmt.Errorf("invalid %s config: %s", providerType, strings.Join(errs, "; "))
+	}
+	if err := validateFilters(configJSON); err != nil {
+		return fmt.Errorf("invalid %s config: %v", providerType, err)
+	}
+	if info.validate != nil {
+		if err := info.validate(configJSON); err != nil {
+			return fmt.Errorf("invalid %s config: %v", providerType, err)
+		}
+	}
+	return nil
+}
+
+// validate returns a message for each violation at path
+func (s *schema) validate(path string, v interface{}) []string {
+	name := path
+	if name == "" {
+		name = "config"
+	}
+
+	if s.Type != "" && !matchesType(s.Type, v) {
+		return []string{fmt.Sprintf("%s must be of type %s", name, s.Type)}
+	}
+
+	var errs []string
+	if len(s.Enum) > 0 {
+		found := false
+		for _, e := range s.Enum {
+			if fmt.Sprint(e) == fmt.Sprint(v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			errs = append(errs, fmt.Sprintf("%s must be one of %v", name, s.Enum))
+		}
+	}
+
+	switch val := v.(type) {
+	case string:
+		errs = append(errs, s.validateString(name, val)...)
+	case []interface{}:
+		if s.Items != nil {
+			for i, item := range val {
+				errs = append(errs, s.Items.validate(fmt.Sprintf("%s[%d]", name, i), item)...)
+			}
+		}
+	case map[string]interface{}:
+		for _, req := range s.Required {
+			if x, ok := val[req]; !ok || x == nil || x == "" {
+				errs = append(errs, fmt.Sprintf("%s is required", join(path, req)))
+			}
+		}
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			prop, ok := s.Properties[k]
+			if !ok {
+				if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+					errs = append(errs, fmt.Sprintf("%s is not a known field", join(path, k)))
+				}
+				continue
+			}
+			if val[k] == "" {
+				continue // empty optional fields are treated as unset; required ones are reported above
+			}
+			errs = append(errs, prop.validate(join(path, k), val[k])...)
+		}
+	}
+	return errs
+}
+
+func (s *schema) validateString(name, val string) []string {
+	var errs []string
+	if len(val) < s.MinLength {
+		errs = append(errs, fmt.Sprintf("%s must be at least %d characters", name, s.MinLength))
+	}
+	if s.Pattern != "" {
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil || !re.MatchString(val) {
+			errs = append(errs, fmt.Sprintf("%s must match %s", name, s.Pattern))
+		}
+	}
+	switch s.Format {
+	case "email":
+		if _, err := mail.ParseAddress(val); err != nil {
+			errs = append(errs, fmt.Sprintf("%s must be an email address", name))
+		}
+	case "uri":
+		if u, err := url.Parse(val); err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, fmt.Sprintf("%s must be an absolute URL", name))
+		}
+	}
+	return errs
+}
+
+func matchesType(t string, v interface{}) bool {
+	switch t {
+	case "object":
+		_, ok := v.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := v.([]interface{})
+		return ok
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "boolean":
+		_, ok := v.(bool)
+		return ok
+	case "number":
+		_, ok := v.(float64)
+		return ok
+	case "integer":
+		f, ok := v.(float64)
+		return ok && f == float64(int64(f))
+	case "null":
+		return v == nil
+	}
+	return true
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
@@ -0,0 +1,355 @@
+package notifications
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
+
+	"dhi-oss-usage/internal/db"
+)
+
+// Social providers (X, Bluesky) publish a short public post per adoption. Posts are
+// rendered from a text/template over db.Project and can be held for manual approval.
+
+const defaultSocialTemplate = `🎉 {{.RepoFullName}} ({{.Stars}} ⭐) just adopted Docker Hardened Images! {{.GitHubURL}}`
+
+// SocialConfig is the config_json of the x and bluesky providers
+type SocialConfig struct {
+	MinStars int    `json:"min_stars"`          // only post about projects with at least this many stars
+	Template string `json:"template,omitempty"` // text/template over db.Project
+	Mode     string `json:"mode,omitempty"`     // post (default) or queue
+}
+
+// socialClient publishes text to one social network
+type socialClient interface {
+	post(text string) error
+	verify() error          // checks credentials without posting
+	length(text string) int // length as counted by the network
+	maxLength() int
+}
+
+type socialProvider struct {
+	kind   string
+	config SocialConfig
+	tmpl   *template.Template
+	client socialClient
+}
+
+// parseSocialConfig parses config_json and its template, rendering the template
+// against a sample project so field typos are caught when the config is saved
+func parseSocialConfig(configJSON string) (SocialConfig, *template.Template, error) {
+	var config SocialConfig
+	if err := json.Unmarshal([]byte(configJSON), &config); err != nil {
+		return config, nil, fmt.Errorf("parsing config: %w", err)
+	}
+	if config.Mode == "" {
+		config.Mode = "post"
+	}
+	text := config.Template
+	if text == "" {
+		text = defaultSocialTemplate
+	}
+	tmpl, err := parseTemplate("template", text)
+	if err != nil {
+		return config, nil, err
+	}
+	return config, tmpl, nil
+}
+
+func validateSocialConfig(configJSON string) error {
+	_, _, err := parseSocialConfig(configJSON)
+	return err
+}
+
+func newSocialProvider(kind, configJSON string, client socialClient) (*socialProvider, error) {
+	config, tmpl, err := parseSocialConfig(configJSON)
+	if err != nil {
+		return nil, fmt.Errorf("%s config: %w", kind, err)
+	}
+	return &socialProvider{kind: kind, config: config, tmpl: tmpl, client: client}, nil
+}
+
+func (p *socialProvider) Type() string {
+	return p.kind
+}
+
+// Send posts about msg.Project. Messages without a project (tests, ops alerts)
+// only verify credentials: nothing is published for them.
+func (p *socialProvider) Send(msg Message) error {
+	if msg.Project == nil {
+		return p.client.verify()
+	}
+	text, err := p.render(msg.Project)
+	if err != nil {
+		return err
+	}
+	return p.client.post(text)
+}
+
+// accepts reports whether the project meets the star threshold
+func (p *socialProvider) accepts(project *db.Project) bool {
+	return project.Stars >= p.config.MinStars
+}
+
+// queued reports whether posts are held for approval instead of published
+func (p *socialProvider) queued() bool {
+	return p.config.Mode == "queue"
+}
+
+// render executes the template and checks the result fits in one post
+func (p *socialProvider) render(project *db.Project) (string, error) {
+	var buf bytes.Buffer
+	if err := p.tmpl.Execute(&buf, project); err != nil {
+		return "", fmt.Errorf("rendering template: %w", err)
+	}
+	text := strings.TrimSpace(buf.String())
+	if text == "" {
+		return "", fmt.Errorf("template rendered an empty post")
+	}
+	if n := p.client.length(text); n > p.client.maxLength() {
+		return "", fmt.Errorf("post is %d characters, %s allows %d", n, p.kind, p.client.maxLength())
+	}
+	return text, nil
+}
+
+var (
+	socialHTTPClient = &http.Client{Timeout: 30 * time.Second}
+	urlPattern       = regexp.MustCompile(`https?://[^\s]+`)
+)
+
+// doSocialRequest sends a request and returns the body, failing on non-2xx statuses
+func doSocialRequest(req *http.Request, service string) ([]byte, error) {
+	resp, err := socialHTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("sending %s request: %w", service, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("%s returned status %d: %s", service, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return body, nil
+}
+
+// X (Twitter) client, using OAuth 1.0a user context
+
+const xAPIBase = "https://api.x.com/2"
+
+type xClient struct {
+	apiKey, apiSecret, accessToken, accessSecret string
+}
+
+func newXProvider(configJSON string) (*socialProvider, error) {
+	c := &xClient{
+		apiKey:       getEnv("X_API_KEY", ""),
+		apiSecret:    getEnv("X_API_SECRET", ""),
+		accessToken:  getEnv("X_ACCESS_TOKEN", ""),
+		accessSecret: getEnv("X_ACCESS_TOKEN_SECRET", ""),
+	}
+	if c.apiKey == "" || c.apiSecret == "" || c.accessToken == "" || c.accessSecret == "" {
+		return nil, fmt.Errorf("X_API_KEY, X_API_SECRET, X_ACCESS_TOKEN and X_ACCESS_TOKEN_SECRET environment variables are required")
+	}
+	return newSocialProvider("x", configJSON, c)
+}
+
+func (c *xClient) post(text string) error {
+	payload, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return err
+	}
+	_, err = c.do("POST", xAPIBase+"/tweets", payload)
+	return err
+}
+
+func (c *xClient) verify() error {
+	_, err := c.do("GET", xAPIBase+"/users/me", nil)
+	return err
+}
+
+// length counts like X does for Latin text: every link is shortened to 23 characters
+func (c *xClient) length(text string) int {
+	n := utf8.RuneCountInString(urlPattern.ReplaceAllString(text, ""))
+	return n + 23*len(urlPattern.FindAllString(text, -1))
+}
+
+func (c *xClient) maxLength() int {
+	return 280
+}
+
+func (c *xClient) do(method, endpoint string, payload []byte) ([]byte, error) {
+	req, err := http.NewRequest(method, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Authorization", c.authorization(method, endpoint))
+	return doSocialRequest(req, "X")
+}
+
+// authorization builds an OAuth 1.0a HMAC-SHA1 header. JSON bodies aren't part of
+// the signature, and the endpoints used here take no query parameters.
+func (c *xClient) authorization(method, endpoint string) string {
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	params := map[string]string{
+		"oauth_consumer_key":     c.apiKey,
+		"oauth_nonce":            hex.EncodeToString(nonce),
+		"oauth_signature_method": "HMAC-SHA1",
+		"oauth_timestamp":        strconv.FormatInt(time.Now().Unix(), 10),
+		"oauth_token":            c.accessToken,
+		"oauth_version":          "1.0",
+	}
+
+	keys := make([]string, 0, len(params)+1)
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = oauthEscape(k) + "=" + oauthEscape(params[k])
+	}
+	base := method + "&" + oauthEscape(endpoint) + "&" + oauthEscape(strings.Join(pairs, "&"))
+
+	mac := hmac.New(sha1.New, []byte(oauthEscape(c.apiSecret)+"&"+oauthEscape(c.accessSecret)))
+	mac.Write([]byte(base))
+	params["oauth_signature"] = base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	keys = append(keys, "oauth_signature")
+	sort.Strings(keys)
+	fields := make([]string, len(keys))
+	for i, k := range keys {
+		fields[i] = fmt.Sprintf(`%s="%s"`, oauthEscape(k), oauthEscape(params[k]))
+	}
+	return "OAuth " + strings.Join(fields, ", ")
+}
+
+// oauthEscape percent-encodes per RFC 3986, as OAuth 1.0a requires
+func oauthEscape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+// Bluesky client, using an app password against the AT Protocol XRPC API
+
+type blueskyClient struct {
+	service  string
+	handle   string
+	password string
+}
+
+func newBlueskyProvider(configJSON string) (*socialProvider, error) {
+	c := &blueskyClient{
+		service:  strings.TrimSuffix(getEnv("BLUESKY_SERVICE", "https://bsky.social"), "/"),
+		handle:   getEnv("BLUESKY_HANDLE", ""),
+		password: getEnv("BLUESKY_APP_PASSWORD", ""),
+	}
+	if c.handle == "" || c.password == "" {
+		return nil, fmt.Errorf("BLUESKY_HANDLE and BLUESKY_APP_PASSWORD environment variables are required")
+	}
+	return newSocialProvider("bluesky", configJSON, c)
+}
+
+type blueskySession struct {
+	AccessJwt string `json:"accessJwt"`
+	DID       string `json:"did"`
+}
+
+func (c *blueskyClient) xrpc(method, token string, payload interface{}) ([]byte, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("POST", c.service+"/xrpc/"+method, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return doSocialRequest(req, "Bluesky")
+}
+
+func (c *blueskyClient) session() (*blueskySession, error) {
+	body, err := c.xrpc("com.atproto.server.createSession", "", map[string]string{
+		"identifier": c.handle,
+		"password":   c.password,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var s blueskySession
+	if err := json.Unmarshal(body, &s); err != nil {
+		return nil, fmt.Errorf("parsing Bluesky session: %w", err)
+	}
+	return &s, nil
+}
+
+func (c *blueskyClient) verify() error {
+	_, err := c.session()
+	return err
+}
+
+// post creates a feed post. Links are only clickable on Bluesky when marked up as
+// facets over their UTF-8 byte range.
+func (c *blueskyClient) post(text string) error {
+	s, err := c.session()
+	if err != nil {
+		return err
+	}
+
+	record := map[string]interface{}{
+		"$type":     "app.bsky.feed.post",
+		"text":      text,
+		"createdAt": time.Now().UTC().Format(time.RFC3339),
+	}
+	var facets []map[string]interface{}
+	for _, loc := range urlPattern.FindAllStringIndex(text, -1) {
+		facets = append(facets, map[string]interface{}{
+			"index": map[string]int{"byteStart": loc[0], "byteEnd": loc[1]},
+			"features": []map[string]string{{
+				"$type": "app.bsky.richtext.facet#link",
+				"uri":   text[loc[0]:loc[1]],
+			}},
+		})
+	}
+	if len(facets) > 0 {
+		record["facets"] = facets
+	}
+
+	_, err = c.xrpc("com.atproto.repo.createRecord", s.AccessJwt, map[string]interface{}{
+		"repo":       s.DID,
+		"collection": "app.bsky.feed.post",
+		"record":     record,
+	})
+	return err
+}
+
+func (c *blueskyClient) length(text string) int {
+	return utf8.RuneCountInString(text)
+}
+
+func (c *blueskyClient) maxLength() int {
+	return 300
+}
@@ -0,0 +1,134 @@
+package notifications
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"text/template"
+
+	"dhi-oss-usage/internal/db"
+)
+
+// Message templates let a config control the wording, emoji and fields of its
+// new-project messages. They are Go text/templates over db.Project, with a json
+// function for embedding values in Slack Block Kit JSON.
+
+var templateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// sampleProject is what previews render by default, and what templates are
+// rendered against when a config is saved
+var sampleProject = db.Project{
+	RepoFullName:    "example/app",
+	GitHubURL:       "https://github.com/example/app",
+	Description:     "An example application",
+	Stars:           1000,
+	PrimaryLanguage: "Go",
+	SourceType:      "Dockerfiles",
+	AdoptionCommit:  "https://github.com/example/app/commit/0123abc",
+}
+
+// parseTemplate parses a message template, rendering it against the sample
+// project so field typos are caught when the config is saved. Empty text has
+// no template.
+func parseTemplate(name, text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+	tmpl, err := template.New(name).Option("missingkey=error").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", name, err)
+	}
+	sample := sampleProject
+	if _, err := execute(tmpl, &sample); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// execute renders a template over a project
+func execute(tmpl *template.Template, project *db.Project) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, project); err != nil {
+		return "", fmt.Errorf("rendering %s: %w", tmpl.Name(), err)
+	}
+	return buf.String(), nil
+}
+
+// Preview is a new-project message rendered without sending it
+type Preview struct {
+	Subject string          `json:"subject,omitempty"`
+	Body    string          `json:"body,omitempty"`    // email body or social post
+	HTML    string          `json:"html,omitempty"`    // HTML part of emails
+	Payload json.RawMessage `json:"payload,omitempty"` // request body of Slack and webhook messages
+}
+
+// Preview renders the message a config would send about a new project, or
+// about the sample project when project is nil. No credentials are needed, so
+// a config can be previewed before it is saved.
+func (s *Service) Preview(providerType, configJSON string, project *db.Project) (*Preview, error) {
+	if err := ValidateConfig(providerType, configJSON); err != nil {
+		return nil, err
+	}
+	if project == nil {
+		sample := sampleProject
+		project = &sample
+	}
+	msg := s.buildNewProjectMessage(project)
+
+	switch providerType {
+	case "slack":
+		provider, err := newSlackProvider(configJSON)
+		if err != nil {
+			return nil, err
+		}
+		payload, err := provider.payload(msg)
+		if err != nil {
+			return nil, err
+		}
+		return &Preview{Subject: msg.Subject, Payload: payload}, nil
+	case "email":
+		provider, err := parseEmailConfig(configJSON)
+		if err != nil {
+			return nil, err
+		}
+		subject, body, err := provider.render(msg)
+		if err != nil {
+			return nil, err
+		}
+		html, err := provider.renderHTML(msg)
+		if err != nil {
+			return nil, err
+		}
+		return &Preview{Subject: subject, Body: body, HTML: html}, nil
+	case "x", "bluesky":
+		config, tmpl, err := parseSocialConfig(configJSON)
+		if err != nil {
+			return nil, err
+		}
+		provider := &socialProvider{kind: providerType, config: config, tmpl: tmpl, client: &xClient{}}
+		if providerType == "bluesky" {
+			provider.client = &blueskyClient{}
+		}
+		text, err := provider.render(project)
+		if err != nil {
+			return nil, err
+		}
+		return &Preview{Body: text}, nil
+	case "webhook":
+		provider, err := newWebhookProvider(configJSON)
+		if err != nil {
+			return nil, err
+		}
+		payload, err := provider.payload(msg)
+		if err != nil {
+			return nil, err
+		}
+		return &Preview{Subject: EventProjectAdopted, Payload: payload}, nil
+	}
+	return nil, fmt.Errorf("unsupported provider type: %s", providerType)
+}
@@ -0,0 +1,173 @@
+package notifications
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"net/url"
+	"time"
+
+	"dhi-oss-usage/internal/db"
+	"dhi-oss-usage/internal/logging"
+)
+
+// reachabilityTimeout bounds each network check of Validate
+const reachabilityTimeout = 5 * time.Second
+
+// Check is the outcome of one step of validating a config
+type Check struct {
+	Name   string `json:"name"`             // config, templates, credentials or reachability
+	Status string `json:"status"`           // ok, failed or skipped
+	Detail string `json:"detail,omitempty"` // what was checked, or why it failed or was skipped
+}
+
+// Validation reports whether a config would be accepted, and whether it would
+// work, without saving it or sending anything
+type Validation struct {
+	Valid   bool     `json:"valid"` // create and update would accept the config
+	Checks  []Check  `json:"checks"`
+	Preview *Preview `json:"preview,omitempty"` // the new-project message about the sample project
+}
+
+// Validate runs every check a config can get short of delivering a message:
+// its schema and templates, as create and update do, then the server's
+// credentials for the provider and whether its endpoint answers. Nothing is
+// posted: Slack and webhook endpoints only get a TCP connection, and only on
+// public addresses, SMTP a login, and X and Bluesky the credential check of a
+// test notification.
+// Credential and reachability failures don't make a config invalid, as they
+// can be fixed after saving.
+func (s *Service) Validate(providerType, configJSON string) *Validation {
+	v := &Validation{}
+	if err := ValidateConfig(providerType, configJSON); err != nil {
+		v.add("config", err, "")
+		v.skip("templates", "the config is invalid")
+		v.skip("credentials", "the config is invalid")
+		v.skip("reachability", "the config is invalid")
+		return v
+	}
+	v.Valid = true
+	v.add("config", nil, "matches the "+providerType+" schema")
+
+	preview, err := s.Preview(providerType, configJSON, nil)
+	v.add("templates", err, "rendered the new-project message about "+sampleProject.RepoFullName)
+	v.Preview = preview
+
+	provider, err := s.createProvider(&db.NotificationConfig{Type: providerType, ConfigJSON: configJSON})
+	v.add("credentials", err, "the server has the settings the "+providerType+" provider needs")
+	if err != nil {
+		v.skip("reachability", "credentials are missing")
+		return v
+	}
+
+	detail, err := reach(provider)
+	v.add("reachability", err, detail)
+	return v
+}
+
+// add records a check that failed with err, or passed
+func (v *Validation) add(name string, err error, detail string) {
+	if err != nil {
+		v.Checks = append(v.Checks, Check{Name: name, Status: "failed", Detail: err.Error()})
+		return
+	}
+	v.Checks = append(v.Checks, Check{Name: name, Status: "ok", Detail: detail})
+}
+
+func (v *Validation) skip(name, reason string) {
+	v.Checks = append(v.Checks, Check{Name: name, Status: "skipped", Detail: reason})
+}
+
+// reach checks a provider's endpoint answers, without sending a message
+func reach(provider Provider) (string, error) {
+	switch p := provider.(type) {
+	case *slackProvider:
+		return dial(p.config.WebhookURL)
+	case *outboundWebhook:
+		return dial(p.config.URL)
+	case *emailProvider:
+		return p.login()
+	case *socialProvider:
+		if err := p.client.verify(); err != nil {
+			return "", err
+		}
+		return "the account's credentials were accepted", nil
+	}
+	return "", fmt.Errorf("no reachability check for %s", provider.Type())
+}
+
+// errUnreachable is the only reachability failure reported for Slack and
+// webhook endpoints, so the check can't be used to probe the network
+var errUnreachable = errors.New("unreachable")
+
+// dial opens and closes a TCP connection to the host of an endpoint URL.
+// Loopback, private and link-local addresses are refused without dialing.
+func dial(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", errUnreachable
+	}
+	port := u.Port()
+	if port == "" {
+		port = "443"
+		if u.Scheme == "http" {
+			port = "80"
+		}
+	}
+
+	ips, err := net.LookupIP(u.Hostname())
+	if err != nil || len(ips) == 0 {
+		logging.Notifications.Warnf("Reachability check: resolving %s: %v", u.Hostname(), err)
+		return "", errUnreachable
+	}
+	for _, ip := range ips {
+		if !publicIP(ip) {
+			logging.Notifications.Warnf("Reachability check: refusing %s, which resolves to non-public address %s", u.Hostname(), ip)
+			return "", errUnreachable
+		}
+	}
+
+	// Dial the address checked above rather than resolving the name again
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(ips[0].String(), port), reachabilityTimeout)
+	if err != nil {
+		logging.Notifications.Warnf("Reachability check: connecting to %s: %v", u.Host, err)
+		return "", errUnreachable
+	}
+	conn.Close()
+	return "connected to " + net.JoinHostPort(u.Hostname(), port), nil
+}
+
+// publicIP reports whether ip is a globally routable unicast address
+func publicIP(ip net.IP) bool {
+	return ip.IsGlobalUnicast() && !ip.IsPrivate() && !ip.IsLoopback() &&
+		!ip.IsLinkLocalUnicast() && !ip.IsUnspecified()
+}
+
+// login authenticates with the SMTP server and quits without sending mail
+func (p *emailProvider) login() (string, error) {
+	addr := net.JoinHostPort(p.smtpHost, p.smtpPort)
+	conn, err := net.DialTimeout("tcp", addr, reachabilityTimeout)
+	if err != nil {
+		return "", fmt.Errorf("connecting to %s: %w", addr, err)
+	}
+	conn.SetDeadline(time.Now().Add(reachabilityTimeout))
+	c, err := smtp.NewClient(conn, p.smtpHost)
+	if err != nil {
+		conn.Close()
+		return "", fmt.Errorf("greeting %s: %w", addr, err)
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: p.smtpHost}); err != nil {
+			return "", fmt.Errorf("starting TLS with %s: %w", addr, err)
+		}
+	}
+	if err := c.Auth(smtp.PlainAuth("", p.smtpUsername, p.smtpPassword, p.smtpHost)); err != nil {
+		return "", fmt.Errorf("logging in to %s: %w", addr, err)
+	}
+	c.Quit()
+	return "logged in to " + addr, nil
+}
@@ -0,0 +1,293 @@
+package notifications
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"dhi-oss-usage/internal/db"
+	"dhi-oss-usage/internal/logging"
+)
+
+// Outbound webhooks POST a signed JSON event to any URL, for integrations that
+// want machine-readable notifications rather than chat messages.
+
+// Event types a webhook config can subscribe to
+const (
+	EventProjectAdopted   = "project.adopted"   // a project was found using DHI
+	EventProjectRemoved   = "project.removed"   // a project stopped using DHI or its repository was deleted
+	EventRefreshFailed    = "refresh.failed"    // a refresh job failed
+	EventMilestoneReached = "milestone.reached" // adopters or combined stars crossed a round number
+)
+
+// eventMessage is the type of events built from plain messages: test
+// notifications, alerts and approved messages. They go to every webhook.
+const eventMessage = "message"
+
+// Delivery attempts per event, waiting webhookRetryDelay, then twice that, and
+// so on between them. Only network errors, 429s and 5xxs are retried.
+const (
+	webhookAttempts   = 3
+	webhookRetryDelay = 2 * time.Second
+)
+
+var webhookHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// Event is the JSON body of a webhook delivery
+type Event struct {
+	ID         string                 `json:"id"` // unique per event and kept on redelivery, so receivers can deduplicate
+	Type       string                 `json:"type"`
+	OccurredAt time.Time              `json:"occurred_at"`
+	Project    *db.Project            `json:"project,omitempty"`
+	Data       map[string]interface{} `json:"data,omitempty"`
+}
+
+// WebhookConfig is the config_json of the webhook provider
+type WebhookConfig struct {
+	URL    string   `json:"url"`
+	Secret string   `json:"secret,omitempty"` // signs deliveries with HMAC-SHA256 when set
+	Events []string `json:"events,omitempty"` // subscribed event types; empty means all
+}
+
+// redactedSecret replaces webhook secrets in API responses. Submitting it
+// back unchanged keeps the stored secret.
+const redactedSecret = "********"
+
+// RedactConfig masks the signing secret of a webhook config_json so it can be
+// returned by the public API. Other provider types are returned unchanged.
+func RedactConfig(providerType, configJSON string) string {
+	if providerType != "webhook" {
+		return configJSON
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal([]byte(configJSON), &doc); err != nil {
+		return configJSON
+	}
+	if secret, _ := doc["secret"].(string); secret == "" {
+		return configJSON
+	}
+	doc["secret"] = redactedSecret
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return configJSON
+	}
+	return string(data)
+}
+
+// RestoreSecret puts the stored signing secret back into a submitted webhook
+// config_json whose secret is still the redacted placeholder
+func RestoreSecret(providerType, configJSON, storedJSON string) string {
+	if providerType != "webhook" {
+		return configJSON
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal([]byte(configJSON), &doc); err != nil {
+		return configJSON
+	}
+	if secret, _ := doc["secret"].(string); secret != redactedSecret {
+		return configJSON
+	}
+	var stored WebhookConfig
+	json.Unmarshal([]byte(storedJSON), &stored)
+	if stored.Secret == "" {
+		delete(doc, "secret")
+	} else {
+		doc["secret"] = stored.Secret
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return configJSON
+	}
+	return string(data)
+}
+
+type outboundWebhook struct {
+	config   WebhookConfig
+	attempts int // delivery attempts, webhookAttempts when zero
+}
+
+func newWebhookProvider(configJSON string) (*outboundWebhook, error) {
+	var config WebhookConfig
+	if err := json.Unmarshal([]byte(configJSON), &config); err != nil {
+		return nil, fmt.Errorf("parsing webhook config: %w", err)
+	}
+	if config.URL == "" {
+		return nil, fmt.Errorf("url is required")
+	}
+	return &outboundWebhook{config: config}, nil
+}
+
+func (p *outboundWebhook) Type() string {
+	return "webhook"
+}
+
+// subscribed reports whether the config wants events of a type
+func (p *outboundWebhook) subscribed(eventType string) bool {
+	if len(p.config.Events) == 0 || eventType == eventMessage {
+		return true
+	}
+	for _, e := range p.config.Events {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *outboundWebhook) Send(msg Message) error {
+	payload, err := p.payload(msg)
+	if err != nil {
+		return err
+	}
+	return p.deliver(payload)
+}
+
+// payload builds the event for msg: its own event if it carries one, else
+// project.adopted for a project and a message event for anything else
+func (p *outboundWebhook) payload(msg Message) ([]byte, error) {
+	var event Event
+	switch {
+	case msg.Event != nil:
+		event = *msg.Event
+	case msg.Project != nil:
+		event = Event{Type: EventProjectAdopted, Project: msg.Project}
+	default:
+		event = Event{Type: eventMessage, Data: map[string]interface{}{"subject": msg.Subject, "body": msg.Body}}
+	}
+	if event.ID == "" {
+		event.ID = newEventID()
+	}
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt = time.Now().UTC()
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return nil, fmt.Errorf("marshaling webhook event: %w", err)
+	}
+	return data, nil
+}
+
+// deliver posts a built payload, retrying transient failures
+func (p *outboundWebhook) deliver(payload []byte) error {
+	var event struct {
+		ID   string `json:"id"`
+		Type string `json:"type"`
+	}
+	json.Unmarshal(payload, &event)
+
+	attempts := p.attempts
+	if attempts == 0 {
+		attempts = webhookAttempts
+	}
+	delay := webhookRetryDelay
+	for attempt := 1; ; attempt++ {
+		retry, err := p.post(payload, event.ID, event.Type)
+		if err == nil || !retry {
+			return err
+		}
+		if attempt == attempts {
+			if attempts == 1 {
+				return err
+			}
+			return fmt.Errorf("%w (after %d attempts)", err, attempt)
+		}
+		logging.Notifications.Warnf("Webhook delivery %s attempt %d/%d failed, retrying in %s: %v", event.ID, attempt, attempts, delay, err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// post makes one delivery attempt, reporting whether a failure is worth retrying
+func (p *outboundWebhook) post(payload []byte, id, eventType string) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, p.config.URL, bytes.NewReader(payload))
+	if err != nil {
+		return false, fmt.Errorf("creating webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "dhi-oss-tracker")
+	req.Header.Set("X-DHI-Event", eventType)
+	req.Header.Set("X-DHI-Delivery", id)
+	if p.config.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(p.config.Secret))
+		mac.Write(payload)
+		req.Header.Set("X-DHI-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := webhookHTTPClient.Do(req)
+	if err != nil {
+		return true, fmt.Errorf("sending webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		return retry, fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return false, nil
+}
+
+// newEventID returns a random event ID
+func newEventID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Dispatch sends an event to every enabled webhook config subscribed to its
+// type. Each delivery is logged with its payload, so it can be redelivered.
+// With outbox retries on, each config gets a single attempt and failures are
+// left to the outbox, so a dead receiver doesn't hold up the caller.
+func (s *Service) Dispatch(event Event) error {
+	if event.ID == "" {
+		event.ID = newEventID()
+	}
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt = time.Now().UTC()
+	}
+
+	configs, err := s.db.GetEnabledNotificationConfigs()
+	if err != nil {
+		return fmt.Errorf("getting enabled notification configs: %w", err)
+	}
+
+	var projectID *int64
+	if event.Project != nil {
+		id := event.Project.ID
+		projectID = &id
+	}
+	for _, config := range configs {
+		if config.Type != "webhook" {
+			continue
+		}
+		provider, err := newWebhookProvider(config.ConfigJSON)
+		if err != nil {
+			s.logger.Errorf("Error creating webhook provider for %q: %v", config.Name, err)
+			s.logNotification(config.ID, projectID, "failed", fmt.Sprintf("failed to create provider: %v", err))
+			continue
+		}
+		if !provider.subscribed(event.Type) {
+			continue
+		}
+		if s.maxAttempts > 1 {
+			provider.attempts = 1
+		}
+
+		message := Message{Subject: event.Type, Event: &event}
+		payload, err := s.send(provider, message)
+		if err != nil {
+			s.logger.Errorf("Failed to deliver %s to %q: %v", event.Type, config.Name, err)
+		} else {
+			s.logger.Infof("Delivered %s to %q", event.Type, config.Name)
+		}
+		s.logOutgoing(&db.NotificationLog{ConfigID: config.ID, ProjectID: projectID, Payload: payload}, message, err)
+		s.db.UpdateNotificationTriggered(config.ID)
+	}
+	return nil
+}
@@ -0,0 +1,295 @@
+// Package publish posts weekly "new DHI adopters" summaries to GitHub, either as
+// a Discussion or as a section prepended to a file in a repository.
+package publish
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"dhi-oss-usage/internal/db"
+	"dhi-oss-usage/internal/github"
+	"dhi-oss-usage/internal/i18n"
+	"dhi-oss-usage/internal/logging"
+	"dhi-oss-usage/internal/summarize"
+)
+
+// Store is the storage the publisher needs
+type Store interface {
+	db.ProjectStore
+	db.PublicationStore
+}
+
+// Config selects where summaries are published
+type Config struct {
+	Repo     string // owner/name
+	Mode     string // discussion, file
+	Category string // discussion category, for discussion mode
+	FilePath string // for file mode
+	Branch   string // for file mode; empty uses the default branch
+	Locale   string // language of summaries, e.g. de; empty is English
+}
+
+// Result describes a publish run
+type Result struct {
+	Period       string `json:"period"`
+	Target       string `json:"target"`
+	ProjectCount int    `json:"project_count"`
+	Locale       string `json:"locale"`
+	Title        string `json:"title"`
+	Body         string `json:"body"`
+	Summary      string `json:"summary,omitempty"`       // narrative paragraph leading the body, when a summarizer is set
+	SummaryError string `json:"summary_error,omitempty"` // why the body has no narrative paragraph
+	URL          string `json:"url,omitempty"`
+	Published    bool   `json:"published"`
+	SkipReason   string `json:"skip_reason,omitempty"`
+}
+
+// Publisher posts weekly adoption summaries
+type Publisher struct {
+	store Store
+	gh    *github.Client
+	cfg   Config
+	loc   *i18n.Locale
+
+	summarizer summarize.Summarizer
+}
+
+// New validates cfg and returns a Publisher
+func New(store Store, gh *github.Client, cfg Config) (*Publisher, error) {
+	if owner, name, ok := strings.Cut(cfg.Repo, "/"); !ok || owner == "" || name == "" {
+		return nil, fmt.Errorf("repository must be owner/name, got %q", cfg.Repo)
+	}
+	switch cfg.Mode {
+	case "discussion":
+		if cfg.Category == "" {
+			return nil, fmt.Errorf("a discussion category is required")
+		}
+	case "file":
+		if cfg.FilePath == "" {
+			return nil, fmt.Errorf("a file path is required")
+		}
+	default:
+		return nil, fmt.Errorf("mode must be 'discussion' or 'file', got %q", cfg.Mode)
+	}
+	if cfg.Locale == "" {
+		cfg.Locale = i18n.Default
+	}
+	loc, ok := i18n.Get(cfg.Locale)
+	if !ok {
+		return nil, fmt.Errorf("locale must be one of %s, got %q", strings.Join(i18n.Tags(), ", "), cfg.Locale)
+	}
+	return &Publisher{store: store, gh: gh, cfg: cfg, loc: loc}, nil
+}
+
+// SetSummarizer adds a narrative paragraph written by s to each summary,
+// above the table of adopters
+func (p *Publisher) SetSummarizer(s summarize.Summarizer) {
+	p.summarizer = s
+}
+
+// Target identifies where this publisher posts, e.g. "discussion:owner/repo"
+func (p *Publisher) Target() string {
+	if p.cfg.Mode == "file" {
+		return "file:" + p.cfg.Repo + "/" + strings.TrimPrefix(p.cfg.FilePath, "/")
+	}
+	return "discussion:" + p.cfg.Repo
+}
+
+// Publish summarizes the last complete ISO week (Monday to Monday, UTC) before now.
+// Each week is published once per target unless force is set; weeks without new
+// adopters are skipped. With dryRun the summary is rendered but not posted. loc
+// overrides the configured language if not nil.
+func (p *Publisher) Publish(ctx context.Context, now time.Time, loc *i18n.Locale, dryRun, force bool) (*Result, error) {
+	if loc == nil {
+		loc = p.loc
+	}
+	end := StartOfWeek(now)
+	start := end.AddDate(0, 0, -7)
+	year, week := start.ISOWeek()
+
+	res := &Result{
+		Period: fmt.Sprintf("%d-W%02d", year, week),
+		Target: p.Target(),
+		Locale: loc.Tag,
+	}
+
+	projects, err := p.store.GetNewProjectsSince(start)
+	if err != nil {
+		return nil, fmt.Errorf("getting new projects: %w", err)
+	}
+	var adopters []db.Project
+	for _, proj := range projects {
+		if proj.AdoptedAt != nil && proj.AdoptedAt.Before(end) {
+			adopters = append(adopters, proj)
+		}
+	}
+	res.ProjectCount = len(adopters)
+	res.Title = loc.T("digest.title", start.Format("2006-01-02"))
+	res.Body = renderSummary(loc, start, end, adopters, "")
+
+	if len(adopters) == 0 {
+		res.SkipReason = "no new adopters"
+		return res, nil
+	}
+
+	if !force {
+		prev, err := p.store.GetPublication(res.Period, res.Target)
+		if err != nil {
+			return nil, fmt.Errorf("checking previous publication: %w", err)
+		}
+		if prev != nil {
+			res.URL = prev.URL
+			res.SkipReason = "already published"
+			return res, nil
+		}
+	}
+
+	if p.summarizer != nil {
+		res.Summary, err = p.summarize(ctx, loc, start, end, adopters)
+		if err != nil {
+			logging.Server.Ctx(ctx).Warnf("Error summarizing %s, publishing without a summary: %v", res.Period, err)
+			res.SummaryError = err.Error()
+		}
+		res.Body = renderSummary(loc, start, end, adopters, res.Summary)
+	}
+
+	if dryRun {
+		return res, nil
+	}
+
+	switch p.cfg.Mode {
+	case "discussion":
+		res.URL, err = p.gh.CreateDiscussion(ctx, p.cfg.Repo, p.cfg.Category, res.Title, res.Body)
+	case "file":
+		res.URL, err = p.publishFile(ctx, loc, res)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("publishing to %s: %w", res.Target, err)
+	}
+	res.Published = true
+	logging.Server.Ctx(ctx).Infof("Published %s summary (%d adopters) to %s", res.Period, res.ProjectCount, res.URL)
+
+	if err := p.store.RecordPublication(&db.Publication{
+		Period:       res.Period,
+		Target:       res.Target,
+		URL:          res.URL,
+		ProjectCount: res.ProjectCount,
+	}); err != nil {
+		return res, fmt.Errorf("recording publication: %w", err)
+	}
+	return res, nil
+}
+
+// publishFile prepends the week's section to the configured file, below its title
+func (p *Publisher) publishFile(ctx context.Context, loc *i18n.Locale, res *Result) (string, error) {
+	existing, sha, err := p.gh.GetFileContent(ctx, p.cfg.Repo, p.cfg.FilePath, p.cfg.Branch)
+	if err != nil && !errors.Is(err, github.ErrFileNotFound) {
+		return "", err
+	}
+
+	section := "## " + res.Title + "\n\n" + res.Body
+	var content string
+	switch {
+	case existing == "":
+		content = "# " + loc.T("digest.file_title") + "\n\n" + section
+	case strings.HasPrefix(existing, "# "):
+		title, rest, _ := strings.Cut(existing, "\n")
+		content = title + "\n\n" + section + "\n" + strings.TrimLeft(rest, "\n")
+	default:
+		content = section + "\n" + existing
+	}
+
+	return p.gh.PutFile(ctx, p.cfg.Repo, p.cfg.FilePath, p.cfg.Branch, sha, "Add DHI adopters for "+res.Period, content)
+}
+
+// summarize has the summarizer write a paragraph about the week from start
+// to end: its adopters, the projects removed and the change in totals
+func (p *Publisher) summarize(ctx context.Context, loc *i18n.Locale, start, end time.Time, adopters []db.Project) (string, error) {
+	week := summarize.Week{Start: start, End: end, NewCount: len(adopters), Removed: []string{}}
+
+	sorted := append([]db.Project{}, adopters...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Stars > sorted[j].Stars })
+	for _, proj := range sorted[:min(len(sorted), summarize.MaxAdopters)] {
+		week.NewAdopters = append(week.NewAdopters, summarize.Adopter{
+			Repo:        proj.RepoFullName,
+			Stars:       proj.Stars,
+			Language:    proj.PrimaryLanguage,
+			UseCase:     proj.UseCase,
+			Description: proj.Description,
+		})
+	}
+
+	removed, err := p.store.ListProjects(db.ProjectFilter{Status: "removed"})
+	if err != nil {
+		return "", fmt.Errorf("listing removed projects: %w", err)
+	}
+	for _, proj := range removed {
+		if proj.RemovedAt != nil && !proj.RemovedAt.Before(start) && proj.RemovedAt.Before(end) {
+			week.Removed = append(week.Removed, proj.RepoFullName)
+		}
+	}
+
+	before, err := p.store.GetSnapshotBefore(start)
+	if err != nil {
+		return "", fmt.Errorf("reading snapshot: %w", err)
+	}
+	if before != nil {
+		week.ProjectsBefore, week.StarsBefore = before.TotalProjects, before.TotalStars
+	}
+	after, err := p.store.GetSnapshotBefore(end)
+	if err != nil {
+		return "", fmt.Errorf("reading snapshot: %w", err)
+	}
+	if after != nil {
+		week.ProjectsAfter, week.StarsAfter = after.TotalProjects, after.TotalStars
+	}
+
+	summary, err := p.summarizer.Summarize(ctx, week, loc.Name)
+	if err != nil {
+		return "", err
+	}
+	// The summary is published as is, so strip anything the data's repository
+	// descriptions may have talked the model into
+	if summary = summarize.Sanitize(summary); summary == "" {
+		return "", fmt.Errorf("summary was empty once sanitized")
+	}
+	return summary, nil
+}
+
+// renderSummary formats adopters as Markdown in a locale, after summary if
+// there is one
+func renderSummary(loc *i18n.Locale, start, end time.Time, adopters []db.Project, summary string) string {
+	var b strings.Builder
+	b.WriteString(loc.Plural("digest.intro", len(adopters),
+		loc.Number(len(adopters)), loc.ShortDate(start), loc.LongDate(end.AddDate(0, 0, -1))))
+	b.WriteString("\n\n")
+	if summary != "" {
+		b.WriteString(summary)
+		b.WriteString("\n\n")
+	}
+
+	fmt.Fprintf(&b, "| %s | %s | %s | %s |\n",
+		loc.T("digest.repository"), loc.T("digest.stars"), loc.T("digest.language"), loc.T("digest.found_in"))
+	b.WriteString("|------------|-------|----------|----------|\n")
+	for _, proj := range adopters {
+		language := proj.PrimaryLanguage
+		if language == "" {
+			language = "-"
+		}
+		fmt.Fprintf(&b, "| [%s](%s) | %s | %s | %s |\n",
+			proj.RepoFullName, proj.GitHubURL, loc.Number(proj.Stars), language, proj.SourceType)
+	}
+	return b.String()
+}
+
+// StartOfWeek returns the Monday 00:00 UTC on or before t. The API's "this
+// week" counts use it too, so both agree on where weeks begin.
+func StartOfWeek(t time.Time) time.Time {
+	t = t.UTC()
+	offset := (int(t.Weekday()) + 6) % 7 // days since Monday
+	return time.Date(t.Year(), t.Month(), t.Day()-offset, 0, 0, 0, 0, time.UTC)
+}
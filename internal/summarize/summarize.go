@@ -0,0 +1,195 @@
+// Package summarize turns a week of adoption changes into a short narrative
+// paragraph for the weekly summary, using a language model behind an
+// OpenAI-compatible chat completions endpoint
+package summarize
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Week is what changed in the tracked projects over a week, the data a
+// narrative is written from
+type Week struct {
+	Start          time.Time `json:"start"`
+	End            time.Time `json:"end"`             // exclusive
+	NewAdopters    []Adopter `json:"new_adopters"`    // most starred first, at most MaxAdopters
+	NewCount       int       `json:"new_count"`       // all new adopters, including those not listed
+	Removed        []string  `json:"removed"`         // projects no longer found by the search this week
+	ProjectsBefore int       `json:"projects_before"` // from the last snapshot before Start; 0 if none
+	ProjectsAfter  int       `json:"projects_after"`  // from the last snapshot before End
+	StarsBefore    int       `json:"stars_before"`
+	StarsAfter     int       `json:"stars_after"`
+}
+
+// Adopter is a project that adopted DHI during the week
+type Adopter struct {
+	Repo        string `json:"repo"`
+	Stars       int    `json:"stars"`
+	Language    string `json:"language,omitempty"`
+	UseCase     string `json:"use_case,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// MaxAdopters is how many new adopters a Week lists, keeping prompts small
+// in busy weeks
+const MaxAdopters = 25
+
+// Summarizer writes a short narrative paragraph about a week in a language,
+// named the way its speakers name it (e.g. "Deutsch"). The weekly summary
+// always includes the week's raw data, so a summarizer that fails only costs
+// the paragraph.
+type Summarizer interface {
+	Summarize(ctx context.Context, week Week, language string) (string, error)
+}
+
+// maxSummaryTokens bounds the length of a paragraph
+const maxSummaryTokens = 250
+
+const systemPrompt = `You write the opening paragraph of a weekly report on open source projects adopting Docker Hardened Images (DHI).
+The user sends the week's changes as JSON. Write one paragraph of at most three sentences in %s, for readers who will also see the full table of new adopters.
+Highlight what stands out, such as notable projects or a shift in totals. Use only facts in the data, and write plain text without headings, lists, links or Markdown.`
+
+// OpenAI summarizes with a chat completions endpoint: OpenAI's or any
+// server implementing the same API, such as a local model server
+type OpenAI struct {
+	url    string // the chat completions endpoint
+	model  string
+	apiKey string
+	client *http.Client
+}
+
+// NewOpenAI returns a summarizer for the API at baseURL (e.g.
+// https://api.openai.com/v1), which serves /chat/completions. apiKey may be
+// empty for servers that don't need one.
+func NewOpenAI(baseURL, model, apiKey string, timeout time.Duration) (*OpenAI, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("URL must be an http or https URL, got %q", baseURL)
+	}
+	if model == "" {
+		return nil, fmt.Errorf("a model is required")
+	}
+	if timeout <= 0 {
+		return nil, fmt.Errorf("timeout must be positive, got %s", timeout)
+	}
+	return &OpenAI{
+		url:    strings.TrimSuffix(baseURL, "/") + "/chat/completions",
+		model:  model,
+		apiKey: apiKey,
+		client: &http.Client{Timeout: timeout},
+	}, nil
+}
+
+// Summarize implements Summarizer
+func (o *OpenAI) Summarize(ctx context.Context, week Week, language string) (string, error) {
+	data, err := json.Marshal(week)
+	if err != nil {
+		return "", err
+	}
+	type message struct {
+		Role    string `json:"role"`
+		Content string `json:"content"`
+	}
+	payload, err := json.Marshal(map[string]interface{}{
+		"model": o.model,
+		"messages": []message{
+			{Role: "system", Content: fmt.Sprintf(systemPrompt, language)},
+			{Role: "user", Content: string(data)},
+		},
+		"temperature": 0.3,
+		"max_tokens":  maxSummaryTokens,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", o.url, bytes.NewReader(payload))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if o.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+o.apiKey)
+	}
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", err
+	}
+
+	var result struct {
+		Choices []struct {
+			Message message `json:"message"`
+		} `json:"choices"`
+		Error *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	jsonErr := json.Unmarshal(body, &result)
+	if resp.StatusCode != http.StatusOK {
+		if jsonErr == nil && result.Error != nil && result.Error.Message != "" {
+			return "", fmt.Errorf("summary API error %d: %s", resp.StatusCode, result.Error.Message)
+		}
+		return "", fmt.Errorf("summary API error %d", resp.StatusCode)
+	}
+	if jsonErr != nil {
+		return "", fmt.Errorf("decoding summary response: %w", jsonErr)
+	}
+	if len(result.Choices) == 0 {
+		return "", fmt.Errorf("summary API returned no choices")
+	}
+	summary := strings.TrimSpace(result.Choices[0].Message.Content)
+	if summary == "" {
+		return "", fmt.Errorf("summary API returned an empty summary")
+	}
+	return summary, nil
+}
+
+// MaxSummaryLength caps a sanitized paragraph, in characters
+const MaxSummaryLength = 800
+
+var (
+	markdownLink = regexp.MustCompile(`!?\[([^\]]*)\]\([^)]*\)`)
+	htmlTag      = regexp.MustCompile(`<[^>]*>`)
+	bareURL      = regexp.MustCompile(`(?i)\b(?:https?://|www\.)\S+`)
+	markdownChar = strings.NewReplacer("*", "", "`", "", "~", "", "|", "", "<", "", ">", "", "[", "", "]", "", "\\", "")
+	// GitHub renders the entities as @ and # without linking a mention or reference
+	references = strings.NewReplacer("@", "&#64;", "#", "&#35;")
+)
+
+// Sanitize makes a model-written paragraph safe to publish as Markdown. The
+// prompt asks for plain text, but the data includes repository descriptions
+// anyone can write, so nothing the model returns is trusted: links and URLs
+// are dropped (keeping link text), Markdown and HTML are stripped, @mentions and
+// #references are escaped so they don't notify or link, everything is joined
+// into one paragraph and it is cut to MaxSummaryLength characters.
+func Sanitize(text string) string {
+	text = markdownLink.ReplaceAllString(text, "$1")
+	text = htmlTag.ReplaceAllString(text, "")
+	text = bareURL.ReplaceAllString(text, "")
+	text = markdownChar.Replace(text)
+	text = strings.TrimLeft(strings.Join(strings.Fields(text), " "), "#-+= ")
+	if utf8.RuneCountInString(text) > MaxSummaryLength {
+		runes := []rune(text)[:MaxSummaryLength]
+		cut := string(runes)
+		if i := strings.LastIndexByte(cut, ' '); i > 0 {
+			cut = cut[:i]
+		}
+		text = strings.TrimRight(cut, " ,;:") + "…"
+	}
+	return references.Replace(text)
+}